@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/platform/database"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AmenityResult struct {
+	ID           int    `json:"id"`
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	Category     uint8  `json:"category"`
+	CategoryName string `json:"category_name"`
+}
+
+func newAmenityResults(amenities []models.Amenity) []AmenityResult {
+	results := make([]AmenityResult, 0, len(amenities))
+	for _, amenity := range amenities {
+		results = append(results, AmenityResult{
+			ID:           amenity.ID,
+			Code:         amenity.Code,
+			Name:         amenity.Name,
+			Category:     uint8(amenity.Category),
+			CategoryName: amenity.Category.Name(),
+		})
+	}
+	return results
+}
+
+// GetAmenityList method
+// @Description Get amenities and house rules catalog
+// @Summary Get amenities catalog
+// @Tags Amenity
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=[]controllers.AmenityResult}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /amenity/list [get]
+func GetAmenityList(c *fiber.Ctx) error {
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	amenities, err := db.GetAmenities(true)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	res := newAmenityResults(amenities)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// getAmenities returns the active amenities with ids, ok is false if any of the ids is not valid.
+func getAmenities(db *database.Queries, ids []int) ([]models.Amenity, bool, error) {
+	amenities, err := db.GetActiveAmenitiesByIDs(ids)
+	if err != nil {
+		return nil, false, err
+	}
+	found := map[int]bool{}
+	for _, amenity := range amenities {
+		found[amenity.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, false, nil
+		}
+	}
+	return amenities, true, nil
+}
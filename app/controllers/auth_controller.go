@@ -5,6 +5,7 @@ import (
 	"ekira-backend/app/models"
 	"ekira-backend/pkg/utils"
 	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
@@ -124,7 +125,8 @@ func Login(c *fiber.Ctx) error {
 	}
 	if user.ProfileImage != nil {
 		if len(user.ProfileImage.Images) > 0 {
-			authUser.ProfileImage = &user.ProfileImage.Images[len(user.ProfileImage.Images)-1].URL
+			profileImageUrl := storage.PresentURL(user.ProfileImage.Images[len(user.ProfileImage.Images)-1].URL)
+			authUser.ProfileImage = &profileImageUrl
 		}
 	}
 
@@ -261,7 +263,8 @@ func Register(c *fiber.Ctx) error {
 
 	if user.ProfileImage != nil {
 		if len(user.ProfileImage.Images) > 0 {
-			authUser.ProfileImage = &user.ProfileImage.Images[len(user.ProfileImage.Images)-1].URL
+			profileImageUrl := storage.PresentURL(user.ProfileImage.Images[len(user.ProfileImage.Images)-1].URL)
+			authUser.ProfileImage = &profileImageUrl
 		}
 	}
 
@@ -313,6 +316,7 @@ func AuthCheck(c *fiber.Ctx) error {
 		images := profileImage.Images
 		if len(images) > 0 {
 			lastItem := images[len(images)-1]
+			lastItem.URL = storage.PresentURL(lastItem.URL)
 			userResult.ProfileImage = &lastItem.URL
 		}
 	}
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getCouponDiscount validates the coupon for the user and rental house, and returns the discount of the price in rental house currency.
+func getCouponDiscount(db *database.Queries, coupon *models.Coupon, userId uuid.UUID, rentalHouse *models.RentalHouse, price float64) (float64, error) {
+	now := time.Now()
+	if !coupon.Active {
+		return 0, errors.New("coupon is not active")
+	}
+	if now.Before(coupon.StartsAt) || (coupon.EndsAt != nil && now.After(*coupon.EndsAt)) {
+		return 0, errors.New("coupon is expired or not started yet")
+	}
+	if !coupon.RentPeriods.Contains(rentalHouse.RentPeriod) {
+		return 0, errors.New("coupon is not valid for the rent period")
+	}
+	if !coupon.CityIDs.Contains(rentalHouse.Quarter.District.Town.CityID) {
+		return 0, errors.New("coupon is not valid in the city")
+	}
+	if !coupon.RentalHouseIDs.Contains(rentalHouse.ID) {
+		return 0, errors.New("coupon is not valid for the rental house")
+	}
+	// Owner funded coupons are only valid for the owner's rental houses.
+	if coupon.FundedBy == models.CouponFundedByOwner && (coupon.CreatorID == nil || *coupon.CreatorID != rentalHouse.CreatorID) {
+		return 0, errors.New("coupon is not valid for the rental house")
+	}
+
+	// Check usage limits.
+	if coupon.UsageLimit > 0 {
+		count, err := db.CountCouponRedemptions(coupon.ID, nil)
+		if err != nil {
+			return 0, err
+		}
+		if count >= int64(coupon.UsageLimit) {
+			return 0, errors.New("coupon usage limit is reached")
+		}
+	}
+	if coupon.PerUserLimit > 0 {
+		count, err := db.CountCouponRedemptions(coupon.ID, &userId)
+		if err != nil {
+			return 0, err
+		}
+		if count >= int64(coupon.PerUserLimit) {
+			return 0, errors.New("you have already used the coupon")
+		}
+	}
+
+	// Coupon amounts are in coupon currency.
+	currency := rentalHouse.Currency
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	rate, err := getExchangeRate(db, coupon.Currency, currency)
+	if err != nil {
+		return 0, err
+	}
+	if price < coupon.MinAmount*rate {
+		return 0, errors.New("price is lower than the minimum amount of the coupon")
+	}
+
+	discount := coupon.Value * rate
+	if coupon.DiscountType == models.CouponDiscountTypePercentage {
+		discount = price * coupon.Value / 100
+		if coupon.MaxDiscount != nil && discount > *coupon.MaxDiscount*rate {
+			discount = *coupon.MaxDiscount * rate
+		}
+	}
+	discount = math.Min(discount, price)
+	return math.Round(discount*100) / 100, nil
+}
+
+type CouponResult struct {
+	ID             string                    `json:"id"`
+	Code           string                    `json:"code"`
+	Description    string                    `json:"description"`
+	DiscountType   models.CouponDiscountType `json:"discount_type"`
+	Value          float64                   `json:"value"`
+	Currency       models.Currency           `json:"currency"`
+	MaxDiscount    *float64                  `json:"max_discount"`
+	MinAmount      float64                   `json:"min_amount"`
+	StartsAt       time.Time                 `json:"starts_at"`
+	EndsAt         *time.Time                `json:"ends_at"`
+	UsageLimit     int                       `json:"usage_limit"`
+	PerUserLimit   int                       `json:"per_user_limit"`
+	UsedCount      int64                     `json:"used_count"`
+	RentPeriods    []int                     `json:"rent_periods"`
+	CityIDs        []int                     `json:"city_ids"`
+	RentalHouseIDs []string                  `json:"rental_house_ids"`
+	FundedBy       string                    `json:"funded_by"`
+	Active         bool                      `json:"active"`
+}
+
+func newCouponResult(coupon *models.Coupon, usedCount int64, rentalHouseIds []string) CouponResult {
+	return CouponResult{
+		ID:             coupon.UID.String(),
+		Code:           coupon.Code,
+		Description:    coupon.Description,
+		DiscountType:   coupon.DiscountType,
+		Value:          coupon.Value,
+		Currency:       coupon.Currency,
+		MaxDiscount:    coupon.MaxDiscount,
+		MinAmount:      coupon.MinAmount,
+		StartsAt:       coupon.StartsAt,
+		EndsAt:         coupon.EndsAt,
+		UsageLimit:     coupon.UsageLimit,
+		PerUserLimit:   coupon.PerUserLimit,
+		UsedCount:      usedCount,
+		RentPeriods:    coupon.RentPeriods,
+		CityIDs:        coupon.CityIDs,
+		RentalHouseIDs: rentalHouseIds,
+		FundedBy:       coupon.FundedByName(),
+		Active:         coupon.Active,
+	}
+}
+
+// CreateCoupon method
+// @Description Create an owner funded coupon for the owned rental houses
+// @Summary Create a coupon
+// @Tags Coupon
+// @Accept json
+// @Produce json
+// @Param couponInfo body controllers.CreateCoupon.Request true "Coupon Info"
+// @Success 200 {object} models.ResponseOK{result=controllers.CouponResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 409 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /coupon/create [post]
+func CreateCoupon(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		Code           string                    `json:"code" example:"SUMMER10" validate:"required"`
+		Description    string                    `json:"description" example:"10% summer discount"`
+		DiscountType   models.CouponDiscountType `json:"discount_type" example:"0" summary:"0 = percentage, 1 = fixed"`
+		Value          float64                   `json:"value" example:"10" validate:"required"`
+		Currency       string                    `json:"currency" example:"TRY" summary:"TRY, EUR, USD"`
+		MaxDiscount    *float64                  `json:"max_discount" example:"500" validate:"omitempty,gt=0"`
+		MinAmount      float64                   `json:"min_amount" example:"0"`
+		StartsAt       *time.Time                `json:"starts_at" example:"2024-06-01T00:00:00Z"`
+		EndsAt         *time.Time                `json:"ends_at" example:"2024-09-01T00:00:00Z"`
+		UsageLimit     int                       `json:"usage_limit" example:"100" summary:"0 = unlimited"`
+		PerUserLimit   *int                      `json:"per_user_limit" example:"1" summary:"0 = unlimited"`
+		RentPeriods    []int                     `json:"rent_periods" example:"1" summary:"empty = all rent periods" validate:"dive,min=1,max=3"`
+		CityIDs        []int                     `json:"city_ids" example:"34" summary:"empty = all cities"`
+		RentalHouseIDs []string                  `json:"rental_house_ids" summary:"empty = all owned rental houses" validate:"dive,uuid4"`
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	if err := validator.New().Struct(req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("validate", err.Error()))
+	}
+
+	coupon := models.Coupon{
+		Code:         strings.ToUpper(req.Code),
+		Description:  req.Description,
+		DiscountType: req.DiscountType,
+		Value:        req.Value,
+		Currency:     models.DefaultCurrency,
+		MaxDiscount:  req.MaxDiscount,
+		MinAmount:    req.MinAmount,
+		StartsAt:     time.Now(),
+		EndsAt:       req.EndsAt,
+		UsageLimit:   req.UsageLimit,
+		PerUserLimit: 1,
+		RentPeriods:  models.IntArray{},
+		CityIDs:      models.IntArray{},
+		FundedBy:     models.CouponFundedByOwner,
+		CreatorID:    &user.ID,
+		Active:       true,
+	}
+	if req.Currency != "" {
+		coupon.Currency = models.Currency(strings.ToUpper(req.Currency))
+	}
+	if req.StartsAt != nil {
+		coupon.StartsAt = *req.StartsAt
+	}
+	if req.PerUserLimit != nil {
+		coupon.PerUserLimit = *req.PerUserLimit
+	}
+	if req.RentPeriods != nil {
+		coupon.RentPeriods = req.RentPeriods
+	}
+	if req.CityIDs != nil {
+		coupon.CityIDs = req.CityIDs
+	}
+	if coupon.DiscountType == models.CouponDiscountTypePercentage && coupon.Value > 100 {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("percentage discount can not be greater than 100")))
+	}
+	if coupon.EndsAt != nil && !coupon.EndsAt.After(coupon.StartsAt) {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("end date must be after start date")))
+	}
+
+	// Validate coupon.
+	if err := utils.NewValidator().Struct(coupon); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Owner coupons are restricted to the owned rental houses.
+	coupon.RentalHouseIDs = models.IntArray{}
+	for _, id := range req.RentalHouseIDs {
+		rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		if rentalHouse.ID == 0 || rentalHouse.CreatorID != user.ID {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("rental house not found")).SetHeader("rental_house_id", id))
+		}
+		coupon.RentalHouseIDs = append(coupon.RentalHouseIDs, rentalHouse.ID)
+	}
+
+	// Check the code is not used.
+	existing, err := db.GetCouponWithCode(coupon.Code)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if existing.ID != 0 {
+		return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("coupon code is already used")))
+	}
+
+	err = db.Create(&coupon).Error
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newCouponResult(&coupon, 0, req.RentalHouseIDs)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetCouponList method
+// @Description Get coupons created by the user
+// @Summary Get coupons created by the user
+// @Tags Coupon
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=[]controllers.CouponResult}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /coupon/list [get]
+func GetCouponList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	coupons, err := db.GetCouponsWithCreator(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := make([]CouponResult, len(coupons))
+	for i := range coupons {
+		usedCount, err := db.CountCouponRedemptions(coupons[i].ID, nil)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		var rentalHouseIds []string
+		if len(coupons[i].RentalHouseIDs) > 0 {
+			err = db.Model(&models.RentalHouse{}).Where("id IN ?", []int(coupons[i].RentalHouseIDs)).Pluck("uid", &rentalHouseIds).Error
+			if err != nil {
+				return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+			}
+		}
+		res[i] = newCouponResult(&coupons[i], usedCount, rentalHouseIds)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// SetCouponActive method
+// @Description Activate or deactivate a coupon created by the user
+// @Summary Activate or deactivate a coupon
+// @Tags Coupon
+// @Accept json
+// @Produce json
+// @Param id path string true "Coupon ID"
+// @Param couponInfo body controllers.SetCouponActive.Request true "Coupon Info"
+// @Success 200 {object} models.ResponseOK{result=bool}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /coupon/{id}/active [put]
+func SetCouponActive(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	err := validator.New().Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	type Request struct {
+		Active bool `json:"active" example:"false"`
+	}
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	coupon, err := db.GetCouponWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if coupon.ID == 0 || coupon.CreatorID == nil || *coupon.CreatorID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("coupon not found")))
+	}
+
+	err = db.Model(&coupon).Update("active", req.Active).Error
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&req.Active))
+}
+
+// CheckCoupon method
+// @Description Check a coupon for a rental house and get the discount of the first payment
+// @Summary Check a coupon for a rental house
+// @Tags Coupon
+// @Accept json
+// @Produce json
+// @Param code query string true "Coupon code"
+// @Param rental_house_id query string true "Rental House ID"
+// @Param days query int false "Rent days for daily rental houses" default(1)
+// @Success 200 {object} models.ResponseOK{result=controllers.CheckCoupon.Response}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /coupon/check [get]
+func CheckCoupon(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	rentalHouseId := c.Query("rental_house_id")
+	validate := validator.New()
+	if err := validate.Var(rentalHouseId, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("rental_house_id", err.Error()))
+	}
+	if err := validate.Var(c.Query("code"), "required,max=32"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("code", err.Error()))
+	}
+	days := 1
+	if c.Query("days") != "" {
+		d, err := strconv.Atoi(c.Query("days"))
+		if err != nil || d < 1 || d > 14 {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("days", "invalid days"))
+		}
+		days = d
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(rentalHouseId))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("rental house not found")))
+	}
+
+	coupon, err := db.GetCouponWithCode(c.Query("code"))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if coupon.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("coupon not found")))
+	}
+
+	price := rentalHouse.Price
+	if rentalHouse.RentPeriod == models.RentPeriodDay {
+		price = rentalHouse.Price * float64(days)
+	}
+	discount, err := getCouponDiscount(db, &coupon, user.ID, &rentalHouse, price)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+	}
+
+	type Response struct {
+		Code            string          `json:"code"`
+		Price           float64         `json:"price"`
+		Discount        float64         `json:"discount"`
+		DiscountedPrice float64         `json:"discounted_price"`
+		Currency        models.Currency `json:"currency"`
+	}
+	res := Response{
+		Code:            coupon.Code,
+		Price:           price,
+		Discount:        discount,
+		DiscountedPrice: math.Round((price-discount)*100) / 100,
+		Currency:        rentalHouse.Currency,
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+// getExchangeRate returns the value of one unit of "from" in "to" currency.
+// The rate is read from the latest snapshot, a new snapshot is taken from the rate source if it is older than EXCHANGE_RATE_TTL_MINUTES.
+func getExchangeRate(db *database.Queries, from, to models.Currency) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	ttl, err := strconv.Atoi(os.Getenv("EXCHANGE_RATE_TTL_MINUTES"))
+	if err != nil || ttl <= 0 {
+		ttl = 60
+	}
+
+	// Get latest snapshot.
+	snapshot, err := db.GetLatestExchangeRate(from, to, time.Now().Add(time.Duration(-ttl)*time.Minute))
+	if err != nil {
+		return 0, err
+	}
+	if snapshot.ID != 0 {
+		return snapshot.Rate, nil
+	}
+
+	// Take a new snapshot from rate source.
+	source := utils.NewRateSource()
+	rate, err := utils.GetExchangeRate(source, from, to)
+	if err != nil {
+		return 0, err
+	}
+	snapshot = models.ExchangeRate{
+		Base:   from,
+		Quote:  to,
+		Rate:   rate,
+		Source: source.Name(),
+	}
+	err = db.CreateExchangeRate(&snapshot)
+	if err != nil {
+		return 0, err
+	}
+	return rate, nil
+}
+
+// getDisplayCurrency returns the currency requested with "currency" query parameter, empty if not given.
+func getDisplayCurrency(c *fiber.Ctx) (models.Currency, error) {
+	if c.Query("currency") == "" {
+		return "", nil
+	}
+	currency, ok := models.ParseCurrency(c.Query("currency"))
+	if !ok {
+		return "", errors.New("unsupported currency")
+	}
+	return currency, nil
+}
+
+// GetExchangeRates method
+// @Description Get exchange rates of supported currencies
+// @Summary Get exchange rates of supported currencies
+// @Tags Currency
+// @Accept json
+// @Produce json
+// @Param base query string false "Base currency" default(TRY)
+// @Success 200 {object} models.ResponseOK{result=controllers.GetExchangeRates.Response}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Router /currency/rates [get]
+func GetExchangeRates(c *fiber.Ctx) error {
+	base := models.DefaultCurrency
+	if c.Query("base") != "" {
+		currency, ok := models.ParseCurrency(c.Query("base"))
+		if !ok {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("base", "unsupported currency"))
+		}
+		base = currency
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	type Rate struct {
+		Currency models.Currency `json:"currency" example:"EUR"`
+		Symbol   string          `json:"symbol" example:"€"`
+		Rate     float64         `json:"rate" example:"0.0285"`
+	}
+	type Response struct {
+		Base  models.Currency `json:"base" example:"TRY"`
+		Rates []Rate          `json:"rates"`
+	}
+
+	res := Response{Base: base, Rates: []Rate{}}
+	for _, currency := range models.SupportedCurrencies {
+		rate, err := getExchangeRate(db, base, currency)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+		}
+		res.Rates = append(res.Rates, Rate{Currency: currency, Symbol: currency.Symbol(), Rate: rate})
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type RegisterDeviceRequest struct {
+	Token    string                `json:"token" validate:"required,max=512"`
+	Platform models.DevicePlatform `json:"platform" validate:"required,oneof=1 2"` // 1: Android, 2: iOS
+}
+
+// RegisterDevice method
+// @Description Register the push token of the mobile app for the current session, the previous token of the session is replaced.
+// @Description The token is removed when the session is logged out or ended, so the push notifications are sent to the logged in devices only.
+// @Summary Register push token
+// @Tags Device
+// @Accept json
+// @Produce json
+// @Param device body RegisterDeviceRequest true "Push token"
+// @Success 200 {object} models.ResponseOK{result=models.Device}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /device/register [post]
+func RegisterDevice(c *fiber.Ctx) error {
+	session := c.Locals("session").(models.Session)
+
+	request := RegisterDeviceRequest{}
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	if err := validator.New().Struct(request); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	device := models.Device{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		Platform:  request.Platform,
+		Token:     request.Token,
+	}
+	if err := db.RegisterDevice(&device); err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&device))
+}
+
+// UnregisterDevice method
+// @Description Remove the push token of the current session, e.g. when the push notifications are turned off in the app.
+// @Summary Unregister push token
+// @Tags Device
+// @Produce json
+// @Success 200 {string} string "OK"
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /device/unregister [post]
+func UnregisterDevice(c *fiber.Ctx) error {
+	session := c.Locals("session").(models.Session)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	if err := db.DeleteSessionDevice(session.ID); err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK("OK"))
+}
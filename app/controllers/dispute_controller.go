@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"time"
+)
+
+const DISPUTE_EVIDENCE_MAX_SIZE = 4.5 * 1024 * 1024 // Stripe limit of all evidence files
+
+type DisputeResult struct {
+	ID                  string                   `json:"id"`
+	PaymentID           string                   `json:"payment_id"`
+	ReservationID       string                   `json:"reservation_id"`
+	RentalHouse         string                   `json:"rental_house"`
+	Amount              float64                  `json:"amount"`
+	Currency            models.Currency          `json:"currency"`
+	FrozenAmount        float64                  `json:"frozen_amount"`
+	Reason              string                   `json:"reason"`
+	Status              models.DisputeStatus     `json:"status"`
+	StatusName          string                   `json:"status_name"`
+	EvidenceDueBy       *time.Time               `json:"evidence_due_by"`
+	EvidenceText        *string                  `json:"evidence_text"`
+	EvidenceSubmittedAt *time.Time               `json:"evidence_submitted_at"`
+	EvidenceFiles       []models.DisputeEvidence `json:"evidence_files"`
+	CreatedAt           time.Time                `json:"created_at"`
+	ClosedAt            *time.Time               `json:"closed_at"`
+}
+
+func newDisputeResult(dispute *models.Dispute) DisputeResult {
+	return DisputeResult{
+		ID:                  dispute.UID.String(),
+		PaymentID:           dispute.Payment.UID.String(),
+		ReservationID:       dispute.Payment.Reservation.UID.String(),
+		RentalHouse:         dispute.Payment.Reservation.RentalHouse.Title,
+		Amount:              dispute.Amount,
+		Currency:            dispute.Currency,
+		FrozenAmount:        dispute.FrozenAmount,
+		Reason:              dispute.Reason,
+		Status:              dispute.Status,
+		StatusName:          dispute.StatusName(),
+		EvidenceDueBy:       dispute.EvidenceDueBy,
+		EvidenceText:        dispute.EvidenceText,
+		EvidenceSubmittedAt: dispute.EvidenceSubmittedAt,
+		EvidenceFiles:       dispute.EvidenceFiles,
+		CreatedAt:           dispute.CreatedAt,
+		ClosedAt:            dispute.ClosedAt,
+	}
+}
+
+// GetDisputeList method
+// @Description Get disputes of the owned rental houses
+// @Summary Get disputes of the owned rental houses
+// @Tags Dispute
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=[]controllers.DisputeResult}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /dispute/list [get]
+func GetDisputeList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Get disputes.
+	disputes, err := db.GetDisputesWithOwner(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := make([]DisputeResult, len(disputes))
+	for i := range disputes {
+		res[i] = newDisputeResult(&disputes[i])
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetDisputeDetails method
+// @Description Get dispute details
+// @Summary Get dispute details
+// @Tags Dispute
+// @Accept json
+// @Produce json
+// @Param id path string true "Dispute ID"
+// @Success 200 {object} models.ResponseOK{result=controllers.DisputeResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /dispute/{id} [get]
+func GetDisputeDetails(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	err := validator.New().Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Get dispute info.
+	dispute, err := db.GetDisputeWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Check if the rental house is owned by the user.
+	if dispute.ID == 0 || dispute.Payment.Reservation.RentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("dispute not found")))
+	}
+
+	res := newDisputeResult(&dispute)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// SubmitDisputeEvidence method
+// @Description Submit evidence for a dispute. Files are accepted in "receipt", "service_documentation", "customer_communication", "cancellation_policy", "refund_policy" and "uncategorized_file" fields as PDF, JPEG or PNG.
+// @Summary Submit evidence for a dispute
+// @Tags Dispute
+// @Accept mpfd
+// @Produce json
+// @Param id path string true "Dispute ID"
+// @Param text formData string false "Evidence explanation"
+// @Param submit formData bool false "Submit evidence to the bank, false only stages the evidence" default(true)
+// @Param receipt formData file false "Receipt"
+// @Param service_documentation formData file false "Service documentation"
+// @Param customer_communication formData file false "Customer communication"
+// @Param cancellation_policy formData file false "Cancellation policy"
+// @Param refund_policy formData file false "Refund policy"
+// @Param uncategorized_file formData file false "Other file"
+// @Success 200 {object} models.ResponseOK{result=controllers.DisputeResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /dispute/{id}/evidence [post]
+func SubmitDisputeEvidence(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	err := validator.New().Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	text := ""
+	if values := form.Value["text"]; len(values) > 0 {
+		text = values[0]
+	}
+	submit := true
+	if values := form.Value["submit"]; len(values) > 0 && values[0] == "false" {
+		submit = false
+	}
+
+	// Validate evidence files.
+	totalSize := int64(0)
+	for _, kind := range utils.DISPUTE_EVIDENCE_FILE_KINDS {
+		files := form.File[kind]
+		if len(files) > 1 {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(fmt.Errorf("only one file is accepted for %s", kind)))
+		}
+		if len(files) == 0 {
+			continue
+		}
+		f, err := files[0].Open()
+		if err != nil {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader(kind, err.Error()))
+		}
+		contentType, err := utils.GetFileContentType(f)
+		f.Close()
+		if err != nil || (contentType != "application/pdf" && contentType != "image/jpeg" && contentType != "image/png") {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(fmt.Errorf("%s must be a pdf, jpeg or png file", kind)))
+		}
+		totalSize += files[0].Size
+	}
+	if totalSize > DISPUTE_EVIDENCE_MAX_SIZE {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("evidence files are too large")))
+	}
+	if text == "" && totalSize == 0 {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("evidence text or file is required")))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Get dispute info.
+	dispute, err := db.GetDisputeWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Check if the rental house is owned by the user.
+	if dispute.ID == 0 || dispute.Payment.Reservation.RentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("dispute not found")))
+	}
+
+	// Evidence can only be given while the dispute is waiting for response.
+	if dispute.Status != models.DISPUTE_STATUS_NEEDS_RESPONSE || dispute.EvidenceSubmittedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("dispute is not waiting for evidence")))
+	}
+	if dispute.EvidenceDueBy != nil && dispute.EvidenceDueBy.Before(time.Now()) {
+		return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("evidence due date is passed")))
+	}
+
+	// Upload evidence files to stripe.
+	fileIds := map[string]string{}
+	for _, kind := range utils.DISPUTE_EVIDENCE_FILE_KINDS {
+		files := form.File[kind]
+		if len(files) == 0 {
+			continue
+		}
+		f, err := files[0].Open()
+		if err != nil {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader(kind, err.Error()))
+		}
+		stripeFile, err := utils.UploadDisputeEvidenceFile(files[0].Filename, f)
+		f.Close()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("evidence file cannot be uploaded")).SetHeader("stripe", err.Error()))
+		}
+		fileIds[kind] = stripeFile.ID
+		dispute.EvidenceFiles = append(dispute.EvidenceFiles, models.DisputeEvidence{
+			DisputeID:    dispute.ID,
+			Kind:         kind,
+			StripeFileID: stripeFile.ID,
+			FileName:     files[0].Filename,
+		})
+	}
+
+	// Send evidence to stripe.
+	_, err = utils.SubmitDisputeEvidence(dispute.StripeDisputeID, text, fileIds, submit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("evidence cannot be submitted")).SetHeader("stripe", err.Error()))
+	}
+
+	// Save evidence.
+	updates := map[string]interface{}{}
+	if text != "" {
+		dispute.EvidenceText = &text
+		updates["evidence_text"] = text
+	}
+	if submit {
+		now := time.Now()
+		dispute.EvidenceSubmittedAt = &now
+		dispute.Status = models.DISPUTE_STATUS_UNDER_REVIEW
+		updates["evidence_submitted_at"] = now
+		updates["status"] = dispute.Status
+	}
+	if len(updates) > 0 {
+		err = db.Model(&models.Dispute{}).Where("id = ?", dispute.ID).Updates(updates).Error
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+	}
+	for i := range dispute.EvidenceFiles {
+		if dispute.EvidenceFiles[i].ID != 0 {
+			continue
+		}
+		err = db.Create(&dispute.EvidenceFiles[i]).Error
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+	}
+
+	res := newDisputeResult(&dispute)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
@@ -0,0 +1,624 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/jobs"
+	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ConversationParticipant struct {
+	ID           string  `json:"id"`
+	FirstName    string  `json:"first_name"`
+	LastName     string  `json:"last_name"`
+	ProfileImage *string `json:"profile_image"`
+}
+
+func newConversationParticipant(user *models.User) ConversationParticipant {
+	participant := ConversationParticipant{
+		ID:        user.ID.String(),
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+	if user.ProfileImage != nil && len(user.ProfileImage.Images) > 0 {
+		url := storage.PresentURL(user.ProfileImage.Images[len(user.ProfileImage.Images)-1].URL)
+		participant.ProfileImage = &url
+	}
+	return participant
+}
+
+type MessageResult struct {
+	ID          string                          `json:"id"`
+	SenderID    string                          `json:"sender_id"`
+	Mine        bool                            `json:"mine"`
+	Body        string                          `json:"body"`
+	Attachments [][]models.RentalHouseImageInfo `json:"attachments"`
+	Read        bool                            `json:"read" summary:"the other side has read the message, only for the own messages"`
+	CreatedAt   time.Time                       `json:"created_at"`
+}
+
+// newMessageResult returns the message for the user, the contact information is hidden until the reservation is paid.
+func newMessageResult(message *models.Message, conversation *models.Conversation, userId uuid.UUID, contactUnlocked bool) MessageResult {
+	result := MessageResult{
+		ID:          message.UID.String(),
+		SenderID:    message.SenderID.String(),
+		Mine:        message.SenderID == userId,
+		Body:        message.Body,
+		Attachments: make([][]models.RentalHouseImageInfo, len(message.Attachments)),
+		CreatedAt:   message.CreatedAt,
+	}
+	if !contactUnlocked {
+		result.Body = utils.MaskContactInfo(result.Body)
+	}
+	for i, attachment := range message.Attachments {
+		result.Attachments[i] = presentImages(attachment.Images)
+	}
+	if readAt := conversation.OtherReadAt(userId); result.Mine && readAt != nil {
+		result.Read = !message.CreatedAt.After(*readAt)
+	}
+	return result
+}
+
+type ConversationResult struct {
+	ID          string `json:"id"`
+	RentalHouse struct {
+		ID     string                        `json:"id"`
+		Title  string                        `json:"title"`
+		Images []models.RentalHouseImageInfo `json:"images"`
+	} `json:"rental_house"`
+	ReservationID   *string                 `json:"reservation_id"`
+	Role            string                  `json:"role" summary:"renter or owner, the side of the user"`
+	Renter          ConversationParticipant `json:"renter"`
+	Owner           ConversationParticipant `json:"owner"`
+	ContactUnlocked bool                    `json:"contact_unlocked" summary:"false until the renter pays a reservation, the phone numbers and the e-mail addresses are hidden"`
+	LastMessage     *MessageResult          `json:"last_message,omitempty"`
+	LastMessageAt   *time.Time              `json:"last_message_at"`
+	UnreadCount     int64                   `json:"unread_count"`
+	ReadAt          *time.Time              `json:"read_at" summary:"the messages until this time are read by the other side"`
+	CreatedAt       time.Time               `json:"created_at"`
+}
+
+func newConversationResult(conversation *models.Conversation, userId uuid.UUID, contactUnlocked bool) ConversationResult {
+	result := ConversationResult{
+		ID:              conversation.UID.String(),
+		Role:            "renter",
+		Renter:          newConversationParticipant(&conversation.Renter),
+		Owner:           newConversationParticipant(&conversation.Owner),
+		ContactUnlocked: contactUnlocked,
+		LastMessageAt:   conversation.LastMessageAt,
+		ReadAt:          conversation.OtherReadAt(userId),
+		CreatedAt:       conversation.CreatedAt,
+	}
+	if conversation.OwnerID == userId {
+		result.Role = "owner"
+	}
+	result.RentalHouse.ID = conversation.RentalHouse.UID.String()
+	result.RentalHouse.Title = conversation.RentalHouse.Title
+	if len(conversation.RentalHouse.Images) > 0 {
+		result.RentalHouse.Images = presentImages(conversation.RentalHouse.Images[0].Images)
+	}
+	if conversation.Reservation != nil {
+		id := conversation.Reservation.UID.String()
+		result.ReservationID = &id
+	}
+	return result
+}
+
+// getUserConversation returns the conversation of the path if the user is a participant, the error is written to the response.
+func getUserConversation(c *fiber.Ctx, db *database.Queries, user *models.User) (models.Conversation, bool, error) {
+	id := c.Params("id")
+	if err := validator.New().Var(id, "required,uuid4"); err != nil {
+		return models.Conversation{}, false, c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+	conversation, err := db.GetConversationWithUid(uuid.MustParse(id))
+	if err != nil {
+		return conversation, false, c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if conversation.ID == 0 || !conversation.IsParticipant(user.ID) {
+		return conversation, false, c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("conversation not found")))
+	}
+	return conversation, true, nil
+}
+
+// StartConversation method
+// @Description Get the conversation with the owner about the rental house, or the conversation of the reservation for the renter and the owner.
+// @Description The conversation is created if it does not exist.
+// @Summary Start conversation
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Param conversation body controllers.StartConversation.Request true "Rental house or reservation"
+// @Success 200 {object} models.ResponseOK{result=controllers.ConversationResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/conversation [post]
+func StartConversation(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		RentalHouseID string `json:"rental_house_id" validate:"required_without=ReservationID,omitempty,uuid4"`
+		ReservationID string `json:"reservation_id" validate:"required_without=RentalHouseID,omitempty,uuid4"`
+	}
+
+	req := new(Request)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	if err := validator.New().Struct(req); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	conversation := models.Conversation{}
+	if req.ReservationID != "" {
+		// The renter and the owner talk about the reservation.
+		reservation, err := db.GetReservationByUid(uuid.MustParse(req.ReservationID))
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		if reservation.ID == 0 || (reservation.CreatorID != user.ID && reservation.RentalHouse.CreatorID != user.ID) {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("reservation not found")))
+		}
+		conversation.ReservationID = &reservation.ID
+		conversation.RentalHouseID = reservation.RentalHouseID
+		conversation.RenterID = reservation.CreatorID
+		conversation.OwnerID = reservation.RentalHouse.CreatorID
+	} else {
+		// The renter asks the owner about the public rental house.
+		rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(req.RentalHouseID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+			}
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		if !rentalHouse.IsPublic() {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+		}
+		if rentalHouse.CreatorID == user.ID {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("you can't message your own rental house")))
+		}
+		conversation.RentalHouseID = rentalHouse.ID
+		conversation.RenterID = user.ID
+		conversation.OwnerID = rentalHouse.CreatorID
+	}
+
+	err = db.GetOrCreateConversation(&conversation)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	contactUnlocked, err := db.HasPaidReservation(conversation.RenterID, conversation.RentalHouseID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newConversationResult(&conversation, user.ID, contactUnlocked)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetConversations method
+// @Description Get the conversations of the user with the last message, the last active is the first
+// @Summary Get conversations
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Limit number" default(20)
+// @Success 200 {object} models.ResponseOK{result=controllers.GetConversations.Response{results=[]controllers.ConversationResult}}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/conversations [get]
+func GetConversations(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	pagination := models.Pagination{Page: 1, Limit: 20}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		pagination.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 100 {
+		pagination.Limit = limit
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	list, err := db.GetUserConversations(user.ID, &pagination)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Response struct {
+		Pagination struct {
+			TotalCount int64 `json:"total_count"`
+			FullCount  int64 `json:"full_count"`
+			NextPage   bool  `json:"next_page"`
+			PrevPage   bool  `json:"prev_page"`
+		} `json:"pagination"`
+		Results []ConversationResult `json:"results"`
+	}
+	res := Response{Results: make([]ConversationResult, 0, len(list.Conversations))}
+	res.Pagination.FullCount = list.FullCount
+	res.Pagination.TotalCount = list.TotalCount
+	res.Pagination.NextPage = list.NextPage
+	res.Pagination.PrevPage = list.PrevPage
+	for i := range list.Conversations {
+		summary := &list.Conversations[i]
+		contactUnlocked, err := db.HasPaidReservation(summary.Conversation.RenterID, summary.Conversation.RentalHouseID)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		result := newConversationResult(&summary.Conversation, user.ID, contactUnlocked)
+		result.UnreadCount = summary.UnreadCount
+		if summary.LastMessage != nil {
+			lastMessage := newMessageResult(summary.LastMessage, &summary.Conversation, user.ID, contactUnlocked)
+			result.LastMessage = &lastMessage
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetConversationMessages method
+// @Description Get the messages of the conversation, the newest is the first. The older messages are loaded with the id of the oldest loaded message.
+// @Summary Get conversation messages
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param before query string false "Message ID, only the older messages are returned" default()
+// @Param limit query int false "Limit number" default(50)
+// @Success 200 {object} models.ResponseOK{result=controllers.GetConversationMessages.Response{messages=[]controllers.MessageResult}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/conversation/{id} [get]
+func GetConversationMessages(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var before *uuid.UUID
+	if v := c.Query("before"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("before", err.Error()))
+		}
+		before = &id
+	}
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	conversation, ok, err := getUserConversation(c, db, &user)
+	if !ok {
+		return err
+	}
+	messages, err := db.GetConversationMessages(conversation.ID, before, limit)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	contactUnlocked, err := db.HasPaidReservation(conversation.RenterID, conversation.RentalHouseID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Response struct {
+		Conversation ConversationResult `json:"conversation"`
+		Messages     []MessageResult    `json:"messages"`
+		HasMore      bool               `json:"has_more"`
+	}
+	res := Response{
+		Conversation: newConversationResult(&conversation, user.ID, contactUnlocked),
+		Messages:     make([]MessageResult, len(messages)),
+		HasMore:      len(messages) == limit,
+	}
+	for i := range messages {
+		res.Messages[i] = newMessageResult(&messages[i], &conversation, user.ID, contactUnlocked)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// SendMessage method
+// @Description Send a message to the conversation, the images are uploaded with /message/upload-image before.
+// @Description The phone numbers and the e-mail addresses are hidden until the renter pays a reservation of the rental house.
+// @Summary Send message
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param message body controllers.SendMessage.Request true "Message"
+// @Success 200 {object} models.ResponseOK{result=controllers.MessageResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/conversation/{id} [post]
+func SendMessage(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		Body          string   `json:"body" validate:"max=4000"`
+		AttachmentIDs []string `json:"attachment_ids" validate:"max=5,dive,uuid4"`
+	}
+
+	req := new(Request)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if err := validator.New().Struct(req); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+	if req.Body == "" && len(req.AttachmentIDs) == 0 {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("message body or attachment is required")))
+	}
+	attachmentIds := make([]uuid.UUID, 0, len(req.AttachmentIDs))
+	for _, id := range req.AttachmentIDs {
+		attachmentIds = append(attachmentIds, uuid.MustParse(id))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	conversation, ok, err := getUserConversation(c, db, &user)
+	if !ok {
+		return err
+	}
+
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Body:           req.Body,
+	}
+	err = db.CreateMessage(&conversation, &message, attachmentIds)
+	if err != nil {
+		if errors.Is(err, queries.ErrAttachmentNotFound) {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	contactUnlocked, err := db.HasPaidReservation(conversation.RenterID, conversation.RentalHouseID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	publishMessageEvent(&message, &conversation, contactUnlocked)
+
+	res := newMessageResult(&message, &conversation, user.ID, contactUnlocked)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// ReadConversation method
+// @Description Mark the messages of the conversation as read, the other side sees the read receipts
+// @Summary Read conversation
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.ResponseOK{result=controllers.ConversationResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/conversation/{id}/read [post]
+func ReadConversation(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	conversation, ok, err := getUserConversation(c, db, &user)
+	if !ok {
+		return err
+	}
+	err = db.MarkConversationRead(&conversation, user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	contactUnlocked, err := db.HasPaidReservation(conversation.RenterID, conversation.RentalHouseID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newConversationResult(&conversation, user.ID, contactUnlocked)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetUnreadMessageCount method
+// @Description Get the number of the unread messages and the conversations with unread messages
+// @Summary Get unread message count
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=controllers.GetUnreadMessageCount.Result}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/unread-count [get]
+func GetUnreadMessageCount(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	messages, conversations, err := db.GetUnreadMessageCount(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Result struct {
+		Messages      int64 `json:"messages"`
+		Conversations int64 `json:"conversations"`
+	}
+	res := Result{Messages: messages, Conversations: conversations}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// UploadMessageImage method
+// @Description Upload an image to send with a message, the image is processed in the background. The id is given in attachment_ids
+// @Description of the message after its status is ready, see /message/image/{id}. The attachments which are not sent in a day are removed.
+// @Summary Upload message image
+// @Tags Message
+// @Accept mpfd
+// @Produce json
+// @Param image formData file true "Image file"
+// @Success 202 {object} models.ResponseOK{result=models.MessageAttachment}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/upload-image [post]
+func UploadMessageImage(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("form", err.Error()))
+	}
+
+	// Check the image, the format is detected from the content.
+	upload, err := utils.ValidateImageUpload(form, "image", utils.MessageImageLimits())
+	if err != nil {
+		return imageUploadError(c, err)
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Store the raw upload, the variants are created by the image workers.
+	uploads, err := storage.NewUploadStorage()
+	if err != nil {
+		return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("storage", err.Error()))
+	}
+	attachmentId := uuid.New()
+	sourceKey := utils.ImageKey(utils.MessageUploadPrefix, attachmentId.String())
+	file, err := upload.File.Open()
+	if err != nil {
+		return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("image", err.Error()))
+	}
+	err = uploads.Put(sourceKey, file, upload.File.Size, upload.ContentType)
+	file.Close()
+	if err != nil {
+		return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("storage", err.Error()))
+	}
+
+	// Insert attachment to database, it is queued again if it is not processed in time.
+	nextAttemptAt := time.Now().Add(jobs.ImageProcessingTimeout)
+	attachment := models.MessageAttachment{
+		ID:            attachmentId,
+		UploaderID:    user.ID,
+		Images:        models.RentalHouseImagesArray{},
+		Status:        models.IMAGE_STATUS_PROCESSING,
+		SourceKey:     sourceKey,
+		NextAttemptAt: &nextAttemptAt,
+	}
+	err = db.CreateMessageAttachment(&attachment)
+	if err != nil {
+		uploads.Delete(sourceKey)
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Add attachment to processing queue.
+	err = jobs.EnqueueMessageImageProcessing(attachmentId)
+	if err != nil {
+		db.SetMessageAttachmentAttempt(attachmentId, 0, models.IMAGE_STATUS_FAILED, err.Error(), nil)
+		uploads.Delete(sourceKey)
+		return c.Status(errs.ErrImageProc.StatusCode).JSON(models.NewResponseError(errs.ErrImageProc).SetHeader("queue", err.Error()))
+	}
+
+	// Return status 202 Accepted.
+	return c.Status(fiber.StatusAccepted).JSON(models.NewResponseOK(&attachment))
+}
+
+// GetMessageImageStatus method
+// @Description Get the processing status of the uploaded message image, the image can be sent after its status is ready
+// @Summary Get uploaded message image status
+// @Tags Message
+// @Accept json
+// @Produce json
+// @Param id path string true "Attachment ID"
+// @Success 200 {object} models.ResponseOK{result=models.MessageAttachment}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /message/image/{id} [get]
+func GetMessageImageStatus(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	attachment, err := db.GetMessageAttachment(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if attachment.UploaderID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+	}
+
+	attachment.Images = presentImages(attachment.Images)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&attachment))
+}
@@ -0,0 +1,540 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RentalHouseModeration struct {
+	Status          models.ModerationStatus `json:"status" summary:"1 = draft, 2 = pending review, 3 = approved, 4 = rejected"`
+	StatusName      string                  `json:"status_name"`
+	RejectionReason string                  `json:"rejection_reason"`
+	Public          bool                    `json:"public" summary:"approved and published"`
+	Flags           []string                `json:"flags,omitempty" summary:"automatic check flags, only for the moderators"`
+}
+
+func newRentalHouseModeration(rh *models.RentalHouse, withFlags bool) *RentalHouseModeration {
+	moderation := &RentalHouseModeration{
+		Status:          rh.ModerationStatus,
+		StatusName:      rh.ModerationStatus.Name(),
+		RejectionReason: rh.RejectionReason,
+		Public:          rh.IsPublic(),
+	}
+	if withFlags {
+		moderation.Flags = rh.ModerationFlags
+	}
+	return moderation
+}
+
+// submitRentalHouse runs the automatic checks and sends the rental house to review.
+// It is rejected if the text checks fail, the duplicate images are only flagged for the moderators.
+func submitRentalHouse(db *database.Queries, rh *models.RentalHouse) error {
+	check := utils.CheckListingText(rh.Title, rh.Description)
+	if len(check.Reasons) > 0 {
+		return db.SetModerationStatus(rh, models.MODERATION_STATUS_REJECTED, nil, strings.Join(check.Reasons, "\n"), check.Flags)
+	}
+	duplicates, err := db.GetDuplicateImageRentalHouseIDs(rh.ID)
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		check.Flags = append(check.Flags, models.ModerationFlagDuplicateImage)
+	}
+	similar, err := db.GetSimilarImageRentalHouseIDs(rh.ID, utils.ImageSimilarityDistance())
+	if err != nil {
+		return err
+	}
+	if len(similar) > 0 {
+		check.Flags = append(check.Flags, models.ModerationFlagSimilarImage)
+	}
+	return db.SetModerationStatus(rh, models.MODERATION_STATUS_PENDING, nil, "", check.Flags)
+}
+
+// SubmitRentalHouse method
+// @Description Send the draft or rejected rental house to review, the automatic checks reject it immediately if the title or the description is not allowed
+// @Summary Submit rental house for review
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Success 200 {object} models.ResponseOK{result=controllers.RentalHouseModeration}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id}/submit [post]
+func SubmitRentalHouse(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	if err := validate.Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+	if rentalHouse.ModerationStatus != models.MODERATION_STATUS_DRAFT && rentalHouse.ModerationStatus != models.MODERATION_STATUS_REJECTED {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("only draft or rejected rental houses can be submitted")).SetHeader("moderation_status", rentalHouse.ModerationStatus.Name()))
+	}
+
+	err = submitRentalHouse(db, &rentalHouse)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHouseModeration(&rentalHouse, false)))
+}
+
+// GetModerationQueue method
+// @Description Get the rental houses with the moderation status, the oldest submitted is the first
+// @Summary Get moderation queue
+// @Tags Moderation
+// @Accept json
+// @Produce json
+// @Param status query int false "Moderation status (1 = draft, 2 = pending review, 3 = approved, 4 = rejected)" default(2)
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Limit number" default(20)
+// @Success 200 {object} models.ResponseOK{result=controllers.GetModerationQueue.Response{results=[]controllers.GetModerationQueue.Result}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /moderation/queue [get]
+func GetModerationQueue(c *fiber.Ctx) error {
+	status := models.MODERATION_STATUS_PENDING
+	if v := c.Query("status"); v != "" {
+		s, err := strconv.Atoi(v)
+		if err != nil || s < int(models.MODERATION_STATUS_DRAFT) || s > int(models.MODERATION_STATUS_REJECTED) {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("status", "invalid status"))
+		}
+		status = models.ModerationStatus(s)
+	}
+	pagination := models.Pagination{Page: 1, Limit: 20}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		pagination.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 100 {
+		pagination.Limit = limit
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouseList, err := db.GetModerationQueue(status, &pagination)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Result struct {
+		ID          string                          `json:"id"`
+		Title       string                          `json:"title"`
+		Description string                          `json:"description"`
+		CreatorID   uuid.UUID                       `json:"creator_id"`
+		CreatorName string                          `json:"creator_name"`
+		CityName    string                          `json:"city_name"`
+		TownName    string                          `json:"town_name"`
+		Images      [][]models.RentalHouseImageInfo `json:"images"`
+		Moderation  *RentalHouseModeration          `json:"moderation"`
+		SubmittedAt *time.Time                      `json:"submitted_at"`
+	}
+	type Response struct {
+		Pagination struct {
+			TotalCount int64 `json:"total_count"`
+			FullCount  int64 `json:"full_count"`
+			NextPage   bool  `json:"next_page"`
+			PrevPage   bool  `json:"prev_page"`
+		} `json:"pagination"`
+		Results []Result `json:"results"`
+	}
+	res := Response{Results: make([]Result, 0, len(rentalHouseList.Houses))}
+	res.Pagination.FullCount = rentalHouseList.FullCount
+	res.Pagination.TotalCount = rentalHouseList.TotalCount
+	res.Pagination.NextPage = rentalHouseList.NextPage
+	res.Pagination.PrevPage = rentalHouseList.PrevPage
+	for i := range rentalHouseList.Houses {
+		rentalHouse := &rentalHouseList.Houses[i]
+		result := Result{
+			ID:          rentalHouse.UID.String(),
+			Title:       rentalHouse.Title,
+			Description: rentalHouse.Description,
+			CreatorID:   rentalHouse.CreatorID,
+			CreatorName: rentalHouse.Creator.FullName(),
+			CityName:    rentalHouse.Quarter.District.Town.City.Name,
+			TownName:    rentalHouse.Quarter.District.Town.Name,
+			Images:      make([][]models.RentalHouseImageInfo, 0, len(rentalHouse.Images)),
+			Moderation:  newRentalHouseModeration(rentalHouse, true),
+			SubmittedAt: rentalHouse.SubmittedAt,
+		}
+		for _, image := range rentalHouse.Images {
+			result.Images = append(result.Images, presentImages(image.Images))
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetModerationHistory method
+// @Description Get the moderation history of the rental house, the newest is the first
+// @Summary Get moderation history
+// @Tags Moderation
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Success 200 {object} models.ResponseOK{result=[]controllers.GetModerationHistory.Result}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /moderation/{id}/history [get]
+func GetModerationHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	if err := validate.Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+
+	logs, err := db.GetModerationLogs(rentalHouse.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Result struct {
+		FromStatus    models.ModerationStatus `json:"from_status"`
+		Status        models.ModerationStatus `json:"status"`
+		StatusName    string                  `json:"status_name"`
+		Reason        string                  `json:"reason"`
+		Flags         []string                `json:"flags"`
+		ModeratorID   *uuid.UUID              `json:"moderator_id" summary:"null for the automatic checks and the owner"`
+		ModeratorName string                  `json:"moderator_name"`
+		CreatedAt     time.Time               `json:"created_at"`
+	}
+	result := make([]Result, len(logs))
+	for i, log := range logs {
+		result[i] = Result{
+			FromStatus:  log.FromStatus,
+			Status:      log.Status,
+			StatusName:  log.Status.Name(),
+			Reason:      log.Reason,
+			Flags:       log.Flags,
+			ModeratorID: log.ModeratorID,
+			CreatedAt:   log.CreatedAt,
+		}
+		if log.Moderator != nil {
+			result[i].ModeratorName = log.Moderator.FullName()
+		}
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&result))
+}
+
+// ApproveRentalHouse method
+// @Description Approve the pending or rejected rental house, it is public if the owner published it
+// @Summary Approve rental house
+// @Tags Moderation
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param body body controllers.ApproveRentalHouse.Request false "Approve"
+// @Success 200 {object} models.ResponseOK{result=controllers.RentalHouseModeration}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /moderation/{id}/approve [post]
+func ApproveRentalHouse(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	if err := validate.Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		Note string `json:"note" example:"" summary:"only in the moderation history" validate:"max=1024"`
+	}
+	var body Request
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+		}
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.ModerationStatus != models.MODERATION_STATUS_PENDING && rentalHouse.ModerationStatus != models.MODERATION_STATUS_REJECTED {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("only pending or rejected rental houses can be approved")).SetHeader("moderation_status", rentalHouse.ModerationStatus.Name()))
+	}
+
+	// The saved searches are alerted if the owner published it, the event is saved with the approval.
+	err = db.WithTransaction(func(tx *database.Queries) error {
+		if err := tx.SetModerationStatus(&rentalHouse, models.MODERATION_STATUS_APPROVED, &user.ID, strings.TrimSpace(body.Note), nil); err != nil {
+			return err
+		}
+		return recordListingEvent(tx, &rentalHouse, false, rentalHouse.Price, rentalHouse.Currency)
+	})
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHouseModeration(&rentalHouse, true)))
+}
+
+// RejectRentalHouse method
+// @Description Reject the pending or approved rental house, the reason is shown to the owner
+// @Summary Reject rental house
+// @Tags Moderation
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param body body controllers.RejectRentalHouse.Request true "Reject"
+// @Success 200 {object} models.ResponseOK{result=controllers.RentalHouseModeration}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /moderation/{id}/reject [post]
+func RejectRentalHouse(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	if err := validate.Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		Reason string `json:"reason" example:"Fotoğraflar ilandaki evle uyuşmuyor" validate:"required,min=3,max=1024"`
+	}
+	var body Request
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if err := validate.Struct(body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.ModerationStatus != models.MODERATION_STATUS_PENDING && rentalHouse.ModerationStatus != models.MODERATION_STATUS_APPROVED {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("only pending or approved rental houses can be rejected")).SetHeader("moderation_status", rentalHouse.ModerationStatus.Name()))
+	}
+
+	// The last public price of the approved listing is kept with the rejection.
+	wasPublic := rentalHouse.IsPublic()
+	err = db.WithTransaction(func(tx *database.Queries) error {
+		if err := tx.SetModerationStatus(&rentalHouse, models.MODERATION_STATUS_REJECTED, &user.ID, body.Reason, rentalHouse.ModerationFlags); err != nil {
+			return err
+		}
+		return recordListingEvent(tx, &rentalHouse, wasPublic, rentalHouse.Price, rentalHouse.Currency)
+	})
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHouseModeration(&rentalHouse, true)))
+}
+
+// GetDuplicateImageClusters method
+// @Description Get the clusters of the similar images of the listings of different owners, the largest cluster is the first
+// @Summary Get duplicate image clusters
+// @Tags Moderation
+// @Accept json
+// @Produce json
+// @Param distance query int false "Maximum hamming distance of the perceptual hashes (0-7)"
+// @Param limit query int false "Maximum number of the similar image pairs" default(500)
+// @Success 200 {object} models.ResponseOK{result=[]controllers.GetDuplicateImageClusters.Cluster}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /moderation/duplicates [get]
+func GetDuplicateImageClusters(c *fiber.Ctx) error {
+	distance := utils.ImageSimilarityDistance()
+	if v := c.Query("distance"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 || d > 7 {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("distance", "invalid distance"))
+		}
+		distance = d
+	}
+	limit := 500
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 2000 {
+		limit = l
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	pairs, err := db.GetSimilarImagePairs(distance, limit)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Join the pairs into the clusters.
+	parents := make(map[uuid.UUID]uuid.UUID)
+	var find func(id uuid.UUID) uuid.UUID
+	find = func(id uuid.UUID) uuid.UUID {
+		parent, ok := parents[id]
+		if !ok {
+			parents[id] = id
+			return id
+		}
+		if parent == id {
+			return id
+		}
+		root := find(parent)
+		parents[id] = root
+		return root
+	}
+	for _, pair := range pairs {
+		a, b := find(pair.ImageID), find(pair.OtherImageID)
+		if a != b {
+			parents[b] = a
+		}
+	}
+	ids := make([]uuid.UUID, 0, len(parents))
+	for id := range parents {
+		ids = append(ids, id)
+	}
+	images, err := db.GetRentalHouseImagesWithRentalHouse(ids)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Image struct {
+		ID            uuid.UUID                     `json:"id"`
+		Images        []models.RentalHouseImageInfo `json:"images"`
+		RentalHouseID uuid.UUID                     `json:"rental_house_id"`
+		Title         string                        `json:"title"`
+		CreatorID     uuid.UUID                     `json:"creator_id"`
+		CreatorName   string                        `json:"creator_name"`
+		Moderation    *RentalHouseModeration        `json:"moderation"`
+	}
+	type Cluster struct {
+		MaxDistance int     `json:"max_distance"`
+		Images      []Image `json:"images"`
+	}
+	clusters := make(map[uuid.UUID]*Cluster)
+	for _, image := range images {
+		if image.RentalHouse == nil {
+			continue
+		}
+		root := find(image.ID)
+		cluster, ok := clusters[root]
+		if !ok {
+			cluster = &Cluster{Images: make([]Image, 0, 2)}
+			clusters[root] = cluster
+		}
+		cluster.Images = append(cluster.Images, Image{
+			ID:            image.ID,
+			Images:        presentImages(image.Images),
+			RentalHouseID: image.RentalHouse.UID,
+			Title:         image.RentalHouse.Title,
+			CreatorID:     image.RentalHouse.CreatorID,
+			CreatorName:   image.RentalHouse.Creator.FullName(),
+			Moderation:    newRentalHouseModeration(image.RentalHouse, true),
+		})
+	}
+	for _, pair := range pairs {
+		if cluster, ok := clusters[find(pair.ImageID)]; ok && pair.Distance > cluster.MaxDistance {
+			cluster.MaxDistance = pair.Distance
+		}
+	}
+	res := make([]Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		if len(cluster.Images) > 1 {
+			res = append(res, *cluster)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if len(res[i].Images) != len(res[j].Images) {
+			return len(res[i].Images) > len(res[j].Images)
+		}
+		return res[i].MaxDistance < res[j].MaxDistance
+	})
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
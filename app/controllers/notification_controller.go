@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetNotificationPreferences method
+// @Description Get the notification settings of the user, all channels are enabled in Turkish until they are changed
+// @Summary Get notification settings
+// @Tags Notification
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=models.NotificationPreference}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /notification/preferences [get]
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	preference, err := db.GetNotificationPreference(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&preference))
+}
+
+// UpdateNotificationPreferences method
+// @Description Change the language (tr or en) and the channels (e-mail, SMS and push) of the notifications, the settings which are not given are kept.
+// @Description The pending notifications of a disabled channel are not sent.
+// @Summary Change notification settings
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Param preferences body models.NotificationPreference true "Notification settings"
+// @Success 200 {object} models.ResponseOK{result=models.NotificationPreference}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /notification/preferences [post]
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// The settings which are not given are kept.
+	preference, err := db.GetNotificationPreference(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if err := c.BodyParser(&preference); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	preference.UserID = user.ID
+	if err := validator.New().Struct(preference); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	err = db.SaveNotificationPreference(&preference)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&preference))
+}
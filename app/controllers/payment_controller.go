@@ -3,6 +3,7 @@ package controllers
 import (
 	"ekira-backend/app/errs"
 	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
 	"ekira-backend/pkg/utils"
 	"ekira-backend/platform/database"
 	"errors"
@@ -11,6 +12,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/stripe/stripe-go/v74"
+	"gorm.io/gorm"
+	"time"
 )
 
 // GetPaymentList method
@@ -117,8 +120,17 @@ func GetReceipt(c *fiber.Ctx) error {
 		Stripe struct {
 			ReceiptURL string `json:"receipt_url"`
 		} `json:"stripe"`
+		Amount      float64         `json:"amount"`
+		AmountGross float64         `json:"amount_gross"`
+		Currency    models.Currency `json:"currency"`
+		Taxes       []TaxLine       `json:"taxes"`
+	}
+	res := Response{
+		Amount:      paymentInfo.Amount,
+		AmountGross: paymentInfo.AmountGross,
+		Currency:    paymentInfo.Currency,
+		Taxes:       newTaxLines(paymentInfo.Taxes),
 	}
-	res := Response{}
 
 	if paymentInfo.StripeChargeID != nil {
 		receiptUrl, err := utils.GetReceiptURL(*paymentInfo.StripeChargeID)
@@ -133,6 +145,38 @@ func GetReceipt(c *fiber.Ctx) error {
 	return c.JSON(models.NewResponseOK(&res))
 }
 
+// completePaymentWithoutCard completes the payment paid with wallet balance and credits only, as the stripe webhooks do for card payments.
+func completePaymentWithoutCard(db *database.Queries, payment *models.Payment) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Payment{}).Where("id = ? AND status != ?", payment.ID, models.PAYMENT_STATUS_COMPLETED).Updates(map[string]interface{}{
+			"status":  models.PAYMENT_STATUS_COMPLETED,
+			"paid_at": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		payment.Status = models.PAYMENT_STATUS_COMPLETED
+		payment.PaidAt = &now
+
+		if payment.IsFirstPayment {
+			err := tx.Model(&models.Reservation{}).Where("id = ?", payment.ReservationID).Update("status", models.RESERVATION_STATUS_PAID).Error
+			if err != nil {
+				return err
+			}
+			// The owner is asked to accept the reservation.
+			return queries.CreateNotifications(tx, payment.Reservation.RentalHouse.CreatorID, models.NOTIFICATION_TYPE_RESERVATION_PAID, payment.Reservation.UID.String(), utils.ReservationNotificationData(&payment.Reservation))
+		}
+
+		// Give a balance to the owner
+		balance := utils.GetOwnerBalanceShare(payment)
+		return tx.Model(&models.User{}).Where("id = ?", payment.Reservation.RentalHouse.CreatorID.String()).Update("balance", gorm.Expr("balance + ?", balance)).Error
+	})
+}
+
 // MakePayment method
 // @Description Make payment for reservation
 // @Summary Make payment for reservation
@@ -151,7 +195,9 @@ func MakePayment(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	type Request struct {
-		PaymentId string `json:"payment_id" validate:"required,uuid4"`
+		PaymentId  string `json:"payment_id" validate:"required,uuid4"`
+		UseWallet  bool   `json:"use_wallet" example:"false" summary:"pay with wallet balance first"`
+		UseCredits bool   `json:"use_credits" example:"false" summary:"pay with credits first"`
 	}
 
 	validate := validator.New()
@@ -189,22 +235,81 @@ func MakePayment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(models.NewResponseErr(errors.New("payment is already paid or canceled")))
 	}
 
+	// The wallet balance and credits of the payment are returned on cancel or expire.
+	for _, tender := range paymentInfo.Tenders {
+		if tender.Type != models.TENDER_TYPE_CARD && tender.RefundedAmount > 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(models.NewResponseErr(errors.New("payment is expired or canceled")))
+		}
+	}
+
 	type Response struct {
 		Stripe struct {
 			ClientSecret string `json:"client_secret"`
 		} `json:"stripe"`
-		Amount      float64 `json:"amount"`
-		AmountGross float64 `json:"amount_gross"`
-		Commision   bool    `json:"commision"`
+		Amount       float64         `json:"amount"`
+		AmountGross  float64         `json:"amount_gross"`
+		WalletAmount float64         `json:"wallet_amount"`
+		CreditAmount float64         `json:"credit_amount"`
+		CardAmount   float64         `json:"card_amount"`
+		Currency     models.Currency `json:"currency"`
+		Commision    bool            `json:"commision"`
+		Paid         bool            `json:"paid"`
+		Taxes        []TaxLine       `json:"taxes"`
 	}
 	res := Response{}
 
+	if paymentInfo.Currency == "" {
+		paymentInfo.Currency = models.DefaultCurrency
+	}
 	res.Amount = paymentInfo.Amount
 	res.AmountGross = paymentInfo.AmountGross
+	res.Currency = paymentInfo.Currency
+	res.Taxes = newTaxLines(paymentInfo.Taxes)
 	if paymentInfo.Amount > paymentInfo.AmountGross {
 		res.Commision = true
 	}
 
+	if paymentInfo.StripeID == nil && len(paymentInfo.Tenders) == 0 {
+		// Take a new exchange rate snapshot, the wallet balance will be given and used with this rate.
+		exchangeRate, err := getExchangeRate(db, paymentInfo.Currency, models.DefaultCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+		}
+		if exchangeRate != paymentInfo.ExchangeRate {
+			paymentInfo.ExchangeRate = exchangeRate
+			err = db.Model(&paymentInfo).Update("exchange_rate", exchangeRate).Error
+			if err != nil {
+				return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+			}
+		}
+
+		// Pay with credits and wallet balance first.
+		if req.UseWallet || req.UseCredits {
+			err = db.ApplyPaymentTenders(&paymentInfo, req.UseWallet, req.UseCredits, utils.GetMinimumChargeAmount(paymentInfo.Currency))
+			if err != nil {
+				return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+			}
+		}
+	}
+	res.WalletAmount = paymentInfo.WalletAmount
+	res.CreditAmount = paymentInfo.CreditAmount
+	res.CardAmount = paymentInfo.CardAmount()
+
+	// The payment is paid without card.
+	if res.CardAmount <= 0 {
+		err = completePaymentWithoutCard(db, &paymentInfo)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		if paymentInfo.IsFirstPayment {
+			paymentInfo.Reservation.Status = models.RESERVATION_STATUS_PAID
+			publishReservationEvent(&paymentInfo.Reservation)
+		}
+		publishPaymentEvent(&paymentInfo)
+		res.Paid = true
+		return c.JSON(models.NewResponseOK(&res))
+	}
+
 	if paymentInfo.StripeID != nil {
 		paymentIntent, err := utils.GetPaymentIntent(*paymentInfo.StripeID)
 		if err != nil {
@@ -236,7 +341,7 @@ func MakePayment(c *fiber.Ctx) error {
 			paymentInfo.Reservation.StartDate.Format("02/01/2006"), paymentInfo.Reservation.EndDate.Format("02/01/2006"),
 			paymentInfo.UID,
 		)
-		paymentIntent, err := utils.CreateAPaymentIntent(customer, description, paymentInfo.Amount, "try")
+		paymentIntent, err := utils.CreateAPaymentIntent(customer, description, res.CardAmount, paymentInfo.Currency)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("payment intent cannot be created")).SetHeader("stripe", err.Error()))
 		}
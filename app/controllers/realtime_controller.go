@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"ekira-backend/app/jobs"
+	"ekira-backend/app/models"
+	"ekira-backend/platform/database"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+const (
+	// realtimePingInterval is the interval of the pings, the connections without pong are closed.
+	realtimePingInterval = 30 * time.Second
+	// realtimeSessionCheckInterval is the interval of checking the session, the connection is closed after the logout.
+	realtimeSessionCheckInterval = 5 * time.Minute
+)
+
+type ReservationEvent struct {
+	ID         string                   `json:"id"`
+	Status     models.ReservationStatus `json:"status"`
+	StatusName string                   `json:"status_name"`
+}
+
+type PaymentEvent struct {
+	ID            string               `json:"id"`
+	ReservationID string               `json:"reservation_id"`
+	Status        models.PaymentStatus `json:"status"`
+	StatusName    string               `json:"status_name"`
+}
+
+type MessageEvent struct {
+	ConversationID string        `json:"conversation_id"`
+	Message        MessageResult `json:"message"`
+}
+
+// publishReservationEvent sends the new status of the reservation to the renter and the owner.
+func publishReservationEvent(reservation *models.Reservation) {
+	event := ReservationEvent{
+		ID:         reservation.UID.String(),
+		Status:     reservation.Status,
+		StatusName: reservation.StatusName(),
+	}
+	userIds := []uuid.UUID{reservation.CreatorID}
+	if reservation.RentalHouse.CreatorID != uuid.Nil {
+		userIds = append(userIds, reservation.RentalHouse.CreatorID)
+	}
+	jobs.PublishRealtimeEvent(jobs.RealtimeEventReservation, event, userIds...)
+}
+
+// publishPaymentEvent sends the new status of the payment to the renter.
+func publishPaymentEvent(payment *models.Payment) {
+	event := PaymentEvent{
+		ID:            payment.UID.String(),
+		ReservationID: payment.Reservation.UID.String(),
+		Status:        payment.Status,
+		StatusName:    payment.StatusName(),
+	}
+	jobs.PublishRealtimeEvent(jobs.RealtimeEventPayment, event, payment.Reservation.CreatorID)
+}
+
+// publishMessageEvent sends the new message to the participants of the conversation, each of them gets the message as they see it.
+func publishMessageEvent(message *models.Message, conversation *models.Conversation, contactUnlocked bool) {
+	for _, userId := range []uuid.UUID{conversation.RenterID, conversation.OwnerID} {
+		event := MessageEvent{
+			ConversationID: conversation.UID.String(),
+			Message:        newMessageResult(message, conversation, userId, contactUnlocked),
+		}
+		jobs.PublishRealtimeEvent(jobs.RealtimeEventMessage, event, userId)
+	}
+}
+
+// RealtimeUpgrade checks if the request is a websocket request before the connection is upgraded.
+func RealtimeUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	return c.Next()
+}
+
+// CreateRealtimeTicket method
+// @Description Create a one-time ticket of the session for the websocket connection, browsers can not set the Authorization header of the websocket requests.
+// @Description The ticket is given with the ticket query parameter of /ws, it expires in 30 seconds.
+// @Summary Create realtime ticket
+// @Tags Realtime
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=controllers.CreateRealtimeTicket.Response}
+// @Failure 401 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /realtime/ticket [post]
+func CreateRealtimeTicket(c *fiber.Ctx) error {
+	session := c.Locals("session").(models.Session)
+
+	type Response struct {
+		Ticket    string `json:"ticket"`
+		ExpiresIn int    `json:"expires_in" example:"30" summary:"seconds"`
+	}
+
+	// Open redis connection.
+	rds := database.NewRConnection()
+	defer rds.RClose()
+
+	ticket := uuid.New().String()
+	err := rds.RSetTTL(models.RealtimeTicketKey(ticket), session.ID.String(), models.RealtimeTicketTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("ticket can not be created")).SetHeader("redis", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&Response{Ticket: ticket, ExpiresIn: models.RealtimeTicketTTL}))
+}
+
+// RealtimeEvents method
+// @Description Websocket connection of the realtime events of the user: reservation.updated, payment.updated and message.created.
+// @Description The events are sent as {"type": "...", "data": {...}}, the data is controllers.ReservationEvent, controllers.PaymentEvent or controllers.MessageEvent.
+// @Description Browsers give a one-time ticket of /realtime/ticket with the ticket query parameter. The events are not stored, the client should get the current state after reconnecting.
+// @Summary Websocket connection of the realtime events
+// @Tags Realtime
+// @Param ticket query string false "One-time ticket, if the Authorization header can not be set"
+// @Success 101
+// @Failure 401 {object} models.ResponseErr
+// @Failure 426 {object} models.ResponseErr
+// @Security Authentication
+// @Router /ws [get]
+func RealtimeEvents(c *websocket.Conn) {
+	user := c.Locals("user").(models.User)
+	session := c.Locals("session").(models.Session)
+
+	client := jobs.AddRealtimeClient(user.ID)
+	defer jobs.RemoveRealtimeClient(client)
+
+	// Read the connection until it is closed, the messages of the client are ignored.
+	closed := make(chan struct{})
+	c.SetReadDeadline(time.Now().Add(2 * realtimePingInterval))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(2 * realtimePingInterval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(realtimePingInterval)
+	defer ping.Stop()
+	sessionCheck := time.NewTicker(realtimeSessionCheckInterval)
+	defer sessionCheck.Stop()
+	expire := time.NewTimer(time.Until(time.Unix(session.ExpiresAt, 0)))
+	defer expire.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-client.Events:
+			if err := c.WriteMessage(websocket.TextMessage, event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-sessionCheck.C:
+			if !isSessionActive(session.ID) {
+				c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended"))
+				return
+			}
+		case <-expire.C:
+			c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired"))
+			return
+		}
+	}
+}
+
+// isSessionActive returns false if the session is deleted by the logout, the connection errors keep the session active.
+func isSessionActive(sessionId uuid.UUID) bool {
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("realtime: session cannot be checked: %v\n", err)
+		return true
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	session, err := db.GetSessionBySessionID(sessionId.String())
+	if err != nil {
+		log.Printf("realtime: session cannot be checked: %v\n", err)
+		return true
+	}
+	return session.ID != uuid.Nil && session.ExpiresAt >= time.Now().Unix()
+}
@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"ekira-backend/app/errs"
+	"ekira-backend/app/jobs"
 	"ekira-backend/app/models"
 	"ekira-backend/app/queries"
 	"ekira-backend/pkg/utils"
 	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
 	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
-	"os"
-	"regexp"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -47,10 +48,22 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 		QuarterID     int                  `json:"quarter_id" example:"1" required:"true"`
 		RentPeriod    int                  `json:"rent_period" example:"1" summary:"1 = daily, 2 = monthly, 3 = yearly" required:"true,min=1,max=3"`
 		Price         float64              `json:"price" example:"100.00" required:"true"`
+		Currency      string               `json:"currency" example:"TRY" summary:"TRY, EUR, USD" required:"false"`
 		MinDay        *int                 `json:"min_day" example:"1" required:"false"`
 		CommisionType models.CommisionType `json:"commision_type" example:"0" summary:"0 = renter pays, 1 = owner pays" required:"true,min=0,max=1"`
-		Lat           string               `json:"g_coordinate,omitempty"`
+		ListingType   models.ListingType   `json:"listing_type" example:"0" summary:"0 = residential, 1 = commercial" required:"false,min=0,max=1"`
+		Lat           string               `json:"g_coordinate,omitempty" example:"(39.418975,29.983876)" summary:"(lat,lon)"`
 		ImageUUIDs    []string             `json:"imageUUIDs" swaggertype:"array,string" example:""`
+		Rooms         string               `json:"rooms" example:"2+1" summary:"rooms and living rooms" required:"false"`
+		GrossArea     int                  `json:"gross_area" example:"110" summary:"m²" required:"false"`
+		NetArea       int                  `json:"net_area" example:"95" summary:"m²" required:"false"`
+		Floor         *int                 `json:"floor" example:"3" required:"false"`
+		BuildingAge   *int                 `json:"building_age" example:"5" required:"false"`
+		HeatingType   models.HeatingType   `json:"heating_type" example:"1" summary:"0 = none, 1 = combi, 2 = central, 3 = floor, 4 = air conditioner, 5 = stove" required:"false"`
+		Furnished     bool                 `json:"furnished" example:"false" required:"false"`
+		MaxGuests     int                  `json:"max_guests" example:"4" required:"false"`
+		AmenityIDs    []int                `json:"amenity_ids" example:"1,2" required:"false"`
+		Draft         bool                 `json:"draft" example:"false" summary:"save without sending to review" required:"false"`
 	}
 
 	// Get rental house from request.
@@ -69,20 +82,43 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 	rentalHouse.RentPeriod = request.RentPeriod
 	rentalHouse.Price = request.Price
 	rentalHouse.CommisionType = request.CommisionType
+	rentalHouse.ListingType = request.ListingType
+	rentalHouse.Currency = models.DefaultCurrency
+	if request.Currency != "" {
+		currency, ok := models.ParseCurrency(request.Currency)
+		if !ok {
+			return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("currency", "unsupported currency"))
+		}
+		rentalHouse.Currency = currency
+	}
 	if rentalHouse.RentPeriod == models.RentPeriodDay && request.MinDay != nil {
 		rentalHouse.MinDay = *request.MinDay
 	} else {
 		rentalHouse.MinDay = 1
 	}
-	//rentalHouse.GCoordinate = rentalHouseBody.GCoordinate
 	rentalHouse.CreatedAt = time.Now()
 	rentalHouse.UpdatedAt = time.Now()
-
-	x, y := 0.0, 0.0
-	if _, err := fmt.Sscanf(rentalHouse.GCoordinate, "(%f,%f)", &x, &y); err != nil {
-		x, y = 0.0, 0.0
+	if request.Rooms != "" {
+		var ok bool
+		rentalHouse.RoomCount, rentalHouse.LivingRoomCount, ok = models.ParseRooms(request.Rooms)
+		if !ok {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("rooms", "invalid rooms, N+M expected"))
+		}
 	}
-	rentalHouse.GCoordinate = fmt.Sprintf("(%f,%f)", x, y)
+	rentalHouse.GrossArea = request.GrossArea
+	rentalHouse.NetArea = request.NetArea
+	rentalHouse.Floor = request.Floor
+	rentalHouse.BuildingAge = request.BuildingAge
+	rentalHouse.HeatingType = request.HeatingType
+	rentalHouse.Furnished = request.Furnished
+	rentalHouse.MaxGuests = request.MaxGuests
+	if rentalHouse.GrossArea > 0 && rentalHouse.NetArea > rentalHouse.GrossArea {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("net_area", "net area can not be greater than gross area"))
+	}
+
+	// The location is taken from the quarter if the coordinate is not given.
+	point, _ := models.ParseGCoordinate(request.Lat)
+	rentalHouse.GCoordinate = fmt.Sprintf("(%f,%f)", point.Lat, point.Lon)
 
 	// Validate rental house.
 	validate := utils.NewValidator()
@@ -93,28 +129,42 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
 	}
 
-	// Create new rental house.
-	err = db.NewRentalHouse(&rentalHouse)
+	// Amenities of the rental house.
+	amenities, ok, err := getAmenities(db, request.AmenityIDs)
 	if err != nil {
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
-
-	if rentalHouse.ID == 0 {
-		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound).SetHeader("db", "Rental house not found"))
+	if !ok {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("amenity_ids", "invalid amenity id"))
 	}
+	rentalHouse.Amenities = amenities
 
-	// Create new rental house images.
-	images, err := db.GetRentalHouseImagesByIDs(request.ImageUUIDs)
-	if err == nil {
-		for _, image := range images {
-			image.RentalHouseID = &rentalHouse.ID
-			err := db.UpdateRentalHouseImage(image)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			rentalHouse.Images = append(rentalHouse.Images, image)
+	// Create new rental house with the uploaded images in the given order, it is not created if an image can not be added.
+	err = db.WithTransaction(func(tx *database.Queries) error {
+		if err := tx.NewRentalHouse(&rentalHouse); err != nil {
+			return err
+		}
+		images, err := tx.AttachRentalHouseImages(rentalHouse.ID, user2.ID, request.ImageUUIDs)
+		if err != nil {
+			return err
 		}
+		rentalHouse.Images = append(rentalHouse.Images, images...)
+
+		// Send to review, the listing is public after it is approved.
+		if !request.Draft {
+			return submitRentalHouse(tx, &rentalHouse)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, queries.ErrRentalHouseImagesNotFound) {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound).SetHeader("db", "Rental house not found"))
 	}
 
 	type Creator struct {
@@ -127,17 +177,24 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 	}
 
 	type Result struct {
-		ID            string                          `json:"id"`
-		Title         string                          `json:"title"`
-		Price         float64                         `json:"price"`
-		MinDay        int                             `json:"min_day"`
-		RentPeriod    int                             `json:"rent_period"`
-		CommisionType string                          `json:"commision_type"`
-		Address       models.Quarter                  `json:"address"`
-		Images        [][]models.RentalHouseImageInfo `json:"images"`
-		Description   string                          `json:"description"`
-		Published     bool                            `json:"published"`
-		Creator       interface{}                     `json:"creator"`
+		ID              string                          `json:"id"`
+		Title           string                          `json:"title"`
+		Price           float64                         `json:"price"`
+		Currency        models.Currency                 `json:"currency"`
+		DisplayPrice    float64                         `json:"display_price"`
+		DisplayCurrency models.Currency                 `json:"display_currency"`
+		MinDay          int                             `json:"min_day"`
+		RentPeriod      int                             `json:"rent_period"`
+		CommisionType   string                          `json:"commision_type"`
+		ListingType     string                          `json:"listing_type"`
+		Address         models.Quarter                  `json:"address"`
+		Images          [][]models.RentalHouseImageInfo `json:"images"`
+		Photos          []RentalHousePhoto              `json:"photos" summary:"images with ids, for the image management"`
+		Description     string                          `json:"description"`
+		Published       bool                            `json:"published"`
+		Attributes      RentalHouseAttributes           `json:"attributes"`
+		Moderation      *RentalHouseModeration          `json:"moderation,omitempty" summary:"only for the owner and the moderators"`
+		Creator         interface{}                     `json:"creator"`
 	}
 
 	creator := Creator{
@@ -149,16 +206,23 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 	}
 
 	result := Result{
-		ID:            rentalHouse.UID.String(),
-		Title:         rentalHouse.Title,
-		Price:         rentalHouse.Price,
-		MinDay:        rentalHouse.MinDay,
-		RentPeriod:    rentalHouse.RentPeriod,
-		CommisionType: rentalHouse.CommisionTypeInfo(),
-		Address:       rentalHouse.Quarter,
-		Images:        make([][]models.RentalHouseImageInfo, len(rentalHouse.Images)),
-		Description:   rentalHouse.Description,
-		Published:     rentalHouse.Published,
+		ID:              rentalHouse.UID.String(),
+		Title:           rentalHouse.Title,
+		Price:           rentalHouse.Price,
+		Currency:        rentalHouse.Currency,
+		DisplayPrice:    rentalHouse.Price,
+		DisplayCurrency: rentalHouse.Currency,
+		MinDay:          rentalHouse.MinDay,
+		RentPeriod:      rentalHouse.RentPeriod,
+		CommisionType:   rentalHouse.CommisionTypeInfo(),
+		ListingType:     rentalHouse.ListingType.Name(),
+		Address:         rentalHouse.Quarter,
+		Images:          make([][]models.RentalHouseImageInfo, len(rentalHouse.Images)),
+		Photos:          newRentalHousePhotos(rentalHouse.Images),
+		Description:     rentalHouse.Description,
+		Published:       rentalHouse.Published,
+		Attributes:      newRentalHouseAttributes(&rentalHouse),
+		Moderation:      newRentalHouseModeration(&rentalHouse, false),
 	}
 
 	if rentalHouse.Creator.ProfileImage != nil {
@@ -166,6 +230,7 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 		images := profileImage.Images
 		if len(images) > 0 {
 			lastItem := images[len(images)-1]
+			lastItem.URL = storage.PresentURL(lastItem.URL)
 			creator.ProfileImage = &lastItem.URL
 		}
 	}
@@ -174,9 +239,11 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 	for i, images := range rentalHouse.Images {
 		result.Images[i] = make([]models.RentalHouseImageInfo, len(images.Images))
 		for j, image := range images.Images {
-			result.Images[i][j].URL = image.URL
+			result.Images[i][j].URL = storage.PresentURL(image.URL)
 			result.Images[i][j].Width = image.Width
 			result.Images[i][j].Height = image.Height
+			result.Images[i][j].Format = image.Format
+			result.Images[i][j].Blurhash = image.Blurhash
 		}
 	}
 
@@ -184,6 +251,269 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 	return c.JSON(models.NewResponseOK(&result))
 }
 
+type RentalHouseAttributes struct {
+	Rooms           string          `json:"rooms"`
+	RoomCount       int             `json:"room_count"`
+	LivingRoomCount int             `json:"living_room_count"`
+	GrossArea       int             `json:"gross_area"`
+	NetArea         int             `json:"net_area"`
+	Floor           *int            `json:"floor"`
+	BuildingAge     *int            `json:"building_age"`
+	HeatingType     uint8           `json:"heating_type"`
+	HeatingTypeName string          `json:"heating_type_name"`
+	Furnished       bool            `json:"furnished"`
+	MaxGuests       int             `json:"max_guests"`
+	Amenities       []AmenityResult `json:"amenities"`
+}
+
+func newRentalHouseAttributes(rh *models.RentalHouse) RentalHouseAttributes {
+	return RentalHouseAttributes{
+		Rooms:           rh.Rooms(),
+		RoomCount:       rh.RoomCount,
+		LivingRoomCount: rh.LivingRoomCount,
+		GrossArea:       rh.GrossArea,
+		NetArea:         rh.NetArea,
+		Floor:           rh.Floor,
+		BuildingAge:     rh.BuildingAge,
+		HeatingType:     uint8(rh.HeatingType),
+		HeatingTypeName: rh.HeatingType.Name(),
+		Furnished:       rh.Furnished,
+		MaxGuests:       rh.MaxGuests,
+		Amenities:       newAmenityResults(rh.Amenities),
+	}
+}
+
+// rentalHouseSortFields are the sortable fields of the rental house lists.
+var rentalHouseSortFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"price":      true,
+	"title":      true,
+	"min_day":    true,
+}
+
+// publicRentalHouseSortFields are the sortable fields of the public rental house list.
+var publicRentalHouseSortFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"price":      true,
+	"title":      true,
+	"min_day":    true,
+	"relevance":  true,
+	"distance":   true,
+	"rating":     true,
+}
+
+// getSort parses the "field:asc|desc" sort query, only the given fields are allowed.
+func getSort(c *fiber.Ctx, fields map[string]bool, defaultSort string) (string, string, error) {
+	sort := strings.TrimSpace(c.Query("sort"))
+	if sort == "" {
+		sort = defaultSort
+	}
+	field, order, _ := strings.Cut(strings.ToLower(sort), ":")
+	if order == "" {
+		order = "asc"
+	}
+	if !fields[field] {
+		return "", "", fmt.Errorf("invalid sort field: %s", field)
+	}
+	if order != "asc" && order != "desc" {
+		return "", "", fmt.Errorf("invalid sort order: %s", order)
+	}
+	return field, order, nil
+}
+
+// getQueryIntList parses a comma separated list query, e.g. "1,2,3", the values must be at least min.
+func getQueryIntList(c *fiber.Ctx, key string, min int) ([]int, error) {
+	var list []int
+	for _, v := range strings.Split(c.Query(key), ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || i < min {
+			return nil, fmt.Errorf("invalid %s: %s", key, v)
+		}
+		list = append(list, i)
+	}
+	return list, nil
+}
+
+// getRentalHouseFilter parses the structured search queries of the rental house list.
+func getRentalHouseFilter(c *fiber.Ctx) (models.RentalHouseFilter, error) {
+	filter := models.RentalHouseFilter{
+		Search: strings.TrimSpace(c.Query("search")),
+	}
+	var err error
+
+	if filter.CityIDs, err = getQueryIntList(c, "city_id", 1); err != nil {
+		return filter, err
+	}
+	if filter.TownIDs, err = getQueryIntList(c, "town_id", 1); err != nil {
+		return filter, err
+	}
+	if filter.DistrictIDs, err = getQueryIntList(c, "district_id", 1); err != nil {
+		return filter, err
+	}
+	if filter.QuarterIDs, err = getQueryIntList(c, "quarter_id", 1); err != nil {
+		return filter, err
+	}
+
+	if v := c.Query("min_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			return filter, errors.New("invalid min_price")
+		}
+		filter.MinPrice = &price
+	}
+	if v := c.Query("max_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			return filter, errors.New("invalid max_price")
+		}
+		filter.MaxPrice = &price
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, errors.New("min_price can not be greater than max_price")
+	}
+	if v := c.Query("price_currency"); v != "" {
+		currency, ok := models.ParseCurrency(v)
+		if !ok {
+			return filter, errors.New("invalid price_currency")
+		}
+		filter.PriceCurrency = currency
+	}
+
+	if v := c.Query("rent_period"); v != "" {
+		filter.RentPeriod, err = strconv.Atoi(v)
+		if err != nil || filter.RentPeriod < models.RentPeriodDay || filter.RentPeriod > models.RentPeriodYear {
+			return filter, errors.New("invalid rent_period")
+		}
+	}
+	if v := c.Query("min_day"); v != "" {
+		filter.MinDay, err = strconv.Atoi(v)
+		if err != nil || filter.MinDay < 1 {
+			return filter, errors.New("invalid min_day")
+		}
+	}
+	if v := c.Query("commision"); v != "" {
+		commision, err := strconv.Atoi(v)
+		if err != nil || commision < int(models.CommisionTypeRenterPays) || commision > int(models.CommisionTypeNone) {
+			return filter, errors.New("invalid commision")
+		}
+		commisionType := models.CommisionType(commision)
+		filter.CommisionType = &commisionType
+	}
+
+	// Availability, both of the dates are required.
+	startDate, endDate := c.Query("start_date"), c.Query("end_date")
+	if startDate != "" || endDate != "" {
+		start, err := time.ParseInLocation("2006-01-02", startDate, utils.TZ)
+		if err != nil {
+			return filter, errors.New("invalid start_date")
+		}
+		end, err := time.ParseInLocation("2006-01-02", endDate, utils.TZ)
+		if err != nil || !end.After(start) {
+			return filter, errors.New("invalid end_date")
+		}
+		filter.StartDate = &start
+		filter.EndDate = &end
+	}
+
+	// Attributes
+	for _, rooms := range strings.Split(c.Query("rooms"), ",") {
+		if strings.TrimSpace(rooms) == "" {
+			continue
+		}
+		if _, _, ok := models.ParseRooms(rooms); !ok {
+			return filter, fmt.Errorf("invalid rooms: %s", rooms)
+		}
+		filter.Rooms = append(filter.Rooms, strings.TrimSpace(rooms))
+	}
+	intQueries := map[string]*int{"min_rooms": &filter.MinRooms, "min_area": &filter.MinArea, "max_area": &filter.MaxArea, "min_guests": &filter.MinGuests}
+	for key, value := range intQueries {
+		if v := c.Query(key); v != "" {
+			*value, err = strconv.Atoi(v)
+			if err != nil || *value < 0 {
+				return filter, fmt.Errorf("invalid %s", key)
+			}
+		}
+	}
+	if filter.MinArea != 0 && filter.MaxArea != 0 && filter.MinArea > filter.MaxArea {
+		return filter, errors.New("min_area can not be greater than max_area")
+	}
+	if v := c.Query("furnished"); v != "" {
+		furnished, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("invalid furnished")
+		}
+		filter.Furnished = &furnished
+	}
+	if v := c.Query("max_building_age"); v != "" {
+		age, err := strconv.Atoi(v)
+		if err != nil || age < 0 {
+			return filter, errors.New("invalid max_building_age")
+		}
+		filter.MaxBuildingAge = &age
+	}
+	heatingTypes, err := getQueryIntList(c, "heating_type", int(models.HeatingTypeNone))
+	if err != nil {
+		return filter, err
+	}
+	for _, heatingType := range heatingTypes {
+		if heatingType > int(models.HeatingTypeStove) {
+			return filter, errors.New("invalid heating_type")
+		}
+		filter.HeatingTypes = append(filter.HeatingTypes, models.HeatingType(heatingType))
+	}
+	if filter.AmenityIDs, err = getQueryIntList(c, "amenity_id", 1); err != nil {
+		return filter, err
+	}
+
+	// Location, "within radius km of lat/lon" and "min_lon,min_lat,max_lon,max_lat" bounding box.
+	if c.Query("lat") != "" || c.Query("lon") != "" {
+		lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+		lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+		if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return filter, errors.New("invalid lat/lon")
+		}
+		radius := 10.0
+		if v := c.Query("radius"); v != "" {
+			radius, err = strconv.ParseFloat(v, 64)
+			if err != nil || radius <= 0 || radius > maxSearchRadiusKm {
+				return filter, fmt.Errorf("invalid radius, it must be between 0 and %.0f km", maxSearchRadiusKm)
+			}
+		}
+		filter.Near = &models.GeoCircle{GeoPoint: models.GeoPoint{Lat: lat, Lon: lon}, RadiusKm: radius}
+	}
+	if v := c.Query("bbox"); v != "" {
+		var bounds models.GeoBounds
+		if _, err := fmt.Sscanf(v, "%f,%f,%f,%f", &bounds.MinLon, &bounds.MinLat, &bounds.MaxLon, &bounds.MaxLat); err != nil ||
+			bounds.MinLat > bounds.MaxLat || bounds.MinLon > bounds.MaxLon || bounds.MinLat < -90 || bounds.MaxLat > 90 || bounds.MinLon < -180 || bounds.MaxLon > 180 {
+			return filter, errors.New("invalid bbox, min_lon,min_lat,max_lon,max_lat expected")
+		}
+		filter.Bounds = &bounds
+	}
+
+	return filter, nil
+}
+
+// maxSearchRadiusKm is the maximum radius of the location search.
+const maxSearchRadiusKm = 500.0
+
+// getPriceRates returns the exchange rates from the supported currencies to the given currency.
+func getPriceRates(db *database.Queries, to models.Currency) (map[models.Currency]float64, error) {
+	rates := map[models.Currency]float64{}
+	for _, currency := range models.SupportedCurrencies {
+		rate, err := getExchangeRate(db, currency, to)
+		if err != nil {
+			return nil, err
+		}
+		rates[currency] = rate
+	}
+	return rates, nil
+}
+
 // GetOwnedList method
 // @Description Get user's owned rental houses
 // @Summary Get user's owned rental houses
@@ -192,8 +522,9 @@ func CreateRentalHouse(c *fiber.Ctx) error {
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Limit number" default(10)
-// @Param sort query string false "Sort by" default(created_at:desc)
+// @Param sort query string false "Sort by (created_at, updated_at, price, title, min_day)" default(created_at:desc)
 // @Param search query string false "Search by title" default()
+// @Param currency query string false "Display currency (TRY, EUR, USD)" default()
 // @Success 200 {object} models.ResponseOK{result=controllers.GetOwnedList.Response{results=[]controllers.GetOwnedList.Result}}
 // @Failure 404 {object} models.ResponseErr
 // @Failure 400 {object} models.ResponseErr
@@ -210,8 +541,6 @@ func GetOwnedList(c *fiber.Ctx) error {
 	// @Param sort query string false "Sort string (field:asc/desc)"
 	limit := 5
 	page := 1
-	//search := ""
-	sort := "created_at:desc"
 
 	if _limit, err := strconv.Atoi(c.Query("limit")); err == nil {
 		limit = _limit
@@ -219,16 +548,15 @@ func GetOwnedList(c *fiber.Ctx) error {
 	if _page, err := strconv.Atoi(c.Query("page")); err == nil {
 		page = _page
 	}
-	//if _search := strings.TrimSpace(c.Query("search")); _search != "" {
-	//	search = _search
-	//}
-	r := regexp.MustCompile(`^[a-z_A-Z0-9]:(asc|desc)$`)
-	if _sort := strings.TrimSpace(c.Query("sort")); _sort != "" && r.MatchString(_sort) {
-		sort = _sort
+	field, order, err := getSort(c, rentalHouseSortFields, "created_at:desc")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("sort", err.Error()))
+	}
+	sort := fmt.Sprintf("%s %s", field, order)
+	displayCurrency, err := getDisplayCurrency(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", err.Error()))
 	}
-	field := strings.Split(sort, ":")[0]
-	order := strings.Split(sort, ":")[1]
-	sort = fmt.Sprintf("%s %s", field, order)
 
 	// Pagination.
 	pagination := models.Pagination{
@@ -249,13 +577,16 @@ func GetOwnedList(c *fiber.Ctx) error {
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
 	type Result struct {
-		ID            string  `json:"id"`
-		Title         string  `json:"title"`
-		Price         float64 `json:"price"`
-		MinDay        int     `json:"min_day"`
-		RentPeriod    int     `json:"rent_period"`
-		CommisionType string  `json:"commision_type"`
-		Address       struct {
+		ID              string          `json:"id"`
+		Title           string          `json:"title"`
+		Price           float64         `json:"price"`
+		Currency        models.Currency `json:"currency"`
+		DisplayPrice    float64         `json:"display_price"`
+		DisplayCurrency models.Currency `json:"display_currency"`
+		MinDay          int             `json:"min_day"`
+		RentPeriod      int             `json:"rent_period"`
+		CommisionType   string          `json:"commision_type"`
+		Address         struct {
 			QuarterID    int    `json:"quarter_id"`
 			QuarterName  string `json:"quarter_name"`
 			DistrictID   int    `json:"district_id"`
@@ -267,8 +598,9 @@ func GetOwnedList(c *fiber.Ctx) error {
 			CountryID    int    `json:"country_id"`
 			CountryName  string `json:"country_name"`
 		} `json:"address"`
-		Images    [][]models.RentalHouseImageInfo `json:"images"`
-		Published bool                            `json:"published"`
+		Images     [][]models.RentalHouseImageInfo `json:"images"`
+		Published  bool                            `json:"published"`
+		Moderation *RentalHouseModeration          `json:"moderation"`
 	}
 	type Response struct {
 		Pagination struct {
@@ -289,11 +621,27 @@ func GetOwnedList(c *fiber.Ctx) error {
 	if rentalHouseList.TotalCount == 0 {
 		return c.JSON(models.NewResponseOK(&res))
 	}
+	rates := map[models.Currency]float64{}
 	i := 0
 	for _, rentalHouse := range rentalHouseList.Houses {
 		result[i].ID = rentalHouse.UID.String()
 		result[i].Title = rentalHouse.Title
 		result[i].Price = rentalHouse.Price
+		result[i].Currency = rentalHouse.Currency
+		result[i].DisplayPrice = rentalHouse.Price
+		result[i].DisplayCurrency = rentalHouse.Currency
+		if displayCurrency != "" && displayCurrency != rentalHouse.Currency {
+			rate, ok := rates[rentalHouse.Currency]
+			if !ok {
+				rate, err = getExchangeRate(db, rentalHouse.Currency, displayCurrency)
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+				}
+				rates[rentalHouse.Currency] = rate
+			}
+			result[i].DisplayPrice = utils.ConvertPrice(rentalHouse.Price, rate)
+			result[i].DisplayCurrency = displayCurrency
+		}
 		result[i].MinDay = rentalHouse.MinDay
 		result[i].RentPeriod = rentalHouse.RentPeriod
 		result[i].Address.QuarterID = rentalHouse.Quarter.ID
@@ -308,13 +656,10 @@ func GetOwnedList(c *fiber.Ctx) error {
 		result[i].Address.CountryName = rentalHouse.Quarter.District.Town.City.Country.Name
 		result[i].Images = [][]models.RentalHouseImageInfo{}
 		result[i].Published = rentalHouse.Published
+		result[i].Moderation = newRentalHouseModeration(&rentalHouse, false)
 		result[i].CommisionType = rentalHouse.CommisionTypeInfo()
 		for _, image := range rentalHouse.Images {
-			var dt []models.RentalHouseImageInfo
-			for _, imageInfo := range image.Images {
-				dt = append(dt, imageInfo)
-			}
-			result[i].Images = append(result[i].Images, dt)
+			result[i].Images = append(result[i].Images, presentImages(image.Images))
 		}
 		i++
 		if i == limit {
@@ -334,9 +679,35 @@ func GetOwnedList(c *fiber.Ctx) error {
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Limit number" default(10)
-// @Param sort query string false "Sort by" default(created_at:desc)
-// @Param search query string false "Search by title" default()
+// @Param sort query string false "Sort by (created_at, updated_at, price, title, min_day, relevance, distance, rating), search results are sorted by relevance" default(created_at:desc)
+// @Param search query string false "Full text search in title, description and address" default()
+// @Param currency query string false "Display currency (TRY, EUR, USD)" default()
 // @Param favorite query bool false "Only get favorite rental houses" default()
+// @Param city_id query string false "City ids, comma separated" default()
+// @Param town_id query string false "Town ids, comma separated" default()
+// @Param district_id query string false "District ids, comma separated" default()
+// @Param quarter_id query string false "Quarter ids, comma separated" default()
+// @Param min_price query number false "Minimum price" default()
+// @Param max_price query number false "Maximum price" default()
+// @Param price_currency query string false "Currency of the price range (TRY, EUR, USD), default is display currency" default()
+// @Param rent_period query int false "Rent period (1 = daily, 2 = monthly, 3 = yearly)" default()
+// @Param min_day query int false "Only houses with minimum stay at most this many days" default()
+// @Param commision query int false "Commision type (0 = renter pays, 1 = owner pays, 2 = none)" default()
+// @Param start_date query string false "Available from (YYYY-MM-DD)" default()
+// @Param end_date query string false "Available until, exclusive (YYYY-MM-DD)" default()
+// @Param lat query number false "Latitude of the location search" default()
+// @Param lon query number false "Longitude of the location search" default()
+// @Param radius query number false "Radius of the location search in km (max 500)" default(10)
+// @Param bbox query string false "Map bounding box, min_lon,min_lat,max_lon,max_lat" default()
+// @Param rooms query string false "Room counts, comma separated (e.g. 2+1,3+1)" default()
+// @Param min_rooms query int false "Minimum number of rooms" default()
+// @Param min_area query int false "Minimum gross area in m²" default()
+// @Param max_area query int false "Maximum gross area in m²" default()
+// @Param furnished query bool false "Furnished" default()
+// @Param min_guests query int false "Minimum of the maximum guests" default()
+// @Param heating_type query string false "Heating types, comma separated, 0 = none" default()
+// @Param max_building_age query int false "Maximum building age" default()
+// @Param amenity_id query string false "Amenity ids, comma separated, all of them are required" default()
 // @Success 200 {object} models.ResponseOK{result=controllers.GetPublicList.Response{results=[]controllers.GetPublicList.Result}}
 // @Failure 404 {object} models.ResponseErr
 // @Failure 400 {object} models.ResponseErr
@@ -349,14 +720,12 @@ func GetPublicList(c *fiber.Ctx) error {
 	// Query parameters.
 	// @Param page query int false "Page number (default: 1)"
 	// @Param limit query int false "Limit number of items per page"
-	// @Param search query string false "Search string (title)"
+	// @Param search query string false "Search string (full text)"
 	// @Param sort query string false "Sort string (field:asc/desc)"
 	// @Param favorite query bool false "Only get favorite rental houses"
 	limit := 5
 	page := 1
 	favorite := false
-	//search := ""
-	sort := "created_at:desc"
 
 	if c.Query("favorite") == "true" {
 		favorite = true
@@ -368,16 +737,46 @@ func GetPublicList(c *fiber.Ctx) error {
 	if _page, err := strconv.Atoi(c.Query("page")); err == nil {
 		page = _page
 	}
-	//if _search := strings.TrimSpace(c.Query("search")); _search != "" {
-	//	search = _search
-	//}
-	r := regexp.MustCompile(`^[a-z_A-Z0-9]:(asc|desc)$`)
-	if _sort := strings.TrimSpace(c.Query("sort")); _sort != "" && r.MatchString(_sort) {
-		sort = _sort
+	// Search results are sorted by relevance, location results by distance by default.
+	defaultSort := "created_at:desc"
+	if strings.TrimSpace(c.Query("search")) != "" {
+		defaultSort = "relevance:desc"
+	} else if c.Query("lat") != "" {
+		defaultSort = "distance:asc"
+	}
+	field, order, err := getSort(c, publicRentalHouseSortFields, defaultSort)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("sort", err.Error()))
+	}
+	displayCurrency, err := getDisplayCurrency(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", err.Error()))
+	}
+	filter, err := getRentalHouseFilter(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("filter", err.Error()))
+	}
+	if filter.PriceCurrency == "" {
+		filter.PriceCurrency = displayCurrency
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Prices of the listings are compared in one currency.
+	if filter.PriceCurrency != "" && (filter.MinPrice != nil || filter.MaxPrice != nil || field == "price") {
+		filter.PriceRates, err = getPriceRates(db, filter.PriceCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+		}
+	}
+	sort := fmt.Sprintf("%s %s", field, order)
+	if field == "price" {
+		sort = fmt.Sprintf("%s %s", filter.PriceExpression(), order)
 	}
-	field := strings.Split(sort, ":")[0]
-	order := strings.Split(sort, ":")[1]
-	sort = fmt.Sprintf("%s %s", field, order)
 
 	// Pagination.
 	pagination := models.Pagination{
@@ -387,37 +786,38 @@ func GetPublicList(c *fiber.Ctx) error {
 		Filters: models.Filter{},
 	}
 
-	// Create database connection.
-	db, err := database.OpenDBConnection()
-	if err != nil {
-		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
-	}
-
 	var rentalHouseList queries.RentalHouseList
 
 	if favorite {
-		pagination.Filters["published"] = true
 		// Get favorite rental houses.
-		rentalHouseList, err = db.GetFavoriteRentalHouseList(user.ID, &pagination)
+		rentalHouseList, err = db.GetFavoriteRentalHouseList(user.ID, &pagination, &filter)
 		if err != nil {
 			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 		}
 	} else {
 		// Get all rental houses.
-		rentalHouseList, err = db.GetRentalHouseList(&pagination)
+		rentalHouseList, err = db.GetRentalHouseList(&pagination, &filter)
 		if err != nil {
 			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 		}
 	}
 
+	// Highlight is the matched parts of the search, the text is HTML escaped and the matched words are in <b> tags.
+	type Highlight struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
 	type Result struct {
-		ID            string  `json:"id"`
-		Title         string  `json:"title"`
-		Price         float64 `json:"price"`
-		MinDay        int     `json:"min_day"`
-		RentPeriod    int     `json:"rent_period"`
-		CommisionType string  `json:"commision_type"`
-		Address       struct {
+		ID              string          `json:"id"`
+		Title           string          `json:"title"`
+		Price           float64         `json:"price"`
+		Currency        models.Currency `json:"currency"`
+		DisplayPrice    float64         `json:"display_price"`
+		DisplayCurrency models.Currency `json:"display_currency"`
+		MinDay          int             `json:"min_day"`
+		RentPeriod      int             `json:"rent_period"`
+		CommisionType   string          `json:"commision_type"`
+		Address         struct {
 			QuarterID    int    `json:"quarter_id"`
 			QuarterName  string `json:"quarter_name"`
 			DistrictID   int    `json:"district_id"`
@@ -429,8 +829,16 @@ func GetPublicList(c *fiber.Ctx) error {
 			CountryID    int    `json:"country_id"`
 			CountryName  string `json:"country_name"`
 		} `json:"address"`
-		Images   [][]models.RentalHouseImageInfo `json:"images"`
-		Favorite bool                            `json:"favorite"`
+		Images      [][]models.RentalHouseImageInfo `json:"images"`
+		Favorite    bool                            `json:"favorite"`
+		Highlight   *Highlight                      `json:"highlight,omitempty"`
+		Location    *models.GeoPoint                `json:"location"`
+		Distance    *float64                        `json:"distance,omitempty" summary:"km"`
+		Rooms       string                          `json:"rooms"`
+		GrossArea   int                             `json:"gross_area"`
+		Furnished   bool                            `json:"furnished"`
+		Rating      *float64                        `json:"rating"`
+		ReviewCount int                             `json:"review_count"`
 	}
 	type Response struct {
 		Pagination struct {
@@ -451,11 +859,37 @@ func GetPublicList(c *fiber.Ctx) error {
 	if rentalHouseList.TotalCount == 0 {
 		return c.JSON(models.NewResponseOK(&res))
 	}
+	// Get highlighted snippets of the search.
+	var ids []int
+	for _, rentalHouse := range rentalHouseList.Houses {
+		ids = append(ids, rentalHouse.ID)
+	}
+	highlights, err := db.GetRentalHouseHighlights(ids, filter.Search)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	rates := map[models.Currency]float64{}
 	i := 0
 	for _, rentalHouse := range rentalHouseList.Houses {
 		result[i].ID = rentalHouse.UID.String()
 		result[i].Title = rentalHouse.Title
 		result[i].Price = rentalHouse.Price
+		result[i].Currency = rentalHouse.Currency
+		result[i].DisplayPrice = rentalHouse.Price
+		result[i].DisplayCurrency = rentalHouse.Currency
+		if displayCurrency != "" && displayCurrency != rentalHouse.Currency {
+			rate, ok := rates[rentalHouse.Currency]
+			if !ok {
+				rate, err = getExchangeRate(db, rentalHouse.Currency, displayCurrency)
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+				}
+				rates[rentalHouse.Currency] = rate
+			}
+			result[i].DisplayPrice = utils.ConvertPrice(rentalHouse.Price, rate)
+			result[i].DisplayCurrency = displayCurrency
+		}
 		result[i].MinDay = rentalHouse.MinDay
 		result[i].RentPeriod = rentalHouse.RentPeriod
 		result[i].Address.QuarterID = rentalHouse.Quarter.ID
@@ -472,12 +906,21 @@ func GetPublicList(c *fiber.Ctx) error {
 		result[i].CommisionType = rentalHouse.CommisionTypeInfo()
 		fav, _ := db.IsUsersFavorite(user.ID, rentalHouse.ID)
 		result[i].Favorite = fav
+		result[i].Location = rentalHouse.Location
+		result[i].Rooms = rentalHouse.Rooms()
+		result[i].GrossArea = rentalHouse.GrossArea
+		result[i].Furnished = rentalHouse.Furnished
+		result[i].Rating = rentalHouse.Rating
+		result[i].ReviewCount = rentalHouse.ReviewCount
+		if rentalHouse.Distance != nil {
+			distance := math.Round(*rentalHouse.Distance*100) / 100
+			result[i].Distance = &distance
+		}
+		if highlight, ok := highlights[rentalHouse.ID]; ok {
+			result[i].Highlight = &Highlight{Title: highlight.Title, Description: highlight.Description}
+		}
 		for _, image := range rentalHouse.Images {
-			var dt []models.RentalHouseImageInfo
-			for _, imageInfo := range image.Images {
-				dt = append(dt, imageInfo)
-			}
-			result[i].Images = append(result[i].Images, dt)
+			result[i].Images = append(result[i].Images, presentImages(image.Images))
 		}
 		i++
 		if i == limit {
@@ -489,14 +932,250 @@ func GetPublicList(c *fiber.Ctx) error {
 	return c.JSON(models.NewResponseOK(&res))
 }
 
+// GetRentalHouseFacets method
+// @Description Get the facet counts of the public rental house search, all list filters are available.
+// @Description Every facet is counted without its own filter, towns are only counted if city_id is given.
+// @Summary Get rental house search facets
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param price_buckets query int false "Number of the price histogram buckets (max 50)" default(10)
+// @Param currency query string false "Display currency (TRY, EUR, USD), prices are in this currency" default()
+// @Success 200 {object} models.ResponseOK{result=controllers.GetRentalHouseFacets.Response{cities=[]controllers.GetRentalHouseFacets.Facet,price=controllers.GetRentalHouseFacets.Price{buckets=[]controllers.GetRentalHouseFacets.Bucket}}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/facets [get]
+func GetRentalHouseFacets(c *fiber.Ctx) error {
+	priceBuckets := 10
+	if _priceBuckets, err := strconv.Atoi(c.Query("price_buckets")); err == nil && _priceBuckets > 0 && _priceBuckets <= 50 {
+		priceBuckets = _priceBuckets
+	}
+	displayCurrency, err := getDisplayCurrency(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", err.Error()))
+	}
+	filter, err := getRentalHouseFilter(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("filter", err.Error()))
+	}
+	if filter.PriceCurrency == "" {
+		filter.PriceCurrency = displayCurrency
+	}
+	if filter.PriceCurrency == "" {
+		filter.PriceCurrency = models.DefaultCurrency
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Prices of the listings are bucketed in one currency.
+	filter.PriceRates, err = getPriceRates(db, filter.PriceCurrency)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+	}
+
+	facets, err := db.GetRentalHouseFacets(filter, priceBuckets)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Facet struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Count int64  `json:"count"`
+	}
+	type Bucket struct {
+		From  float64 `json:"from"`
+		To    float64 `json:"to"`
+		Count int64   `json:"count"`
+	}
+	type Price struct {
+		Currency models.Currency `json:"currency"`
+		Min      float64         `json:"min"`
+		Max      float64         `json:"max"`
+		Buckets  []Bucket        `json:"buckets"`
+	}
+	type Response struct {
+		Total          int64   `json:"total"`
+		Cities         []Facet `json:"cities"`
+		Towns          []Facet `json:"towns"`
+		RentPeriods    []Facet `json:"rent_periods"`
+		CommisionTypes []Facet `json:"commision_types"`
+		Price          Price   `json:"price"`
+	}
+	res := Response{
+		Total:          facets.Total,
+		Cities:         make([]Facet, 0, len(facets.Cities)),
+		Towns:          make([]Facet, 0, len(facets.Towns)),
+		RentPeriods:    make([]Facet, 0, len(facets.RentPeriods)),
+		CommisionTypes: make([]Facet, 0, len(facets.CommisionTypes)),
+		Price: Price{
+			Currency: filter.PriceCurrency,
+			Min:      utils.RoundPrice(facets.MinPrice),
+			Max:      utils.RoundPrice(facets.MaxPrice),
+			Buckets:  make([]Bucket, 0, len(facets.PriceBuckets)),
+		},
+	}
+	for _, facet := range facets.Cities {
+		res.Cities = append(res.Cities, Facet(facet))
+	}
+	for _, facet := range facets.Towns {
+		res.Towns = append(res.Towns, Facet(facet))
+	}
+	for _, facet := range facets.RentPeriods {
+		res.RentPeriods = append(res.RentPeriods, Facet{ID: facet.ID, Name: models.RentPeriodName(facet.ID), Count: facet.Count})
+	}
+	for _, facet := range facets.CommisionTypes {
+		res.CommisionTypes = append(res.CommisionTypes, Facet{ID: facet.ID, Name: models.CommisionType(facet.ID).Name(), Count: facet.Count})
+	}
+	for _, bucket := range facets.PriceBuckets {
+		res.Price.Buckets = append(res.Price.Buckets, Bucket{From: utils.RoundPrice(bucket.From), To: utils.RoundPrice(bucket.To), Count: bucket.Count})
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetRentalHouseMap method
+// @Description Get lightweight locations of the public rental houses for the map, all list filters are available.
+// @Description If cluster is given, the rental houses are grouped in a grid of the cell size in degrees.
+// @Summary Get rental house locations for the map
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param bbox query string false "Map bounding box, min_lon,min_lat,max_lon,max_lat (bbox or lat/lon is required)" default()
+// @Param lat query number false "Latitude of the location search" default()
+// @Param lon query number false "Longitude of the location search" default()
+// @Param radius query number false "Radius of the location search in km (max 500)" default(10)
+// @Param cluster query number false "Grid cell size in degrees to cluster the results" default()
+// @Param limit query int false "Maximum number of the points (max 1000)" default(500)
+// @Param currency query string false "Display currency (TRY, EUR, USD)" default()
+// @Success 200 {object} models.ResponseOK{result=controllers.GetRentalHouseMap.Response{points=[]controllers.GetRentalHouseMap.Point,clusters=[]controllers.GetRentalHouseMap.Cluster}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/map [get]
+func GetRentalHouseMap(c *fiber.Ctx) error {
+	limit := 500
+	if _limit, err := strconv.Atoi(c.Query("limit")); err == nil && _limit > 0 && _limit <= 1000 {
+		limit = _limit
+	}
+	cluster := 0.0
+	if v := c.Query("cluster"); v != "" {
+		var err error
+		cluster, err = strconv.ParseFloat(v, 64)
+		if err != nil || cluster < 0.0001 || cluster > 10 {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("cluster", "invalid cluster, it must be between 0.0001 and 10 degrees"))
+		}
+	}
+	displayCurrency, err := getDisplayCurrency(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", err.Error()))
+	}
+	filter, err := getRentalHouseFilter(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("filter", err.Error()))
+	}
+	if filter.Bounds == nil && filter.Near == nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("filter", "bbox or lat/lon is required"))
+	}
+	if filter.PriceCurrency == "" {
+		filter.PriceCurrency = displayCurrency
+	}
+	if filter.PriceCurrency == "" {
+		filter.PriceCurrency = models.DefaultCurrency
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Prices are shown and clustered in one currency.
+	filter.PriceRates, err = getPriceRates(db, filter.PriceCurrency)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+	}
+
+	type Point struct {
+		ID           string   `json:"id"`
+		Lat          float64  `json:"lat"`
+		Lon          float64  `json:"lon"`
+		DisplayPrice float64  `json:"display_price"`
+		Distance     *float64 `json:"distance,omitempty" summary:"km"`
+	}
+	type Cluster struct {
+		Lat      float64 `json:"lat"`
+		Lon      float64 `json:"lon"`
+		Count    int64   `json:"count"`
+		MinPrice float64 `json:"min_price"`
+		MaxPrice float64 `json:"max_price"`
+	}
+	type Response struct {
+		DisplayCurrency models.Currency `json:"display_currency"`
+		Points          []Point         `json:"points"`
+		Clusters        []Cluster       `json:"clusters"`
+		Truncated       bool            `json:"truncated"`
+	}
+	res := Response{
+		DisplayCurrency: filter.PriceCurrency,
+		Points:          make([]Point, 0),
+		Clusters:        make([]Cluster, 0),
+	}
+
+	if cluster > 0 {
+		clusters, err := db.GetRentalHouseMapClusters(&filter, cluster)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		for _, cl := range clusters {
+			res.Clusters = append(res.Clusters, Cluster{
+				Lat:      cl.Lat,
+				Lon:      cl.Lon,
+				Count:    cl.Count,
+				MinPrice: utils.RoundPrice(cl.MinPrice),
+				MaxPrice: utils.RoundPrice(cl.MaxPrice),
+			})
+		}
+		return c.JSON(models.NewResponseOK(&res))
+	}
+
+	points, truncated, err := db.GetRentalHouseMapPoints(&filter, limit)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	res.Truncated = truncated
+	for _, point := range points {
+		p := Point{
+			ID:           point.UID.String(),
+			Lat:          point.Lat,
+			Lon:          point.Lon,
+			DisplayPrice: utils.ConvertPrice(point.Price, filter.PriceRates[point.Currency]),
+		}
+		if point.Distance != nil {
+			distance := math.Round(*point.Distance*100) / 100
+			p.Distance = &distance
+		}
+		res.Points = append(res.Points, p)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
 // UploadRentalHouseImage method
-// @Description Upload rental house image
+// @Description Upload rental house image, the image is processed in the background. It can be added to a rental house after its status is ready, see /rental-house/image/{id}
 // @Summary Upload rental house image
 // @Tags Rental House
 // @Accept multipart/form-data
 // @Produce json
 // @Param image formData file true "Image file"
-// @Success 200 {object} models.ResponseOK{result=controllers.UploadRentalHouseImage.Result}
+// @Success 202 {object} models.ResponseOK{result=controllers.UploadRentalHouseImage.Result}
 // @Failure 404 {object} models.ResponseErr
 // @Failure 400 {object} models.ResponseErr
 // @Failure 500 {object} models.ResponseErr
@@ -504,8 +1183,9 @@ func GetPublicList(c *fiber.Ctx) error {
 // @Router /rental-house/upload-image [post]
 func UploadRentalHouseImage(c *fiber.Ctx) error {
 	type Result struct {
-		ID     uuid.UUID `json:"id"`
-		Images []models.RentalHouseImageInfo
+		ID     uuid.UUID                     `json:"id"`
+		Status models.ImageStatus            `json:"status" summary:"1 = ready, 2 = processing, 3 = failed"`
+		Images []models.RentalHouseImageInfo `json:"images" summary:"empty while processing"`
 	}
 
 	// Create database connection.
@@ -518,67 +1198,64 @@ func UploadRentalHouseImage(c *fiber.Ctx) error {
 	user2 := c.Locals("user").(models.User)
 
 	if form, err := c.MultipartForm(); err == nil {
-		// Get all files from form field "images".
-		file := form.File["image"][0]
-
-		// Is file image?
-		if !strings.HasPrefix(file.Header["Content-Type"][0], "image/") {
-			return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage))
-		}
-
-		// Get file extension.
-		f, ee := file.Open()
-		if ee != nil {
-			// File not found or cannot be opened.
-			return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage))
+		// Check the image, the format is detected from the content.
+		upload, err := utils.ValidateImageUpload(form, "image", utils.RentalHouseImageLimits())
+		if err != nil {
+			return imageUploadError(c, err)
 		}
+		file := upload.File
 
-		// Get file content type and check if it is a valid image.
-		contentType, err := utils.GetFileContentType(f)
-		if err != nil || contentType != file.Header.Get("Content-type") {
-			return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage))
+		// Store the raw upload, the variants are created by the image workers.
+		uploads, err := storage.NewUploadStorage()
+		if err != nil {
+			return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("storage", err.Error()))
 		}
-		if !utils.ValidImageContentType(file.Header.Get("Content-type")) {
-			return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage))
+		imageId := uuid.New()
+		sourceKey := utils.ImageKey(utils.RentalHouseUploadPrefix, imageId.String())
+		f, err := file.Open()
+		if err != nil {
+			return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage))
 		}
-
-		// Close file.
+		err = uploads.Put(sourceKey, f, file.Size, upload.ContentType)
 		f.Close()
-
-		// Create files.
-		images, err := utils.CreateImageFile(file, "public/photos/rental-house")
-		if err != nil || len(images) == 0 {
-			return c.Status(errs.ErrImageProc.StatusCode).JSON(models.NewResponseError(errs.ErrImageProc).SetHeader("image", err.Error()))
-		}
-
-		// Create result
-		result := Result{
-			ID:     images[0].ID,
-			Images: make([]models.RentalHouseImageInfo, len(images)),
-		}
-		for i, image := range images {
-			result.Images[i].URL = fmt.Sprintf("%s/photos/rental-house/%s", os.Getenv("API_URL"), image.Filename)
-			result.Images[i].Width = image.Width
-			result.Images[i].Height = image.Height
+		if err != nil {
+			return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("storage", err.Error()))
 		}
 
-		// Insert image to database.
+		// Insert image to database, it is queued again if it is not processed in time.
+		nextAttemptAt := time.Now().Add(jobs.ImageProcessingTimeout)
 		rentalHouseImage := models.RentalHouseImage{
-			ID:        images[0].ID,
-			CreatorID: user2.ID,
-			Expire:    time.Now().AddDate(0, 0, 1),
-			Images:    result.Images,
+			ID:            imageId,
+			CreatorID:     user2.ID,
+			Expire:        time.Now().AddDate(0, 0, 1),
+			Images:        models.RentalHouseImagesArray{},
+			Status:        models.IMAGE_STATUS_PROCESSING,
+			SourceKey:     sourceKey,
+			NextAttemptAt: &nextAttemptAt,
 		}
 
 		// Insert rental house image to database.
 		err = db.CreateRentalHouseImage(&rentalHouseImage)
 		if err != nil {
+			uploads.Delete(sourceKey)
 			// Return status 500 and error message.
 			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 		}
 
-		// Return status 200 OK.
-		return c.JSON(models.NewResponseOK(&result))
+		// Add image to processing queue.
+		err = jobs.EnqueueImageProcessing(imageId)
+		if err != nil {
+			db.SetRentalHouseImageAttempt(imageId, 0, models.IMAGE_STATUS_FAILED, err.Error(), nil)
+			uploads.Delete(sourceKey)
+			return c.Status(errs.ErrImageProc.StatusCode).JSON(models.NewResponseError(errs.ErrImageProc).SetHeader("queue", err.Error()))
+		}
+
+		// Return status 202 Accepted.
+		return c.Status(fiber.StatusAccepted).JSON(models.NewResponseOK(&Result{
+			ID:     imageId,
+			Status: rentalHouseImage.Status,
+			Images: []models.RentalHouseImageInfo{},
+		}))
 	}
 	return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest))
 }
@@ -590,6 +1267,7 @@ func UploadRentalHouseImage(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param id path string true "Rental house ID"
+// @Param currency query string false "Display currency (TRY, EUR, USD)" default()
 // @Success 200 {object} models.ResponseOK{result=controllers.GetDetails.Result{creator=controllers.GetDetails.Creator}}
 // @Failure 404 {object} models.ResponseErr
 // @Failure 400 {object} models.ResponseErr
@@ -606,6 +1284,11 @@ func GetDetails(c *fiber.Ctx) error {
 		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
 	}
 
+	displayCurrency, err := getDisplayCurrency(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", err.Error()))
+	}
+
 	// Create database connection.
 	db, err := database.OpenDBConnection()
 	if err != nil {
@@ -620,7 +1303,7 @@ func GetDetails(c *fiber.Ctx) error {
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
 
-	if rentalHouse.Published == false && rentalHouse.CreatorID != user.ID {
+	if !rentalHouse.IsPublic() && rentalHouse.CreatorID != user.ID && !user.IsModerator() {
 		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
 	}
 
@@ -628,44 +1311,89 @@ func GetDetails(c *fiber.Ctx) error {
 		ID           string  `json:"id"`
 		FirstName    string  `json:"first_name"`
 		LastName     string  `json:"last_name"`
-		Email        string  `json:"email"`
-		Phone        string  `json:"phone"`
+		Email        string  `json:"email" summary:"empty until a reservation is paid"`
+		Phone        string  `json:"phone" summary:"empty until a reservation is paid"`
 		ProfileImage *string `json:"profile_image"`
 	}
 
 	type Result struct {
-		ID            string                          `json:"id"`
-		Title         string                          `json:"title"`
-		Price         float64                         `json:"price"`
-		MinDay        int                             `json:"min_day"`
-		RentPeriod    int                             `json:"rent_period"`
-		CommisionType string                          `json:"commision_type"`
-		Address       models.Quarter                  `json:"address"`
-		Images        [][]models.RentalHouseImageInfo `json:"images"`
-		Description   string                          `json:"description"`
-		Published     bool                            `json:"published"`
-		Creator       interface{}                     `json:"creator"`
+		ID              string                          `json:"id"`
+		Title           string                          `json:"title"`
+		Price           float64                         `json:"price"`
+		Currency        models.Currency                 `json:"currency"`
+		DisplayPrice    float64                         `json:"display_price"`
+		DisplayCurrency models.Currency                 `json:"display_currency"`
+		MinDay          int                             `json:"min_day"`
+		RentPeriod      int                             `json:"rent_period"`
+		CommisionType   string                          `json:"commision_type"`
+		ListingType     string                          `json:"listing_type"`
+		Address         models.Quarter                  `json:"address"`
+		Images          [][]models.RentalHouseImageInfo `json:"images"`
+		Photos          []RentalHousePhoto              `json:"photos" summary:"images with ids, for the image management"`
+		Description     string                          `json:"description"`
+		Published       bool                            `json:"published"`
+		Location        *models.GeoPoint                `json:"location"`
+		Attributes      RentalHouseAttributes           `json:"attributes"`
+		Moderation      *RentalHouseModeration          `json:"moderation,omitempty" summary:"only for the owner and the moderators"`
+		Rating          *float64                        `json:"rating"`
+		ReviewCount     int                             `json:"review_count"`
+		CategoryRatings models.ReviewRatings            `json:"category_ratings"`
+		Creator         interface{}                     `json:"creator"`
 	}
 
 	creator := Creator{
 		ID:        rentalHouse.CreatorID.String(),
 		FirstName: rentalHouse.Creator.FirstName,
 		LastName:  rentalHouse.Creator.LastName,
-		Email:     rentalHouse.Creator.Email,
-		Phone:     rentalHouse.Creator.PhoneNumber,
+	}
+
+	// The contact information of the owner is given after a reservation is paid, the renters use the messages before.
+	contactUnlocked := rentalHouse.CreatorID == user.ID || user.IsModerator()
+	if !contactUnlocked {
+		contactUnlocked, err = db.HasPaidReservation(user.ID, rentalHouse.ID)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+	}
+	if contactUnlocked {
+		creator.Email = rentalHouse.Creator.Email
+		creator.Phone = rentalHouse.Creator.PhoneNumber
 	}
 
 	result := Result{
-		ID:            rentalHouse.UID.String(),
-		Title:         rentalHouse.Title,
-		Price:         rentalHouse.Price,
-		MinDay:        rentalHouse.MinDay,
-		RentPeriod:    rentalHouse.RentPeriod,
-		CommisionType: rentalHouse.CommisionTypeInfo(),
-		Address:       rentalHouse.Quarter,
-		Images:        make([][]models.RentalHouseImageInfo, len(rentalHouse.Images)),
-		Description:   rentalHouse.Description,
-		Published:     rentalHouse.Published,
+		ID:              rentalHouse.UID.String(),
+		Title:           rentalHouse.Title,
+		Price:           rentalHouse.Price,
+		Currency:        rentalHouse.Currency,
+		DisplayPrice:    rentalHouse.Price,
+		DisplayCurrency: rentalHouse.Currency,
+		MinDay:          rentalHouse.MinDay,
+		RentPeriod:      rentalHouse.RentPeriod,
+		CommisionType:   rentalHouse.CommisionTypeInfo(),
+		ListingType:     rentalHouse.ListingType.Name(),
+		Address:         rentalHouse.Quarter,
+		Images:          make([][]models.RentalHouseImageInfo, len(rentalHouse.Images)),
+		Photos:          newRentalHousePhotos(rentalHouse.Images),
+		Description:     rentalHouse.Description,
+		Published:       rentalHouse.Published,
+		Location:        rentalHouse.Location,
+		Attributes:      newRentalHouseAttributes(&rentalHouse),
+		Rating:          rentalHouse.Rating,
+		ReviewCount:     rentalHouse.ReviewCount,
+		CategoryRatings: rentalHouse.CategoryRatings,
+	}
+	if rentalHouse.CreatorID == user.ID || user.IsModerator() {
+		result.Moderation = newRentalHouseModeration(&rentalHouse, user.IsModerator())
+	}
+
+	// Convert price to display currency.
+	if displayCurrency != "" && displayCurrency != rentalHouse.Currency {
+		rate, err := getExchangeRate(db, rentalHouse.Currency, displayCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+		}
+		result.DisplayPrice = utils.ConvertPrice(rentalHouse.Price, rate)
+		result.DisplayCurrency = displayCurrency
 	}
 
 	if rentalHouse.Creator.ProfileImage != nil {
@@ -673,6 +1401,7 @@ func GetDetails(c *fiber.Ctx) error {
 		images := profileImage.Images
 		if len(images) > 0 {
 			lastItem := images[len(images)-1]
+			lastItem.URL = storage.PresentURL(lastItem.URL)
 			creator.ProfileImage = &lastItem.URL
 		}
 	}
@@ -681,9 +1410,11 @@ func GetDetails(c *fiber.Ctx) error {
 	for i, images := range rentalHouse.Images {
 		result.Images[i] = make([]models.RentalHouseImageInfo, len(images.Images))
 		for j, image := range images.Images {
-			result.Images[i][j].URL = image.URL
+			result.Images[i][j].URL = storage.PresentURL(image.URL)
 			result.Images[i][j].Width = image.Width
 			result.Images[i][j].Height = image.Height
+			result.Images[i][j].Format = image.Format
+			result.Images[i][j].Blurhash = image.Blurhash
 		}
 	}
 
@@ -692,7 +1423,7 @@ func GetDetails(c *fiber.Ctx) error {
 }
 
 // EditRentalHouse method
-// @Description Edit rental house
+// @Description Edit rental house, the approved or rejected rental house is reviewed again if the title, the description or the images change
 // @Summary Edit rental house
 // @Tags Rental House
 // @Accept json
@@ -716,14 +1447,26 @@ func EditRentalHouse(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	type Request struct {
-		Title       *string  `json:"title" example:"My rental house" required:"false"`
-		Description *string  `json:"description" example:"3 rooms, 2 bathrooms, 1 kitchen, 1 living room" required:"false"`
-		QuarterID   *int     `json:"quarter_id" example:"1" required:"false"`
-		RentPeriod  *int     `json:"rent_period" example:"1" summary:"1 = daily, 2 = monthly, 3 = yearly" required:"false,min=1,max=3"`
-		Price       *float64 `json:"price" example:"100.00" required:"true"`
-		MinDay      *int     `json:"min_day" example:"1"`
-		Lat         *string  `json:"g_coordinate,omitempty"`
-		Published   *bool    `json:"published" example:"true" required:"false"`
+		Title       *string             `json:"title" example:"My rental house" required:"false"`
+		Description *string             `json:"description" example:"3 rooms, 2 bathrooms, 1 kitchen, 1 living room" required:"false"`
+		QuarterID   *int                `json:"quarter_id" example:"1" required:"false"`
+		RentPeriod  *int                `json:"rent_period" example:"1" summary:"1 = daily, 2 = monthly, 3 = yearly" required:"false,min=1,max=3"`
+		Price       *float64            `json:"price" example:"100.00" required:"true"`
+		Currency    *string             `json:"currency" example:"TRY" summary:"TRY, EUR, USD" required:"false"`
+		ListingType *models.ListingType `json:"listing_type" example:"0" summary:"0 = residential, 1 = commercial" validate:"omitempty,max=1" required:"false"`
+		MinDay      *int                `json:"min_day" example:"1"`
+		Lat         *string             `json:"g_coordinate,omitempty"`
+		Published   *bool               `json:"published" example:"true" required:"false"`
+		Rooms       *string             `json:"rooms" example:"2+1" summary:"rooms and living rooms" required:"false"`
+		GrossArea   *int                `json:"gross_area" example:"110" summary:"m²" validate:"omitempty,min=0,max=100000" required:"false"`
+		NetArea     *int                `json:"net_area" example:"95" summary:"m²" validate:"omitempty,min=0,max=100000" required:"false"`
+		Floor       *int                `json:"floor" example:"3" validate:"omitempty,min=-5,max=200" required:"false"`
+		BuildingAge *int                `json:"building_age" example:"5" validate:"omitempty,min=0,max=500" required:"false"`
+		HeatingType *models.HeatingType `json:"heating_type" example:"1" summary:"0 = none, 1 = combi, 2 = central, 3 = floor, 4 = air conditioner, 5 = stove" validate:"omitempty,max=5" required:"false"`
+		Furnished   *bool               `json:"furnished" example:"false" required:"false"`
+		MaxGuests   *int                `json:"max_guests" example:"4" validate:"omitempty,min=0,max=50" required:"false"`
+		AmenityIDs  *[]int              `json:"amenity_ids" example:"1,2" summary:"replaces the amenities" required:"false"`
+		ImageUUIDs  []string            `json:"imageUUIDs" swaggertype:"array,string" example:"" summary:"new uploaded images to add" required:"false"`
 	}
 
 	// Parse request body.
@@ -758,6 +1501,13 @@ func EditRentalHouse(c *fiber.Ctx) error {
 		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
 	}
 
+	// The saved searches are alerted if the rental house becomes public or gets cheaper.
+	wasPublic, oldPrice, oldCurrency := rentalHouse.IsPublic(), rentalHouse.Price, rentalHouse.Currency
+
+	// Changes of the title, the description or the images are reviewed again.
+	contentChanged := (body.Title != nil && *body.Title != "" && *body.Title != rentalHouse.Title) ||
+		(body.Description != nil && *body.Description != "" && *body.Description != rentalHouse.Description)
+
 	// Check not nil fields and non empty fields.
 	if body.Title != nil && *body.Title != "" {
 		rentalHouse.Title = *body.Title
@@ -777,16 +1527,113 @@ func EditRentalHouse(c *fiber.Ctx) error {
 	if body.Price != nil && *body.Price != 0 {
 		rentalHouse.Price = *body.Price
 	}
+	if body.Currency != nil && *body.Currency != "" {
+		currency, ok := models.ParseCurrency(*body.Currency)
+		if !ok {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", "unsupported currency"))
+		}
+		rentalHouse.Currency = currency
+	}
+	if body.ListingType != nil {
+		rentalHouse.ListingType = *body.ListingType
+	}
 	if body.MinDay != nil && *body.MinDay > 0 {
 		rentalHouse.MinDay = *body.MinDay
 	}
 	if body.Lat != nil && *body.Lat != "" {
-		rentalHouse.GCoordinate = *body.Lat
+		point, ok := models.ParseGCoordinate(*body.Lat)
+		if !ok {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("g_coordinate", "invalid coordinate, (lat,lon) expected"))
+		}
+		rentalHouse.GCoordinate = fmt.Sprintf("(%f,%f)", point.Lat, point.Lon)
+	}
+
+	if body.Rooms != nil {
+		if *body.Rooms == "" {
+			rentalHouse.RoomCount, rentalHouse.LivingRoomCount = 0, 0
+		} else {
+			var ok bool
+			rentalHouse.RoomCount, rentalHouse.LivingRoomCount, ok = models.ParseRooms(*body.Rooms)
+			if !ok {
+				return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("rooms", "invalid rooms, N+M expected"))
+			}
+		}
+	}
+	if body.GrossArea != nil {
+		rentalHouse.GrossArea = *body.GrossArea
+	}
+	if body.NetArea != nil {
+		rentalHouse.NetArea = *body.NetArea
+	}
+	if rentalHouse.GrossArea > 0 && rentalHouse.NetArea > rentalHouse.GrossArea {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("net_area", "net area can not be greater than gross area"))
+	}
+	if body.Floor != nil {
+		rentalHouse.Floor = body.Floor
+	}
+	if body.BuildingAge != nil {
+		rentalHouse.BuildingAge = body.BuildingAge
+	}
+	if body.HeatingType != nil {
+		rentalHouse.HeatingType = *body.HeatingType
+	}
+	if body.Furnished != nil {
+		rentalHouse.Furnished = *body.Furnished
+	}
+	if body.MaxGuests != nil {
+		rentalHouse.MaxGuests = *body.MaxGuests
+	}
+
+	// Validate the amenities before the rental house is updated.
+	var amenities []models.Amenity
+	if body.AmenityIDs != nil {
+		var ok bool
+		amenities, ok, err = getAmenities(db, *body.AmenityIDs)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		if !ok {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("amenity_ids", "invalid amenity id"))
+		}
 	}
 
-	// Update rental house.
-	err = db.UpdateRentalHouse(&rentalHouse)
+	// Update rental house with its amenities and new images, the changed content is sent to review in the same transaction
+	// so the approved listing is not public with the content which is not reviewed.
+	err = db.WithTransaction(func(tx *database.Queries) error {
+		if err := tx.LockRentalHouseModeration(&rentalHouse); err != nil {
+			return err
+		}
+		if err := tx.UpdateRentalHouse(&rentalHouse); err != nil {
+			return err
+		}
+
+		// Replace the amenities.
+		if body.AmenityIDs != nil {
+			if err := tx.SetRentalHouseAmenities(&rentalHouse, amenities); err != nil {
+				return err
+			}
+		}
+
+		// Add the new images.
+		images, err := tx.AttachRentalHouseImages(rentalHouse.ID, user.ID, body.ImageUUIDs)
+		if err != nil {
+			return err
+		}
+		if len(images) > 0 {
+			contentChanged = true
+		}
+
+		if contentChanged && rentalHouse.ModerationStatus != models.MODERATION_STATUS_DRAFT {
+			if err := submitRentalHouse(tx, &rentalHouse); err != nil {
+				return err
+			}
+		}
+		return recordListingEvent(tx, &rentalHouse, wasPublic, oldPrice, oldCurrency)
+	})
 	if err != nil {
+		if errors.Is(err, queries.ErrRentalHouseImagesNotFound) {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+		}
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
 
@@ -890,7 +1737,7 @@ func FavoriteRentalHouse(c *fiber.Ctx) error {
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
 
-	if rentalHouse.Published == false && rentalHouse.CreatorID != user.ID {
+	if !rentalHouse.IsPublic() && rentalHouse.CreatorID != user.ID {
 		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
 	}
 
@@ -954,7 +1801,7 @@ func UnfavoriteRentalHouse(c *fiber.Ctx) error {
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
 
-	if rentalHouse.Published == false && rentalHouse.CreatorID != user.ID {
+	if !rentalHouse.IsPublic() && rentalHouse.CreatorID != user.ID {
 		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
 	}
 
@@ -977,3 +1824,236 @@ func UnfavoriteRentalHouse(c *fiber.Ctx) error {
 	// Return status 200 OK.
 	return c.JSON(models.NewResponseOK("OK"))
 }
+
+// DeleteRentalHouse method
+// @Description Archive the rental house. Pending and paid reservations are cancelled and refunded, the favorites are removed.
+// @Description If the rental house has accepted reservations which are not ended, confirm=true is required, they are kept.
+// @Summary Delete (archive) rental house
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param confirm query bool false "Archive even if there are accepted reservations" default(false)
+// @Success 200 {object} models.ResponseOK{result=controllers.DeleteRentalHouse.Response}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 409 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id} [delete]
+func DeleteRentalHouse(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+	confirm := false
+	if v := c.Query("confirm"); v != "" {
+		if confirm, err = strconv.ParseBool(v); err != nil {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("confirm", "invalid confirm"))
+		}
+	}
+
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+
+	reservations, err := db.GetActiveReservationsByRentalHouseID(rentalHouse.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Response struct {
+		Archived              bool `json:"archived"`
+		CancelledReservations int  `json:"cancelled_reservations"`
+		RefundedReservations  int  `json:"refunded_reservations"`
+		KeptReservations      int  `json:"kept_reservations" summary:"accepted reservations, they continue"`
+	}
+	res := Response{}
+
+	// The accepted reservations are paid to the owner, they are not cancelled.
+	for _, reservation := range reservations {
+		if reservation.Status == models.RESERVATION_STATUS_ACCEPTED {
+			res.KeptReservations++
+		}
+	}
+	if res.KeptReservations > 0 && !confirm {
+		return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("rental house has accepted reservations, confirm=true is required")).SetHeader("accepted_reservations", strconv.Itoa(res.KeptReservations)))
+	}
+
+	// Cancel the pending and paid reservations.
+	for i := range reservations {
+		if reservations[i].Status == models.RESERVATION_STATUS_ACCEPTED {
+			continue
+		}
+		refunded, err := cancelReservation(db, &reservations[i])
+		if err != nil {
+			if errors.Is(err, errPaymentProvider) {
+				return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("refund failed")).SetHeader("stripe", err.Error()))
+			}
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		res.CancelledReservations++
+		if refunded {
+			res.RefundedReservations++
+		}
+	}
+
+	err = db.ArchiveRentalHouse(&rentalHouse)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	res.Archived = true
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetArchivedList method
+// @Description Get user's archived rental houses, the last archived is the first
+// @Summary Get user's archived rental houses
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Limit number" default(10)
+// @Success 200 {object} models.ResponseOK{result=controllers.GetArchivedList.Response{results=[]controllers.GetArchivedList.Result}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/archived-list [get]
+func GetArchivedList(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	pagination := models.Pagination{Page: 1, Limit: 10}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		pagination.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 100 {
+		pagination.Limit = limit
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouseList, err := db.GetRentalHouseArchivedList(user.ID, &pagination)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Result struct {
+		ID         string                          `json:"id"`
+		Title      string                          `json:"title"`
+		Price      float64                         `json:"price"`
+		Currency   models.Currency                 `json:"currency"`
+		RentPeriod int                             `json:"rent_period"`
+		CityName   string                          `json:"city_name"`
+		TownName   string                          `json:"town_name"`
+		Images     [][]models.RentalHouseImageInfo `json:"images"`
+		ArchivedAt time.Time                       `json:"archived_at"`
+	}
+	type Response struct {
+		Pagination struct {
+			TotalCount int64 `json:"total_count"`
+			FullCount  int64 `json:"full_count"`
+			NextPage   bool  `json:"next_page"`
+			PrevPage   bool  `json:"prev_page"`
+		} `json:"pagination"`
+		Results []Result `json:"results"`
+	}
+	res := Response{Results: make([]Result, 0, len(rentalHouseList.Houses))}
+	res.Pagination.FullCount = rentalHouseList.FullCount
+	res.Pagination.TotalCount = rentalHouseList.TotalCount
+	res.Pagination.NextPage = rentalHouseList.NextPage
+	res.Pagination.PrevPage = rentalHouseList.PrevPage
+	for _, rentalHouse := range rentalHouseList.Houses {
+		result := Result{
+			ID:         rentalHouse.UID.String(),
+			Title:      rentalHouse.Title,
+			Price:      rentalHouse.Price,
+			Currency:   rentalHouse.Currency,
+			RentPeriod: rentalHouse.RentPeriod,
+			CityName:   rentalHouse.Quarter.District.Town.City.Name,
+			TownName:   rentalHouse.Quarter.District.Town.Name,
+			Images:     make([][]models.RentalHouseImageInfo, 0, len(rentalHouse.Images)),
+			ArchivedAt: rentalHouse.DeletedAt.Time,
+		}
+		for _, image := range rentalHouse.Images {
+			result.Images = append(result.Images, presentImages(image.Images))
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// RestoreRentalHouse method
+// @Description Restore the archived rental house, it is restored as unpublished
+// @Summary Restore archived rental house
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Success 200 {object} models.ResponseOK{result=controllers.RentalHouseModeration}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id}/restore [post]
+func RestoreRentalHouse(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetArchivedRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+
+	err = db.RestoreRentalHouse(&rentalHouse)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHouseModeration(&rentalHouse, false)))
+}
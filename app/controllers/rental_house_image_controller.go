@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+)
+
+type RentalHousePhoto struct {
+	ID           uuid.UUID                     `json:"id"`
+	MainPhoto    bool                          `json:"main_photo"`
+	DisplayOrder int                           `json:"display_order"`
+	Src          string                        `json:"src" summary:"jpeg fallback for the img tag"`
+	Width        uint                          `json:"width" summary:"size of the original image"`
+	Height       uint                          `json:"height"`
+	Blurhash     string                        `json:"blurhash,omitempty"`
+	Sources      []RentalHousePhotoSource      `json:"sources" summary:"srcset of each format, the most efficient is the first"`
+	Images       []models.RentalHouseImageInfo `json:"images"`
+}
+
+type RentalHousePhotoSource struct {
+	Type   string `json:"type" example:"image/webp"`
+	SrcSet string `json:"srcset" example:"https://api.e-kira.tk/photos/rental-house/00000000-0000-0000-0000-000000000000-320x240.webp 320w"`
+}
+
+// photoFormats are the formats of the sources, the browsers use the first format they support.
+var photoFormats = []string{"avif", "webp", "jpeg"}
+
+// photoFallbackWidth is the largest jpeg width for the src of the photos.
+const photoFallbackWidth = 1280
+
+// newRentalHousePhotos returns the photos in the given order, the images are preloaded with the main photo first.
+func newRentalHousePhotos(images []models.RentalHouseImage) []RentalHousePhoto {
+	photos := make([]RentalHousePhoto, len(images))
+	for i, image := range images {
+		infos := presentImages(image.Images)
+		sort.SliceStable(infos, func(a, b int) bool { return infos[a].Width < infos[b].Width })
+		photo := RentalHousePhoto{
+			ID:           image.ID,
+			MainPhoto:    image.MainPhoto,
+			DisplayOrder: image.DisplayOrder,
+			Sources:      []RentalHousePhotoSource{},
+			Images:       infos,
+		}
+		for _, info := range infos {
+			if info.Width >= photo.Width {
+				photo.Width = info.Width
+				photo.Height = info.Height
+			}
+			if photo.Blurhash == "" {
+				photo.Blurhash = info.Blurhash
+			}
+			if info.ImageFormat() == "jpeg" && (photo.Src == "" || info.Width <= photoFallbackWidth) {
+				photo.Src = info.URL
+			}
+		}
+		for _, format := range photoFormats {
+			var srcSet []string
+			for _, info := range infos {
+				if info.ImageFormat() == format {
+					srcSet = append(srcSet, fmt.Sprintf("%s %dw", info.URL, info.Width))
+				}
+			}
+			if len(srcSet) > 0 {
+				photo.Sources = append(photo.Sources, RentalHousePhotoSource{Type: "image/" + format, SrcSet: strings.Join(srcSet, ", ")})
+			}
+		}
+		photos[i] = photo
+	}
+	return photos
+}
+
+// presentImages returns a copy of the image infos with the urls to show to the clients, see storage.PresentURL.
+func presentImages(images []models.RentalHouseImageInfo) []models.RentalHouseImageInfo {
+	result := make([]models.RentalHouseImageInfo, len(images))
+	for i, image := range images {
+		result[i] = image
+		result[i].URL = storage.PresentURL(image.URL)
+	}
+	return result
+}
+
+// imageUploadError returns the reason of the rejected image upload with errs.ErrInvalidImage.
+func imageUploadError(c *fiber.Ctx, err error) error {
+	var uploadErr *utils.ImageUploadError
+	if errors.As(err, &uploadErr) {
+		return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage).SetHeader("image", uploadErr.Reason))
+	}
+	return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("image", err.Error()))
+}
+
+// AddRentalHouseImages method
+// @Description Add the uploaded images to the rental house after the current images, an approved rental house is reviewed again
+// @Summary Add images to rental house
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param body body controllers.AddRentalHouseImages.Request true "Images"
+// @Success 200 {object} models.ResponseOK{result=[]controllers.RentalHousePhoto}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id}/images [post]
+func AddRentalHouseImages(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		ImageIDs []string `json:"image_ids" validate:"required,min=1,max=30,dive,uuid" summary:"ids of the uploaded images"`
+	}
+	var body Request
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+
+	_, err = db.AttachRentalHouseImages(rentalHouse.ID, user.ID, body.ImageIDs)
+	if err != nil {
+		if errors.Is(err, queries.ErrRentalHouseImagesNotFound) {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// New images are reviewed again.
+	if rentalHouse.ModerationStatus != models.MODERATION_STATUS_DRAFT {
+		err = submitRentalHouse(db, &rentalHouse)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+	}
+
+	allImages, err := db.GetRentalHouseImagesByRentalHouseID(rentalHouse.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHousePhotos(allImages)))
+}
+
+// SetRentalHouseImageOrder method
+// @Description Save the display order of the rental house images, all image ids of the rental house are required
+// @Summary Reorder rental house images
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param body body controllers.SetRentalHouseImageOrder.Request true "Order"
+// @Success 200 {object} models.ResponseOK{result=[]controllers.RentalHousePhoto}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id}/images/order [put]
+func SetRentalHouseImageOrder(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		ImageIDs []uuid.UUID `json:"image_ids" validate:"required,min=1" swaggertype:"array,string"`
+	}
+	var body Request
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+
+	// The order must have every image of the rental house once.
+	current := map[uuid.UUID]bool{}
+	for _, image := range rentalHouse.Images {
+		current[image.ID] = true
+	}
+	if len(body.ImageIDs) != len(current) {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("image_ids", "all images of the rental house are required"))
+	}
+	for _, imageId := range body.ImageIDs {
+		if !current[imageId] {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("image_ids", "invalid or repeated image id: "+imageId.String()))
+		}
+		delete(current, imageId)
+	}
+
+	err = db.SetRentalHouseImageOrder(rentalHouse.ID, body.ImageIDs)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	images, err := db.GetRentalHouseImagesByRentalHouseID(rentalHouse.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHousePhotos(images)))
+}
+
+// SetRentalHouseMainImage method
+// @Description Set the main photo of the rental house, it is the first image of the lists and the details
+// @Summary Set main photo of rental house
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param imageId path string true "Image ID"
+// @Success 200 {object} models.ResponseOK{result=[]controllers.RentalHousePhoto}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id}/images/{imageId}/main [put]
+func SetRentalHouseMainImage(c *fiber.Ctx) error {
+	id := c.Params("id")
+	imageId := c.Params("imageId")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+	err = validate.Var(imageId, "required,uuid")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("imageId", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if rentalHouse.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+	if rentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+
+	found := false
+	for _, image := range rentalHouse.Images {
+		if image.ID.String() == imageId {
+			found = true
+		}
+	}
+	if !found {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+	}
+
+	err = db.SetRentalHouseMainImage(rentalHouse.ID, uuid.MustParse(imageId))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	images, err := db.GetRentalHouseImagesByRentalHouseID(rentalHouse.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHousePhotos(images)))
+}
+
+// DeleteRentalHouseImage method
+// @Description Delete the image and its files from the rental house, the next image is the main photo if the main photo is deleted
+// @Summary Delete rental house image
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param imageId path string true "Image ID"
+// @Success 200 {object} models.ResponseOK{result=[]controllers.RentalHousePhoto}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 403 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/{id}/images/{imageId} [delete]
+func DeleteRentalHouseImage(c *fiber.Ctx) error {
+	id := c.Params("id")
+	imageId := c.Params("imageId")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid4")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+	err = validate.Var(imageId, "required,uuid")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("imageId", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	image, err := db.GetRentalHouseImageByID(imageId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if image.RentalHouse == nil || image.RentalHouse.UID.String() != id {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+	}
+	if image.RentalHouse.CreatorID != user.ID {
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+
+	err = db.DeleteRentalHouseImage(&image)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// The record is deleted, the files left behind are only logged.
+	urls := make([]string, len(image.Images))
+	for i, info := range image.Images {
+		urls[i] = info.URL
+	}
+	store, err := storage.NewStorage()
+	if err == nil {
+		err = utils.RemoveImageFiles(store, utils.RentalHouseImagePrefix, urls...)
+	}
+	if err != nil {
+		fmt.Println("Rental house image files cannot be removed:", err)
+	}
+
+	images, err := db.GetRentalHouseImagesByRentalHouseID(*image.RentalHouseID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(newRentalHousePhotos(images)))
+}
+
+// GetRentalHouseImageStatus method
+// @Description Get the processing status of the uploaded image, the images are ready to add to the rental houses after processing
+// @Summary Get uploaded image status
+// @Tags Rental House
+// @Accept json
+// @Produce json
+// @Param id path string true "Image ID"
+// @Success 200 {object} models.ResponseOK{result=controllers.GetRentalHouseImageStatus.Result}
+// @Failure 404 {object} models.ResponseErr
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /rental-house/image/{id} [get]
+func GetRentalHouseImageStatus(c *fiber.Ctx) error {
+	id := c.Params("id")
+	validate := validator.New()
+	err := validate.Var(id, "required,uuid")
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	user := c.Locals("user").(models.User)
+
+	type Result struct {
+		ID     uuid.UUID                     `json:"id"`
+		Status models.ImageStatus            `json:"status" summary:"1 = ready, 2 = processing, 3 = failed"`
+		Error  string                        `json:"error,omitempty" summary:"reason of the last failed attempt"`
+		Images []models.RentalHouseImageInfo `json:"images"`
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	image, err := db.GetRentalHouseImageByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if image.CreatorID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("image not found")))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&Result{
+		ID:     image.ID,
+		Status: image.Status,
+		Error:  image.Error,
+		Images: presentImages(image.Images),
+	}))
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"ekira-backend/app/errs"
 	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
 	"ekira-backend/pkg/utils"
 	"ekira-backend/platform/database"
 	"errors"
@@ -31,10 +32,13 @@ func CreateReservation(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	type Request struct {
-		RentalHouseId  string `json:"rental_house_id" validate:"required,uuid4" example:"123e4567-e89b-12d3-a456-426614174000"`
-		StartDate      string `json:"start_date" validate:"required,datetime=2006-01-02" example:"YYYY-MM-DD"`
-		EndDate        string `json:"end_date" validate:"required,datetime=2006-01-02" example:"YYYY-MM-DD"`
-		IdentityNumber string `json:"identity_number" validate:"required,min=11,max=11,numeric" example:"12345678901"`
+		RentalHouseId  string            `json:"rental_house_id" validate:"required,uuid4" example:"123e4567-e89b-12d3-a456-426614174000"`
+		StartDate      string            `json:"start_date" validate:"required,datetime=2006-01-02" example:"YYYY-MM-DD"`
+		EndDate        string            `json:"end_date" validate:"required,datetime=2006-01-02" example:"YYYY-MM-DD"`
+		IdentityNumber string            `json:"identity_number" validate:"required,min=11,max=11,numeric" example:"12345678901"`
+		RenterType     models.RenterType `json:"renter_type" validate:"min=0,max=1" example:"0" summary:"0 = individual, 1 = corporate"`
+		TaxNumber      string            `json:"tax_number" validate:"omitempty,min=10,max=11,numeric" example:"1234567890"`
+		CouponCode     string            `json:"coupon_code" validate:"omitempty,max=32" example:"SUMMER10"`
 	}
 
 	validate := validator.New()
@@ -47,6 +51,11 @@ func CreateReservation(c *fiber.Ctx) error {
 		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("validate", err.Error()))
 	}
 
+	// Corporate renters must give a tax number for stopaj.
+	if req.RenterType == models.RenterTypeCorporate && req.TaxNumber == "" {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("tax number is required for corporate renters")))
+	}
+
 	// Create database connection.
 	db, err := database.OpenDBConnection()
 	if err != nil {
@@ -61,6 +70,9 @@ func CreateReservation(c *fiber.Ctx) error {
 		}
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
+	if rentalHouse.ID == 0 || !rentalHouse.IsPublic() {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("rental house not found")))
+	}
 
 	// Checks
 	startDate, _ := time.ParseInLocation("2006-01-02", req.StartDate, utils.TZ)
@@ -146,6 +158,47 @@ func CreateReservation(c *fiber.Ctx) error {
 		}
 	}
 
+	// Snapshot the exchange rate from rental house currency to wallet currency.
+	currency := rentalHouse.Currency
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	exchangeRate, err := getExchangeRate(db, currency, models.DefaultCurrency)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("exchange rate not found")).SetHeader("rate", err.Error()))
+	}
+
+	totalPriceFirst := rentalHouse.Price
+	commision := 0.0
+	if rentalHouse.RentPeriod == models.RentPeriodDay {
+		totalDays := _endDate.Sub(startDate).Hours() / 24
+		totalPriceFirst = rentalHouse.Price * totalDays
+		if rentalHouse.CommisionType == models.CommisionTypeRenterPays {
+			priceWithCommision := utils.GetPriceWithCommission(totalPriceFirst, currency)
+			commision = priceWithCommision - totalPriceFirst
+			totalPriceFirst = priceWithCommision
+		}
+	}
+
+	// Apply coupon discount to the first payment.
+	var coupon models.Coupon
+	discount := 0.0
+	if req.CouponCode != "" {
+		coupon, err = db.GetCouponWithCode(req.CouponCode)
+		if err != nil {
+			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+		}
+		if coupon.ID == 0 {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("coupon not found")))
+		}
+		discount, err = getCouponDiscount(db, &coupon, user.ID, &rentalHouse, totalPriceFirst)
+		if err != nil {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+		}
+		totalPriceFirst = totalPriceFirst - discount
+		totalPrice = totalPrice - discount
+	}
+
 	// Create reservation.
 	reservation := models.Reservation{
 		RentalHouseID:  rentalHouse.ID,
@@ -158,33 +211,31 @@ func CreateReservation(c *fiber.Ctx) error {
 		Email:          user.Email,
 		Phone:          user.PhoneNumber,
 		IdentityNumber: req.IdentityNumber,
+		RenterType:     req.RenterType,
 		UnitPrice:      rentalHouse.Price,
 		TotalPrice:     totalPrice,
+		Currency:       currency,
+		ExchangeRate:   exchangeRate,
 		RentPeriod:     rentalHouse.RentPeriod,
 	}
-	err = db.Create(&reservation).Error
-	if err != nil {
-		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	if req.TaxNumber != "" {
+		reservation.TaxNumber = &req.TaxNumber
 	}
 
-	totalPriceFirst := rentalHouse.Price
-	if rentalHouse.RentPeriod == models.RentPeriodDay {
-		totalDays := _endDate.Sub(startDate).Hours() / 24
-		totalPriceFirst = rentalHouse.Price * totalDays
-		if rentalHouse.CommisionType == models.CommisionTypeRenterPays {
-			totalPriceFirst = utils.GetPriceWithCommission(totalPriceFirst)
-		}
-	}
+	// Calculate taxes, withheld taxes are paid by the renter to the tax office instead of the owner.
+	taxes := utils.CalculateTaxes(totalPriceFirst-commision, commision, rentalHouse.RentPeriod, rentalHouse.ListingType, reservation.RenterType)
+	totalPriceFirst = totalPriceFirst - utils.GetWithheldTax(taxes)
 
 	amount := totalPriceFirst
 	if rentalHouse.CommisionType == models.CommisionTypeRenterPays {
-		amount = utils.GetPriceWithCommission(amount)
+		amount = utils.GetPriceWithCommission(amount, currency)
 	}
 
 	payment := models.Payment{
-		ReservationID:  reservation.ID,
 		Amount:         amount,
 		AmountGross:    totalPriceFirst,
+		Currency:       currency,
+		ExchangeRate:   exchangeRate,
 		StartDate:      paymentStartDate,
 		EndDate:        paymentEndDate,
 		Expire:         expire,
@@ -192,16 +243,58 @@ func CreateReservation(c *fiber.Ctx) error {
 		Status:         models.PAYMENT_STATUS_PENDING,
 		UID:            uuid.New(),
 		IsFirstPayment: true,
+		Discount:       discount,
+		DiscountFunder: coupon.FundedBy,
+		Taxes:          taxes,
+	}
+
+	// The reservation is saved with its payment, coupon redemption and notification in one transaction,
+	// the renter is asked to pay the reservation only if all of them are saved.
+	reservation.RentalHouse = rentalHouse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("RentalHouse").Create(&reservation).Error; err != nil {
+			return err
+		}
+		payment.ReservationID = reservation.ID
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+
+		// Redeem coupon.
+		if coupon.ID != 0 {
+			redemption := models.CouponRedemption{
+				CouponID:      coupon.ID,
+				UserID:        user.ID,
+				ReservationID: reservation.ID,
+				PaymentID:     payment.ID,
+				Discount:      discount,
+				Currency:      currency,
+				FundedBy:      coupon.FundedBy,
+			}
+			couponQueries := &queries.CouponQueries{DB: tx}
+			if err := couponQueries.RedeemCoupon(&coupon, &redemption); err != nil {
+				return err
+			}
+		}
+		return queries.CreateNotifications(tx, user.ID, models.NOTIFICATION_TYPE_RESERVATION_CREATED, reservation.UID.String(), utils.PaymentNotificationData(&payment, &reservation))
+	})
+	if err != nil {
+		if errors.Is(err, queries.ErrCouponUsageLimit) {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
-	db.Create(&payment)
 
 	type Response struct {
-		ID        string  `json:"id"`
-		StartDate string  `json:"start_date"`
-		EndDate   string  `json:"end_date"`
-		Status    string  `json:"status"`
-		PaymentID string  `json:"payment_id"`
-		Price     float64 `json:"price"`
+		ID        string          `json:"id"`
+		StartDate string          `json:"start_date"`
+		EndDate   string          `json:"end_date"`
+		Status    string          `json:"status"`
+		PaymentID string          `json:"payment_id"`
+		Price     float64         `json:"price"`
+		Discount  float64         `json:"discount"`
+		Currency  models.Currency `json:"currency"`
+		Taxes     []TaxLine       `json:"taxes"`
 	}
 
 	res := Response{
@@ -211,12 +304,121 @@ func CreateReservation(c *fiber.Ctx) error {
 		Status:    reservation.StatusName(),
 		PaymentID: payment.UID.String(),
 		Price:     payment.Amount,
+		Discount:  payment.Discount,
+		Currency:  payment.Currency,
+		Taxes:     newTaxLines(payment.Taxes),
 	}
 
 	// Return status 200 OK.
 	return c.JSON(models.NewResponseOK(&res))
 }
 
+// errPaymentProvider is returned when stripe can not refund or cancel the payment.
+var errPaymentProvider = errors.New("payment provider error")
+
+// errReservationChanged is returned when the status of the reservation is changed by another request meanwhile.
+var errReservationChanged = errors.New("reservation status is changed, try again")
+
+// cancelReservation cancels the pending or paid reservation. The paid reservation is refunded,
+// the wallet balance and credits reserved for the pending one are released. Returns true if the payment is refunded.
+func cancelReservation(db *database.Queries, reservation *models.Reservation) (bool, error) {
+	refunded := false
+
+	// If reservation is paid, refund payment.
+	if reservation.Status == models.RESERVATION_STATUS_PAID {
+		// Get first payment.
+		payment, err := db.GetFirstPaymentWithReservationID(reservation.ID)
+		if err != nil {
+			return false, err
+		}
+
+		// If the payment, completed or succeeded, refund it.
+		if payment.Status == models.PAYMENT_STATUS_COMPLETED || payment.Status == models.PAYMENT_STATUS_SUCCEEDED {
+			// If payment is already refunded, user can't cancel it.
+			if payment.StripeRefundID == nil && payment.StripeChargeID != nil {
+				// Refund payment.
+				refund, err := utils.RefundCharge(*payment.StripeChargeID)
+				if err != nil {
+					return false, fmt.Errorf("%w, refund failed: %v", errPaymentProvider, err)
+				}
+				payment.StripeRefundID = &refund.ID
+			}
+
+			// Return the wallet balance and credits used for the payment.
+			err = db.RefundPaymentTenders(payment.ID, reservation.CreatorID, 1)
+			if err != nil {
+				return false, err
+			}
+
+			// Update payment status to refunded.
+			if payment.StripeRefundID != nil || payment.CardAmount() <= 0 {
+				payment.Status = models.PAYMENT_STATUS_REFUNDED
+				err = db.Save(&payment).Error
+				if err != nil {
+					return false, err
+				}
+				refunded = true
+			}
+		}
+	}
+
+	// If reservation is not paid yet, cancel the card payment and release the wallet balance and credits reserved for the payment.
+	if reservation.Status == models.RESERVATION_STATUS_PENDING {
+		// Get first payment.
+		payment, err := db.GetFirstPaymentWithReservationID(reservation.ID)
+		if err != nil {
+			return false, err
+		}
+
+		if payment.ID != 0 && (payment.Status == models.PAYMENT_STATUS_PENDING || payment.Status == models.PAYMENT_STATUS_FAILED) {
+			// Cancel the card payment first, so it can not be paid after the reservation is cancelled or the balance is returned.
+			if payment.StripeID != nil {
+				_, err = utils.CancelPaymentIntent(*payment.StripeID)
+				if err != nil {
+					return false, fmt.Errorf("%w, payment cancel failed: %v", errPaymentProvider, err)
+				}
+			}
+
+			if payment.WalletAmount > 0 || payment.CreditAmount > 0 {
+				err = db.RefundPaymentTenders(payment.ID, reservation.CreatorID, 1)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			payment.Status = models.PAYMENT_STATUS_CANCELLED
+			err = db.Model(&models.Payment{}).Where("id = ?", payment.ID).Update("status", payment.Status).Error
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Update reservation status to cancelled, the renter and the owner are notified in the same transaction.
+	reservation.Status = models.RESERVATION_STATUS_CANCELLED
+	data := utils.ReservationNotificationData(reservation)
+	if refunded {
+		data["refunded"] = "true"
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(reservation).Error; err != nil {
+			return err
+		}
+		if err := queries.CreateNotifications(tx, reservation.CreatorID, models.NOTIFICATION_TYPE_RESERVATION_CANCELLED, reservation.UID.String(), data); err != nil {
+			return err
+		}
+		if reservation.RentalHouse.CreatorID == uuid.Nil {
+			return nil
+		}
+		return queries.CreateNotifications(tx, reservation.RentalHouse.CreatorID, models.NOTIFICATION_TYPE_RESERVATION_CANCELLED, reservation.UID.String(), data)
+	})
+	if err != nil {
+		return refunded, err
+	}
+	publishReservationEvent(reservation)
+	return refunded, nil
+}
+
 // CancelReservation method
 // @Description Cancel a reservation for rental house
 // @Summary Cancel a reservation for rental house
@@ -286,42 +488,11 @@ func CancelReservation(c *fiber.Ctx) error {
 		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("you can't cancel reservation because it's expired")))
 	}
 
-	refunded := false
-
-	// If reservation is paid, refund payment.
-	if reservation.Status == models.RESERVATION_STATUS_PAID {
-		// Get first payment.
-		payment, err := db.GetFirstPaymentWithReservationID(reservation.ID)
-		if err != nil {
-			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
-		}
-
-		// If the payment, completed or succeeded, refund it.
-		if payment.Status == models.PAYMENT_STATUS_COMPLETED || payment.Status == models.PAYMENT_STATUS_SUCCEEDED {
-			// If payment is already refunded, user can't cancel it.
-			if payment.StripeRefundID == nil && payment.StripeChargeID != nil {
-				// Refund payment.
-				refund, err := utils.RefundCharge(*payment.StripeChargeID)
-				if err != nil {
-					return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("refund failed")).SetHeader("stripe", err.Error()))
-				}
-
-				// Update payment status to refunded.
-				payment.Status = models.PAYMENT_STATUS_REFUNDED
-				payment.StripeRefundID = &refund.ID
-				e := db.Save(&payment).Error
-				if e != nil {
-					return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", e.Error()))
-				}
-				refunded = true
-			}
-		}
-	}
-
-	// Update reservation status to cancelled.
-	reservation.Status = models.RESERVATION_STATUS_CANCELLED
-	err = db.Save(&reservation).Error
+	refunded, err := cancelReservation(db, &reservation)
 	if err != nil {
+		if errors.Is(err, errPaymentProvider) {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("refund failed")).SetHeader("stripe", err.Error()))
+		}
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
 
@@ -478,9 +649,16 @@ func AcceptReservation(c *fiber.Ctx) error {
 		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("reservation must be in the status of paid to be accepted")))
 	}
 
+	// Get first paid payment.
+	var firstPaidPayment models.Payment
+	err = db.Where("reservation_id = ? AND status = ? AND is_first_payment = ?", reservationInfo.ID, models.PAYMENT_STATUS_COMPLETED, true).First(&firstPaidPayment).Error
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
 	// Create payment plan for monthly and yearly rental house.
+	var payments []models.Payment
 	if reservationInfo.RentPeriod == models.RentPeriodMonth {
-		var err error
 		var nextMonth time.Time = reservationInfo.StartDate
 		for {
 			nextMonth = nextMonth.AddDate(0, 1, 0)
@@ -492,70 +670,66 @@ func AcceptReservation(c *fiber.Ctx) error {
 				break
 			}
 
-			amount := reservationInfo.UnitPrice
+			taxes := utils.CalculateTaxes(reservationInfo.UnitPrice, 0, reservationInfo.RentPeriod, reservationInfo.RentalHouse.ListingType, reservationInfo.RenterType)
+			amountGross := reservationInfo.UnitPrice - utils.GetWithheldTax(taxes)
+
+			amount := amountGross
 			if reservationInfo.RentalHouse.CommisionType == models.CommisionTypeRenterPays {
-				amount = utils.GetPriceWithCommission(amount)
+				amount = utils.GetPriceWithCommission(amount, reservationInfo.Currency)
 			}
 
-			payment := models.Payment{
+			payments = append(payments, models.Payment{
 				UID:           uuid.New(),
 				ReservationID: reservationInfo.ID,
 				Amount:        amount,
-				AmountGross:   reservationInfo.UnitPrice,
+				AmountGross:   amountGross,
+				Currency:      reservationInfo.Currency,
+				ExchangeRate:  reservationInfo.ExchangeRate,
 				StartDate:     firstDayOfNextMonth,
 				EndDate:       lastSecondOfNextMonth,
 				Status:        models.PAYMENT_STATUS_PENDING,
 				// expire every 15th of the month
 				Expire:         time.Date(lastDayOfNextMonth.Year(), lastDayOfNextMonth.Month(), 15, 23, 59, 59, 0, lastDayOfNextMonth.Location()),
 				IsFirstPayment: false,
-			}
-			err = db.Create(&payment).Error
-			if err != nil {
-				break
-			}
-		}
-		if err != nil {
-			// Rollback: delete all payments except the first payment.
-			db.Model(models.Payment{}).Where("reservation_id = ? AND is_first_payment = ?", reservationInfo.ID, false).Delete(&models.Payment{})
-			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+				Taxes:          taxes,
+			})
 		}
 	}
 
-	// Update
+	// Give a balance to the owner
 	reservationInfo.Status = models.RESERVATION_STATUS_ACCEPTED
-	err = db.Save(&reservationInfo).First(&reservationInfo).Error
-	if err != nil {
-		// Rollback: delete all payments except the first payment.
-		db.Model(models.Payment{}).Where("reservation_id = ? AND is_first_payment = ?", reservationInfo.ID, false).Delete(&models.Payment{})
-		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	firstPaidPayment.Reservation = reservationInfo
+	balanceAmount := utils.GetOwnerBalanceShare(&firstPaidPayment)
+	// The payment plan, the status, the balance of the owner and the notification of the renter are saved in one transaction.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range payments {
+			if err := tx.Create(&payments[i]).Error; err != nil {
+				return err
+			}
+		}
+		res := tx.Model(&models.Reservation{}).Where("id = ? AND status = ?", reservationInfo.ID, models.RESERVATION_STATUS_PAID).Update("status", models.RESERVATION_STATUS_ACCEPTED)
+		if res.Error != nil {
+			return res.Error
+		}
+		// The reservation is accepted or cancelled meanwhile.
+		if res.RowsAffected == 0 {
+			return errReservationChanged
+		}
+		if balanceAmount > 0 {
+			err := tx.Model(&models.User{}).Where("id = ?", reservationInfo.RentalHouse.CreatorID).Update("balance", gorm.Expr("balance + ?", balanceAmount)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return queries.CreateNotifications(tx, reservationInfo.CreatorID, models.NOTIFICATION_TYPE_RESERVATION_ACCEPTED, reservationInfo.UID.String(), utils.ReservationNotificationData(&reservationInfo))
+	})
+	if errors.Is(err, errReservationChanged) {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(err))
 	}
-
-	// Give a balance to the owner
-	// Get first paid payment.
-	var firstPaidPayment models.Payment
-	err = db.Where("reservation_id = ? AND status = ? AND is_first_payment = ?", reservationInfo.ID, models.PAYMENT_STATUS_COMPLETED, true).First(&firstPaidPayment).Error
 	if err != nil {
-		// Rollback: delete all payments except the first payment, and set reservation status to "RESERVATION_STATUS_PAID".
-		db.Model(models.Payment{}).Where("reservation_id = ? AND is_first_payment = ?", reservationInfo.ID, false).Delete(&models.Payment{})
-		reservationInfo.Status = models.RESERVATION_STATUS_PAID
-		db.Save(&reservationInfo).First(&reservationInfo)
 		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
 	}
-	balanceAmount := firstPaidPayment.Amount
-	if reservationInfo.RentalHouse.CommisionType == models.CommisionTypeOwnerPays {
-		commision := utils.GetPriceWithCommission(firstPaidPayment.AmountGross) - firstPaidPayment.Amount
-		balanceAmount = balanceAmount - commision
-	}
-	if balanceAmount > 0 {
-		err = db.Model(&models.User{}).Where("id = ?", reservationInfo.RentalHouse.CreatorID).Update("balance", gorm.Expr("balance + ?", balanceAmount)).Error
-		if err != nil {
-			// Rollback: delete all payments except the first payment, and set reservation status to "RESERVATION_STATUS_PAID".
-			db.Model(models.Payment{}).Where("reservation_id = ? AND is_first_payment = ?", reservationInfo.ID, false).Delete(&models.Payment{})
-			reservationInfo.Status = models.RESERVATION_STATUS_PAID
-			db.Save(&reservationInfo).First(&reservationInfo)
-			return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
-		}
-	}
+	publishReservationEvent(&reservationInfo)
 
 	type Response struct {
 		ReservationID string  `json:"reservation_id"`
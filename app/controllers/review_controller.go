@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReviewAuthor struct {
+	ID           string  `json:"id"`
+	FirstName    string  `json:"first_name"`
+	ProfileImage *string `json:"profile_image"`
+}
+
+type ReviewResult struct {
+	ID          string               `json:"id"`
+	Type        models.ReviewType    `json:"type" summary:"1 = rental house review, 2 = renter review"`
+	TypeName    string               `json:"type_name"`
+	Rating      int                  `json:"rating"`
+	Scores      *models.ReviewScores `json:"scores,omitempty" summary:"only for the rental house reviews"`
+	Comment     string               `json:"comment"`
+	Author      ReviewAuthor         `json:"author"`
+	RentalHouse struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"rental_house"`
+	Response    *string    `json:"response"`
+	RespondedAt *time.Time `json:"responded_at"`
+	Published   bool       `json:"published" summary:"false until the other side reviews or the review window is over"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newReviewResult(review *models.Review) ReviewResult {
+	result := ReviewResult{
+		ID:       review.UID.String(),
+		Type:     review.Type,
+		TypeName: review.Type.Name(),
+		Rating:   review.Rating,
+		Comment:  review.Comment,
+		Author: ReviewAuthor{
+			ID:        review.AuthorID.String(),
+			FirstName: review.Author.FirstName,
+		},
+		Response:    review.Response,
+		RespondedAt: review.RespondedAt,
+		Published:   review.IsPublished(),
+		PublishedAt: review.PublishedAt,
+		CreatedAt:   review.CreatedAt,
+	}
+	if review.Type == models.REVIEW_TYPE_RENTAL_HOUSE {
+		scores := review.ReviewScores
+		result.Scores = &scores
+	}
+	if review.Author.ProfileImage != nil && len(review.Author.ProfileImage.Images) > 0 {
+		url := storage.PresentURL(review.Author.ProfileImage.Images[len(review.Author.ProfileImage.Images)-1].URL)
+		result.Author.ProfileImage = &url
+	}
+	result.RentalHouse.ID = review.RentalHouse.UID.String()
+	result.RentalHouse.Title = review.RentalHouse.Title
+	return result
+}
+
+// ReviewListResponse is the page of the published reviews.
+type ReviewListResponse struct {
+	Pagination struct {
+		TotalCount int64 `json:"total_count"`
+		FullCount  int64 `json:"full_count"`
+		NextPage   bool  `json:"next_page"`
+		PrevPage   bool  `json:"prev_page"`
+	} `json:"pagination"`
+	Rating      *float64              `json:"rating"`
+	ReviewCount int64                 `json:"review_count"`
+	Ratings     *models.ReviewRatings `json:"ratings,omitempty" summary:"average category scores, only for the rental houses"`
+	Results     []ReviewResult        `json:"results"`
+}
+
+func newReviewListResponse(list *queries.ReviewList) ReviewListResponse {
+	res := ReviewListResponse{Results: make([]ReviewResult, len(list.Reviews))}
+	res.Pagination.FullCount = list.FullCount
+	res.Pagination.TotalCount = list.TotalCount
+	res.Pagination.NextPage = list.NextPage
+	res.Pagination.PrevPage = list.PrevPage
+	for i := range list.Reviews {
+		res.Results[i] = newReviewResult(&list.Reviews[i])
+	}
+	return res
+}
+
+// getReviewPagination parses the page and the limit of the review lists.
+func getReviewPagination(c *fiber.Ctx) models.Pagination {
+	pagination := models.Pagination{Page: 1, Limit: 10}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		pagination.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 50 {
+		pagination.Limit = limit
+	}
+	return pagination
+}
+
+// CreateReview method
+// @Description Review a stay, the renter reviews the rental house with the category scores and the owner reviews the renter.
+// @Description Only accepted reservations can be reviewed, after the end date and within the review window.
+// @Description The review is hidden until the other side reviews or the review window is over.
+// @Summary Review a stay
+// @Tags Review
+// @Accept json
+// @Produce json
+// @Param review body controllers.CreateReview.Request true "Review"
+// @Success 200 {object} models.ResponseOK{result=controllers.ReviewResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 409 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /review/create [post]
+func CreateReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		ReservationID string `json:"reservation_id" validate:"required,uuid4"`
+		Rating        int    `json:"rating" validate:"required,min=1,max=5"`
+		models.ReviewScores
+		Comment string `json:"comment" validate:"max=2048"`
+	}
+
+	req := new(Request)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if err := validator.New().Struct(req); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	reservation, err := db.GetReservationByUid(uuid.MustParse(req.ReservationID))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// The renter reviews the rental house, the owner reviews the renter.
+	review := models.Review{
+		ReservationID: reservation.ID,
+		AuthorID:      user.ID,
+		Author:        user,
+		RentalHouseID: reservation.RentalHouseID,
+		RentalHouse:   reservation.RentalHouse,
+		Rating:        req.Rating,
+		Comment:       req.Comment,
+	}
+	switch {
+	case reservation.ID == 0:
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("reservation not found")))
+	case reservation.CreatorID == user.ID:
+		if !req.ReviewScores.IsComplete() {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("all category scores are required")))
+		}
+		review.Type = models.REVIEW_TYPE_RENTAL_HOUSE
+		review.SubjectID = reservation.RentalHouse.CreatorID
+		review.ReviewScores = req.ReviewScores
+	case reservation.RentalHouse.CreatorID == user.ID:
+		review.Type = models.REVIEW_TYPE_RENTER
+		review.SubjectID = reservation.CreatorID
+	default:
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("reservation not found")))
+	}
+
+	// Only the accepted stays are reviewed, after the end date and within the review window.
+	if reservation.Status != models.RESERVATION_STATUS_ACCEPTED {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("only accepted reservations can be reviewed")))
+	}
+	if time.Now().Before(reservation.EndDate) {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("the stay is not ended yet")))
+	}
+	if time.Now().After(reservation.EndDate.Add(utils.ReviewWindow())) {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("the review window is over")))
+	}
+
+	reviews, err := db.GetReservationReviews(reservation.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	for _, r := range reviews {
+		if r.Type == review.Type {
+			return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("the stay is already reviewed")))
+		}
+	}
+
+	err = db.CreateReview(&review)
+	if err != nil {
+		if strings.Contains(err.Error(), "idx_reviews_reservation_type") {
+			return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("the stay is already reviewed")))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newReviewResult(&review)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetPendingReviews method
+// @Description Get the ended stays which the user can review, as the renter or the owner
+// @Summary Get stays to review
+// @Tags Review
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=[]controllers.GetPendingReviews.Result}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /review/pending [get]
+func GetPendingReviews(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	window := utils.ReviewWindow()
+	reservations, err := db.GetReviewableReservations(user.ID, window)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Result struct {
+		ReservationID    string            `json:"reservation_id"`
+		Type             models.ReviewType `json:"type" summary:"1 = review the rental house, 2 = review the renter"`
+		RentalHouseID    string            `json:"rental_house_id"`
+		RentalHouseTitle string            `json:"rental_house_title"`
+		RenterName       string            `json:"renter_name"`
+		StartDate        time.Time         `json:"start_date"`
+		EndDate          time.Time         `json:"end_date"`
+		ReviewUntil      time.Time         `json:"review_until"`
+	}
+	res := make([]Result, 0, len(reservations))
+	for _, reservation := range reservations {
+		result := Result{
+			ReservationID:    reservation.UID.String(),
+			Type:             models.REVIEW_TYPE_RENTAL_HOUSE,
+			RentalHouseID:    reservation.RentalHouse.UID.String(),
+			RentalHouseTitle: reservation.RentalHouse.Title,
+			RenterName:       reservation.Creator.FullName(),
+			StartDate:        reservation.StartDate,
+			EndDate:          reservation.EndDate,
+			ReviewUntil:      reservation.EndDate.Add(window),
+		}
+		if reservation.RentalHouse.CreatorID == user.ID {
+			result.Type = models.REVIEW_TYPE_RENTER
+		}
+		res = append(res, result)
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetRentalHouseReviews method
+// @Description Get the published reviews of the rental house with the average scores, the newest is the first
+// @Summary Get rental house reviews
+// @Tags Review
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental house ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Limit number" default(10)
+// @Success 200 {object} models.ResponseOK{result=controllers.ReviewListResponse{results=[]controllers.ReviewResult}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /review/rental-house/{id} [get]
+func GetRentalHouseReviews(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	if err := validator.New().Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+	pagination := getReviewPagination(c)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	rentalHouse, err := db.GetRentalHouseWithUid(uuid.MustParse(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+		}
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if !rentalHouse.IsPublic() && rentalHouse.CreatorID != user.ID && !user.IsModerator() {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseError(errs.ErrNotFound))
+	}
+
+	list, err := db.GetRentalHouseReviews(rentalHouse.ID, &pagination)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newReviewListResponse(&list)
+	res.Rating = rentalHouse.Rating
+	res.ReviewCount = int64(rentalHouse.ReviewCount)
+	res.Ratings = &rentalHouse.CategoryRatings
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// GetRenterReviews method
+// @Description Get the published reviews of the owners about the renter, the newest is the first
+// @Summary Get renter reviews
+// @Tags Review
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Limit number" default(10)
+// @Success 200 {object} models.ResponseOK{result=controllers.ReviewListResponse{results=[]controllers.ReviewResult}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /review/user/{id} [get]
+func GetRenterReviews(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := validator.New().Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+	pagination := getReviewPagination(c)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	list, err := db.GetRenterReviews(uuid.MustParse(id), &pagination)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	rating, count, err := db.GetRenterRating(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newReviewListResponse(&list)
+	res.Rating = rating
+	res.ReviewCount = count
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
+
+// RespondReview method
+// @Description Respond to a published review of the owned rental house, the response is public and can be given once
+// @Summary Respond to a review
+// @Tags Review
+// @Accept json
+// @Produce json
+// @Param id path string true "Review ID"
+// @Param response body controllers.RespondReview.Request true "Response"
+// @Success 200 {object} models.ResponseOK{result=controllers.ReviewResult}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 409 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /review/{id}/response [post]
+func RespondReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	if err := validator.New().Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	type Request struct {
+		Response string `json:"response" validate:"required,max=2048"`
+	}
+
+	req := new(Request)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	req.Response = strings.TrimSpace(req.Response)
+	if err := validator.New().Struct(req); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	review, err := db.GetReviewWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Only the published reviews of the owned rental houses are responded.
+	if review.ID == 0 || review.Type != models.REVIEW_TYPE_RENTAL_HOUSE || review.RentalHouse.CreatorID != user.ID || !review.IsPublished() {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("review not found")))
+	}
+	if review.Response != nil {
+		return c.Status(fiber.StatusConflict).JSON(models.NewResponseErr(errors.New("the review is already responded")))
+	}
+
+	err = db.RespondReview(&review, req.Response)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	res := newReviewResult(&review)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
@@ -0,0 +1,413 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"html"
+	"strings"
+	"time"
+)
+
+// savedSearchLimit is the maximum number of the saved searches of a user.
+const savedSearchLimit = 20
+
+// recordListingEvent saves the listing event for the saved search alerts if the rental house is published for the first time
+// or its price is decreased, db is the transaction of the change. wasPublic, oldPrice and oldCurrency are the values before
+// the change. The listing which is public again is compared with its last public price.
+func recordListingEvent(db *database.Queries, rh *models.RentalHouse, wasPublic bool, oldPrice float64, oldCurrency models.Currency) error {
+	lastPrice, lastCurrency := oldPrice, oldCurrency
+	publishedBefore := false
+	if rh.IsPublic() && !wasPublic {
+		lastEvent, err := db.GetLastListingEvent(rh.ID)
+		if err != nil {
+			return err
+		}
+		publishedBefore = lastEvent.ID != 0
+		lastPrice, lastCurrency = lastEvent.Price, lastEvent.Currency
+	}
+
+	eventType, ok := listingEventType(rh.IsPublic(), wasPublic, publishedBefore, rh.Price, rh.Currency, lastPrice, lastCurrency)
+	if !ok {
+		return nil
+	}
+	event := models.ListingEvent{
+		RentalHouseID: rh.ID,
+		Type:          eventType,
+		Price:         rh.Price,
+		Currency:      rh.Currency,
+	}
+	switch eventType {
+	case models.LISTING_EVENT_PRICE_DROPPED:
+		event.OldPrice = lastPrice
+	case models.LISTING_EVENT_HIDDEN:
+		event.Price, event.Currency = oldPrice, oldCurrency
+	}
+	return db.CreateListingEvent(&event)
+}
+
+// listingEventType returns the listing event of the change, ok is false if the change is not saved. lastPrice and lastCurrency
+// are the last public price of the listing. A listing which is published again, e.g. after it is hidden by the owner,
+// is not sent as a new listing, it is sent only if it is cheaper than before.
+func listingEventType(isPublic, wasPublic, publishedBefore bool, price float64, currency models.Currency, lastPrice float64, lastCurrency models.Currency) (models.ListingEventType, bool) {
+	if !isPublic {
+		if wasPublic {
+			return models.LISTING_EVENT_HIDDEN, true
+		}
+		return 0, false
+	}
+	if !wasPublic && !publishedBefore {
+		return models.LISTING_EVENT_PUBLISHED, true
+	}
+	if lastCurrency != currency || lastPrice <= price {
+		return 0, false
+	}
+	return models.LISTING_EVENT_PRICE_DROPPED, true
+}
+
+// updateSavedSearchAlerts sets the next alert of the search after its frequency is changed. The listings of the time
+// the alerts were off are not sent.
+func updateSavedSearchAlerts(db *database.Queries, search *models.SavedSearch, oldFrequency models.SavedSearchFrequency) error {
+	if oldFrequency == models.SAVED_SEARCH_FREQUENCY_OFF && search.Frequency != models.SAVED_SEARCH_FREQUENCY_OFF {
+		lastSequence, err := db.GetLastListingEventSequence()
+		if err != nil {
+			return err
+		}
+		search.LastEventSequence = lastSequence
+	}
+	search.NextAlertAt = time.Now()
+	if search.LastAlertAt != nil && search.LastAlertAt.Add(search.Frequency.Interval()).After(search.NextAlertAt) {
+		search.NextAlertAt = search.LastAlertAt.Add(search.Frequency.Interval())
+	}
+	return db.UpdateSavedSearch(search)
+}
+
+// GetSavedSearches method
+// @Description Get the saved searches of the user
+// @Summary Get saved searches
+// @Tags Saved Search
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=[]models.SavedSearch}
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /saved-search/list [get]
+func GetSavedSearches(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	searches, err := db.GetSavedSearches(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&searches))
+}
+
+// CreateSavedSearch method
+// @Description Save the search of the public rental house list, the filters are the same query parameters with /rental-house/list.
+// @Description The user is alerted about the listings which are published or get cheaper after the search is saved, with the frequency of the search (daily by default).
+// @Summary Save search
+// @Tags Saved Search
+// @Accept json
+// @Produce json
+// @Param search body controllers.CreateSavedSearch.Request true "Saved search"
+// @Param currency query string false "Currency of the price range if price_currency is not given (TRY, EUR, USD)" default()
+// @Param city_id query string false "City ids, comma separated" default()
+// @Param town_id query string false "Town ids, comma separated" default()
+// @Param min_price query number false "Minimum price" default()
+// @Param max_price query number false "Maximum price" default()
+// @Param rent_period query int false "Rent period (1 = daily, 2 = monthly, 3 = yearly)" default()
+// @Success 200 {object} models.ResponseOK{result=models.SavedSearch}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /saved-search/create [post]
+func CreateSavedSearch(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	type Request struct {
+		Name      string                      `json:"name" example:"Kadıköy 2+1" validate:"required,max=100"`
+		Frequency models.SavedSearchFrequency `json:"frequency" example:"2" summary:"1 = instant, 2 = daily, 3 = weekly, 4 = off" validate:"omitempty,min=1,max=4"`
+	}
+	var body Request
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if err := validator.New().Struct(body); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+	if body.Frequency == 0 {
+		body.Frequency = models.SAVED_SEARCH_FREQUENCY_DAILY
+	}
+
+	displayCurrency, err := getDisplayCurrency(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("currency", err.Error()))
+	}
+	filter, err := getRentalHouseFilter(c)
+	if err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("filter", err.Error()))
+	}
+	// The price range is kept in its currency, the listings are compared with the rates of the alert time.
+	if filter.PriceCurrency == "" && (filter.MinPrice != nil || filter.MaxPrice != nil) {
+		filter.PriceCurrency = displayCurrency
+		if filter.PriceCurrency == "" {
+			filter.PriceCurrency = models.DefaultCurrency
+		}
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	count, err := db.GetSavedSearchCount(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if count >= savedSearchLimit {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseErr(errors.New("saved search limit is reached")).SetHeader("limit", savedSearchLimit))
+	}
+
+	search := models.SavedSearch{
+		UserID:    user.ID,
+		Name:      body.Name,
+		Filter:    filter,
+		Frequency: body.Frequency,
+	}
+	err = db.CreateSavedSearch(&search)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&search))
+}
+
+// UpdateSavedSearch method
+// @Description Change the name or the alert frequency of the saved search, the filters are not changed
+// @Summary Change saved search
+// @Tags Saved Search
+// @Accept json
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Param search body controllers.UpdateSavedSearch.Request true "Saved search"
+// @Success 200 {object} models.ResponseOK{result=models.SavedSearch}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /saved-search/{id} [put]
+func UpdateSavedSearch(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	validate := validator.New()
+	if err := validate.Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	type Request struct {
+		Name      *string                      `json:"name" example:"Kadıköy 2+1" validate:"omitempty,min=1,max=100"`
+		Frequency *models.SavedSearchFrequency `json:"frequency" example:"2" summary:"1 = instant, 2 = daily, 3 = weekly, 4 = off" validate:"omitempty,min=1,max=4"`
+	}
+	var body Request
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("body", err.Error()))
+	}
+	if body.Name != nil {
+		*body.Name = strings.TrimSpace(*body.Name)
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(errs.ErrValidate.StatusCode).JSON(models.NewResponseError(errs.ErrValidate).SetHeader("validate", utils.ValidatorErrors(err)))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	search, err := db.GetSavedSearchWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if search.ID == 0 || search.UserID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("saved search not found")))
+	}
+
+	oldFrequency := search.Frequency
+	if body.Name != nil && *body.Name != "" {
+		search.Name = *body.Name
+	}
+	if body.Frequency != nil {
+		search.Frequency = *body.Frequency
+	}
+	err = updateSavedSearchAlerts(db, &search, oldFrequency)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&search))
+}
+
+// DeleteSavedSearch method
+// @Description Delete the saved search, its pending alerts are still sent
+// @Summary Delete saved search
+// @Tags Saved Search
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Success 200 {string} string "OK"
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /saved-search/{id} [delete]
+func DeleteSavedSearch(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	id := c.Params("id")
+	if err := validator.New().Var(id, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("id", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	search, err := db.GetSavedSearchWithUid(uuid.MustParse(id))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if search.ID == 0 || search.UserID != user.ID {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("saved search not found")))
+	}
+
+	err = db.DeleteSavedSearch(search.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK("OK"))
+}
+
+// unsubscribePage is the page of the unsubscribe link, the alerts are turned off with its form so the link does not change
+// anything when it is opened by a mail scanner.
+const unsubscribePage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>E-Kira</title></head>
+<body>
+<p>%s</p>
+<p>%s</p>
+%s
+</body>
+</html>`
+
+// unsubscribeForm is the form of the unsubscribe page which posts to the same link.
+const unsubscribeForm = `<form method="post"><button type="submit">Bildirimleri durdur / Stop alerts</button></form>`
+
+// ConfirmUnsubscribeSavedSearch method
+// @Description Show the page of the unsubscribe link of the alert e-mail, the alerts are turned off after it is confirmed
+// @Summary Confirm unsubscribe saved search alerts
+// @Tags Saved Search
+// @Produce html
+// @Param token path string true "Unsubscribe token"
+// @Success 200 {string} string
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Router /saved-search/unsubscribe/{token} [get]
+func ConfirmUnsubscribeSavedSearch(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if err := validator.New().Var(token, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("token", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	search, err := db.GetSavedSearchWithUnsubscribeToken(uuid.MustParse(token))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if search.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("saved search not found")))
+	}
+
+	name := html.EscapeString(search.Name)
+	if search.Frequency == models.SAVED_SEARCH_FREQUENCY_OFF {
+		return unsubscribedPage(c, name)
+	}
+
+	// Return status 200 OK.
+	c.Type("html", "utf-8")
+	return c.SendString(fmt.Sprintf(unsubscribePage,
+		fmt.Sprintf("\"%s\" aramanızın bildirimleri durdurulsun mu?", name),
+		fmt.Sprintf("Stop the alerts of your search \"%s\"?", name),
+		unsubscribeForm))
+}
+
+// UnsubscribeSavedSearch method
+// @Description Turn off the alerts of the saved search with the form of the unsubscribe page, the search is kept and the alerts can be turned on in the app
+// @Summary Unsubscribe saved search alerts
+// @Tags Saved Search
+// @Produce html
+// @Param token path string true "Unsubscribe token"
+// @Success 200 {string} string
+// @Failure 400 {object} models.ResponseErr
+// @Failure 404 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Router /saved-search/unsubscribe/{token} [post]
+func UnsubscribeSavedSearch(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if err := validator.New().Var(token, "required,uuid4"); err != nil {
+		return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("token", err.Error()))
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	search, err := db.UnsubscribeSavedSearch(uuid.MustParse(token))
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+	if search.ID == 0 {
+		return c.Status(errs.ErrNotFound.StatusCode).JSON(models.NewResponseErr(errors.New("saved search not found")))
+	}
+
+	// Return status 200 OK.
+	return unsubscribedPage(c, html.EscapeString(search.Name))
+}
+
+// unsubscribedPage sends the page of the unsubscribed search, name is escaped.
+func unsubscribedPage(c *fiber.Ctx, name string) error {
+	c.Type("html", "utf-8")
+	return c.SendString(fmt.Sprintf(unsubscribePage,
+		fmt.Sprintf("\"%s\" aramanızın bildirimleri durduruldu, uygulamadan tekrar açabilirsiniz.", name),
+		fmt.Sprintf("The alerts of your search \"%s\" are stopped, you can turn them on in the app.", name),
+		""))
+}
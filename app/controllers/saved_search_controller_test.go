@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"ekira-backend/app/models"
+	"testing"
+)
+
+func TestListingEventType(t *testing.T) {
+	tests := []struct {
+		name            string
+		isPublic        bool
+		wasPublic       bool
+		publishedBefore bool
+		price           float64
+		currency        models.Currency
+		lastPrice       float64
+		lastCurrency    models.Currency
+		want            models.ListingEventType
+		wantOk          bool
+	}{
+		{"not public", false, false, true, 900, models.CurrencyTRY, 1000, models.CurrencyTRY, 0, false},
+		{"hidden", false, true, true, 900, models.CurrencyTRY, 1000, models.CurrencyTRY, models.LISTING_EVENT_HIDDEN, true},
+		{"first publication", true, false, false, 1000, models.CurrencyTRY, 1000, models.CurrencyTRY, models.LISTING_EVENT_PUBLISHED, true},
+		{"published again", true, false, true, 1000, models.CurrencyTRY, 1000, models.CurrencyTRY, 0, false},
+		{"published again cheaper", true, false, true, 900, models.CurrencyTRY, 1000, models.CurrencyTRY, models.LISTING_EVENT_PRICE_DROPPED, true},
+		{"price dropped", true, true, true, 900, models.CurrencyTRY, 1000, models.CurrencyTRY, models.LISTING_EVENT_PRICE_DROPPED, true},
+		{"same price", true, true, true, 1000, models.CurrencyTRY, 1000, models.CurrencyTRY, 0, false},
+		{"price increased", true, true, true, 1100, models.CurrencyTRY, 1000, models.CurrencyTRY, 0, false},
+		{"currency changed", true, true, true, 100, models.CurrencyUSD, 1000, models.CurrencyTRY, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := listingEventType(tt.isPublic, tt.wasPublic, tt.publishedBefore, tt.price, tt.currency, tt.lastPrice, tt.lastCurrency)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("%s: listingEventType() = %d, %v, want %d, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -2,19 +2,27 @@ package controllers
 
 import (
 	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
 	"ekira-backend/pkg/utils"
 	"ekira-backend/platform/database"
 	"encoding/json"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/stripe/stripe-go/v74"
 	"github.com/stripe/stripe-go/v74/webhook"
 	"gorm.io/gorm"
 	"log"
+	"math"
 	"os"
 	"strings"
+	"time"
 )
 
+// receivablePaymentStatuses are the statuses of the payments which are not paid yet. A cancelled payment is paid if its
+// payment intent is confirmed before it is cancelled, the refunded or disputed payments are not changed by the late events.
+var receivablePaymentStatuses = []models.PaymentStatus{models.PAYMENT_STATUS_PENDING, models.PAYMENT_STATUS_FAILED, models.PAYMENT_STATUS_CANCELLED}
+
 func ChargeEvent(c *fiber.Ctx, event stripe.Event) error {
 	var charge stripe.Charge
 	err := json.Unmarshal(event.Data.Raw, &charge)
@@ -50,31 +58,57 @@ func ChargeEvent(c *fiber.Ctx, event stripe.Event) error {
 
 	switch subType {
 	case "succeeded":
-		// Update payment info
+		// Complete the payment, the owner gets the balance of the monthly payment in the same transaction. The event is sent
+		// again by stripe and the reconcile command, only the payment which is not completed yet is credited.
 		updates := map[string]interface{}{
 			"status":           models.PAYMENT_STATUS_COMPLETED,
 			"stripe_charge_id": charge.ID,
+			"paid_at":          time.Now(),
 		}
-		e := db.Model(&paymentInfo).Updates(updates).Error
+		completed := false
+		e := db.Transaction(func(tx *gorm.DB) error {
+			// The payment intent event can come after this one, the renter is informed of the monthly payment here then.
+			result := tx.Model(&models.Payment{}).Where("id = ? AND status IN ?", paymentInfo.ID, receivablePaymentStatuses).Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			received := result.RowsAffected == 1
+			if !received {
+				result = tx.Model(&models.Payment{}).Where("id = ? AND status = ?", paymentInfo.ID, models.PAYMENT_STATUS_SUCCEEDED).Updates(updates)
+				if result.Error != nil {
+					return result.Error
+				}
+			}
+			if result.RowsAffected != 1 {
+				return nil
+			}
+			completed = true
+			paymentInfo.Status = models.PAYMENT_STATUS_COMPLETED
+			if paymentInfo.IsFirstPayment {
+				return nil
+			}
+			if received {
+				err := queries.CreateNotifications(tx, paymentInfo.Reservation.CreatorID, models.NOTIFICATION_TYPE_PAYMENT_RECEIVED, paymentInfo.UID.String(), utils.PaymentNotificationData(&paymentInfo, &paymentInfo.Reservation))
+				if err != nil {
+					return err
+				}
+			}
+
+			// Give a balance to the user
+			balance := utils.GetOwnerBalanceShare(&paymentInfo)
+			return tx.Model(&models.User{}).Where("id = ?", paymentInfo.Reservation.RentalHouse.CreatorID.String()).Update("balance", gorm.Expr("balance + ?", balance)).Error
+		})
 		if e != nil {
 			fmt.Printf("[stripe webhook]️ Error updating payment info: %v\n", e)
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
-
-		if !paymentInfo.IsFirstPayment {
-			// Give a balance to the user
-			balance := paymentInfo.Amount
-			if paymentInfo.Reservation.RentalHouse.CommisionType == models.CommisionTypeOwnerPays {
-				commision := utils.GetPriceWithCommission(paymentInfo.Amount) - paymentInfo.Amount
-				balance = paymentInfo.Amount - commision
-			}
-			e := db.Model(&models.User{}).Where("id = ?", paymentInfo.Reservation.RentalHouse.CreatorID.String()).Update("balance", gorm.Expr("balance + ?", balance)).Error
-			if e != nil {
-				fmt.Printf("[stripe webhook]️ Error updating user balance: %v\n", e)
-			}
+		if !completed {
+			return c.SendStatus(fiber.StatusOK)
 		}
 
-		fmt.Println("[stripe webhook]️ Successful payment for %d %s.", charge.Amount, charge.Currency)
+		publishPaymentEvent(&paymentInfo)
+
+		fmt.Printf("[stripe webhook]️ Successful payment for %d %s.\n", charge.Amount, charge.Currency)
 	case "failed":
 		// Update payment info
 		e := db.Model(&paymentInfo).Update("status", models.PAYMENT_STATUS_FAILED).Error
@@ -83,7 +117,9 @@ func ChargeEvent(c *fiber.Ctx, event stripe.Event) error {
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
 
-		log.Println("[stripe webhook]️ Unsuccessful payment for %d %s.", charge.Amount, charge.Currency)
+		publishPaymentEvent(&paymentInfo)
+
+		log.Printf("[stripe webhook]️ Unsuccessful payment for %d %s.\n", charge.Amount, charge.Currency)
 	case "refunded":
 		// Update payment info
 		e := db.Model(&paymentInfo).Update("status", models.PAYMENT_STATUS_REFUNDED).Error
@@ -92,7 +128,18 @@ func ChargeEvent(c *fiber.Ctx, event stripe.Event) error {
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
 
-		log.Println("[stripe webhook]️ Refunded payment for %d %s.", charge.Amount, charge.Currency)
+		// Return the wallet balance and credits used for the payment in the same ratio with the card refund.
+		if charge.Amount > 0 && (paymentInfo.WalletAmount > 0 || paymentInfo.CreditAmount > 0) {
+			e = db.RefundPaymentTenders(paymentInfo.ID, paymentInfo.Reservation.CreatorID, float64(charge.AmountRefunded)/float64(charge.Amount))
+			if e != nil {
+				fmt.Printf("[stripe webhook]️ Error refunding payment tenders: %v\n", e)
+				return c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		publishPaymentEvent(&paymentInfo)
+
+		log.Printf("[stripe webhook]️ Refunded payment for %d %s.\n", charge.Amount, charge.Currency)
 	}
 
 	return c.SendStatus(fiber.StatusOK)
@@ -133,32 +180,318 @@ func PaymentIndentEvent(c *fiber.Ctx, event stripe.Event) error {
 
 	switch subType {
 	case "succeeded":
-		// Update payment info
-		e := db.Model(&paymentInfo).Update("status", models.PAYMENT_STATUS_SUCCEEDED).Error
+		// The first payment of the reservation which is cancelled or rejected before it is paid is refunded.
+		if paymentInfo.IsFirstPayment && isClosedReservation(paymentInfo.Reservation.Status) {
+			return refundClosedReservationPayment(c, db, &paymentInfo, &paymentIntent)
+		}
+
+		// The event is sent again by stripe if it is not answered in time, the handled payments are not notified again.
+		if paymentInfo.Status == models.PAYMENT_STATUS_SUCCEEDED {
+			return c.SendStatus(fiber.StatusOK)
+		}
+
+		// Update payment info, the renter is informed and the owner is asked to accept the reservation in the same transaction with the status.
+		// The charge event can come first, the completed payment stays completed but its reservation is still paid.
+		notified, closed := false, false
+		e := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.Payment{}).Where("id = ? AND status IN ?", paymentInfo.ID, receivablePaymentStatuses).
+				Update("status", models.PAYMENT_STATUS_SUCCEEDED)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				paymentInfo.Status = models.PAYMENT_STATUS_SUCCEEDED
+			}
+			if !paymentInfo.IsFirstPayment {
+				// The renter is informed by the charge event if it is handled first.
+				if result.RowsAffected == 0 {
+					return nil
+				}
+				notified = true
+				return queries.CreateNotifications(tx, paymentInfo.Reservation.CreatorID, models.NOTIFICATION_TYPE_PAYMENT_RECEIVED, paymentInfo.UID.String(), utils.PaymentNotificationData(&paymentInfo, &paymentInfo.Reservation))
+			}
+
+			// The reservation is paid once, whichever event of the payment comes first.
+			result = tx.Model(&models.Reservation{}).Where("id = ? AND status = ?", paymentInfo.ReservationID, models.RESERVATION_STATUS_PENDING).
+				Update("status", models.RESERVATION_STATUS_PAID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// The reservation can be cancelled after the payment is read.
+				var status models.ReservationStatus
+				if err := tx.Model(&models.Reservation{}).Where("id = ?", paymentInfo.ReservationID).Select("status").Scan(&status).Error; err != nil {
+					return err
+				}
+				closed = isClosedReservation(status)
+				return nil
+			}
+			paymentInfo.Reservation.Status = models.RESERVATION_STATUS_PAID
+			notified = true
+			if err := queries.CreateNotifications(tx, paymentInfo.Reservation.CreatorID, models.NOTIFICATION_TYPE_PAYMENT_RECEIVED, paymentInfo.UID.String(), utils.PaymentNotificationData(&paymentInfo, &paymentInfo.Reservation)); err != nil {
+				return err
+			}
+			return queries.CreateNotifications(tx, paymentInfo.Reservation.RentalHouse.CreatorID, models.NOTIFICATION_TYPE_RESERVATION_PAID, paymentInfo.Reservation.UID.String(), utils.ReservationNotificationData(&paymentInfo.Reservation))
+		})
 		if e != nil {
 			fmt.Printf("[stripe webhook]️ Error updating payment info: %v\n", e)
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
+		if closed {
+			return refundClosedReservationPayment(c, db, &paymentInfo, &paymentIntent)
+		}
+		if !notified {
+			return c.SendStatus(fiber.StatusOK)
+		}
 
 		if paymentInfo.IsFirstPayment {
-			e := db.Model(&paymentInfo.Reservation).Update("status", models.RESERVATION_STATUS_PAID).Error
-			if e != nil {
-				fmt.Printf("[stripe webhook]️ Error updating reservation status: %v\n", e)
-				return c.SendStatus(fiber.StatusInternalServerError)
-			}
+			publishReservationEvent(&paymentInfo.Reservation)
 		}
-		log.Println("[stripe webhook]️ Successful payment for %d %s.", paymentIntent.Amount, paymentIntent.Currency)
+		publishPaymentEvent(&paymentInfo)
+
+		log.Printf("[stripe webhook]️ Successful payment for %d %s.\n", paymentIntent.Amount, paymentIntent.Currency)
 	case "payment_failed":
-		// Update payment info
-		e := db.Model(&paymentInfo).Update("status", models.PAYMENT_STATUS_FAILED).Error
+		// Update payment info, the renter is informed in the same transaction with the status.
+		e := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&paymentInfo).Update("status", models.PAYMENT_STATUS_FAILED).Error; err != nil {
+				return err
+			}
+			return queries.CreateNotifications(tx, paymentInfo.Reservation.CreatorID, models.NOTIFICATION_TYPE_PAYMENT_FAILED, paymentInfo.UID.String(), utils.PaymentNotificationData(&paymentInfo, &paymentInfo.Reservation))
+		})
 		if e != nil {
 			fmt.Printf("[stripe webhook]️ Error updating payment info: %v\n", e)
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
 
-		log.Println("[stripe webhook]️ Unsuccessful payment for %d %s.", paymentIntent.Amount, paymentIntent.Currency)
+		publishPaymentEvent(&paymentInfo)
+
+		log.Printf("[stripe webhook]️ Unsuccessful payment for %d %s.\n", paymentIntent.Amount, paymentIntent.Currency)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// isClosedReservation returns true if the reservation is cancelled or rejected, its payments are not accepted.
+func isClosedReservation(status models.ReservationStatus) bool {
+	return status == models.RESERVATION_STATUS_CANCELLED || status == models.RESERVATION_STATUS_REJECTED
+}
+
+// refundClosedReservationPayment refunds the payment which succeeded after its reservation is cancelled or rejected,
+// e.g. the card payment is confirmed while the reservation is cancelled.
+func refundClosedReservationPayment(c *fiber.Ctx, db *database.Queries, paymentInfo *models.Payment, paymentIntent *stripe.PaymentIntent) error {
+	if paymentInfo.StripeRefundID != nil || paymentIntent.LatestCharge == nil {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	refund, err := utils.RefundCharge(paymentIntent.LatestCharge.ID)
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error refunding payment of closed reservation: %v\n", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	paymentInfo.Status = models.PAYMENT_STATUS_REFUNDED
+	paymentInfo.StripeRefundID = &refund.ID
+	err = db.Model(&models.Payment{}).Where("id = ?", paymentInfo.ID).Updates(map[string]interface{}{
+		"status":           paymentInfo.Status,
+		"stripe_charge_id": paymentIntent.LatestCharge.ID,
+		"stripe_refund_id": refund.ID,
+	}).Error
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error updating payment info: %v\n", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// Return the wallet balance and credits used for the payment.
+	err = db.RefundPaymentTenders(paymentInfo.ID, paymentInfo.Reservation.CreatorID, 1)
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error refunding payment tenders: %v\n", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	publishPaymentEvent(paymentInfo)
+
+	log.Printf("[stripe webhook]️ Refunded payment %d of closed reservation.\n", paymentInfo.ID)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func getDisputeStatus(status stripe.DisputeStatus) models.DisputeStatus {
+	switch status {
+	case stripe.DisputeStatusWarningUnderReview, stripe.DisputeStatusUnderReview:
+		return models.DISPUTE_STATUS_UNDER_REVIEW
+	case stripe.DisputeStatusWon:
+		return models.DISPUTE_STATUS_WON
+	case stripe.DisputeStatusLost:
+		return models.DISPUTE_STATUS_LOST
+	case stripe.DisputeStatusWarningClosed:
+		return models.DISPUTE_STATUS_WARNING_CLOSED
+	case stripe.DisputeStatusChargeRefunded:
+		return models.DISPUTE_STATUS_CHARGE_REFUNDED
+	}
+	return models.DISPUTE_STATUS_NEEDS_RESPONSE
+}
+
+// closeDispute releases the frozen balance to the owner if the dispute is won, or debits it if lost.
+// The payment gets back the status it had before the dispute if the dispute is won.
+func closeDispute(tx *gorm.DB, dispute *models.Dispute) error {
+	ownerId := dispute.Payment.Reservation.RentalHouse.CreatorID.String()
+	paymentStatus := dispute.PaymentStatus
+	if paymentStatus == 0 {
+		// The disputes opened before the status is saved were on the completed payments.
+		paymentStatus = models.PAYMENT_STATUS_COMPLETED
+	}
+	userUpdates := map[string]interface{}{
+		"balance":        gorm.Expr("balance + ?", dispute.FrozenAmount),
+		"frozen_balance": gorm.Expr("frozen_balance - ?", dispute.FrozenAmount),
+	}
+	switch dispute.Status {
+	case models.DISPUTE_STATUS_LOST:
+		paymentStatus = models.PAYMENT_STATUS_CHARGEBACK
+		userUpdates = map[string]interface{}{"frozen_balance": gorm.Expr("frozen_balance - ?", dispute.FrozenAmount)}
+	case models.DISPUTE_STATUS_CHARGE_REFUNDED:
+		paymentStatus = models.PAYMENT_STATUS_REFUNDED
+		userUpdates = map[string]interface{}{"frozen_balance": gorm.Expr("frozen_balance - ?", dispute.FrozenAmount)}
+	}
+
+	if dispute.FrozenAmount > 0 {
+		err := tx.Model(&models.User{}).Where("id = ?", ownerId).Updates(userUpdates).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.Payment{}).Where("id = ?", dispute.PaymentID).Update("status", paymentStatus).Error
+}
+
+func DisputeEvent(c *fiber.Ctx, event stripe.Event) error {
+	var disputeInfo stripe.Dispute
+	err := json.Unmarshal(event.Data.Raw, &disputeInfo)
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error parsing webhook JSON: %v\n", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	validEvents := map[string]bool{"created": true, "updated": true, "closed": true}
+	subType := strings.TrimPrefix(event.Type, "charge.dispute.")
+	if _, ok := validEvents[subType]; !ok {
+		fmt.Printf("[stripe webhook]️ Unhandled event type: %s\n", event.Type)
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error opening database connection: %v\n", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// Get dispute info from stripe dispute id
+	dispute, err := db.GetDisputeWithStripeID(disputeInfo.ID)
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error getting dispute info: %v\n", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var evidenceDueBy *time.Time
+	if disputeInfo.EvidenceDetails != nil && disputeInfo.EvidenceDetails.DueBy > 0 {
+		dueBy := time.Unix(disputeInfo.EvidenceDetails.DueBy, 0)
+		evidenceDueBy = &dueBy
+	}
+
+	if dispute.ID == 0 {
+		if disputeInfo.PaymentIntent == nil {
+			fmt.Printf("[stripe webhook]️ Dispute has no payment intent: %s\n", disputeInfo.ID)
+			return c.SendStatus(fiber.StatusOK)
+		}
+
+		// Get payment info from payment intent id
+		paymentInfo, err := db.GetPaymentWithSPI(disputeInfo.PaymentIntent.ID)
+		if err != nil {
+			fmt.Printf("[stripe webhook]️ Error getting payment info: %v\n", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if paymentInfo.ID == 0 {
+			fmt.Printf("[stripe webhook]️ Payment info not found: %s\n", disputeInfo.PaymentIntent.ID)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+
+		dispute = models.Dispute{
+			UID:             uuid.New(),
+			PaymentID:       paymentInfo.ID,
+			Payment:         paymentInfo,
+			StripeDisputeID: disputeInfo.ID,
+			Amount:          float64(disputeInfo.Amount) / 100,
+			Currency:        paymentInfo.Currency,
+			Reason:          string(disputeInfo.Reason),
+			Status:          getDisputeStatus(disputeInfo.Status),
+			PaymentStatus:   paymentInfo.Status,
+			EvidenceDueBy:   evidenceDueBy,
+		}
+
+		// Freeze the disputed part of the balance given to the owner.
+		// The owner's balance is given after the first payment only when the reservation is accepted.
+		if !paymentInfo.IsFirstPayment || paymentInfo.Reservation.Status == models.RESERVATION_STATUS_ACCEPTED {
+			ratio := 1.0
+			if paymentInfo.Amount > 0 && dispute.Amount < paymentInfo.Amount {
+				ratio = dispute.Amount / paymentInfo.Amount
+			}
+			dispute.FrozenAmount = math.Round(utils.GetOwnerBalanceShare(&paymentInfo)*ratio*100) / 100
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Payment").Create(&dispute).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Payment{}).Where("id = ?", paymentInfo.ID).Update("status", models.PAYMENT_STATUS_DISPUTED).Error; err != nil {
+				return err
+			}
+			if dispute.FrozenAmount > 0 {
+				err := tx.Model(&models.User{}).Where("id = ?", paymentInfo.Reservation.RentalHouse.CreatorID.String()).Updates(map[string]interface{}{
+					"balance":        gorm.Expr("balance - ?", dispute.FrozenAmount),
+					"frozen_balance": gorm.Expr("frozen_balance + ?", dispute.FrozenAmount),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			if dispute.IsClosed() {
+				return closeDispute(tx, &dispute)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("[stripe webhook]️ Error creating dispute: %v\n", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+
+		log.Printf("[stripe webhook]️ Dispute created for %d %s.\n", disputeInfo.Amount, disputeInfo.Currency)
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	// Closed disputes are final, ignore late events.
+	if dispute.IsClosed() {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	dispute.Status = getDisputeStatus(disputeInfo.Status)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"status":          dispute.Status,
+			"evidence_due_by": evidenceDueBy,
+		}
+		if dispute.IsClosed() {
+			updates["closed_at"] = time.Now()
+		}
+		if err := tx.Model(&models.Dispute{}).Where("id = ?", dispute.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if dispute.IsClosed() {
+			return closeDispute(tx, &dispute)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[stripe webhook]️ Error updating dispute: %v\n", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
+	log.Printf("[stripe webhook]️ Dispute %s is %s.\n", disputeInfo.ID, disputeInfo.Status)
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -184,6 +517,8 @@ func StripeWebhook(c *fiber.Ctx) error {
 
 	if strings.HasPrefix(event.Type, "payment_intent.") {
 		return PaymentIndentEvent(c, event)
+	} else if strings.HasPrefix(event.Type, "charge.dispute.") {
+		return DisputeEvent(c, event)
 	} else if strings.HasPrefix(event.Type, "charge.") {
 		return ChargeEvent(c, event)
 	}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"ekira-backend/app/errs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"math"
+	"strconv"
+	"time"
+)
+
+// TaxLine is the tax line of a payment shown to the users.
+type TaxLine struct {
+	Name     string  `json:"name" example:"KDV"`
+	Rate     float64 `json:"rate" example:"10"`
+	Base     float64 `json:"base" example:"892.86"`
+	Amount   float64 `json:"amount" example:"89.29"`
+	Withheld bool    `json:"withheld" example:"false"`
+}
+
+func newTaxLines(taxes []models.PaymentTax) []TaxLine {
+	lines := make([]TaxLine, 0, len(taxes))
+	for _, tax := range taxes {
+		lines = append(lines, TaxLine{
+			Name:     tax.TypeName(),
+			Rate:     tax.Rate,
+			Base:     tax.Base,
+			Amount:   tax.Amount,
+			Withheld: tax.Withheld,
+		})
+	}
+	return lines
+}
+
+// GetAnnualRentalIncomeReport method
+// @Description Get annual rental income report of the owned rental houses for tax declaration, amounts are in TRY
+// @Summary Get annual rental income report of the owned rental houses
+// @Tags Tax
+// @Accept json
+// @Produce json
+// @Param year query int false "Year" default(2024)
+// @Success 200 {object} models.ResponseOK{result=controllers.GetAnnualRentalIncomeReport.Response}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /tax/annual-report [get]
+func GetAnnualRentalIncomeReport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	year := time.Now().Year()
+	if c.Query("year") != "" {
+		y, err := strconv.Atoi(c.Query("year"))
+		if err != nil || y < 2000 || y > time.Now().Year() {
+			return c.Status(errs.ErrBadRequest.StatusCode).JSON(models.NewResponseError(errs.ErrBadRequest).SetHeader("year", "invalid year"))
+		}
+		year = y
+	}
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	// Get completed payments of the year.
+	payments, err := db.GetOwnerCompletedPaymentsInYear(user.ID, year)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Summary struct {
+		GrossRent        float64 `json:"gross_rent"`
+		Stopaj           float64 `json:"stopaj"`
+		KDV              float64 `json:"kdv"`
+		AccommodationTax float64 `json:"accommodation_tax"`
+		Commision        float64 `json:"commision"`
+		NetIncome        float64 `json:"net_income"`
+	}
+	type Listing struct {
+		ID       string  `json:"id"`
+		Title    string  `json:"title"`
+		Category string  `json:"category" example:"Konut"`
+		Summary  Summary `json:"summary"`
+	}
+	type Response struct {
+		Year                     int       `json:"year"`
+		Currency                 string    `json:"currency" example:"TRY"`
+		Listings                 []Listing `json:"listings"`
+		Categories               []Listing `json:"categories"`
+		Total                    Summary   `json:"total"`
+		ResidentialExemption     float64   `json:"residential_exemption"`
+		TaxableResidentialIncome float64   `json:"taxable_residential_income"`
+	}
+
+	add := func(s *Summary, payment *models.Payment) {
+		gross := payment.AmountGross
+		commision := 0.0
+		if payment.Reservation.RentalHouse.CommisionType == models.CommisionTypeOwnerPays {
+			commision = utils.GetPriceWithCommission(payment.AmountGross, payment.Currency) - payment.AmountGross
+		}
+		for _, tax := range payment.Taxes {
+			switch tax.Type {
+			case models.TAX_TYPE_STOPAJ:
+				// Gross rent includes the stopaj withheld by the renter.
+				gross += tax.Amount
+				s.Stopaj += payment.ToDefaultCurrency(tax.Amount)
+			case models.TAX_TYPE_KDV:
+				s.KDV += payment.ToDefaultCurrency(tax.Amount)
+			case models.TAX_TYPE_ACCOMMODATION:
+				s.AccommodationTax += payment.ToDefaultCurrency(tax.Amount)
+			case models.TAX_TYPE_COMMISSION_KDV:
+				// The commission paid by the renter and its KDV are the income of the platform.
+				gross -= tax.Base + tax.Amount
+			}
+		}
+		s.GrossRent += payment.ToDefaultCurrency(gross)
+		s.Commision += payment.ToDefaultCurrency(commision)
+	}
+	finish := func(s *Summary) {
+		s.NetIncome = utils.RoundPrice(s.GrossRent - s.Stopaj - s.KDV - s.AccommodationTax - s.Commision)
+		s.GrossRent = utils.RoundPrice(s.GrossRent)
+		s.Stopaj = utils.RoundPrice(s.Stopaj)
+		s.KDV = utils.RoundPrice(s.KDV)
+		s.AccommodationTax = utils.RoundPrice(s.AccommodationTax)
+		s.Commision = utils.RoundPrice(s.Commision)
+	}
+
+	res := Response{Year: year, Currency: string(models.DefaultCurrency), Listings: []Listing{}, Categories: []Listing{}}
+	listings := map[int]int{}
+	categories := map[string]int{}
+	for i := range payments {
+		payment := &payments[i]
+		rentalHouse := payment.Reservation.RentalHouse
+
+		// Daily rentals are declared as accommodation income, others by the listing type.
+		category := rentalHouse.ListingType.Name()
+		if rentalHouse.RentPeriod == models.RentPeriodDay {
+			category = "Günlük Konaklama"
+		}
+
+		index, ok := listings[rentalHouse.ID]
+		if !ok {
+			index = len(res.Listings)
+			listings[rentalHouse.ID] = index
+			res.Listings = append(res.Listings, Listing{ID: rentalHouse.UID.String(), Title: rentalHouse.Title, Category: category})
+		}
+		add(&res.Listings[index].Summary, payment)
+
+		index, ok = categories[category]
+		if !ok {
+			index = len(res.Categories)
+			categories[category] = index
+			res.Categories = append(res.Categories, Listing{Category: category})
+		}
+		add(&res.Categories[index].Summary, payment)
+
+		add(&res.Total, payment)
+	}
+	for i := range res.Listings {
+		finish(&res.Listings[i].Summary)
+	}
+	residentialIncome := 0.0
+	for i := range res.Categories {
+		finish(&res.Categories[i].Summary)
+		if res.Categories[i].Category == models.ListingTypeResidential.Name() {
+			residentialIncome = res.Categories[i].Summary.GrossRent
+		}
+	}
+	finish(&res.Total)
+
+	// Residential income under the exemption is not taxable.
+	res.ResidentialExemption = utils.RESIDENTIAL_INCOME_EXEMPTION[year]
+	res.TaxableResidentialIncome = utils.RoundPrice(math.Max(0, residentialIncome-res.ResidentialExemption))
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
@@ -5,14 +5,13 @@ import (
 	"ekira-backend/app/models"
 	"ekira-backend/pkg/utils"
 	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
 	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"os"
 	"regexp"
-	"strings"
 	"time"
 )
 
@@ -273,39 +272,19 @@ func SetProfileImage(c *fiber.Ctx) error {
 
 	form, err := c.MultipartForm()
 	if err == nil {
-		// Get all files from form field "images".
-		file := form.File["image"][0]
-
-		// Is file image?
-		if !strings.HasPrefix(file.Header["Content-Type"][0], "image/") {
-			fmt.Println("hata2, file is not image")
-			return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage).SetHeader("image", "file is not image"))
-		}
-
-		// Get file extension.
-		f, ee := file.Open()
-		if ee != nil {
-			// File not found or cannot be opened.
-			fmt.Println("hata2, file not found or cannot be opened")
-			return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("image", ee.Error()))
-		}
-
-		// Get file content type and check if it is a valid image.
-		contentType, err := utils.GetFileContentType(f)
-		if err != nil || contentType != file.Header.Get("Content-type") {
-			fmt.Println("hata2, content type is not valid")
-			return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage).SetHeader("image", "content type is not valid").SetHeader("content-type", contentType).SetHeader("req-content-type", file.Header.Get("Content-type")))
-		}
-		if !utils.ValidImageContentType(file.Header.Get("Content-type")) {
-			fmt.Println("hata2, content type is not valid")
-			return c.Status(errs.ErrInvalidImage.StatusCode).JSON(models.NewResponseError(errs.ErrInvalidImage).SetHeader("image", "content type is not valid").SetHeader("content-type", contentType))
+		// Check the image, the format is detected from the content.
+		upload, err := utils.ValidateImageUpload(form, "image", utils.ProfileImageLimits())
+		if err != nil {
+			return imageUploadError(c, err)
 		}
-
-		// Close file.
-		f.Close()
+		file := upload.File
 
 		// Create files.
-		images, err := utils.CreateProfileImageFile(file, "public/photos/profile")
+		store, err := storage.NewStorage()
+		if err != nil {
+			return c.Status(errs.ErrUploadImage.StatusCode).JSON(models.NewResponseError(errs.ErrUploadImage).SetHeader("storage", err.Error()))
+		}
+		images, err := utils.CreateProfileImageFile(file, store, utils.ProfileImagePrefix)
 		if err != nil || len(images) == 0 {
 			fmt.Println("hata2, file cannot be created")
 			return c.Status(errs.ErrImageProc.StatusCode).JSON(models.NewResponseError(errs.ErrImageProc).SetHeader("image", err.Error()))
@@ -317,7 +296,7 @@ func SetProfileImage(c *fiber.Ctx) error {
 			Images: make([]models.UserProfileImageInfo, len(images)),
 		}
 		for i, image := range images {
-			result.Images[i].URL = fmt.Sprintf("%s/photos/profile/%s", os.Getenv("API_URL"), image.Filename)
+			result.Images[i].URL = image.URL
 			result.Images[i].Width = image.Width
 			result.Images[i].Height = image.Height
 		}
@@ -1,8 +1,13 @@
 package controllers
 
 import (
+	"ekira-backend/app/errs"
 	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"time"
 )
 
 // GetWalletBalance
@@ -24,3 +29,64 @@ func GetWalletBalance(c *fiber.Ctx) error {
 	// Return status 200 OK.
 	return c.JSON(models.NewResponseOK(&user.Balance))
 }
+
+// GetWalletCredits
+// @Description Get available platform credits and wallet balance
+// @Summary Get available platform credits
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK{result=controllers.GetWalletCredits.Response{credits=[]controllers.GetWalletCredits.Credit}}
+// @Failure 400 {object} models.ResponseErr
+// @Failure 500 {object} models.ResponseErr
+// @Security Authentication
+// @Router /wallet/credits [get]
+func GetWalletCredits(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	// Create database connection.
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection).SetHeader("db", err.Error()))
+	}
+
+	credits, err := db.GetAvailableCredits(user.ID)
+	if err != nil {
+		return c.Status(errs.ErrDatabaseQuery.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseQuery).SetHeader("db", err.Error()))
+	}
+
+	type Credit struct {
+		ID        uuid.UUID  `json:"id"`
+		Amount    float64    `json:"amount"`
+		Remaining float64    `json:"remaining"`
+		Reason    string     `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		CreatedAt time.Time  `json:"created_at"`
+	}
+	type Response struct {
+		Balance       float64         `json:"balance"`
+		CreditBalance float64         `json:"credit_balance"`
+		Currency      models.Currency `json:"currency"`
+		Credits       []Credit        `json:"credits"`
+	}
+	res := Response{
+		Balance:  user.Balance,
+		Currency: models.DefaultCurrency,
+		Credits:  make([]Credit, 0),
+	}
+	for _, credit := range credits {
+		res.CreditBalance += credit.Remaining
+		res.Credits = append(res.Credits, Credit{
+			ID:        credit.UID,
+			Amount:    credit.Amount,
+			Remaining: credit.Remaining,
+			Reason:    credit.Reason,
+			ExpiresAt: credit.ExpiresAt,
+			CreatedAt: credit.CreatedAt,
+		})
+	}
+	res.CreditBalance = utils.RoundPrice(res.CreditBalance)
+
+	// Return status 200 OK.
+	return c.JSON(models.NewResponseOK(&res))
+}
@@ -0,0 +1,339 @@
+package jobs
+
+import (
+	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// imageQueueKey is the redis list of the image ids waiting for processing.
+	imageQueueKey = "image-processing:queue"
+	// imageProcessingKeyPrefix is the redis list of the image ids which are processed by an instance.
+	imageProcessingKeyPrefix = "image-processing:processing:"
+	// imageMaxAttempts is the number of tries before the image is failed.
+	imageMaxAttempts = 3
+	// imageRetryDelay is the wait before the next attempt of a failed image, it is multiplied by the attempts.
+	imageRetryDelay = time.Minute
+	// imageRetryBatchSize is the number of the images queued again at once.
+	imageRetryBatchSize = 100
+	// messageImageQueuePrefix marks the message attachments in the queue, the other ids are the rental house images.
+	messageImageQueuePrefix = "message:"
+)
+
+// ImageProcessingTimeout is the time after which a processing image is queued again, e.g. if its instance is stopped
+// or the database is not available while it is processed.
+const ImageProcessingTimeout = 10 * time.Minute
+
+// EnqueueImageProcessing adds the uploaded image to the processing queue.
+func EnqueueImageProcessing(imageId uuid.UUID) error {
+	rds := database.NewRConnection()
+	defer rds.RClose()
+	return rds.RLPush(imageQueueKey, imageId.String())
+}
+
+// EnqueueMessageImageProcessing adds the uploaded message attachment to the processing queue.
+func EnqueueMessageImageProcessing(attachmentId uuid.UUID) error {
+	rds := database.NewRConnection()
+	defer rds.RClose()
+	return rds.RLPush(imageQueueKey, messageImageQueuePrefix+attachmentId.String())
+}
+
+// StartImageProcessingWorkers starts IMAGE_WORKERS workers (2 by default) which create the variants of the uploaded rental house
+// and message images.
+// The images are moved to the processing list of the instance while they are processed, the images left there by a stopped
+// instance with the same IMAGE_WORKER_ID (the host name by default) are queued again on start. The failed images are
+// queued again by their next attempt time, so the workers do not wait for them.
+func StartImageProcessingWorkers() {
+	workers, err := strconv.Atoi(os.Getenv("IMAGE_WORKERS"))
+	if err != nil || workers <= 0 {
+		workers = 2
+	}
+	workerId := os.Getenv("IMAGE_WORKER_ID")
+	if workerId == "" {
+		workerId, _ = os.Hostname()
+	}
+	processingKey := imageProcessingKeyPrefix + workerId
+
+	rds := database.NewRConnection()
+	for {
+		id, err := rds.RRPopLPush(processingKey, imageQueueKey)
+		if err != nil {
+			log.Printf("image processing: unfinished images cannot be queued again: %v\n", err)
+			break
+		}
+		if id == "" {
+			break
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			// Each worker keeps its database connection.
+			db := openImageWorkerDB()
+			for {
+				id, err := rds.RBRPopLPush(imageQueueKey, processingKey, 10*time.Second)
+				if err != nil {
+					log.Printf("image processing: queue cannot be read: %v\n", err)
+					time.Sleep(5 * time.Second)
+					continue
+				}
+				if id == "" {
+					continue
+				}
+				if strings.HasPrefix(id, messageImageQueuePrefix) {
+					processMessageImage(db, strings.TrimPrefix(id, messageImageQueuePrefix))
+				} else {
+					processUploadedImage(db, id)
+				}
+				if err := rds.RLRem(processingKey, id); err != nil {
+					log.Printf("image processing: %s cannot be removed from the processing list: %v\n", id, err)
+				}
+			}
+		}()
+	}
+
+	// The failed images are queued again when their next attempt time comes.
+	go func() {
+		for {
+			retryImages(rds)
+			time.Sleep(30 * time.Second)
+		}
+	}()
+}
+
+// openImageWorkerDB opens the database connection of a worker, it is tried until the database is available.
+func openImageWorkerDB() *database.Queries {
+	for {
+		db, err := database.OpenDBConnection()
+		if err == nil {
+			return db
+		}
+		log.Printf("image processing: database connection failed: %v\n", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// retryImages adds the processing images whose next attempt time has come to the queue.
+func retryImages(rds database.RedisCon) {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("image processing: database connection failed: %v\n", err)
+		return
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	for {
+		ids, err := db.ClaimRetryRentalHouseImages(imageRetryBatchSize, ImageProcessingTimeout)
+		if err != nil {
+			log.Printf("image processing: images to retry cannot be read: %v\n", err)
+			return
+		}
+		for _, id := range ids {
+			if err := rds.RLPush(imageQueueKey, id.String()); err != nil {
+				log.Printf("image processing: %s cannot be queued again: %v\n", id, err)
+			}
+		}
+		if len(ids) < imageRetryBatchSize {
+			break
+		}
+	}
+
+	for {
+		ids, err := db.ClaimRetryMessageAttachments(imageRetryBatchSize, ImageProcessingTimeout)
+		if err != nil {
+			log.Printf("image processing: message images to retry cannot be read: %v\n", err)
+			return
+		}
+		for _, id := range ids {
+			if err := rds.RLPush(imageQueueKey, messageImageQueuePrefix+id.String()); err != nil {
+				log.Printf("image processing: message image %s cannot be queued again: %v\n", id, err)
+			}
+		}
+		if len(ids) < imageRetryBatchSize {
+			return
+		}
+	}
+}
+
+// processUploadedImage creates the variants of the uploaded image, the failed images are tried again until imageMaxAttempts.
+// The images which can not be read or saved are queued again after ImageProcessingTimeout.
+func processUploadedImage(db *database.Queries, id string) {
+	image, err := db.GetRentalHouseImageByID(id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("image processing: %s cannot be read: %v\n", id, err)
+		}
+		return
+	}
+	if image.Status != models.IMAGE_STATUS_PROCESSING {
+		return
+	}
+
+	images, err := createImageVariants(image.SourceKey, image.ID, utils.RentalHouseImagePrefix)
+	if err != nil {
+		failImage(db, &image, err)
+		return
+	}
+
+	infos := imageInfos(images)
+	err = db.SetRentalHouseImageProcessed(image.ID, infos, images[0].Checksum, images[0].PHash)
+	if errors.Is(err, queries.ErrImageAlreadyHandled) {
+		// The image is handled by another worker, its upload is removed by that worker.
+		return
+	}
+	if err != nil {
+		log.Printf("image processing: %s cannot be saved: %v\n", id, err)
+		return
+	}
+	deleteUpload(image.SourceKey)
+}
+
+// processMessageImage creates the variants of the uploaded message attachment like processUploadedImage.
+func processMessageImage(db *database.Queries, id string) {
+	attachmentId, err := uuid.Parse(id)
+	if err != nil {
+		log.Printf("image processing: message image %s is not valid: %v\n", id, err)
+		return
+	}
+	attachment, err := db.GetMessageAttachment(attachmentId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("image processing: message image %s cannot be read: %v\n", id, err)
+		}
+		return
+	}
+	if attachment.Status != models.IMAGE_STATUS_PROCESSING {
+		return
+	}
+
+	images, err := createImageVariants(attachment.SourceKey, attachment.ID, utils.MessageImagePrefix)
+	if err != nil {
+		failMessageImage(db, &attachment, err)
+		return
+	}
+
+	err = db.SetMessageAttachmentProcessed(attachment.ID, imageInfos(images))
+	if errors.Is(err, queries.ErrImageAlreadyHandled) {
+		// The attachment is handled by another worker, its upload is removed by that worker.
+		return
+	}
+	if err != nil {
+		log.Printf("image processing: message image %s cannot be saved: %v\n", id, err)
+		return
+	}
+	deleteUpload(attachment.SourceKey)
+}
+
+// createImageVariants creates the variants of the raw upload under the prefix of the storage.
+func createImageVariants(sourceKey string, id uuid.UUID, prefix string) ([]utils.CreatedImage, error) {
+	uploads, err := storage.NewUploadStorage()
+	if err != nil {
+		return nil, err
+	}
+	store, err := storage.NewStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := uploads.Get(sourceKey)
+	if err != nil {
+		return nil, err
+	}
+	images, err := utils.CreateImageFile(source, id, store, prefix)
+	source.Close()
+	if err == nil && len(images) == 0 {
+		err = errors.New("no image is created")
+	}
+	return images, err
+}
+
+// imageInfos returns the saved infos of the created image variants.
+func imageInfos(images []utils.CreatedImage) models.RentalHouseImagesArray {
+	infos := make(models.RentalHouseImagesArray, len(images))
+	for i, created := range images {
+		infos[i] = models.RentalHouseImageInfo{
+			URL:      created.URL,
+			Width:    created.Width,
+			Height:   created.Height,
+			Format:   created.Format,
+			Blurhash: created.Blurhash,
+		}
+	}
+	return infos
+}
+
+// deleteUpload removes the raw upload after its image is processed or failed.
+func deleteUpload(sourceKey string) {
+	uploads, err := storage.NewUploadStorage()
+	if err == nil {
+		err = uploads.Delete(sourceKey)
+	}
+	if err != nil {
+		log.Printf("image processing: upload %s cannot be removed: %v\n", sourceKey, err)
+	}
+}
+
+// failImage saves the failed attempt, the image is queued again after a delay until imageMaxAttempts.
+func failImage(db *database.Queries, image *models.RentalHouseImage, cause error) {
+	attempts := image.Attempts + 1
+	status := models.IMAGE_STATUS_PROCESSING
+	nextAttemptAt := time.Now().Add(time.Duration(attempts) * imageRetryDelay)
+	if attempts >= imageMaxAttempts {
+		status = models.IMAGE_STATUS_FAILED
+	}
+	log.Printf("image processing: %s failed (attempt %d): %v\n", image.ID, attempts, cause)
+
+	if status == models.IMAGE_STATUS_FAILED {
+		err := db.SetRentalHouseImageAttempt(image.ID, attempts, status, cause.Error(), nil)
+		if errors.Is(err, queries.ErrImageAlreadyHandled) {
+			return
+		}
+		if err != nil {
+			log.Printf("image processing: %s cannot be saved: %v\n", image.ID, err)
+			return
+		}
+		deleteUpload(image.SourceKey)
+		return
+	}
+	err := db.SetRentalHouseImageAttempt(image.ID, attempts, status, cause.Error(), &nextAttemptAt)
+	if err != nil && !errors.Is(err, queries.ErrImageAlreadyHandled) {
+		log.Printf("image processing: %s cannot be saved: %v\n", image.ID, err)
+	}
+}
+
+// failMessageImage saves the failed attempt of the message attachment like failImage.
+func failMessageImage(db *database.Queries, attachment *models.MessageAttachment, cause error) {
+	attempts := attachment.Attempts + 1
+	log.Printf("image processing: message image %s failed (attempt %d): %v\n", attachment.ID, attempts, cause)
+
+	if attempts >= imageMaxAttempts {
+		err := db.SetMessageAttachmentAttempt(attachment.ID, attempts, models.IMAGE_STATUS_FAILED, cause.Error(), nil)
+		if errors.Is(err, queries.ErrImageAlreadyHandled) {
+			return
+		}
+		if err != nil {
+			log.Printf("image processing: message image %s cannot be saved: %v\n", attachment.ID, err)
+			return
+		}
+		deleteUpload(attachment.SourceKey)
+		return
+	}
+	nextAttemptAt := time.Now().Add(time.Duration(attempts) * imageRetryDelay)
+	err := db.SetMessageAttachmentAttempt(attachment.ID, attempts, models.IMAGE_STATUS_PROCESSING, cause.Error(), &nextAttemptAt)
+	if err != nil && !errors.Is(err, queries.ErrImageAlreadyHandled) {
+		log.Printf("image processing: message image %s cannot be saved: %v\n", attachment.ID, err)
+	}
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
+	"log"
+	"time"
+)
+
+const (
+	// messageAttachmentExpiry is the time after which the uploaded attachments which are not sent are removed.
+	messageAttachmentExpiry = 24 * time.Hour
+	// messageAttachmentCleanupBatchSize is the number of the attachments removed at once.
+	messageAttachmentCleanupBatchSize = 100
+)
+
+// removeUnsentMessageAttachments removes the expired attachments which are not sent with a message and their files.
+func removeUnsentMessageAttachments() {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("[message] Error connecting to database: %v\n", err)
+		return
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	store, err := storage.NewStorage()
+	if err != nil {
+		log.Printf("[message] Error opening storage: %v\n", err)
+		return
+	}
+	uploads, err := storage.NewUploadStorage()
+	if err != nil {
+		log.Printf("[message] Error opening upload storage: %v\n", err)
+		return
+	}
+
+	removed := 0
+	for {
+		attachments, err := db.DeleteUnsentMessageAttachments(time.Now().Add(-messageAttachmentExpiry), messageAttachmentCleanupBatchSize)
+		if err != nil {
+			log.Printf("[message] Error removing attachments: %v\n", err)
+			break
+		}
+		for _, attachment := range attachments {
+			urls := make([]string, len(attachment.Images))
+			for i, image := range attachment.Images {
+				urls[i] = image.URL
+			}
+			if err := utils.RemoveImageFiles(store, utils.MessageImagePrefix, urls...); err != nil {
+				log.Printf("[message] Error removing files of attachment %s: %v\n", attachment.ID, err)
+			}
+			if attachment.SourceKey != "" {
+				if err := uploads.Delete(attachment.SourceKey); err != nil {
+					log.Printf("[message] Error removing upload of attachment %s: %v\n", attachment.ID, err)
+				}
+			}
+		}
+		removed += len(attachments)
+		if len(attachments) < messageAttachmentCleanupBatchSize {
+			break
+		}
+	}
+	if removed > 0 {
+		log.Printf("[message] %d unsent attachments removed\n", removed)
+	}
+}
+
+// StartMessageAttachmentCleanupJob removes the attachments which are not sent in a day every hour.
+func StartMessageAttachmentCleanupJob() {
+	go func() {
+		for {
+			removeUnsentMessageAttachments()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
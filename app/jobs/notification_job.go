@@ -0,0 +1,254 @@
+package jobs
+
+import (
+	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/notification"
+	"ekira-backend/platform/push"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// notificationBatchSize is the number of the notifications claimed by a worker at once.
+	notificationBatchSize = 50
+	// notificationLease is the time the claimed notifications are kept from the other workers.
+	notificationLease = 5 * time.Minute
+	// notificationMaxAttempts is the number of tries before the notification is failed.
+	notificationMaxAttempts = 5
+)
+
+// Reasons of the skipped notifications, they are not tried again.
+var (
+	errNoAddress       = errors.New("user has no address for the channel")
+	errNoDevice        = errors.New("user has no device for push")
+	errChannelDisabled = errors.New("channel is disabled by the user")
+)
+
+// notificationRetryDelay returns the wait before the next attempt, 1, 4, 9 and 16 minutes.
+func notificationRetryDelay(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * time.Minute
+}
+
+// deliverNotification renders the notification with the current settings of the user and sends it.
+func deliverNotification(db *database.Queries, senders map[models.NotificationChannel]notification.Sender, pushSenders map[models.DevicePlatform]push.Sender, item *models.Notification) {
+	preference, err := db.GetNotificationPreference(item.UserID)
+	if err == nil {
+		if item.Channel == models.NOTIFICATION_CHANNEL_PUSH {
+			err = sendPushNotification(db, pushSenders, item, &preference)
+		} else {
+			err = sendNotification(senders, item, &preference)
+		}
+	}
+
+	item.Attempts++
+	status := models.NOTIFICATION_STATUS_SENT
+	message := ""
+	nextAttemptAt := time.Now()
+	switch {
+	case errors.Is(err, errNoAddress) || errors.Is(err, errNoDevice) || errors.Is(err, errChannelDisabled):
+		status = models.NOTIFICATION_STATUS_SKIPPED
+		message = err.Error()
+	case err != nil:
+		message = err.Error()
+		status = models.NOTIFICATION_STATUS_PENDING
+		nextAttemptAt = nextAttemptAt.Add(notificationRetryDelay(item.Attempts))
+		if item.Attempts >= notificationMaxAttempts {
+			status = models.NOTIFICATION_STATUS_FAILED
+		}
+		log.Printf("notification: %s failed (attempt %d): %v\n", item.UID, item.Attempts, err)
+	}
+
+	if err := db.SetNotificationResult(item, status, message, nextAttemptAt); err != nil {
+		log.Printf("notification: %s cannot be saved: %v\n", item.UID, err)
+	}
+}
+
+func sendNotification(senders map[models.NotificationChannel]notification.Sender, item *models.Notification, preference *models.NotificationPreference) error {
+	to := item.User.Email
+	enabled := preference.Email
+	if item.Channel == models.NOTIFICATION_CHANNEL_SMS {
+		to = item.User.PhoneNumber
+		enabled = preference.SMS
+	}
+	if to == "" {
+		return errNoAddress
+	}
+	if !enabled {
+		return errChannelDisabled
+	}
+	sender, ok := senders[item.Channel]
+	if !ok {
+		return errors.New("no sender for channel " + item.Channel.Name())
+	}
+
+	subject, body, err := utils.RenderNotification(item.Type, item.Channel, preference.Language, item.Data)
+	if err != nil {
+		return err
+	}
+	return sender.Send(notification.Message{To: to, Subject: subject, Body: body})
+}
+
+// sendPushNotification sends the notification to all devices of the user. The tokens rejected by the provider are removed,
+// the notification is tried again only if it is not delivered to any device.
+func sendPushNotification(db *database.Queries, senders map[models.DevicePlatform]push.Sender, item *models.Notification, preference *models.NotificationPreference) error {
+	if !preference.Push {
+		return errChannelDisabled
+	}
+	devices, err := db.GetUserDevices(item.UserID)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errNoDevice
+	}
+
+	title, body, err := utils.RenderNotification(item.Type, item.Channel, preference.Language, item.Data)
+	if err != nil {
+		return err
+	}
+	message := push.Message{
+		Title: title,
+		Body:  body,
+		Data:  map[string]string{"type": strconv.Itoa(int(item.Type)), "reference": item.Reference},
+	}
+
+	sent := 0
+	var failed error
+	for _, device := range devices {
+		sender, ok := senders[device.Platform]
+		if !ok {
+			failed = errors.New("no push sender for platform " + device.Platform.Name())
+			continue
+		}
+		message.Token = device.Token
+		err := sender.Send(message)
+		switch {
+		case errors.Is(err, push.ErrInvalidToken):
+			if err := db.DeleteDevice(device.ID); err != nil {
+				log.Printf("notification: device %d cannot be removed: %v\n", device.ID, err)
+			}
+		case err != nil:
+			failed = err
+		default:
+			sent++
+		}
+	}
+	if sent > 0 {
+		return nil
+	}
+	if failed != nil {
+		return failed
+	}
+	// All tokens of the user are rejected.
+	return errNoDevice
+}
+
+// deliverDueNotifications sends the pending notifications until there is none.
+func deliverDueNotifications(senders map[models.NotificationChannel]notification.Sender, pushSenders map[models.DevicePlatform]push.Sender) {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("notification: database connection failed: %v\n", err)
+		return
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	for {
+		notifications, err := db.ClaimDueNotifications(notificationBatchSize, notificationLease)
+		if err != nil {
+			log.Printf("notification: outbox cannot be read: %v\n", err)
+			return
+		}
+		for i := range notifications {
+			deliverNotification(db, senders, pushSenders, &notifications[i])
+		}
+		if len(notifications) < notificationBatchSize {
+			return
+		}
+	}
+}
+
+// StartNotificationWorker sends the notifications of the outbox every 10 seconds with the senders of NOTIFICATION_EMAIL_DRIVER,
+// NOTIFICATION_SMS_DRIVER, PUSH_ANDROID_DRIVER and PUSH_IOS_DRIVER. Failed deliveries are tried again notificationMaxAttempts times
+// with increasing delays.
+func StartNotificationWorker() {
+	senders := map[models.NotificationChannel]notification.Sender{}
+	if sender, err := notification.NewEmailSender(); err != nil {
+		log.Printf("notification: e-mail sender cannot be created: %v\n", err)
+	} else {
+		senders[models.NOTIFICATION_CHANNEL_EMAIL] = sender
+	}
+	if sender, err := notification.NewSMSSender(); err != nil {
+		log.Printf("notification: sms sender cannot be created: %v\n", err)
+	} else {
+		senders[models.NOTIFICATION_CHANNEL_SMS] = sender
+	}
+	pushSenders := map[models.DevicePlatform]push.Sender{}
+	if sender, err := push.NewAndroidSender(); err != nil {
+		log.Printf("notification: android push sender cannot be created: %v\n", err)
+	} else {
+		pushSenders[models.DEVICE_PLATFORM_ANDROID] = sender
+	}
+	if sender, err := push.NewIOSSender(); err != nil {
+		log.Printf("notification: ios push sender cannot be created: %v\n", err)
+	} else {
+		pushSenders[models.DEVICE_PLATFORM_IOS] = sender
+	}
+
+	go func() {
+		for {
+			deliverDueNotifications(senders, pushSenders)
+			time.Sleep(10 * time.Second)
+		}
+	}()
+}
+
+// remindDuePayments adds the reminders of the monthly payments which expire in the reminder window to the outbox.
+func remindDuePayments(window time.Duration) {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("[payment reminder] Error connecting to database: %v\n", err)
+		return
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	payments, err := db.GetPaymentsToRemind(time.Now().Add(window))
+	if err != nil {
+		log.Printf("[payment reminder] Error getting payments: %v\n", err)
+		return
+	}
+	for i := range payments {
+		payment := &payments[i]
+		err = queries.CreateNotifications(db.DB, payment.Reservation.CreatorID, models.NOTIFICATION_TYPE_PAYMENT_DUE, payment.UID.String(), utils.PaymentNotificationData(payment, &payment.Reservation))
+		if err != nil {
+			log.Printf("[payment reminder] Error adding reminder of %s: %v\n", payment.UID, err)
+		}
+	}
+	if len(payments) > 0 {
+		log.Printf("[payment reminder] %d payments reminded\n", len(payments))
+	}
+}
+
+// StartPaymentReminderJob reminds the renters of the monthly payments every hour, PAYMENT_REMINDER_DAYS (3 by default) before they expire.
+func StartPaymentReminderJob() {
+	days, err := strconv.Atoi(os.Getenv("PAYMENT_REMINDER_DAYS"))
+	if err != nil || days <= 0 {
+		days = 3
+	}
+
+	go func() {
+		for {
+			remindDuePayments(time.Duration(days) * 24 * time.Hour)
+			time.Sleep(time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"ekira-backend/platform/database"
+	"encoding/json"
+	"github.com/google/uuid"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// realtimeChannel is the redis channel of the events, every instance sends the events to its own connected users.
+	realtimeChannel = "realtime:events"
+	// realtimeClientBuffer is the number of the events waiting for a slow connection before the events are dropped.
+	realtimeClientBuffer = 32
+)
+
+// Types of the realtime events.
+const (
+	RealtimeEventReservation = "reservation.updated" // the status of the reservation is changed
+	RealtimeEventPayment     = "payment.updated"     // the payment is succeeded, failed or refunded
+	RealtimeEventMessage     = "message.created"     // a new message is sent to the conversation
+)
+
+// RealtimeEvent is the event sent to the websocket connections of the users.
+type RealtimeEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// realtimeMessage is the event published to the redis channel with its receivers.
+type realtimeMessage struct {
+	UserIDs []uuid.UUID     `json:"user_ids"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// RealtimeClient is a websocket connection of a user, the events of the user are received from Events.
+type RealtimeClient struct {
+	UserID uuid.UUID
+	Events chan []byte
+}
+
+// realtimeClients are the websocket connections of the users on this instance.
+var realtimeClients = struct {
+	sync.RWMutex
+	users map[uuid.UUID]map[*RealtimeClient]struct{}
+}{users: map[uuid.UUID]map[*RealtimeClient]struct{}{}}
+
+// AddRealtimeClient registers a websocket connection of the user.
+func AddRealtimeClient(userId uuid.UUID) *RealtimeClient {
+	client := &RealtimeClient{UserID: userId, Events: make(chan []byte, realtimeClientBuffer)}
+
+	realtimeClients.Lock()
+	defer realtimeClients.Unlock()
+	if realtimeClients.users[userId] == nil {
+		realtimeClients.users[userId] = map[*RealtimeClient]struct{}{}
+	}
+	realtimeClients.users[userId][client] = struct{}{}
+	return client
+}
+
+// RemoveRealtimeClient removes the closed websocket connection.
+func RemoveRealtimeClient(client *RealtimeClient) {
+	realtimeClients.Lock()
+	defer realtimeClients.Unlock()
+	delete(realtimeClients.users[client.UserID], client)
+	if len(realtimeClients.users[client.UserID]) == 0 {
+		delete(realtimeClients.users, client.UserID)
+	}
+}
+
+// PublishRealtimeEvent sends the event to the websocket connections of the users on all instances.
+// The errors are only logged, the events are not stored and the clients get the current state from the API after reconnecting.
+func PublishRealtimeEvent(eventType string, data interface{}, userIds ...uuid.UUID) {
+	if len(userIds) == 0 {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("realtime: %s event cannot be encoded: %v\n", eventType, err)
+		return
+	}
+	message, err := json.Marshal(realtimeMessage{UserIDs: userIds, Type: eventType, Data: payload})
+	if err != nil {
+		log.Printf("realtime: %s event cannot be encoded: %v\n", eventType, err)
+		return
+	}
+
+	rds := database.NewRConnection()
+	defer rds.RClose()
+	if err := rds.RPublish(realtimeChannel, message); err != nil {
+		log.Printf("realtime: %s event cannot be published: %v\n", eventType, err)
+	}
+}
+
+// dispatchRealtimeEvent sends the published event to the connections of its users on this instance.
+func dispatchRealtimeEvent(payload string) {
+	var message realtimeMessage
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		log.Printf("realtime: invalid event: %v\n", err)
+		return
+	}
+	event, err := json.Marshal(RealtimeEvent{Type: message.Type, Data: message.Data})
+	if err != nil {
+		log.Printf("realtime: %s event cannot be encoded: %v\n", message.Type, err)
+		return
+	}
+
+	realtimeClients.RLock()
+	defer realtimeClients.RUnlock()
+	for _, userId := range message.UserIDs {
+		for client := range realtimeClients.users[userId] {
+			select {
+			case client.Events <- event:
+			default:
+				// The connection does not read its events, the event is dropped instead of blocking the others.
+			}
+		}
+	}
+}
+
+// StartRealtimeSubscriber receives the events published by all instances and sends them to the websocket connections on this instance.
+func StartRealtimeSubscriber() {
+	go func() {
+		rds := database.NewRConnection()
+		for {
+			subscription := rds.RSubscribe(realtimeChannel)
+			// The channel is closed when the subscription is closed, redis reconnects are handled by the subscription.
+			for message := range subscription.Channel() {
+				dispatchRealtimeEvent(message.Payload)
+			}
+			subscription.Close()
+			log.Println("realtime: subscription is closed, subscribing again")
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
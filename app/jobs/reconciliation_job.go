@@ -0,0 +1,343 @@
+package jobs
+
+import (
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"encoding/json"
+	"fmt"
+	"github.com/stripe/stripe-go/v74"
+	"gorm.io/gorm"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Discrepancy types of reconciliation report.
+const (
+	RECONCILIATION_MISSED_SUCCESS     = "missed_success"
+	RECONCILIATION_MISSING_CHARGE_ID  = "missing_charge_id"
+	RECONCILIATION_UNKNOWN_INTENT     = "unknown_payment_intent"
+	RECONCILIATION_AMOUNT_MISMATCH    = "amount_mismatch"
+	RECONCILIATION_CURRENCY_MISMATCH  = "currency_mismatch"
+	RECONCILIATION_CHARGE_MISMATCH    = "charge_mismatch"
+	RECONCILIATION_PROVIDER_NOT_PAID  = "provider_not_paid"
+	RECONCILIATION_REFUND_NOT_SAVED   = "refund_not_recorded"
+	RECONCILIATION_CLOSED_RESERVATION = "paid_for_closed_reservation"
+	RECONCILIATION_STATUS_MISMATCH    = "status_mismatch"
+	RECONCILIATION_LOOKUP_FAILED      = "provider_lookup_failed"
+)
+
+type ReconciliationItem struct {
+	Type      string `json:"type"`
+	PaymentID string `json:"payment_id,omitempty"`
+	StripeID  string `json:"stripe_id"`
+	Detail    string `json:"detail"`
+}
+
+type ReconciliationReport struct {
+	From          time.Time            `json:"from"`
+	To            time.Time            `json:"to"`
+	DryRun        bool                 `json:"dry_run"`
+	Checked       int                  `json:"checked"`
+	Fixed         []ReconciliationItem `json:"fixed"`
+	Discrepancies []ReconciliationItem `json:"discrepancies"`
+}
+
+func (r *ReconciliationReport) addFixed(payment *models.Payment, typ, detail string) {
+	r.Fixed = append(r.Fixed, ReconciliationItem{Type: typ, PaymentID: payment.UID.String(), StripeID: *payment.StripeID, Detail: detail})
+}
+
+func (r *ReconciliationReport) addDiscrepancy(payment *models.Payment, stripeId, typ, detail string) {
+	item := ReconciliationItem{Type: typ, StripeID: stripeId, Detail: detail}
+	if payment != nil {
+		item.PaymentID = payment.UID.String()
+	}
+	r.Discrepancies = append(r.Discrepancies, item)
+}
+
+// ReconcilePayments matches the payment intents of the provider created in the given time range with the local payments.
+// Missed successful payments are fixed unless dryRun is true, other mismatches are only reported.
+func ReconcilePayments(from, to time.Time, dryRun bool) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{From: from, To: to, DryRun: dryRun, Fixed: []ReconciliationItem{}, Discrepancies: []ReconciliationItem{}}
+
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	// List payment intents of the provider.
+	paymentIntents, err := utils.ListPaymentIntents(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, paymentIntent := range paymentIntents {
+		seen[paymentIntent.ID] = true
+
+		paymentInfo, err := db.GetPaymentWithSPI(paymentIntent.ID)
+		if err != nil {
+			return nil, err
+		}
+		if paymentInfo.ID == 0 {
+			if paymentIntent.Status == stripe.PaymentIntentStatusSucceeded {
+				report.addDiscrepancy(nil, paymentIntent.ID, RECONCILIATION_UNKNOWN_INTENT, fmt.Sprintf("succeeded payment intent of %d %s has no local payment", paymentIntent.Amount, paymentIntent.Currency))
+			}
+			continue
+		}
+
+		report.Checked++
+		err = reconcilePayment(db, report, &paymentInfo, paymentIntent, dryRun)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Check local payments updated in the time range but created on the provider before it.
+	payments, err := db.GetStripePaymentsUpdatedBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payments {
+		paymentInfo := &payments[i]
+		if seen[*paymentInfo.StripeID] {
+			continue
+		}
+		seen[*paymentInfo.StripeID] = true
+
+		paymentIntent, err := utils.GetPaymentIntent(*paymentInfo.StripeID)
+		if err != nil {
+			report.addDiscrepancy(paymentInfo, *paymentInfo.StripeID, RECONCILIATION_LOOKUP_FAILED, err.Error())
+			continue
+		}
+
+		report.Checked++
+		err = reconcilePayment(db, report, paymentInfo, paymentIntent, dryRun)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func reconcilePayment(db *database.Queries, report *ReconciliationReport, paymentInfo *models.Payment, paymentIntent *stripe.PaymentIntent, dryRun bool) error {
+	// Disputes are followed by their own webhooks.
+	if paymentInfo.Status == models.PAYMENT_STATUS_DISPUTED || paymentInfo.Status == models.PAYMENT_STATUS_CHARGEBACK {
+		return nil
+	}
+
+	if paymentIntent.Amount != int64(math.Round(paymentInfo.CardAmount()*100)) {
+		report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_AMOUNT_MISMATCH, fmt.Sprintf("provider amount %d, local card amount %.2f", paymentIntent.Amount, paymentInfo.CardAmount()))
+		return nil
+	}
+	if paymentInfo.Currency != "" && string(paymentIntent.Currency) != paymentInfo.Currency.StripeCode() {
+		report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_CURRENCY_MISMATCH, fmt.Sprintf("provider currency %s, local currency %s", paymentIntent.Currency, paymentInfo.Currency))
+		return nil
+	}
+
+	paid := paymentInfo.Status == models.PAYMENT_STATUS_SUCCEEDED || paymentInfo.Status == models.PAYMENT_STATUS_COMPLETED
+	if paymentIntent.Status != stripe.PaymentIntentStatusSucceeded {
+		if paid {
+			report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_PROVIDER_NOT_PAID, fmt.Sprintf("provider status %s, local status %s", paymentIntent.Status, paymentInfo.StatusName()))
+		}
+		return nil
+	}
+
+	charge := paymentIntent.LatestCharge
+	if charge == nil || charge.ID == "" {
+		report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_LOOKUP_FAILED, "succeeded payment intent has no charge")
+		return nil
+	}
+	if charge.Refunded {
+		if paymentInfo.Status != models.PAYMENT_STATUS_REFUNDED {
+			report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_REFUND_NOT_SAVED, fmt.Sprintf("charge %s is refunded, local status %s", charge.ID, paymentInfo.StatusName()))
+		}
+		return nil
+	}
+	if paymentInfo.StripeChargeID != nil && *paymentInfo.StripeChargeID != charge.ID {
+		report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_CHARGE_MISMATCH, fmt.Sprintf("provider charge %s, local charge %s", charge.ID, *paymentInfo.StripeChargeID))
+		return nil
+	}
+
+	if paymentInfo.Status == models.PAYMENT_STATUS_COMPLETED {
+		if paymentInfo.StripeChargeID == nil {
+			if !dryRun {
+				err := db.Model(&models.Payment{}).Where("id = ?", paymentInfo.ID).Update("stripe_charge_id", charge.ID).Error
+				if err != nil {
+					return err
+				}
+			}
+			report.addFixed(paymentInfo, RECONCILIATION_MISSING_CHARGE_ID, fmt.Sprintf("charge id set to %s", charge.ID))
+		}
+		return nil
+	}
+
+	// Only the pending and succeeded payments are completed automatically, e.g. failed or refunded ones are reviewed manually.
+	if paymentInfo.Status != models.PAYMENT_STATUS_PENDING && paymentInfo.Status != models.PAYMENT_STATUS_SUCCEEDED {
+		report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_STATUS_MISMATCH, fmt.Sprintf("provider status %s, local status %s", paymentIntent.Status, paymentInfo.StatusName()))
+		return nil
+	}
+
+	// The first payment of a closed reservation can not be completed automatically.
+	if paymentInfo.IsFirstPayment && paymentInfo.Reservation.Status != models.RESERVATION_STATUS_PENDING && paymentInfo.Reservation.Status != models.RESERVATION_STATUS_PAID {
+		report.addDiscrepancy(paymentInfo, paymentIntent.ID, RECONCILIATION_CLOSED_RESERVATION, fmt.Sprintf("payment succeeded but reservation status is %d", paymentInfo.Reservation.Status))
+		return nil
+	}
+
+	// Missed success: apply the payment_intent.succeeded and charge.succeeded webhooks.
+	if !dryRun {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			updates := map[string]interface{}{
+				"status":           models.PAYMENT_STATUS_COMPLETED,
+				"stripe_charge_id": charge.ID,
+				"paid_at":          time.Unix(charge.Created, 0),
+			}
+			res := tx.Model(&models.Payment{}).Where("id = ? AND status = ?", paymentInfo.ID, paymentInfo.Status).Updates(updates)
+			if res.Error != nil {
+				return res.Error
+			}
+			// The webhook is received meanwhile.
+			if res.RowsAffected == 0 {
+				return nil
+			}
+
+			if paymentInfo.IsFirstPayment {
+				return tx.Model(&models.Reservation{}).Where("id = ? AND status = ?", paymentInfo.ReservationID, models.RESERVATION_STATUS_PENDING).Update("status", models.RESERVATION_STATUS_PAID).Error
+			}
+
+			// Give a balance to the owner
+			balance := utils.GetOwnerBalanceShare(paymentInfo)
+			return tx.Model(&models.User{}).Where("id = ?", paymentInfo.Reservation.RentalHouse.CreatorID.String()).Update("balance", gorm.Expr("balance + ?", balance)).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	report.addFixed(paymentInfo, RECONCILIATION_MISSED_SUCCESS, fmt.Sprintf("status %s changed to completed with charge %s", paymentInfo.StatusName(), charge.ID))
+	return nil
+}
+
+// ReleaseExpiredTenders returns the wallet balance and credits reserved for the unpaid and expired payments.
+func ReleaseExpiredTenders() (int, error) {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		return 0, err
+	}
+
+	payments, err := db.GetExpiredPaymentsWithTenders()
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range payments {
+		paymentInfo := &payments[i]
+
+		// Cancel the card payment first, so it can not be paid after the balance is returned.
+		if paymentInfo.StripeID != nil && paymentInfo.Status == models.PAYMENT_STATUS_PENDING {
+			paymentIntent, err := utils.GetPaymentIntent(*paymentInfo.StripeID)
+			if err != nil {
+				log.Printf("[reconciliation] Error getting payment intent %s: %v\n", *paymentInfo.StripeID, err)
+				continue
+			}
+			// The payment is paid, it is left to the reconciliation.
+			if paymentIntent.Status == stripe.PaymentIntentStatusSucceeded || paymentIntent.Status == stripe.PaymentIntentStatusProcessing {
+				continue
+			}
+			if paymentIntent.Status != stripe.PaymentIntentStatusCanceled {
+				_, err = utils.CancelPaymentIntent(paymentIntent.ID)
+				if err != nil {
+					log.Printf("[reconciliation] Error cancelling payment intent %s: %v\n", paymentIntent.ID, err)
+					continue
+				}
+			}
+		}
+
+		err = db.RefundPaymentTenders(paymentInfo.ID, paymentInfo.Reservation.CreatorID, 1)
+		if err != nil {
+			return released, err
+		}
+		err = db.Model(&models.Payment{}).Where("id = ? AND status = ?", paymentInfo.ID, models.PAYMENT_STATUS_PENDING).Update("status", models.PAYMENT_STATUS_CANCELLED).Error
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+// WriteReconciliationReport writes the report as json into the logs folder and returns the file path.
+func WriteReconciliationReport(report *ReconciliationReport) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join("logs", fmt.Sprintf("reconciliation-%s.json", report.To.Format("2006-01-02-150405")))
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func runReconciliation(window time.Duration) {
+	// Only one instance runs the job in a day.
+	rds := database.NewRConnection()
+	defer rds.RClose()
+	ok, err := rds.RSetNX(fmt.Sprintf("reconciliation:%s", time.Now().Format("2006-01-02")), "1", 24*60*60)
+	if err != nil || !ok {
+		return
+	}
+
+	released, err := ReleaseExpiredTenders()
+	if err != nil {
+		log.Printf("[reconciliation] Error releasing expired payment tenders: %v\n", err)
+	} else if released > 0 {
+		log.Printf("[reconciliation] Wallet balance and credits of %d expired payments released.\n", released)
+	}
+
+	to := time.Now()
+	report, err := ReconcilePayments(to.Add(-window), to, false)
+	if err != nil {
+		log.Printf("[reconciliation] Error reconciling payments: %v\n", err)
+		return
+	}
+	path, err := WriteReconciliationReport(report)
+	if err != nil {
+		log.Printf("[reconciliation] Error writing report: %v\n", err)
+	}
+	log.Printf("[reconciliation] %d payments checked, %d fixed, %d discrepancies. Report: %s\n", report.Checked, len(report.Fixed), len(report.Discrepancies), path)
+}
+
+// StartReconciliationJob runs the payment reconciliation every night at RECONCILIATION_HOUR
+// for the payments of the last RECONCILIATION_WINDOW_HOURS.
+func StartReconciliationJob() {
+	hour, err := strconv.Atoi(os.Getenv("RECONCILIATION_HOUR"))
+	if err != nil || hour < 0 || hour > 23 {
+		hour = 3
+	}
+	windowHours, err := strconv.Atoi(os.Getenv("RECONCILIATION_WINDOW_HOURS"))
+	if err != nil || windowHours <= 0 {
+		windowHours = 48
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			runReconciliation(time.Duration(windowHours) * time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"log"
+	"time"
+)
+
+// publishExpiredReviews publishes the reviews which are not answered by the other side in the review window.
+func publishExpiredReviews() {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("[review] Error connecting to database: %v\n", err)
+		return
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	published, err := db.PublishExpiredReviews(utils.ReviewWindow())
+	if err != nil {
+		log.Printf("[review] Error publishing reviews: %v\n", err)
+		return
+	}
+	if published > 0 {
+		log.Printf("[review] %d reviews published\n", published)
+	}
+}
+
+// StartReviewPublishingJob publishes the reviews of the ended review windows every hour.
+func StartReviewPublishingJob() {
+	go func() {
+		for {
+			publishExpiredReviews()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
+	"ekira-backend/platform/database"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// savedSearchBatchSize is the number of the saved searches claimed by a worker at once.
+	savedSearchBatchSize = 50
+	// savedSearchLease is the time the claimed saved searches are kept from the other workers.
+	savedSearchLease = 10 * time.Minute
+	// savedSearchAlertListings is the number of the listings written in an alert, the others are only counted.
+	savedSearchAlertListings = 10
+)
+
+// savedSearchPriceRates returns the latest exchange rates from the supported currencies to the given currency.
+// The alerts do not take new snapshots, the missing rates are left to the price expression.
+func savedSearchPriceRates(db *database.Queries, to models.Currency) (map[models.Currency]float64, error) {
+	rates := map[models.Currency]float64{}
+	for _, currency := range models.SupportedCurrencies {
+		if currency == to {
+			rates[currency] = 1
+			continue
+		}
+		rate, err := db.GetLatestExchangeRate(currency, to, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if rate.ID != 0 {
+			rates[currency] = rate.Rate
+		}
+	}
+	return rates, nil
+}
+
+// savedSearchAlertData returns the template values of the alert, the listings are written in the alert because they are the same in all languages.
+func savedSearchAlertData(search *models.SavedSearch, matches []queries.SavedSearchMatch, count int64) models.NotificationData {
+	lines := make([]string, len(matches))
+	for i, match := range matches {
+		rentalHouse := &match.RentalHouse
+		price := strconv.FormatFloat(rentalHouse.Price, 'f', 2, 64)
+		if match.Event.Type == models.LISTING_EVENT_PRICE_DROPPED && match.Event.Currency == rentalHouse.Currency && match.Event.OldPrice > rentalHouse.Price {
+			price = strconv.FormatFloat(match.Event.OldPrice, 'f', 2, 64) + " → " + price
+		}
+		lines[i] = fmt.Sprintf("- %s, %s: %s %s", rentalHouse.Title, rentalHouse.Quarter.District.Town.Name, price, rentalHouse.Currency)
+	}
+
+	data := models.NotificationData{
+		"name":            search.Name,
+		"count":           strconv.FormatInt(count, 10),
+		"listings":        strings.Join(lines, "\n"),
+		"unsubscribe_url": strings.TrimSuffix(os.Getenv("API_URL"), "/") + "/v1/saved-search/unsubscribe/" + search.UnsubscribeToken.String(),
+	}
+	if more := count - int64(len(matches)); more > 0 {
+		data["more"] = strconv.FormatInt(more, 10)
+	}
+	return data
+}
+
+// alertSavedSearch matches the processed listing events until lastSequence with the saved search and adds the alert to the outbox if there is a match.
+func alertSavedSearch(db *database.Queries, search *models.SavedSearch, lastSequence uint64, rates map[models.Currency]map[models.Currency]float64) (bool, error) {
+	// Prices of the listings are compared in the currency of the search.
+	filter := search.Filter
+	if filter.PriceCurrency != "" && (filter.MinPrice != nil || filter.MaxPrice != nil) {
+		if _, ok := rates[filter.PriceCurrency]; !ok {
+			currencyRates, err := savedSearchPriceRates(db, filter.PriceCurrency)
+			if err != nil {
+				return false, err
+			}
+			rates[filter.PriceCurrency] = currencyRates
+		}
+		filter.PriceRates = rates[filter.PriceCurrency]
+	}
+
+	matches, count, err := db.GetSavedSearchMatches(search, &filter, lastSequence, savedSearchAlertListings)
+	if err != nil {
+		return false, err
+	}
+
+	// The search is due again when its interval after the last alert is over.
+	now := time.Now()
+	search.LastEventSequence = lastSequence
+	search.NextAlertAt = now
+	if count == 0 {
+		if search.LastAlertAt != nil && search.LastAlertAt.Add(search.Frequency.Interval()).After(now) {
+			search.NextAlertAt = search.LastAlertAt.Add(search.Frequency.Interval())
+		}
+		return false, queries.SetSavedSearchMatched(db.DB, search)
+	}
+	search.LastAlertAt = &now
+	search.NextAlertAt = now.Add(search.Frequency.Interval())
+
+	// The alert is sent only if the matched events are saved, so the listings are not sent twice.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := queries.SetSavedSearchMatched(tx, search); err != nil {
+			return err
+		}
+		return queries.CreateNotifications(tx, search.UserID, models.NOTIFICATION_TYPE_SAVED_SEARCH_ALERT, search.UID.String(), savedSearchAlertData(search, matches, count))
+	})
+	return err == nil, err
+}
+
+// alertSavedSearches matches the new listing events with the due saved searches until there is none.
+func alertSavedSearches() {
+	// Open database connection
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		log.Printf("[saved search] Error connecting to database: %v\n", err)
+		return
+	}
+	sqlDb, _ := db.DB.DB()
+	defer sqlDb.Close()
+
+	// The new events are numbered after the processed ones, the events which are not committed yet are left to the next run.
+	lastSequence, err := db.ProcessListingEvents()
+	if err != nil {
+		log.Printf("[saved search] Error getting listing events: %v\n", err)
+		return
+	}
+
+	rates := map[models.Currency]map[models.Currency]float64{}
+	alerted := 0
+	for {
+		searches, err := db.ClaimDueSavedSearches(lastSequence, savedSearchBatchSize, savedSearchLease)
+		if err != nil {
+			log.Printf("[saved search] Error getting saved searches: %v\n", err)
+			break
+		}
+		for i := range searches {
+			// The failed searches are tried again after the lease.
+			ok, err := alertSavedSearch(db, &searches[i], lastSequence, rates)
+			if err != nil {
+				log.Printf("[saved search] Error matching saved search %s: %v\n", searches[i].UID, err)
+			}
+			if ok {
+				alerted++
+			}
+		}
+		if len(searches) < savedSearchBatchSize {
+			break
+		}
+	}
+	if alerted > 0 {
+		log.Printf("[saved search] %d saved searches alerted\n", alerted)
+	}
+}
+
+// StartSavedSearchAlertJob matches the published and the cheaper listings with the saved searches every 5 minutes,
+// the alerts are sent by the notification worker with the frequency of the search.
+func StartSavedSearchAlertJob() {
+	go func() {
+		for {
+			alertSavedSearches()
+			time.Sleep(5 * time.Minute)
+		}
+	}()
+}
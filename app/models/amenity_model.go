@@ -0,0 +1,47 @@
+package models
+
+type AmenityCategory uint8
+
+const (
+	AmenityCategoryFeature AmenityCategory = 1 + iota
+	AmenityCategoryRule
+)
+
+func (a AmenityCategory) Name() string {
+	switch a {
+	case AmenityCategoryFeature:
+		return "Özellik"
+	case AmenityCategoryRule:
+		return "Kural"
+	}
+	return "-"
+}
+
+// Amenity is an item of the amenities and house rules catalog, e.g. parking, pets allowed.
+type Amenity struct {
+	ID           int             `json:"id" gorm:"column:id;primary_key;type:int;not null;autoIncrement"`
+	Code         string          `json:"code" gorm:"column:code;type:varchar(32);not null;uniqueIndex" validate:"required,max=32"`
+	Name         string          `json:"name" gorm:"column:name;type:varchar(64);not null" validate:"required,max=64"`
+	Category     AmenityCategory `json:"category" gorm:"column:category;type:smallint;not null;default:1" validate:"min=1,max=2"`
+	DisplayOrder int             `json:"display_order" gorm:"column:display_order;type:integer;not null;default:0"`
+	Active       bool            `json:"active" gorm:"column:active;not null;default:true"`
+}
+
+// DefaultAmenities are created on the first migration.
+var DefaultAmenities = []Amenity{
+	{Code: "wifi", Name: "İnternet (Wi-Fi)", Category: AmenityCategoryFeature},
+	{Code: "parking", Name: "Otopark", Category: AmenityCategoryFeature},
+	{Code: "elevator", Name: "Asansör", Category: AmenityCategoryFeature},
+	{Code: "air_conditioning", Name: "Klima", Category: AmenityCategoryFeature},
+	{Code: "washing_machine", Name: "Çamaşır Makinesi", Category: AmenityCategoryFeature},
+	{Code: "dishwasher", Name: "Bulaşık Makinesi", Category: AmenityCategoryFeature},
+	{Code: "balcony", Name: "Balkon", Category: AmenityCategoryFeature},
+	{Code: "garden", Name: "Bahçe", Category: AmenityCategoryFeature},
+	{Code: "pool", Name: "Havuz", Category: AmenityCategoryFeature},
+	{Code: "sea_view", Name: "Deniz Manzarası", Category: AmenityCategoryFeature},
+	{Code: "security", Name: "Güvenlik", Category: AmenityCategoryFeature},
+	{Code: "pets_allowed", Name: "Evcil Hayvan Kabul Edilir", Category: AmenityCategoryRule},
+	{Code: "smoking_allowed", Name: "Sigara İçilebilir", Category: AmenityCategoryRule},
+	{Code: "parties_allowed", Name: "Parti ve Etkinlik Yapılabilir", Category: AmenityCategoryRule},
+	{Code: "students_allowed", Name: "Öğrenciye Uygun", Category: AmenityCategoryRule},
+}
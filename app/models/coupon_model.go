@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+type CouponDiscountType uint8
+
+const (
+	CouponDiscountTypePercentage CouponDiscountType = iota
+	CouponDiscountTypeFixed
+)
+
+type CouponFundedBy uint8
+
+const (
+	CouponFundedByPlatform CouponFundedBy = iota
+	CouponFundedByOwner
+)
+
+type IntArray []int
+
+func (sla *IntArray) Scan(src interface{}) error {
+	return json.Unmarshal(src.([]byte), &sla)
+}
+
+func (sla IntArray) Value() (driver.Value, error) {
+	val, err := json.Marshal(sla)
+	return string(val), err
+}
+
+// Contains returns true if the array is empty (no restriction) or has the value.
+func (sla IntArray) Contains(value int) bool {
+	if len(sla) == 0 {
+		return true
+	}
+	for _, v := range sla {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type Coupon struct {
+	ID             uint64             `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID            uuid.UUID          `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	Code           string             `gorm:"type:varchar(32);not null;uniqueIndex" json:"code" validate:"required,min=3,max=32,alphanum"`
+	Description    string             `gorm:"type:varchar(255)" json:"description" validate:"max=255"`
+	DiscountType   CouponDiscountType `gorm:"type:smallint;not null;default:0" json:"discount_type" validate:"max=1"`
+	Value          float64            `gorm:"type:decimal;not null" json:"value" validate:"gt=0"`
+	Currency       Currency           `gorm:"type:varchar(3);not null;default:'TRY'" json:"currency" validate:"required,oneof=TRY EUR USD"`
+	MaxDiscount    *float64           `gorm:"type:decimal" json:"max_discount"`
+	MinAmount      float64            `gorm:"type:decimal;not null;default:0" json:"min_amount" validate:"min=0"`
+	StartsAt       time.Time          `gorm:"not null;default:now()" json:"starts_at"`
+	EndsAt         *time.Time         `gorm:"default:null" json:"ends_at"`
+	UsageLimit     int                `gorm:"not null;default:0" json:"usage_limit" validate:"min=0"`
+	PerUserLimit   int                `gorm:"not null;default:1" json:"per_user_limit" validate:"min=0"`
+	RentPeriods    IntArray           `gorm:"type:jsonb;not null;default:'[]'" json:"rent_periods" swaggertype:"array,integer"`
+	CityIDs        IntArray           `gorm:"type:jsonb;not null;default:'[]'" json:"city_ids" swaggertype:"array,integer"`
+	RentalHouseIDs IntArray           `gorm:"type:jsonb;not null;default:'[]'" json:"-"`
+	FundedBy       CouponFundedBy     `gorm:"type:smallint;not null;default:0" json:"funded_by"`
+	CreatorID      *uuid.UUID         `gorm:"type:uuid;index" json:"-"`
+	Active         bool               `gorm:"type:boolean;not null;default:true" json:"active"`
+	CreatedAt      time.Time          `gorm:"default:now()" json:"created_at"`
+	UpdatedAt      time.Time          `gorm:"default:now()" json:"-"`
+}
+
+type CouponRedemption struct {
+	ID            uint64         `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	CouponID      uint64         `gorm:"not null;index" json:"-"`
+	Coupon        Coupon         `gorm:"foreignKey:CouponID" json:"-"`
+	UserID        uuid.UUID      `gorm:"type:uuid;not null;index" json:"-"`
+	ReservationID uint64         `gorm:"not null;index" json:"-"`
+	PaymentID     uint64         `gorm:"not null;index" json:"-"`
+	Discount      float64        `gorm:"type:decimal;not null" json:"discount"`
+	Currency      Currency       `gorm:"type:varchar(3);not null;default:'TRY'" json:"currency"`
+	FundedBy      CouponFundedBy `gorm:"type:smallint;not null;default:0" json:"funded_by"`
+	CreatedAt     time.Time      `gorm:"default:now()" json:"created_at"`
+}
+
+func (c *Coupon) DiscountTypeName() string {
+	switch c.DiscountType {
+	case CouponDiscountTypePercentage:
+		return "Yüzde"
+	case CouponDiscountTypeFixed:
+		return "Sabit"
+	}
+	return "-"
+}
+
+func (c *Coupon) FundedByName() string {
+	switch c.FundedBy {
+	case CouponFundedByPlatform:
+		return "Platform"
+	case CouponFundedByOwner:
+		return "Ev Sahibi"
+	}
+	return "-"
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type Currency string
+
+const (
+	CurrencyTRY Currency = "TRY"
+	CurrencyEUR Currency = "EUR"
+	CurrencyUSD Currency = "USD"
+)
+
+// DefaultCurrency is the currency used for wallet balances and legacy rows.
+const DefaultCurrency = CurrencyTRY
+
+var SupportedCurrencies = []Currency{CurrencyTRY, CurrencyEUR, CurrencyUSD}
+
+// ParseCurrency returns the currency for the given code, ok is false if the currency is not supported.
+func ParseCurrency(code string) (Currency, bool) {
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	for _, c := range SupportedCurrencies {
+		if c == currency {
+			return currency, true
+		}
+	}
+	return "", false
+}
+
+func (c Currency) Symbol() string {
+	switch c {
+	case CurrencyTRY:
+		return "₺"
+	case CurrencyEUR:
+		return "€"
+	case CurrencyUSD:
+		return "$"
+	}
+	return string(c)
+}
+
+// StripeCode returns the lowercase ISO code expected by stripe.
+func (c Currency) StripeCode() string {
+	return strings.ToLower(string(c))
+}
+
+// ExchangeRate is a snapshot of the value of one unit of Base in Quote currency.
+type ExchangeRate struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	Base      Currency  `gorm:"type:varchar(3);not null;index:idx_exchange_rate_pair" json:"base"`
+	Quote     Currency  `gorm:"type:varchar(3);not null;index:idx_exchange_rate_pair" json:"quote"`
+	Rate      float64   `gorm:"type:decimal;not null" json:"rate"`
+	Source    string    `gorm:"type:varchar(32);not null" json:"source"`
+	CreatedAt time.Time `gorm:"default:now();index" json:"created_at"`
+}
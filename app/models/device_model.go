@@ -0,0 +1,34 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type DevicePlatform uint8
+
+const (
+	DEVICE_PLATFORM_ANDROID DevicePlatform = 1 + iota
+	DEVICE_PLATFORM_IOS
+)
+
+func (p DevicePlatform) Name() string {
+	switch p {
+	case DEVICE_PLATFORM_ANDROID:
+		return "Android"
+	case DEVICE_PLATFORM_IOS:
+		return "iOS"
+	}
+	return "-"
+}
+
+// Device is the push token of a mobile app, it belongs to the session of the login and is removed with the session.
+type Device struct {
+	ID        uint64         `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UserID    uuid.UUID      `gorm:"column:user_id;type:varchar(36);not null;index" json:"-"`
+	SessionID uuid.UUID      `gorm:"column:session_id;type:varchar(36);not null;uniqueIndex" json:"-"`
+	Platform  DevicePlatform `gorm:"type:smallint;not null" json:"platform"`
+	Token     string         `gorm:"type:varchar(512);not null;uniqueIndex" json:"-"`
+	CreatedAt time.Time      `gorm:"default:now()" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"default:now()" json:"-"`
+}
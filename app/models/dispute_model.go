@@ -0,0 +1,71 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type DisputeStatus uint8
+
+const (
+	DISPUTE_STATUS_NEEDS_RESPONSE DisputeStatus = 1 + iota
+	DISPUTE_STATUS_UNDER_REVIEW
+	DISPUTE_STATUS_WON
+	DISPUTE_STATUS_LOST
+	DISPUTE_STATUS_WARNING_CLOSED
+	DISPUTE_STATUS_CHARGE_REFUNDED
+)
+
+type Dispute struct {
+	ID                  uint64            `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID                 uuid.UUID         `gorm:"type:uuid;default:uuid_generate_v4()" json:"uid"`
+	PaymentID           uint64            `gorm:"not null;index" json:"-"`
+	Payment             Payment           `gorm:"foreignKey:PaymentID" json:"-"`
+	StripeDisputeID     string            `gorm:"type:varchar(255);not null;unique" json:"-"`
+	Amount              float64           `gorm:"type:decimal;not null" json:"amount"`
+	Currency            Currency          `gorm:"type:varchar(3);not null;default:'TRY'" json:"currency"`
+	Reason              string            `gorm:"type:varchar(64);not null" json:"reason"`
+	Status              DisputeStatus     `gorm:"type:smallint;not null;default:1" json:"status"`
+	FrozenAmount        float64           `gorm:"type:decimal(10,2);not null;default:0" json:"frozen_amount"`
+	PaymentStatus       PaymentStatus     `gorm:"type:smallint;not null;default:0" json:"-"` // status of the payment before the dispute, restored when the dispute is won
+	EvidenceDueBy       *time.Time        `gorm:"default:null" json:"evidence_due_by"`
+	EvidenceText        *string           `gorm:"type:text" json:"evidence_text"`
+	EvidenceSubmittedAt *time.Time        `gorm:"default:null" json:"evidence_submitted_at"`
+	EvidenceFiles       []DisputeEvidence `gorm:"foreignKey:DisputeID" json:"evidence_files"`
+	ClosedAt            *time.Time        `gorm:"default:null" json:"closed_at"`
+	CreatedAt           time.Time         `gorm:"default:now()" json:"created_at"`
+	UpdatedAt           time.Time         `gorm:"default:now()" json:"-"`
+}
+
+type DisputeEvidence struct {
+	ID           uint64    `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	DisputeID    uint64    `gorm:"not null;index" json:"-"`
+	Kind         string    `gorm:"type:varchar(32);not null" json:"kind"`
+	StripeFileID string    `gorm:"type:varchar(255);not null" json:"-"`
+	FileName     string    `gorm:"type:varchar(255);not null" json:"file_name"`
+	CreatedAt    time.Time `gorm:"default:now()" json:"created_at"`
+}
+
+func (d *Dispute) StatusName() string {
+	switch d.Status {
+	case DISPUTE_STATUS_NEEDS_RESPONSE:
+		return "Yanıt Bekleniyor"
+	case DISPUTE_STATUS_UNDER_REVIEW:
+		return "İnceleniyor"
+	case DISPUTE_STATUS_WON:
+		return "Kazanıldı"
+	case DISPUTE_STATUS_LOST:
+		return "Kaybedildi"
+	case DISPUTE_STATUS_WARNING_CLOSED:
+		return "Uyarı Kapatıldı"
+	case DISPUTE_STATUS_CHARGE_REFUNDED:
+		return "Ödeme İade Edildi"
+	default:
+		return "unknown"
+	}
+}
+
+// IsClosed returns true if the dispute has a final result.
+func (d *Dispute) IsClosed() bool {
+	return d.Status == DISPUTE_STATUS_WON || d.Status == DISPUTE_STATUS_LOST || d.Status == DISPUTE_STATUS_WARNING_CLOSED || d.Status == DISPUTE_STATUS_CHARGE_REFUNDED
+}
@@ -1,9 +1,13 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type Filter map[string]interface{}
@@ -66,3 +70,88 @@ type Pagination struct {
 	Search  string `json:"search"`
 	Filters Filter `json:"filters"`
 }
+
+// RentalHouseFilter is the structured search of the public rental house list.
+type RentalHouseFilter struct {
+	Search        string         `json:"search,omitempty"`
+	CityIDs       []int          `json:"city_ids,omitempty"`
+	TownIDs       []int          `json:"town_ids,omitempty"`
+	DistrictIDs   []int          `json:"district_ids,omitempty"`
+	QuarterIDs    []int          `json:"quarter_ids,omitempty"`
+	MinPrice      *float64       `json:"min_price,omitempty"`
+	MaxPrice      *float64       `json:"max_price,omitempty"`
+	PriceCurrency Currency       `json:"price_currency,omitempty"`
+	RentPeriod    int            `json:"rent_period,omitempty"`
+	MinDay        int            `json:"min_day,omitempty"`
+	CommisionType *CommisionType `json:"commision,omitempty"`
+	StartDate     *time.Time     `json:"start_date,omitempty"`
+	EndDate       *time.Time     `json:"end_date,omitempty"`
+	Near          *GeoCircle     `json:"near,omitempty"`
+	Bounds        *GeoBounds     `json:"bounds,omitempty"`
+
+	Rooms          []string      `json:"rooms,omitempty"`
+	MinRooms       int           `json:"min_rooms,omitempty"`
+	MinArea        int           `json:"min_area,omitempty"`
+	MaxArea        int           `json:"max_area,omitempty"`
+	Furnished      *bool         `json:"furnished,omitempty"`
+	MinGuests      int           `json:"min_guests,omitempty"`
+	HeatingTypes   []HeatingType `json:"heating_types,omitempty"`
+	MaxBuildingAge *int          `json:"max_building_age,omitempty"`
+	AmenityIDs     []int         `json:"amenity_ids,omitempty"`
+
+	// PriceRates are the exchange rates from the listing currencies to PriceCurrency, used for price range and sorting.
+	PriceRates map[Currency]float64 `json:"-"`
+}
+
+// Scan and Value store the filter of the saved searches as json, PriceRates are taken again when the filter is used.
+func (f *RentalHouseFilter) Scan(src interface{}) error {
+	return json.Unmarshal(src.([]byte), f)
+}
+
+func (f RentalHouseFilter) Value() (driver.Value, error) {
+	val, err := json.Marshal(f)
+	return string(val), err
+}
+
+// PriceExpression returns the sql expression of the listing price in PriceCurrency.
+func (f *RentalHouseFilter) PriceExpression() string {
+	if len(f.PriceRates) == 0 {
+		return "price"
+	}
+	var cases []string
+	for _, currency := range SupportedCurrencies {
+		if rate, ok := f.PriceRates[currency]; ok {
+			cases = append(cases, fmt.Sprintf("WHEN '%s' THEN %f", currency, rate))
+		}
+	}
+	return fmt.Sprintf("(price * CASE currency %s ELSE 1 END)", strings.Join(cases, " "))
+}
+
+// GeoCircle is the "within RadiusKm of the point" search.
+type GeoCircle struct {
+	GeoPoint
+	RadiusKm float64 `json:"radius_km"`
+}
+
+// GeoBounds is the map bounding box search.
+type GeoBounds struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// BoundingBox returns the bounds containing the circle, used to filter with the spatial index before the distance.
+func (c *GeoCircle) BoundingBox() GeoBounds {
+	latDelta := c.RadiusKm / 111.32
+	lonDelta := 180.0
+	if cos := math.Cos(c.Lat * math.Pi / 180); cos > 0.0001 {
+		lonDelta = math.Min(c.RadiusKm/(111.32*cos), 180)
+	}
+	return GeoBounds{
+		MinLat: math.Max(c.Lat-latDelta, -90),
+		MinLon: math.Max(c.Lon-lonDelta, -180),
+		MaxLat: math.Min(c.Lat+latDelta, 90),
+		MaxLon: math.Min(c.Lon+lonDelta, 180),
+	}
+}
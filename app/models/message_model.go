@@ -0,0 +1,71 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Conversation is the message thread of a renter and the owner about a rental house, before a reservation or for a reservation.
+type Conversation struct {
+	ID            uint64       `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID           uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();uniqueIndex" json:"uid"`
+	RentalHouseID int          `gorm:"not null;index" json:"-"`
+	RentalHouse   RentalHouse  `gorm:"foreignKey:RentalHouseID" json:"-"`
+	ReservationID *uint64      `gorm:"uniqueIndex" json:"-"` // nil for the questions before a reservation
+	Reservation   *Reservation `gorm:"foreignKey:ReservationID" json:"-"`
+	RenterID      uuid.UUID    `gorm:"column:renter;type:uuid;not null;index" json:"-"`
+	Renter        User         `gorm:"foreignKey:RenterID" json:"-"`
+	OwnerID       uuid.UUID    `gorm:"column:owner;type:uuid;not null;index" json:"-"`
+	Owner         User         `gorm:"foreignKey:OwnerID" json:"-"`
+	LastMessageAt *time.Time   `gorm:"default:null;index" json:"last_message_at"`
+	RenterReadAt  *time.Time   `gorm:"default:null" json:"-"` // the messages until this time are read by the renter
+	OwnerReadAt   *time.Time   `gorm:"default:null" json:"-"` // the messages until this time are read by the owner
+	CreatedAt     time.Time    `gorm:"default:now()" json:"created_at"`
+	UpdatedAt     time.Time    `gorm:"default:now()" json:"-"`
+}
+
+// IsParticipant returns true if the user is the renter or the owner of the conversation.
+func (c *Conversation) IsParticipant(userId uuid.UUID) bool {
+	return c.RenterID == userId || c.OwnerID == userId
+}
+
+// ReadAt returns the last read time of the user.
+func (c *Conversation) ReadAt(userId uuid.UUID) *time.Time {
+	if c.OwnerID == userId {
+		return c.OwnerReadAt
+	}
+	return c.RenterReadAt
+}
+
+// OtherReadAt returns the last read time of the other side of the user.
+func (c *Conversation) OtherReadAt(userId uuid.UUID) *time.Time {
+	if c.OwnerID == userId {
+		return c.RenterReadAt
+	}
+	return c.OwnerReadAt
+}
+
+type Message struct {
+	ID             uint64              `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID            uuid.UUID           `gorm:"type:uuid;default:uuid_generate_v4();uniqueIndex" json:"uid"`
+	ConversationID uint64              `gorm:"not null;index" json:"-"`
+	SenderID       uuid.UUID           `gorm:"column:sender;type:uuid;not null" json:"-"`
+	Body           string              `gorm:"type:text;not null;default:''" json:"body"`
+	Attachments    []MessageAttachment `gorm:"foreignKey:MessageID" json:"attachments"`
+	CreatedAt      time.Time           `gorm:"default:now()" json:"created_at"`
+}
+
+// MessageAttachment is an image uploaded before the message is sent, it is added to the message when the message is sent.
+// The image is processed in the background like the rental house images, only the ready images can be sent.
+type MessageAttachment struct {
+	ID            uuid.UUID              `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	UploaderID    uuid.UUID              `gorm:"column:uploader;type:uuid;not null" json:"-"`
+	MessageID     *uint64                `gorm:"default:null;index" json:"-"`
+	Images        RentalHouseImagesArray `gorm:"column:images;type:jsonb;default:'[]'" json:"images"`
+	Status        ImageStatus            `gorm:"type:smallint;not null;default:1" json:"status"`
+	SourceKey     string                 `gorm:"type:varchar(255);not null;default:''" json:"-"` // storage key of the raw upload while processing
+	Attempts      int                    `gorm:"not null;default:0" json:"-"`
+	Error         string                 `gorm:"column:processing_error;type:text;not null;default:''" json:"error,omitempty"`
+	NextAttemptAt *time.Time             `gorm:"default:null;index" json:"-"` // the processing image is queued again at this time if it is not processed
+	CreatedAt     time.Time              `gorm:"default:now();index" json:"created_at"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+type ModerationStatus uint8
+
+const (
+	MODERATION_STATUS_DRAFT ModerationStatus = 1 + iota
+	MODERATION_STATUS_PENDING
+	MODERATION_STATUS_APPROVED
+	MODERATION_STATUS_REJECTED
+)
+
+func (s ModerationStatus) Name() string {
+	switch s {
+	case MODERATION_STATUS_DRAFT:
+		return "Taslak"
+	case MODERATION_STATUS_PENDING:
+		return "İncelemede"
+	case MODERATION_STATUS_APPROVED:
+		return "Onaylandı"
+	case MODERATION_STATUS_REJECTED:
+		return "Reddedildi"
+	}
+	return "-"
+}
+
+// Flags of the automatic moderation checks.
+const (
+	ModerationFlagBannedWord     = "banned_word"
+	ModerationFlagPhoneNumber    = "phone_number"
+	ModerationFlagDuplicateImage = "duplicate_image"
+	ModerationFlagSimilarImage   = "similar_image" // an image looks like an image of another owner
+)
+
+type StringArray []string
+
+func (sla *StringArray) Scan(src interface{}) error {
+	return json.Unmarshal(src.([]byte), &sla)
+}
+
+func (sla StringArray) Value() (driver.Value, error) {
+	if sla == nil {
+		return "[]", nil
+	}
+	val, err := json.Marshal(sla)
+	return string(val), err
+}
+
+// ModerationLog is the moderation history of a rental house, ModeratorID is nil for the automatic checks and the owner actions.
+type ModerationLog struct {
+	ID            uint64           `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	RentalHouseID int              `gorm:"not null;index" json:"-"`
+	RentalHouse   RentalHouse      `gorm:"foreignKey:RentalHouseID" json:"-"`
+	ModeratorID   *uuid.UUID       `gorm:"type:uuid" json:"-"`
+	Moderator     *User            `gorm:"foreignKey:ModeratorID" json:"-"`
+	FromStatus    ModerationStatus `gorm:"type:smallint;not null" json:"from_status"`
+	Status        ModerationStatus `gorm:"type:smallint;not null" json:"status"`
+	Reason        string           `gorm:"type:text;not null;default:''" json:"reason"`
+	Flags         StringArray      `gorm:"type:jsonb;not null;default:'[]'" json:"flags" swaggertype:"array,string"`
+	CreatedAt     time.Time        `gorm:"not null;default:now()" json:"created_at"`
+}
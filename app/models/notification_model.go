@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+type NotificationType uint8
+
+const (
+	NOTIFICATION_TYPE_RESERVATION_CREATED   NotificationType = 1 + iota // the renter is asked to pay the reservation
+	NOTIFICATION_TYPE_RESERVATION_PAID                                  // the owner is asked to accept the paid reservation
+	NOTIFICATION_TYPE_RESERVATION_ACCEPTED                              // the renter is informed about the acceptance
+	NOTIFICATION_TYPE_RESERVATION_CANCELLED                             // the renter and the owner are informed about the cancellation
+	NOTIFICATION_TYPE_PAYMENT_DUE                                       // the renter is reminded of the monthly payment
+	NOTIFICATION_TYPE_PAYMENT_RECEIVED                                  // the card payment of the renter is succeeded
+	NOTIFICATION_TYPE_PAYMENT_FAILED                                    // the card payment of the renter is failed
+	NOTIFICATION_TYPE_SAVED_SEARCH_ALERT                                // the user is informed about the listings matching the saved search
+)
+
+func (t NotificationType) Name() string {
+	switch t {
+	case NOTIFICATION_TYPE_RESERVATION_CREATED:
+		return "Rezervasyon Oluşturuldu"
+	case NOTIFICATION_TYPE_RESERVATION_PAID:
+		return "Rezervasyon Ödendi"
+	case NOTIFICATION_TYPE_RESERVATION_ACCEPTED:
+		return "Rezervasyon Onaylandı"
+	case NOTIFICATION_TYPE_RESERVATION_CANCELLED:
+		return "Rezervasyon İptal Edildi"
+	case NOTIFICATION_TYPE_PAYMENT_DUE:
+		return "Ödeme Hatırlatması"
+	case NOTIFICATION_TYPE_PAYMENT_RECEIVED:
+		return "Ödeme Alındı"
+	case NOTIFICATION_TYPE_PAYMENT_FAILED:
+		return "Ödeme Başarısız"
+	case NOTIFICATION_TYPE_SAVED_SEARCH_ALERT:
+		return "Kayıtlı Arama Bildirimi"
+	}
+	return "-"
+}
+
+type NotificationChannel uint8
+
+const (
+	NOTIFICATION_CHANNEL_EMAIL NotificationChannel = 1 + iota
+	NOTIFICATION_CHANNEL_SMS
+	NOTIFICATION_CHANNEL_PUSH
+)
+
+func (c NotificationChannel) Name() string {
+	switch c {
+	case NOTIFICATION_CHANNEL_EMAIL:
+		return "E-posta"
+	case NOTIFICATION_CHANNEL_SMS:
+		return "SMS"
+	case NOTIFICATION_CHANNEL_PUSH:
+		return "Anlık Bildirim"
+	}
+	return "-"
+}
+
+type NotificationStatus uint8
+
+const (
+	NOTIFICATION_STATUS_PENDING NotificationStatus = 1 + iota
+	NOTIFICATION_STATUS_SENT
+	NOTIFICATION_STATUS_FAILED
+	NOTIFICATION_STATUS_SKIPPED // the user has no address or device for the channel or disabled it before the delivery
+)
+
+func (s NotificationStatus) Name() string {
+	switch s {
+	case NOTIFICATION_STATUS_PENDING:
+		return "Gönderilecek"
+	case NOTIFICATION_STATUS_SENT:
+		return "Gönderildi"
+	case NOTIFICATION_STATUS_FAILED:
+		return "Gönderilemedi"
+	case NOTIFICATION_STATUS_SKIPPED:
+		return "Atlandı"
+	}
+	return "-"
+}
+
+// NotificationData are the values of the notification template, e.g. the title of the rental house.
+type NotificationData map[string]string
+
+func (d *NotificationData) Scan(src interface{}) error {
+	return json.Unmarshal(src.([]byte), &d)
+}
+
+func (d NotificationData) Value() (driver.Value, error) {
+	val, err := json.Marshal(d)
+	return string(val), err
+}
+
+// Notification is a message in the outbox, it is written in the same transaction with the change it tells about
+// and delivered by the notification worker. The message is rendered on delivery with the language of the user.
+type Notification struct {
+	ID            uint64              `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID           uuid.UUID           `gorm:"type:uuid;default:uuid_generate_v4()" json:"uid"`
+	UserID        uuid.UUID           `gorm:"column:user_id;type:uuid;not null;index" json:"-"`
+	User          User                `gorm:"foreignKey:UserID" json:"-"`
+	Type          NotificationType    `gorm:"type:smallint;not null" json:"type"`
+	Channel       NotificationChannel `gorm:"type:smallint;not null" json:"channel"`
+	Reference     string              `gorm:"type:varchar(64);not null;default:'';index" json:"-"` // the uid of the reservation, the payment or the saved search
+	Data          NotificationData    `gorm:"type:jsonb;not null;default:'{}'" json:"-"`
+	Status        NotificationStatus  `gorm:"type:smallint;not null;default:1;index:idx_notifications_due" json:"status"`
+	Attempts      int                 `gorm:"type:int;not null;default:0" json:"-"`
+	Error         string              `gorm:"type:text;not null;default:''" json:"-"`
+	NextAttemptAt time.Time           `gorm:"not null;default:now();index:idx_notifications_due" json:"-"`
+	SentAt        *time.Time          `gorm:"default:null" json:"sent_at"`
+	CreatedAt     time.Time           `gorm:"default:now()" json:"created_at"`
+	UpdatedAt     time.Time           `gorm:"default:now()" json:"-"`
+}
+
+// NotificationPreference are the notification settings of the user, the users without settings get all channels in Turkish.
+type NotificationPreference struct {
+	UserID    uuid.UUID `gorm:"column:user_id;type:uuid;primaryKey" json:"-"`
+	Language  string    `gorm:"type:varchar(2);not null;default:'tr'" json:"language" validate:"required,oneof=tr en"`
+	Email     bool      `gorm:"not null" json:"email"`
+	SMS       bool      `gorm:"column:sms;not null" json:"sms"`
+	Push      bool      `gorm:"not null;default:true" json:"push"`
+	UpdatedAt time.Time `gorm:"default:now()" json:"-"`
+}
+
+// DefaultNotificationPreference returns the settings of the user who has not changed them.
+func DefaultNotificationPreference(userId uuid.UUID) NotificationPreference {
+	return NotificationPreference{UserID: userId, Language: "tr", Email: true, SMS: true, Push: true}
+}
+
+// Channels returns the enabled channels.
+func (p *NotificationPreference) Channels() []NotificationChannel {
+	channels := make([]NotificationChannel, 0, 3)
+	if p.Email {
+		channels = append(channels, NOTIFICATION_CHANNEL_EMAIL)
+	}
+	if p.SMS {
+		channels = append(channels, NOTIFICATION_CHANNEL_SMS)
+	}
+	if p.Push {
+		channels = append(channels, NOTIFICATION_CHANNEL_PUSH)
+	}
+	return channels
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"math"
 	"time"
 )
 
@@ -14,26 +15,37 @@ const (
 	PAYMENT_STATUS_FAILED
 	PAYMENT_STATUS_CANCELLED
 	PAYMENT_STATUS_REFUNDED
+	PAYMENT_STATUS_DISPUTED
+	PAYMENT_STATUS_CHARGEBACK
 )
 
 type Payment struct {
-	ID             uint64        `gorm:"primaryKey;autoIncrement;not null" json:"-"`
-	UID            uuid.UUID     `gorm:"type:uuid;default:uuid_generate_v4()" json:"uid"`
-	ReservationID  uint64        `gorm:"not null" json:"-"`
-	Reservation    Reservation   `gorm:"foreignKey:ReservationID" json:"-"`
-	Amount         float64       `gorm:"type:decimal;not null" json:"amount"`
-	AmountGross    float64       `gorm:"type:decimal;not null;default:0" json:"amount_clean"`
-	StartDate      time.Time     `gorm:"not null" json:"start_date"`
-	EndDate        time.Time     `gorm:"not null" json:"end_date"`
-	Expire         time.Time     `gorm:"not null" json:"expire"`
-	Status         PaymentStatus `gorm:"type:smallint;not null;default:1" json:"status"`
-	StripeID       *string       `gorm:"type:varchar(255);unique" json:"-"`
-	StripeChargeID *string       `gorm:"type:varchar(255);unique" json:"-"`
-	StripeRefundID *string       `gorm:"type:varchar(255);unique" json:"-"`
-	IsFirstPayment bool          `gorm:"type:boolean;not null;default:false" json:"is_first_payment"`
-	CreatedAt      time.Time     `gorm:"default:now()" json:"created_at"`
-	UpdatedAt      time.Time     `gorm:"default:now()" json:"-"`
-	DeletedAt      time.Time     `gorm:"index;column:deleted_at" json:"-"`
+	ID             uint64          `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID            uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4()" json:"uid"`
+	ReservationID  uint64          `gorm:"not null" json:"-"`
+	Reservation    Reservation     `gorm:"foreignKey:ReservationID" json:"-"`
+	Amount         float64         `gorm:"type:decimal;not null" json:"amount"`
+	AmountGross    float64         `gorm:"type:decimal;not null;default:0" json:"amount_clean"`
+	Currency       Currency        `gorm:"type:varchar(3);not null;default:'TRY'" json:"currency"`
+	ExchangeRate   float64         `gorm:"type:decimal;not null;default:1" json:"exchange_rate"`
+	StartDate      time.Time       `gorm:"not null" json:"start_date"`
+	EndDate        time.Time       `gorm:"not null" json:"end_date"`
+	Expire         time.Time       `gorm:"not null" json:"expire"`
+	Status         PaymentStatus   `gorm:"type:smallint;not null;default:1" json:"status"`
+	StripeID       *string         `gorm:"type:varchar(255);unique" json:"-"`
+	StripeChargeID *string         `gorm:"type:varchar(255);unique" json:"-"`
+	StripeRefundID *string         `gorm:"type:varchar(255);unique" json:"-"`
+	IsFirstPayment bool            `gorm:"type:boolean;not null;default:false" json:"is_first_payment"`
+	WalletAmount   float64         `gorm:"type:decimal;not null;default:0" json:"wallet_amount"`
+	CreditAmount   float64         `gorm:"type:decimal;not null;default:0" json:"credit_amount"`
+	Tenders        []PaymentTender `gorm:"foreignKey:PaymentID" json:"tenders"`
+	Discount       float64         `gorm:"type:decimal;not null;default:0" json:"discount"`
+	DiscountFunder CouponFundedBy  `gorm:"type:smallint;not null;default:0" json:"-"`
+	Taxes          []PaymentTax    `gorm:"foreignKey:PaymentID" json:"taxes"`
+	PaidAt         *time.Time      `gorm:"default:null" json:"paid_at"`
+	CreatedAt      time.Time       `gorm:"default:now()" json:"created_at"`
+	UpdatedAt      time.Time       `gorm:"default:now()" json:"-"`
+	DeletedAt      time.Time       `gorm:"index;column:deleted_at" json:"-"`
 }
 
 func (p *Payment) StatusName() string {
@@ -50,6 +62,10 @@ func (p *Payment) StatusName() string {
 		return "Ödeme İptal Edildi"
 	case PAYMENT_STATUS_REFUNDED:
 		return "Ödeme İade Edildi"
+	case PAYMENT_STATUS_DISPUTED:
+		return "Ödemeye İtiraz Edildi"
+	case PAYMENT_STATUS_CHARGEBACK:
+		return "Ödeme Ters İbraz Edildi"
 	default:
 		return "unknown"
 	}
@@ -69,3 +85,24 @@ type PaymentActivity struct {
 	UpdatedAt time.Time     `gorm:"default:now()" json:"updated_at"`
 	DeletedAt time.Time     `gorm:"index;column:deleted_at" json:"-"`
 }
+
+// CardAmount returns the part of the payment charged from the card.
+func (p *Payment) CardAmount() float64 {
+	return math.Round((p.Amount-p.WalletAmount-p.CreditAmount)*100) / 100
+}
+
+// ToDefaultCurrency converts the given amount in payment currency to the wallet currency with the rate snapshot of the payment.
+func (p *Payment) ToDefaultCurrency(amount float64) float64 {
+	if p.Currency == "" || p.Currency == DefaultCurrency || p.ExchangeRate <= 0 {
+		return amount
+	}
+	return math.Round(amount*p.ExchangeRate*100) / 100
+}
+
+// FromDefaultCurrency converts the given amount in wallet currency to the payment currency with the rate snapshot of the payment.
+func (p *Payment) FromDefaultCurrency(amount float64) float64 {
+	if p.Currency == "" || p.Currency == DefaultCurrency || p.ExchangeRate <= 0 {
+		return amount
+	}
+	return math.Floor(amount/p.ExchangeRate*100) / 100
+}
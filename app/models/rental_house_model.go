@@ -3,8 +3,10 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
@@ -32,6 +34,7 @@ type RentalHouse struct {
 	QuarterID     int                `json:"quarter_id" gorm:"column:quarter_id;type:int4;not null" validate:"required"`
 	RentPeriod    int                `json:"rent_period" gorm:"column:rent_period;type:int4;not null;default:1" validate:"required,min=1,max=4"`
 	Price         float64            `json:"price" gorm:"column:price;type:decimal;not null" validate:"required,min=1,max=1000000000"`
+	Currency      Currency           `json:"currency" gorm:"column:currency;type:varchar(3);not null;default:'TRY'" validate:"required,oneof=TRY EUR USD"`
 	MinDay        int                `json:"min_day" gorm:"column:min_day;type:int2;not null" validate:"required,min=1,max=7"`
 	CreatedAt     time.Time          `json:"created_at" gorm:"column:created_at;default:now();index"`
 	UpdatedAt     time.Time          `json:"updated_at" gorm:"column:updated_at;default:now()"`
@@ -40,11 +43,133 @@ type RentalHouse struct {
 	Quarter       Quarter            `json:"quarter" gorm:"foreignKey:QuarterID;references:id"`
 	Images        []RentalHouseImage `json:"images" gorm:"foreignKey:RentalHouseID;references:id"`
 	CommisionType CommisionType      `json:"commision" gorm:"column:commision;type:smallint;default:0"`
+	ListingType   ListingType        `json:"listing_type" gorm:"column:listing_type;type:smallint;not null;default:0" validate:"max=1"`
 	Published     bool               `json:"published" gorm:"column:published;default:true;index"`
+	SearchVector  string             `json:"-" gorm:"column:search_vector;type:tsvector;index:,type:gin;->:false;<-:false"`
+	Location      *GeoPoint          `json:"location" gorm:"column:location;type:point;index:,type:gist;<-:false"`
+	Distance      *float64           `json:"-" gorm:"column:distance;->;-:migration"`
+
+	// Attributes
+	RoomCount       int         `json:"room_count" gorm:"column:room_count;type:smallint;not null;default:0;index" validate:"min=0,max=20"`
+	LivingRoomCount int         `json:"living_room_count" gorm:"column:living_room_count;type:smallint;not null;default:0" validate:"min=0,max=5"`
+	GrossArea       int         `json:"gross_area" gorm:"column:gross_area;type:integer;not null;default:0" validate:"min=0,max=100000"`
+	NetArea         int         `json:"net_area" gorm:"column:net_area;type:integer;not null;default:0" validate:"min=0,max=100000"`
+	Floor           *int        `json:"floor" gorm:"column:floor;type:smallint;default:null" validate:"omitempty,min=-5,max=200"`
+	BuildingAge     *int        `json:"building_age" gorm:"column:building_age;type:smallint;default:null" validate:"omitempty,min=0,max=500"`
+	HeatingType     HeatingType `json:"heating_type" gorm:"column:heating_type;type:smallint;not null;default:0" validate:"max=5"`
+	Furnished       bool        `json:"furnished" gorm:"column:furnished;not null;default:false"`
+	MaxGuests       int         `json:"max_guests" gorm:"column:max_guests;type:smallint;not null;default:0" validate:"min=0,max=50"`
+	Amenities       []Amenity   `json:"amenities" gorm:"many2many:rental_house_amenities"`
+
+	// Moderation
+	ModerationStatus ModerationStatus `json:"moderation_status" gorm:"column:moderation_status;type:smallint;not null;default:1;index"`
+	RejectionReason  string           `json:"rejection_reason" gorm:"column:rejection_reason;type:text;not null;default:''"`
+	ModerationFlags  StringArray      `json:"-" gorm:"column:moderation_flags;type:jsonb;not null;default:'[]'"`
+	SubmittedAt      *time.Time       `json:"-" gorm:"column:submitted_at;index"`
+	ModeratedAt      *time.Time       `json:"-" gorm:"column:moderated_at"`
+
+	// Reviews
+	Rating          *float64      `json:"rating" gorm:"column:rating;type:decimal(3,2);index"`
+	ReviewCount     int           `json:"review_count" gorm:"column:review_count;not null;default:0"`
+	CategoryRatings ReviewRatings `json:"category_ratings" gorm:"embedded;embeddedPrefix:rating_"`
+}
+
+// IsPublic returns true if the rental house is approved by the moderators and published by the owner.
+func (r *RentalHouse) IsPublic() bool {
+	return r.Published && r.ModerationStatus == MODERATION_STATUS_APPROVED
+}
+
+type HeatingType uint8
+
+const (
+	HeatingTypeNone HeatingType = iota
+	HeatingTypeCombi
+	HeatingTypeCentral
+	HeatingTypeFloor
+	HeatingTypeAirConditioner
+	HeatingTypeStove
+)
+
+func (h HeatingType) Name() string {
+	switch h {
+	case HeatingTypeNone:
+		return "Yok"
+	case HeatingTypeCombi:
+		return "Kombi (Doğalgaz)"
+	case HeatingTypeCentral:
+		return "Merkezi"
+	case HeatingTypeFloor:
+		return "Yerden Isıtma"
+	case HeatingTypeAirConditioner:
+		return "Klima"
+	case HeatingTypeStove:
+		return "Soba"
+	}
+	return "-"
+}
+
+// Rooms returns the room count in "N+M" form, N is rooms and M is living rooms, e.g. "2+1".
+func (r *RentalHouse) Rooms() string {
+	if r.RoomCount == 0 && r.LivingRoomCount == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d+%d", r.RoomCount, r.LivingRoomCount)
+}
+
+// ParseRooms parses the "N+M" room count, e.g. "3+1" or "1+0".
+func ParseRooms(rooms string) (int, int, bool) {
+	var roomCount, livingRoomCount int
+	if _, err := fmt.Sscanf(strings.TrimSpace(rooms), "%d+%d", &roomCount, &livingRoomCount); err != nil {
+		return 0, 0, false
+	}
+	if roomCount < 0 || roomCount > 20 || livingRoomCount < 0 || livingRoomCount > 5 || roomCount+livingRoomCount == 0 {
+		return 0, 0, false
+	}
+	return roomCount, livingRoomCount, true
+}
+
+// GeoPoint is a coordinate stored as postgres point (lon,lat), used with the earthdistance extension.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (p *GeoPoint) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return fmt.Errorf("unsupported point type: %T", src)
+	}
+	_, err := fmt.Sscanf(str, "(%f,%f)", &p.Lon, &p.Lat)
+	return err
+}
+
+func (p GeoPoint) Value() (driver.Value, error) {
+	return fmt.Sprintf("(%f,%f)", p.Lon, p.Lat), nil
+}
+
+// ParseGCoordinate returns the point of the "(lat,lon)" coordinate string, ok is false if it is not set.
+func ParseGCoordinate(coordinate string) (GeoPoint, bool) {
+	p := GeoPoint{}
+	if _, err := fmt.Sscanf(coordinate, "(%f,%f)", &p.Lat, &p.Lon); err != nil {
+		return p, false
+	}
+	if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 || (p.Lat == 0 && p.Lon == 0) {
+		return p, false
+	}
+	return p, true
 }
 
 func (r *RentalHouse) CommisionTypeInfo() string {
-	switch r.CommisionType {
+	return r.CommisionType.Name()
+}
+
+func (t CommisionType) Name() string {
+	switch t {
 	case CommisionTypeRenterPays:
 		return "Kiracı Öder"
 	case CommisionTypeOwnerPays:
@@ -53,6 +178,39 @@ func (r *RentalHouse) CommisionTypeInfo() string {
 	return "-"
 }
 
+func RentPeriodName(period int) string {
+	switch period {
+	case RentPeriodDay:
+		return "Günlük"
+	case RentPeriodMonth:
+		return "Aylık"
+	case RentPeriodYear:
+		return "Yıllık"
+	}
+	return "-"
+}
+
+// ImageStatus is the processing state of an uploaded image, only the ready images can be added to the rental houses.
+type ImageStatus uint8
+
+const (
+	IMAGE_STATUS_READY ImageStatus = 1 + iota
+	IMAGE_STATUS_PROCESSING
+	IMAGE_STATUS_FAILED
+)
+
+func (s ImageStatus) Name() string {
+	switch s {
+	case IMAGE_STATUS_READY:
+		return "Hazır"
+	case IMAGE_STATUS_PROCESSING:
+		return "İşleniyor"
+	case IMAGE_STATUS_FAILED:
+		return "Başarısız"
+	}
+	return "-"
+}
+
 type RentalHouseImagesArray []RentalHouseImageInfo
 
 func (sla *RentalHouseImagesArray) Scan(src interface{}) error {
@@ -65,9 +223,19 @@ func (sla RentalHouseImagesArray) Value() (driver.Value, error) {
 }
 
 type RentalHouseImageInfo struct {
-	URL    string `json:"url"`
-	Width  uint   `json:"width"`
-	Height uint   `json:"height"`
+	URL      string `json:"url"`
+	Width    uint   `json:"width"`
+	Height   uint   `json:"height"`
+	Format   string `json:"format,omitempty" example:"webp"`                           // jpeg, webp or avif, empty for the old jpeg images
+	Blurhash string `json:"blurhash,omitempty" example:"LKO2?U%2Tw=w]~RBVZRi};RPxuwH"` // placeholder of the image, same for all sizes
+}
+
+// ImageFormat returns the format of the image file, the old images are jpeg.
+func (i RentalHouseImageInfo) ImageFormat() string {
+	if i.Format == "" {
+		return "jpeg"
+	}
+	return i.Format
 }
 
 type RentalHouseImage struct {
@@ -77,9 +245,17 @@ type RentalHouseImage struct {
 	RentalHouseID *int                   `json:"rental_house_id" gorm:"column:rental_house_id;type:int;size:32;default:null;index"`
 	RentalHouse   *RentalHouse           `json:"-" gorm:"foreignKey:RentalHouseID;references:id"`
 	MainPhoto     bool                   `json:"main_photo" gorm:"column:main_photo;type:bool;default:false"`
+	DisplayOrder  int                    `json:"display_order" gorm:"column:display_order;type:integer;not null;default:0"`
 	Expire        time.Time              `json:"expire" gorm:"column:expire;default:now()"`
 	CreatedAt     time.Time              `json:"created_at" gorm:"column:created_at;default:now()"`
 	Images        RentalHouseImagesArray `json:"images" gorm:"column:images;type:jsonb;default:'[]'"`
+	Checksum      string                 `json:"-" gorm:"column:checksum;type:varchar(64);not null;default:'';index"`
+	PHash         *int64                 `json:"-" gorm:"column:perceptual_hash;type:bigint;default:null"` // difference hash, see utils.ImageDHash
+	Status        ImageStatus            `json:"status" gorm:"column:status;type:smallint;not null;default:1"`
+	SourceKey     string                 `json:"-" gorm:"column:source_key;type:varchar(255);not null;default:''"` // storage key of the raw upload while processing
+	Attempts      int                    `json:"-" gorm:"column:attempts;type:int;not null;default:0"`
+	NextAttemptAt *time.Time             `json:"-" gorm:"column:next_attempt_at;default:null;index"` // the processing image is queued again at this time if it is not processed
+	Error         string                 `json:"error,omitempty" gorm:"column:processing_error;type:text;not null;default:''"`
 }
 
 type RentalHouseFavorite struct {
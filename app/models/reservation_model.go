@@ -27,12 +27,16 @@ type Reservation struct {
 	RentPeriod     int               `gorm:"type:int;not null" json:"rent_period"`
 	UnitPrice      float64           `gorm:"type:decimal;not null;default:0.0" json:"unit_price"`
 	TotalPrice     float64           `gorm:"type:decimal;not null;default:0.0" json:"total_price"`
+	Currency       Currency          `gorm:"type:varchar(3);not null;default:'TRY'" json:"currency"`
+	ExchangeRate   float64           `gorm:"type:decimal;not null;default:1" json:"exchange_rate"`
 	Expire         time.Time         `gorm:"not null" json:"expire"`
 	Status         ReservationStatus `gorm:"type:smallint;not null;default:1" json:"status"`
 	FullName       string            `gorm:"type:varchar(128);not null" json:"full_name"`
 	Email          string            `gorm:"type:varchar(255);not null" json:"email"`
 	Phone          string            `gorm:"type:varchar(16);not null" json:"phone"`
 	IdentityNumber string            `gorm:"type:varchar(12);not null" json:"identity_number"`
+	RenterType     RenterType        `gorm:"type:smallint;not null;default:0" json:"renter_type"`
+	TaxNumber      *string           `gorm:"type:varchar(11)" json:"tax_number"`
 	CreatedAt      time.Time         `gorm:"default:now()" json:"created_at"`
 	UpdatedAt      time.Time         `gorm:"default:now()" json:"updated_at"`
 	DeletedAt      time.Time         `gorm:"index;column:deleted_at" json:"-"`
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type ReviewType uint8
+
+const (
+	REVIEW_TYPE_RENTAL_HOUSE ReviewType = 1 + iota // the renter reviews the rental house
+	REVIEW_TYPE_RENTER                             // the owner reviews the renter
+)
+
+func (t ReviewType) Name() string {
+	switch t {
+	case REVIEW_TYPE_RENTAL_HOUSE:
+		return "Ev Değerlendirmesi"
+	case REVIEW_TYPE_RENTER:
+		return "Kiracı Değerlendirmesi"
+	}
+	return "-"
+}
+
+// Review is the review of a stay, the renter and the owner review each other once for a reservation.
+// Reviews are published when both sides have reviewed or the review window is over, until then nobody sees the other review.
+type Review struct {
+	ID            uint64      `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID           uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4()" json:"uid"`
+	ReservationID uint64      `gorm:"not null;uniqueIndex:idx_reviews_reservation_type" json:"-"`
+	Reservation   Reservation `gorm:"foreignKey:ReservationID" json:"-"`
+	Type          ReviewType  `gorm:"type:smallint;not null;uniqueIndex:idx_reviews_reservation_type" json:"type"`
+	AuthorID      uuid.UUID   `gorm:"column:author;type:uuid;not null;index" json:"-"`
+	Author        User        `gorm:"foreignKey:AuthorID" json:"-"`
+	SubjectID     uuid.UUID   `gorm:"column:subject;type:uuid;not null;index" json:"-"` // the reviewed user, the owner or the renter
+	RentalHouseID int         `gorm:"not null;index" json:"-"`
+	RentalHouse   RentalHouse `gorm:"foreignKey:RentalHouseID" json:"-"`
+	Rating        int         `gorm:"type:smallint;not null" json:"rating"`
+	ReviewScores
+	Comment     string     `gorm:"type:text;not null;default:''" json:"comment"`
+	Response    *string    `gorm:"type:text" json:"response"` // public response of the owner to the rental house review
+	RespondedAt *time.Time `gorm:"default:null" json:"responded_at"`
+	PublishedAt *time.Time `gorm:"default:null;index" json:"published_at"`
+	CreatedAt   time.Time  `gorm:"default:now()" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"default:now()" json:"-"`
+}
+
+// ReviewScores are the category scores of the rental house reviews, they are not given to the renters.
+type ReviewScores struct {
+	Cleanliness   *int `gorm:"type:smallint" json:"cleanliness" validate:"omitempty,min=1,max=5"`
+	Accuracy      *int `gorm:"type:smallint" json:"accuracy" validate:"omitempty,min=1,max=5"`
+	Location      *int `gorm:"type:smallint" json:"location" validate:"omitempty,min=1,max=5"`
+	Communication *int `gorm:"type:smallint" json:"communication" validate:"omitempty,min=1,max=5"`
+	CheckIn       *int `gorm:"type:smallint" json:"check_in" validate:"omitempty,min=1,max=5"`
+	Value         *int `gorm:"type:smallint" json:"value" validate:"omitempty,min=1,max=5"`
+}
+
+// IsComplete returns true if all category scores are given.
+func (s *ReviewScores) IsComplete() bool {
+	return s.Cleanliness != nil && s.Accuracy != nil && s.Location != nil && s.Communication != nil && s.CheckIn != nil && s.Value != nil
+}
+
+// ReviewRatings are the average scores of the published reviews of a rental house.
+type ReviewRatings struct {
+	Cleanliness   *float64 `gorm:"column:cleanliness;type:decimal(3,2)" json:"cleanliness"`
+	Accuracy      *float64 `gorm:"column:accuracy;type:decimal(3,2)" json:"accuracy"`
+	Location      *float64 `gorm:"column:location;type:decimal(3,2)" json:"location"`
+	Communication *float64 `gorm:"column:communication;type:decimal(3,2)" json:"communication"`
+	CheckIn       *float64 `gorm:"column:check_in;type:decimal(3,2)" json:"check_in"`
+	Value         *float64 `gorm:"column:value;type:decimal(3,2)" json:"value"`
+}
+
+// IsPublished returns true if the review is visible to everyone.
+func (r *Review) IsPublished() bool {
+	return r.PublishedAt != nil && !r.PublishedAt.After(time.Now())
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type SavedSearchFrequency uint8
+
+const (
+	SAVED_SEARCH_FREQUENCY_INSTANT SavedSearchFrequency = 1 + iota // the matches are sent in the next run of the alert job
+	SAVED_SEARCH_FREQUENCY_DAILY
+	SAVED_SEARCH_FREQUENCY_WEEKLY
+	SAVED_SEARCH_FREQUENCY_OFF // the search is kept without alerts, e.g. after the unsubscribe link
+)
+
+func (f SavedSearchFrequency) Name() string {
+	switch f {
+	case SAVED_SEARCH_FREQUENCY_INSTANT:
+		return "Anında"
+	case SAVED_SEARCH_FREQUENCY_DAILY:
+		return "Günlük"
+	case SAVED_SEARCH_FREQUENCY_WEEKLY:
+		return "Haftalık"
+	case SAVED_SEARCH_FREQUENCY_OFF:
+		return "Kapalı"
+	}
+	return "-"
+}
+
+// Interval returns the minimum time between two alerts of the search.
+func (f SavedSearchFrequency) Interval() time.Duration {
+	switch f {
+	case SAVED_SEARCH_FREQUENCY_DAILY:
+		return 24 * time.Hour
+	case SAVED_SEARCH_FREQUENCY_WEEKLY:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// SavedSearch is the public listing search of a user, the user is alerted about the new and the cheaper listings matching it.
+// The processed listing events until LastEventSequence are already matched.
+type SavedSearch struct {
+	ID                uint64               `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID               uuid.UUID            `gorm:"type:uuid;default:uuid_generate_v4()" json:"uid"`
+	UserID            uuid.UUID            `gorm:"column:user_id;type:uuid;not null;index" json:"-"`
+	Name              string               `gorm:"type:varchar(100);not null" json:"name"`
+	Filter            RentalHouseFilter    `gorm:"type:jsonb;not null" json:"filter"`
+	Frequency         SavedSearchFrequency `gorm:"type:smallint;not null;default:2" json:"frequency"`
+	LastEventSequence uint64               `gorm:"not null;default:0" json:"-"`
+	NextAlertAt       time.Time            `gorm:"not null;default:now();index" json:"-"`
+	LastAlertAt       *time.Time           `gorm:"default:null" json:"last_alert_at"`
+	UnsubscribeToken  uuid.UUID            `gorm:"type:uuid;default:uuid_generate_v4();uniqueIndex" json:"-"`
+	CreatedAt         time.Time            `gorm:"default:now()" json:"created_at"`
+	UpdatedAt         time.Time            `gorm:"default:now()" json:"updated_at"`
+}
+
+type ListingEventType uint8
+
+const (
+	LISTING_EVENT_PUBLISHED     ListingEventType = 1 + iota // the listing became public, it is published by the owner or approved by the moderators
+	LISTING_EVENT_PRICE_DROPPED                             // the price of the public listing is decreased
+	LISTING_EVENT_HIDDEN                                    // the listing is not public anymore, its last public price is kept, it is not sent to the saved searches
+)
+
+// AlertedListingEvents are the listing events which are sent to the saved searches.
+var AlertedListingEvents = []ListingEventType{LISTING_EVENT_PUBLISHED, LISTING_EVENT_PRICE_DROPPED}
+
+func (t ListingEventType) Name() string {
+	switch t {
+	case LISTING_EVENT_PUBLISHED:
+		return "Yayınlandı"
+	case LISTING_EVENT_PRICE_DROPPED:
+		return "Fiyatı Düştü"
+	case LISTING_EVENT_HIDDEN:
+		return "Yayından Kalktı"
+	}
+	return "-"
+}
+
+// ListingEvent is a change of a listing which the saved searches are matched against. The events are numbered by the
+// alert job in the order they are processed, Sequence is 0 until the event is processed.
+type ListingEvent struct {
+	ID            uint64           `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	Sequence      uint64           `gorm:"not null;default:0;index" json:"-"`
+	RentalHouseID int              `gorm:"type:int;not null;index" json:"-"`
+	Type          ListingEventType `gorm:"type:smallint;not null" json:"type"`
+	OldPrice      float64          `gorm:"type:decimal;not null;default:0" json:"old_price"`
+	Price         float64          `gorm:"type:decimal;not null" json:"price"`
+	Currency      Currency         `gorm:"type:varchar(3);not null" json:"currency"`
+	CreatedAt     time.Time        `gorm:"default:now();index" json:"created_at"`
+}
@@ -16,3 +16,11 @@ type Session struct {
 	UpdatedAt time.Time      `gorm:"column:updated_at;not null" json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index;column:deleted_at" json:"deleted_at" validate:""`
 }
+
+// RealtimeTicketTTL is the lifetime of the one-time ticket of the websocket connection in seconds.
+const RealtimeTicketTTL = 30
+
+// RealtimeTicketKey returns the redis key of the one-time ticket of the websocket connection, its value is the session id.
+func RealtimeTicketKey(ticket string) string {
+	return "realtime-ticket:" + ticket
+}
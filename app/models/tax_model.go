@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+type ListingType uint8
+
+const (
+	ListingTypeResidential ListingType = iota
+	ListingTypeCommercial
+)
+
+func (l ListingType) Name() string {
+	switch l {
+	case ListingTypeResidential:
+		return "Konut"
+	case ListingTypeCommercial:
+		return "İşyeri"
+	}
+	return "-"
+}
+
+type RenterType uint8
+
+const (
+	RenterTypeIndividual RenterType = iota
+	RenterTypeCorporate
+)
+
+func (r RenterType) Name() string {
+	switch r {
+	case RenterTypeIndividual:
+		return "Bireysel"
+	case RenterTypeCorporate:
+		return "Kurumsal"
+	}
+	return "-"
+}
+
+type TaxType uint8
+
+const (
+	TAX_TYPE_KDV TaxType = 1 + iota
+	TAX_TYPE_ACCOMMODATION
+	TAX_TYPE_STOPAJ
+	TAX_TYPE_COMMISSION_KDV
+)
+
+type PaymentTax struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	PaymentID uint64    `gorm:"not null;index" json:"-"`
+	Type      TaxType   `gorm:"type:smallint;not null" json:"type"`
+	Rate      float64   `gorm:"type:decimal;not null" json:"rate"`
+	Base      float64   `gorm:"type:decimal;not null" json:"base"`
+	Amount    float64   `gorm:"type:decimal;not null" json:"amount"`
+	Withheld  bool      `gorm:"type:boolean;not null;default:false" json:"withheld"`
+	CreatedAt time.Time `gorm:"default:now()" json:"-"`
+}
+
+func (t *PaymentTax) TypeName() string {
+	switch t.Type {
+	case TAX_TYPE_KDV:
+		return "KDV"
+	case TAX_TYPE_ACCOMMODATION:
+		return "Konaklama Vergisi"
+	case TAX_TYPE_STOPAJ:
+		return "Stopaj"
+	case TAX_TYPE_COMMISSION_KDV:
+		return "Komisyon KDV"
+	}
+	return "-"
+}
@@ -8,6 +8,23 @@ import (
 	"time"
 )
 
+type UserRole uint8
+
+const (
+	USER_ROLE_USER UserRole = 1 + iota
+	USER_ROLE_MODERATOR
+)
+
+func (r UserRole) Name() string {
+	switch r {
+	case USER_ROLE_USER:
+		return "user"
+	case USER_ROLE_MODERATOR:
+		return "moderator"
+	}
+	return "-"
+}
+
 // User struct to describe user object.
 type User struct {
 	ID               uuid.UUID         `gorm:"column:id;primary_key;type:uuid;default:uuid_generate_v4()" json:"id"`
@@ -24,13 +41,19 @@ type User struct {
 	ProfileImageID   *uuid.UUID        `gorm:"column:profile_image_id;type:uuid;default:NULL" json:"-" validate:""`
 	ProfileImage     *UserProfileImage `gorm:"foreignKey:ProfileImageID;references:id" json:"profileImage" validate:""`
 	Balance          float64           `gorm:"column:balance;type:decimal(10,2);default:0" json:"balance" validate:""`
+	FrozenBalance    float64           `gorm:"column:frozen_balance;type:decimal(10,2);default:0" json:"frozenBalance" validate:""`
 	StripeCustomerID *string           `gorm:"column:stripe_customer_id;type:varchar(255);unique" json:"-" validate:""`
+	Role             UserRole          `gorm:"column:role;type:smallint;not null;default:1" json:"-" validate:""`
 }
 
 func (u User) FullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
+func (u User) IsModerator() bool {
+	return u.Role == USER_ROLE_MODERATOR
+}
+
 type UserProfileImagesArray []UserProfileImageInfo
 
 func (sla *UserProfileImagesArray) Scan(src interface{}) error {
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type TenderType uint8
+
+const (
+	TENDER_TYPE_CARD TenderType = 1 + iota
+	TENDER_TYPE_WALLET
+	TENDER_TYPE_CREDIT
+)
+
+// UserCredit is a platform credit given to the user, amounts are in default currency.
+type UserCredit struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	UID       uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	Amount    float64    `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Remaining float64    `gorm:"type:decimal(10,2);not null" json:"remaining"`
+	Reason    string     `gorm:"type:varchar(255);not null" json:"reason"`
+	ExpiresAt *time.Time `gorm:"default:null" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"default:now()" json:"created_at"`
+}
+
+// PaymentTender is a part of the payment paid with a card, wallet balance or credit.
+// Amount is in payment currency, DefaultAmount is the debited wallet or credit amount in default currency.
+type PaymentTender struct {
+	ID             uint64     `gorm:"primaryKey;autoIncrement;not null" json:"-"`
+	PaymentID      uint64     `gorm:"not null;index" json:"-"`
+	Type           TenderType `gorm:"type:smallint;not null" json:"type"`
+	CreditID       *uint64    `gorm:"index" json:"-"`
+	Amount         float64    `gorm:"type:decimal;not null" json:"amount"`
+	DefaultAmount  float64    `gorm:"type:decimal(10,2);not null;default:0" json:"-"`
+	RefundedAmount float64    `gorm:"type:decimal;not null;default:0" json:"refunded_amount"`
+	CreatedAt      time.Time  `gorm:"default:now()" json:"created_at"`
+}
+
+func (c *UserCredit) IsExpired() bool {
+	return c.ExpiresAt != nil && c.ExpiresAt.Before(time.Now())
+}
+
+func (t *PaymentTender) TypeName() string {
+	switch t.Type {
+	case TENDER_TYPE_CARD:
+		return "Kart"
+	case TENDER_TYPE_WALLET:
+		return "Cüzdan"
+	case TENDER_TYPE_CREDIT:
+		return "Kredi"
+	}
+	return "-"
+}
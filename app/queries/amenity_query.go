@@ -0,0 +1,84 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"gorm.io/gorm"
+)
+
+// AmenityQueries struct
+type AmenityQueries struct {
+	*gorm.DB
+}
+
+// GetAmenities method for get the amenities catalog.
+func (q *AmenityQueries) GetAmenities(activeOnly bool) ([]models.Amenity, error) {
+	// Define amenities variable.
+	amenities := make([]models.Amenity, 0)
+
+	// Send query to database.
+	tx := q.Model(models.Amenity{})
+	if activeOnly {
+		tx = tx.Where("active IS TRUE")
+	}
+	err := tx.Order("category, display_order, id").Find(&amenities).Error
+	if err != nil {
+		// Return empty object and error.
+		return amenities, err
+	}
+
+	// Return query result.
+	return amenities, nil
+}
+
+// GetActiveAmenitiesByIDs method for get the active amenities with ids.
+func (q *AmenityQueries) GetActiveAmenitiesByIDs(ids []int) ([]models.Amenity, error) {
+	// Define amenities variable.
+	amenities := make([]models.Amenity, 0)
+	if len(ids) == 0 {
+		return amenities, nil
+	}
+
+	// Send query to database.
+	err := q.Model(models.Amenity{}).Where("id IN ? AND active IS TRUE", ids).Order("category, display_order, id").Find(&amenities).Error
+	if err != nil {
+		// Return empty object and error.
+		return amenities, err
+	}
+
+	// Return query result.
+	return amenities, nil
+}
+
+// GetAmenityWithCode method for get the amenity with code.
+func (q *AmenityQueries) GetAmenityWithCode(code string) (models.Amenity, error) {
+	// Define amenity variable.
+	amenity := models.Amenity{}
+
+	// Send query to database.
+	err := q.Model(models.Amenity{}).Where("code = ?", code).First(&amenity).Error
+	if err != nil {
+		// If record not found return empty object.
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return amenity, nil
+		}
+
+		// Return empty object and error.
+		return amenity, err
+	}
+
+	// Return query result.
+	return amenity, nil
+}
+
+// SetRentalHouseAmenities method for replace the amenities of the rental house.
+func (q *AmenityQueries) SetRentalHouseAmenities(rh *models.RentalHouse, amenities []models.Amenity) error {
+	// Send query to database.
+	err := q.Model(rh).Association("Amenities").Replace(amenities)
+	if err != nil {
+		// Return only error.
+		return err
+	}
+	rh.Amenities = amenities
+	return nil
+}
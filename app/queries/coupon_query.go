@@ -0,0 +1,126 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+var ErrCouponUsageLimit = errors.New("coupon usage limit is reached")
+
+// CouponQueries struct
+type CouponQueries struct {
+	*gorm.DB
+}
+
+// GetCouponWithCode method for get coupon with code.
+func (q *CouponQueries) GetCouponWithCode(code string) (models.Coupon, error) {
+	// Define coupon variable.
+	coupon := models.Coupon{}
+
+	// Send query to database.
+	err := q.Model(models.Coupon{}).Where("code = ?", strings.ToUpper(code)).First(&coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return coupon, nil
+		}
+		// Return empty object and error.
+		return coupon, err
+	}
+
+	// Return query result.
+	return coupon, nil
+}
+
+// GetCouponWithUid method for get coupon with uid.
+func (q *CouponQueries) GetCouponWithUid(uid uuid.UUID) (models.Coupon, error) {
+	// Define coupon variable.
+	coupon := models.Coupon{}
+
+	// Send query to database.
+	err := q.Model(models.Coupon{}).Where("uid = ?", uid).First(&coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return coupon, nil
+		}
+		// Return empty object and error.
+		return coupon, err
+	}
+
+	// Return query result.
+	return coupon, nil
+}
+
+// GetCouponsWithCreator method for get coupons created by the user.
+func (q *CouponQueries) GetCouponsWithCreator(creatorId uuid.UUID) ([]models.Coupon, error) {
+	// Define coupons variable.
+	coupons := make([]models.Coupon, 0)
+
+	// Send query to database.
+	err := q.Model(models.Coupon{}).Where("creator_id = ?", creatorId).Order("created_at desc").Find(&coupons).Error
+	if err != nil {
+		// Return empty object and error.
+		return coupons, err
+	}
+
+	// Return query result.
+	return coupons, nil
+}
+
+// CountCouponRedemptions method for count redemptions of the coupon with a reservation not cancelled, rejected or expired.
+// Only the redemptions of the user are counted if userId is not nil.
+func (q *CouponQueries) CountCouponRedemptions(couponId uint64, userId *uuid.UUID) (int64, error) {
+	var count int64
+
+	// Send query to database.
+	query := q.Model(models.CouponRedemption{}).
+		Joins("JOIN reservations ON reservations.id = coupon_redemptions.reservation_id").
+		Where("coupon_redemptions.coupon_id = ?", couponId).
+		Where("reservations.status NOT IN ?", []models.ReservationStatus{models.RESERVATION_STATUS_REJECTED, models.RESERVATION_STATUS_CANCELLED}).
+		Where("NOT (reservations.status = ? AND reservations.expire < NOW())", models.RESERVATION_STATUS_PENDING)
+	if userId != nil {
+		query = query.Where("coupon_redemptions.user_id = ?", *userId)
+	}
+	err := query.Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// Return query result.
+	return count, nil
+}
+
+// RedeemCoupon method for check the usage limits of the coupon and create the redemption, q is the transaction of the reservation.
+// The coupon is locked until the transaction ends, so the concurrent redemptions are counted after it.
+func (q *CouponQueries) RedeemCoupon(coupon *models.Coupon, redemption *models.CouponRedemption) error {
+	// Lock the coupon for concurrent redemptions.
+	err := q.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Coupon{}, coupon.ID).Error
+	if err != nil {
+		return err
+	}
+
+	if coupon.UsageLimit > 0 {
+		count, err := q.CountCouponRedemptions(coupon.ID, nil)
+		if err != nil {
+			return err
+		}
+		if count >= int64(coupon.UsageLimit) {
+			return ErrCouponUsageLimit
+		}
+	}
+	if coupon.PerUserLimit > 0 {
+		count, err := q.CountCouponRedemptions(coupon.ID, &redemption.UserID)
+		if err != nil {
+			return err
+		}
+		if count >= int64(coupon.PerUserLimit) {
+			return ErrCouponUsageLimit
+		}
+	}
+
+	// Insert query to database.
+	return q.Create(redemption).Error
+}
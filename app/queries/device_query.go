@@ -0,0 +1,63 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// DeviceQueries struct
+type DeviceQueries struct {
+	*gorm.DB
+}
+
+// RegisterDevice method for save the push token of the session. A session has one token, so the previous token of the session
+// is replaced. The token is moved to the session if it was registered by another login on the same device.
+func (q *DeviceQueries) RegisterDevice(device *models.Device) error {
+	device.UpdatedAt = time.Now()
+
+	// Send query to database.
+	return q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ? AND token <> ?", device.SessionID.String(), device.Token).Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "session_id", "platform", "updated_at"}),
+		}).Create(device).Error
+	})
+}
+
+// DeleteSessionDevice method for delete the push token of the session.
+func (q *DeviceQueries) DeleteSessionDevice(sessionId uuid.UUID) error {
+	// Send query to database.
+	return q.Where("session_id = ?", sessionId.String()).Delete(&models.Device{}).Error
+}
+
+// GetUserDevices method for get the push tokens of the active sessions of the user.
+func (q *DeviceQueries) GetUserDevices(userId uuid.UUID) ([]models.Device, error) {
+	// Define devices variable.
+	devices := make([]models.Device, 0)
+
+	// Send query to database.
+	err := q.Model(&models.Device{}).
+		Joins("JOIN sessions ON sessions.session_id = devices.session_id AND sessions.deleted_at IS NULL").
+		Where("devices.user_id = ? AND sessions.expires_at > ?", userId.String(), time.Now().Unix()).
+		Order("devices.id").
+		Find(&devices).Error
+	if err != nil {
+		// Return empty object and error.
+		return devices, err
+	}
+
+	// Return query result.
+	return devices, nil
+}
+
+// DeleteDevice method for delete the push token which is rejected by the push provider.
+func (q *DeviceQueries) DeleteDevice(id uint64) error {
+	// Send query to database.
+	return q.Where("id = ?", id).Delete(&models.Device{}).Error
+}
@@ -0,0 +1,73 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DisputeQueries struct
+type DisputeQueries struct {
+	*gorm.DB
+}
+
+// GetDisputeWithStripeID method for get dispute with stripe dispute id.
+func (q *DisputeQueries) GetDisputeWithStripeID(stripeDisputeId string) (models.Dispute, error) {
+	// Define dispute variable.
+	dispute := models.Dispute{}
+
+	// Send query to database.
+	err := q.Model(models.Dispute{}).Preload("Payment.Reservation."+clause.Associations).Preload("Payment.Reservation.RentalHouse", withArchived).Where("stripe_dispute_id = ?", stripeDisputeId).First(&dispute).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dispute, nil
+		}
+		// Return empty object and error.
+		return dispute, err
+	}
+
+	// Return query result.
+	return dispute, nil
+}
+
+// GetDisputeWithUid method for get dispute with uid.
+func (q *DisputeQueries) GetDisputeWithUid(uid uuid.UUID) (models.Dispute, error) {
+	// Define dispute variable.
+	dispute := models.Dispute{}
+
+	// Send query to database.
+	err := q.Model(models.Dispute{}).Preload("Payment.Reservation."+clause.Associations).Preload("Payment.Reservation.RentalHouse", withArchived).Preload("EvidenceFiles").Where("uid = ?", uid).First(&dispute).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dispute, nil
+		}
+		// Return empty object and error.
+		return dispute, err
+	}
+
+	// Return query result.
+	return dispute, nil
+}
+
+// GetDisputesWithOwner method for get disputes of the rental houses owned by the user.
+func (q *DisputeQueries) GetDisputesWithOwner(ownerId uuid.UUID) ([]models.Dispute, error) {
+	// Define disputes variable.
+	disputes := make([]models.Dispute, 0)
+
+	// Send query to database.
+	err := q.Model(models.Dispute{}).
+		Joins("JOIN payments ON payments.id = disputes.payment_id").
+		Joins("JOIN reservations ON reservations.id = payments.reservation_id").
+		Joins("JOIN rental_houses ON rental_houses.id = reservations.rental_house_id").
+		Where("rental_houses.creator = ?", ownerId.String()).
+		Preload("Payment.Reservation.RentalHouse").Preload("EvidenceFiles").Order("disputes.created_at desc").Find(&disputes).Error
+	if err != nil {
+		// Return empty object and error.
+		return disputes, err
+	}
+
+	// Return query result.
+	return disputes, nil
+}
@@ -0,0 +1,43 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ExchangeRateQueries struct
+type ExchangeRateQueries struct {
+	*gorm.DB
+}
+
+// GetLatestExchangeRate method for get latest exchange rate snapshot created after given time.
+func (q *ExchangeRateQueries) GetLatestExchangeRate(base, quote models.Currency, since time.Time) (models.ExchangeRate, error) {
+	// Define rate variable.
+	rate := models.ExchangeRate{}
+
+	// Send query to database.
+	err := q.Model(models.ExchangeRate{}).Where("base = ? AND quote = ? AND created_at > ?", base, quote, since).Order("created_at desc").First(&rate).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rate, nil
+		}
+		// Return empty object and error.
+		return rate, err
+	}
+
+	// Return query result.
+	return rate, nil
+}
+
+// CreateExchangeRate method for create new exchange rate snapshot.
+func (q *ExchangeRateQueries) CreateExchangeRate(rate *models.ExchangeRate) error {
+	// Insert query to database.
+	err := q.Model(models.ExchangeRate{}).Create(rate).Error
+	if err != nil {
+		// Return only error.
+		return err
+	}
+	return nil
+}
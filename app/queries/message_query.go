@@ -0,0 +1,345 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// MessageQueries struct
+type MessageQueries struct {
+	*gorm.DB
+}
+
+// ErrAttachmentNotFound is returned when an attachment of the message is not uploaded by the sender, not processed yet or is already sent.
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// ConversationSummary is a conversation of the list with the last message and the number of the unread messages of the user.
+type ConversationSummary struct {
+	Conversation models.Conversation
+	LastMessage  *models.Message
+	UnreadCount  int64
+}
+
+// ConversationList is the page of the conversations of the user.
+type ConversationList struct {
+	TotalCount    int64
+	FullCount     int64
+	NextPage      bool
+	PrevPage      bool
+	Conversations []ConversationSummary
+}
+
+// conversationDetails preloads the rental house and the participants of the conversations.
+func conversationDetails(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("RentalHouse", withArchived).Preload("RentalHouse.Images", orderedImages).Preload("Reservation").
+		Preload("Renter.ProfileImage").Preload("Owner.ProfileImage")
+}
+
+// GetConversationWithUid method for get conversation with uid.
+func (q *MessageQueries) GetConversationWithUid(uid uuid.UUID) (models.Conversation, error) {
+	// Define conversation variable.
+	conversation := models.Conversation{}
+
+	// Send query to database.
+	err := conversationDetails(q.Model(models.Conversation{})).Where("uid = ?", uid).First(&conversation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return conversation, nil
+		}
+		// Return empty object and error.
+		return conversation, err
+	}
+
+	// Return query result.
+	return conversation, nil
+}
+
+// GetOrCreateConversation method for get the conversation of the reservation, or the conversation of the renter about the rental house
+// if there is no reservation. The conversation is created if it does not exist.
+func (q *MessageQueries) GetOrCreateConversation(conversation *models.Conversation) error {
+	find := func(tx *gorm.DB) *gorm.DB {
+		tx = conversationDetails(tx.Model(models.Conversation{}))
+		if conversation.ReservationID != nil {
+			return tx.Where("reservation_id = ?", *conversation.ReservationID)
+		}
+		return tx.Where("rental_house_id = ? AND renter = ? AND reservation_id IS NULL", conversation.RentalHouseID, conversation.RenterID)
+	}
+
+	// Send query to database.
+	err := find(q.DB).Limit(1).Find(conversation).Error
+	if err != nil || conversation.ID != 0 {
+		return err
+	}
+	// The conversation may be created at the same time, the unique indexes keep one of them.
+	err = q.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(conversation).Error
+	if err != nil {
+		return err
+	}
+	return find(q.DB).First(conversation).Error
+}
+
+// GetUserConversations method for get the conversations of the user as the renter or the owner, the last active is the first.
+func (q *MessageQueries) GetUserConversations(userId uuid.UUID, pagination *models.Pagination) (ConversationList, error) {
+	// Define variables.
+	data := ConversationList{}
+	offset := (pagination.Page - 1) * pagination.Limit
+	if pagination.Page > 1 {
+		data.PrevPage = true
+	}
+
+	// Only the conversations with messages are listed.
+	tx := q.Model(models.Conversation{}).Where("(renter = ? OR owner = ?) AND last_message_at IS NOT NULL", userId, userId).Session(&gorm.Session{})
+	err := tx.Count(&data.FullCount).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	if int(data.FullCount) > offset+pagination.Limit {
+		data.NextPage = true
+	}
+
+	// Send query to database.
+	var conversations []models.Conversation
+	err = conversationDetails(tx).Limit(pagination.Limit).Offset(offset).Order("last_message_at desc, id desc").Find(&conversations).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	data.TotalCount = int64(len(conversations))
+	if len(conversations) == 0 {
+		return data, nil
+	}
+
+	ids := make([]uint64, len(conversations))
+	for i := range conversations {
+		ids[i] = conversations[i].ID
+	}
+	var lastMessages []models.Message
+	err = q.Raw("SELECT DISTINCT ON (conversation_id) * FROM messages WHERE conversation_id IN ? ORDER BY conversation_id, id DESC", ids).Scan(&lastMessages).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	var unread []struct {
+		ConversationID uint64
+		Count          int64
+	}
+	err = q.Raw(`SELECT m.conversation_id, COUNT(*) AS count FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.conversation_id IN ? AND m.sender <> ?
+			AND m.created_at > COALESCE(CASE WHEN c.owner = ? THEN c.owner_read_at ELSE c.renter_read_at END, '-infinity')
+		GROUP BY m.conversation_id`, ids, userId, userId).Scan(&unread).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+
+	data.Conversations = make([]ConversationSummary, len(conversations))
+	for i := range conversations {
+		data.Conversations[i].Conversation = conversations[i]
+		for j := range lastMessages {
+			if lastMessages[j].ConversationID == conversations[i].ID {
+				data.Conversations[i].LastMessage = &lastMessages[j]
+			}
+		}
+		for _, u := range unread {
+			if u.ConversationID == conversations[i].ID {
+				data.Conversations[i].UnreadCount = u.Count
+			}
+		}
+	}
+
+	// Return query result.
+	return data, nil
+}
+
+// GetConversationMessages method for get the messages of the conversation before the message, the newest is the first.
+func (q *MessageQueries) GetConversationMessages(conversationId uint64, before *uuid.UUID, limit int) ([]models.Message, error) {
+	// Define messages variable.
+	messages := make([]models.Message, 0)
+
+	tx := q.Model(models.Message{}).Where("conversation_id = ?", conversationId)
+	if before != nil {
+		tx = tx.Where("id < (SELECT id FROM messages WHERE uid = ? AND conversation_id = ?)", *before, conversationId)
+	}
+
+	// Send query to database.
+	err := tx.Order("id desc").Limit(limit).Preload("Attachments").Find(&messages).Error
+	if err != nil {
+		// Return empty object and error.
+		return messages, err
+	}
+
+	// Return query result.
+	return messages, nil
+}
+
+// CreateMessage method for save the message with the attachments uploaded by the sender, the conversation is read by the sender.
+func (q *MessageQueries) CreateMessage(conversation *models.Conversation, message *models.Message, attachmentIds []uuid.UUID) error {
+	// Send query to database.
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(message).Error; err != nil {
+			return err
+		}
+		if len(attachmentIds) > 0 {
+			result := tx.Model(&models.MessageAttachment{}).Where("id IN ? AND uploader = ? AND message_id IS NULL AND status = ?", attachmentIds, message.SenderID, models.IMAGE_STATUS_READY).
+				Update("message_id", message.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(attachmentIds)) {
+				return ErrAttachmentNotFound
+			}
+			if err := tx.Where("message_id = ?", message.ID).Find(&message.Attachments).Error; err != nil {
+				return err
+			}
+		}
+		updates := map[string]interface{}{"last_message_at": message.CreatedAt, "updated_at": time.Now()}
+		if conversation.OwnerID == message.SenderID {
+			conversation.OwnerReadAt = &message.CreatedAt
+			updates["owner_read_at"] = message.CreatedAt
+		} else {
+			conversation.RenterReadAt = &message.CreatedAt
+			updates["renter_read_at"] = message.CreatedAt
+		}
+		conversation.LastMessageAt = &message.CreatedAt
+		return tx.Model(&models.Conversation{}).Where("id = ?", conversation.ID).Updates(updates).Error
+	})
+
+	// Return query result.
+	return err
+}
+
+// MarkConversationRead method for save that the messages of the conversation are read by the user until now.
+func (q *MessageQueries) MarkConversationRead(conversation *models.Conversation, userId uuid.UUID) error {
+	now := time.Now()
+	column := "renter_read_at"
+	if conversation.OwnerID == userId {
+		column = "owner_read_at"
+		conversation.OwnerReadAt = &now
+	} else {
+		conversation.RenterReadAt = &now
+	}
+
+	// Send query to database.
+	return q.Model(&models.Conversation{}).Where("id = ?", conversation.ID).UpdateColumn(column, now).Error
+}
+
+// GetUnreadMessageCount method for get the number of the unread messages and the conversations with unread messages of the user.
+func (q *MessageQueries) GetUnreadMessageCount(userId uuid.UUID) (int64, int64, error) {
+	var result struct {
+		Messages      int64
+		Conversations int64
+	}
+
+	// Send query to database.
+	err := q.Raw(`SELECT COUNT(*) AS messages, COUNT(DISTINCT m.conversation_id) AS conversations FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE (c.renter = ? OR c.owner = ?) AND m.sender <> ?
+			AND m.created_at > COALESCE(CASE WHEN c.owner = ? THEN c.owner_read_at ELSE c.renter_read_at END, '-infinity')`,
+		userId, userId, userId, userId).Scan(&result).Error
+
+	// Return query result.
+	return result.Messages, result.Conversations, err
+}
+
+// CreateMessageAttachment method for save the uploaded attachment.
+func (q *MessageQueries) CreateMessageAttachment(attachment *models.MessageAttachment) error {
+	// Send query to database.
+	return q.Create(attachment).Error
+}
+
+// GetMessageAttachment method for get the uploaded attachment, gorm.ErrRecordNotFound is returned if it is not found.
+func (q *MessageQueries) GetMessageAttachment(id uuid.UUID) (models.MessageAttachment, error) {
+	// Define attachment variable.
+	attachment := models.MessageAttachment{}
+
+	// Send query to database.
+	err := q.Where("id = ?", id).First(&attachment).Error
+	if err != nil {
+		// Return empty object and error.
+		return attachment, err
+	}
+
+	// Return query result.
+	return attachment, nil
+}
+
+// SetMessageAttachmentProcessed method for save the created variants of the uploaded attachment, the attachment is ready to send.
+func (q *MessageQueries) SetMessageAttachmentProcessed(id uuid.UUID, images models.RentalHouseImagesArray) error {
+	// Send query to database.
+	result := q.Model(&models.MessageAttachment{}).Where("id = ? AND status = ?", id, models.IMAGE_STATUS_PROCESSING).Updates(map[string]interface{}{
+		"images":           images,
+		"status":           models.IMAGE_STATUS_READY,
+		"source_key":       "",
+		"processing_error": "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrImageAlreadyHandled
+	}
+	return nil
+}
+
+// SetMessageAttachmentAttempt method for save a failed processing attempt of the uploaded attachment,
+// the processing attachment is queued again at nextAttemptAt.
+func (q *MessageQueries) SetMessageAttachmentAttempt(id uuid.UUID, attempts int, status models.ImageStatus, message string, nextAttemptAt *time.Time) error {
+	updates := map[string]interface{}{
+		"attempts":         attempts,
+		"status":           status,
+		"processing_error": message,
+		"next_attempt_at":  nextAttemptAt,
+	}
+	if status == models.IMAGE_STATUS_FAILED {
+		updates["source_key"] = ""
+	}
+
+	// Send query to database.
+	result := q.Model(&models.MessageAttachment{}).Where("id = ? AND status = ?", id, models.IMAGE_STATUS_PROCESSING).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrImageAlreadyHandled
+	}
+	return nil
+}
+
+// ClaimRetryMessageAttachments method for get the processing attachments whose next attempt time has come. The next attempt of the
+// claimed attachments is postponed for the lease duration, so they are queued again if they are not processed until then.
+func (q *MessageQueries) ClaimRetryMessageAttachments(limit int, lease time.Duration) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+
+	// Send query to database.
+	err := q.Raw(`UPDATE message_attachments SET next_attempt_at = ? WHERE id IN (
+			SELECT id FROM message_attachments WHERE status = ? AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED
+		) RETURNING id`, time.Now().Add(lease), models.IMAGE_STATUS_PROCESSING, limit).Scan(&ids).Error
+	return ids, err
+}
+
+// DeleteUnsentMessageAttachments method for delete the attachments which are uploaded before the given time and not sent.
+// The deleted attachments are returned to remove their files.
+func (q *MessageQueries) DeleteUnsentMessageAttachments(before time.Time, limit int) ([]models.MessageAttachment, error) {
+	// Define attachments variable.
+	attachments := make([]models.MessageAttachment, 0)
+
+	// Send query to database.
+	err := q.Raw(`DELETE FROM message_attachments WHERE id IN (
+			SELECT id FROM message_attachments WHERE message_id IS NULL AND created_at < ?
+			ORDER BY created_at LIMIT ? FOR UPDATE SKIP LOCKED
+		) RETURNING *`, before, limit).Scan(&attachments).Error
+	if err != nil {
+		// Return empty object and error.
+		return attachments, err
+	}
+
+	// Return query result.
+	return attachments, nil
+}
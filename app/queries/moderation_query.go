@@ -0,0 +1,220 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// PerceptualHashBands is the number of the 8 bit bands of the perceptual hashes, each band is indexed.
+const PerceptualHashBands = 8
+
+// PerceptualHashBand returns the sql expression of the band of the hash column, the indexes use the same expression.
+func PerceptualHashBand(column string, band int) string {
+	return fmt.Sprintf("((%s >> %d) & 255)", column, band*8)
+}
+
+// similarHashCondition returns the sql condition of the similar hashes, the distance is the only parameter.
+// The hashes within 7 bits share a band, the bands use the indexes and the distance is checked after them.
+func similarHashCondition(a string, b string) string {
+	bands := make([]string, PerceptualHashBands)
+	for i := range bands {
+		bands[i] = PerceptualHashBand(a, i) + " = " + PerceptualHashBand(b, i)
+	}
+	return "(" + strings.Join(bands, " OR ") + ") AND " + hammingDistance(a, b) + " <= ?"
+}
+
+// hammingDistance returns the sql expression of the number of the different bits of the hashes.
+func hammingDistance(a string, b string) string {
+	return fmt.Sprintf("length(replace((%s # %s)::bit(64)::text, '0', ''))", a, b)
+}
+
+// SimilarImagePair is a pair of similar images of the listings of different owners.
+type SimilarImagePair struct {
+	ImageID      uuid.UUID
+	OtherImageID uuid.UUID
+	Distance     int
+}
+
+// ModerationQueries struct
+type ModerationQueries struct {
+	*gorm.DB
+}
+
+// LockRentalHouseModeration method for lock the rental house until the end of the transaction and read its moderation
+// fields again, so the decision of a moderator is not lost while the rental house is edited.
+func (q *ModerationQueries) LockRentalHouseModeration(rh *models.RentalHouse) error {
+	// Send query to database.
+	return q.Model(&models.RentalHouse{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", rh.ID).
+		Select("moderation_status", "rejection_reason", "moderation_flags", "submitted_at", "moderated_at").Take(rh).Error
+}
+
+// SetModerationStatus method for change the moderation status of the rental house and write it to the history.
+// moderatorId is nil for the automatic checks and the owner actions.
+func (q *ModerationQueries) SetModerationStatus(rh *models.RentalHouse, status models.ModerationStatus, moderatorId *uuid.UUID, reason string, flags []string) error {
+	now := time.Now()
+	log := models.ModerationLog{
+		RentalHouseID: rh.ID,
+		ModeratorID:   moderatorId,
+		FromStatus:    rh.ModerationStatus,
+		Status:        status,
+		Reason:        reason,
+		Flags:         flags,
+	}
+	updates := map[string]interface{}{
+		"moderation_status": status,
+		"moderation_flags":  models.StringArray(flags),
+		"rejection_reason":  "",
+	}
+	switch status {
+	case models.MODERATION_STATUS_PENDING:
+		updates["submitted_at"] = now
+	case models.MODERATION_STATUS_APPROVED:
+		updates["moderated_at"] = now
+	case models.MODERATION_STATUS_REJECTED:
+		updates["rejection_reason"] = reason
+		updates["moderated_at"] = now
+	}
+
+	// Send query to database.
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RentalHouse{}).Where("id = ?", rh.ID).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&log).Error
+	})
+	if err != nil {
+		// Return only error.
+		return err
+	}
+
+	// Keep the struct in sync with the saved fields.
+	rh.ModerationStatus = status
+	rh.ModerationFlags = flags
+	rh.RejectionReason = updates["rejection_reason"].(string)
+	if status == models.MODERATION_STATUS_PENDING {
+		rh.SubmittedAt = &now
+	} else if status != models.MODERATION_STATUS_DRAFT {
+		rh.ModeratedAt = &now
+	}
+	return nil
+}
+
+// GetModerationQueue method for get the rental houses with the moderation status, the oldest submitted is the first.
+func (q *ModerationQueries) GetModerationQueue(status models.ModerationStatus, pagination *models.Pagination) (RentalHouseList, error) {
+	// Define variables.
+	data := RentalHouseList{}
+	offset := (pagination.Page - 1) * pagination.Limit
+	if pagination.Page > 1 {
+		data.PrevPage = true
+	}
+
+	// Get full count.
+	err := q.Model(models.RentalHouse{}).Where("moderation_status = ?", status).Count(&data.FullCount).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	if int(data.FullCount) > offset+pagination.Limit {
+		data.NextPage = true
+	}
+
+	// Send query to database.
+	err = q.Model(models.RentalHouse{}).Where("moderation_status = ?", status).Limit(pagination.Limit).Offset(offset).Order("submitted_at ASC NULLS LAST, id ASC").Preload("Images", orderedImages).Preload("Creator").Preload("Quarter.District.Town.City.Country").Find(&data.Houses).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return data, nil
+		}
+		// Return empty object and error.
+		return data, err
+	}
+	data.TotalCount = int64(len(data.Houses))
+
+	// Return query result.
+	return data, nil
+}
+
+// GetModerationLogs method for get the moderation history of the rental house, the newest is the first.
+func (q *ModerationQueries) GetModerationLogs(rentalHouseId int) ([]models.ModerationLog, error) {
+	// Define logs variable.
+	logs := make([]models.ModerationLog, 0)
+
+	// Send query to database.
+	err := q.Model(models.ModerationLog{}).Where("rental_house_id = ?", rentalHouseId).Preload("Moderator").Order("created_at DESC, id DESC").Find(&logs).Error
+	if err != nil {
+		// Return empty object and error.
+		return logs, err
+	}
+
+	// Return query result.
+	return logs, nil
+}
+
+// GetDuplicateImageRentalHouseIDs method for get the other rental houses which have one of the images of the rental house.
+func (q *ModerationQueries) GetDuplicateImageRentalHouseIDs(rentalHouseId int) ([]int, error) {
+	// Define ids variable.
+	ids := make([]int, 0)
+
+	// Send query to database.
+	err := q.Raw(`SELECT DISTINCT o.rental_house_id FROM rental_house_images i
+		JOIN rental_house_images o ON o.checksum = i.checksum AND o.rental_house_id <> i.rental_house_id
+		JOIN rental_houses rh ON rh.id = o.rental_house_id AND rh.deleted_at IS NULL
+		WHERE i.rental_house_id = ? AND i.checksum <> ''`, rentalHouseId).Scan(&ids).Error
+	if err != nil {
+		// Return empty object and error.
+		return ids, err
+	}
+
+	// Return query result.
+	return ids, nil
+}
+
+// GetSimilarImageRentalHouseIDs method for get the rental houses of the other owners which have an image similar to one of the images of the rental house.
+func (q *ModerationQueries) GetSimilarImageRentalHouseIDs(rentalHouseId int, maxDistance int) ([]int, error) {
+	// Define ids variable.
+	ids := make([]int, 0)
+
+	// Send query to database.
+	err := q.Raw(`SELECT DISTINCT o.rental_house_id FROM rental_house_images i
+		JOIN rental_houses rh ON rh.id = i.rental_house_id
+		JOIN rental_house_images o ON o.rental_house_id <> i.rental_house_id AND o.perceptual_hash IS NOT NULL
+			AND `+similarHashCondition("i.perceptual_hash", "o.perceptual_hash")+`
+		JOIN rental_houses orh ON orh.id = o.rental_house_id AND orh.deleted_at IS NULL AND orh.creator <> rh.creator
+		WHERE i.rental_house_id = ? AND i.perceptual_hash IS NOT NULL`, maxDistance, rentalHouseId).Scan(&ids).Error
+	if err != nil {
+		// Return empty object and error.
+		return ids, err
+	}
+
+	// Return query result.
+	return ids, nil
+}
+
+// GetSimilarImagePairs method for get the similar images of the listings of different owners, the newest pairs are the first.
+func (q *ModerationQueries) GetSimilarImagePairs(maxDistance int, limit int) ([]SimilarImagePair, error) {
+	// Define pairs variable.
+	pairs := make([]SimilarImagePair, 0)
+
+	// Send query to database.
+	err := q.Raw(`SELECT i.id AS image_id, o.id AS other_image_id, `+hammingDistance("i.perceptual_hash", "o.perceptual_hash")+` AS distance
+		FROM rental_house_images i
+		JOIN rental_houses rh ON rh.id = i.rental_house_id AND rh.deleted_at IS NULL
+		JOIN rental_house_images o ON o.id > i.id AND o.perceptual_hash IS NOT NULL
+			AND `+similarHashCondition("i.perceptual_hash", "o.perceptual_hash")+`
+		JOIN rental_houses orh ON orh.id = o.rental_house_id AND orh.deleted_at IS NULL AND orh.creator <> rh.creator
+		WHERE i.perceptual_hash IS NOT NULL
+		ORDER BY GREATEST(i.created_at, o.created_at) DESC
+		LIMIT ?`, maxDistance, limit).Scan(&pairs).Error
+	if err != nil {
+		// Return empty object and error.
+		return pairs, err
+	}
+
+	// Return query result.
+	return pairs, nil
+}
@@ -0,0 +1,133 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// NotificationQueries struct
+type NotificationQueries struct {
+	*gorm.DB
+}
+
+func getNotificationPreference(tx *gorm.DB, userId uuid.UUID) (models.NotificationPreference, error) {
+	preference := models.NotificationPreference{}
+	err := tx.Where("user_id = ?", userId).First(&preference).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultNotificationPreference(userId), nil
+	}
+	return preference, err
+}
+
+// CreateNotifications adds the notification to the outbox for each channel enabled by the user.
+// tx is the transaction of the change which the notification tells about, so the notification is sent only if the change is saved.
+func CreateNotifications(tx *gorm.DB, userId uuid.UUID, notificationType models.NotificationType, reference string, data models.NotificationData) error {
+	preference, err := getNotificationPreference(tx, userId)
+	if err != nil {
+		return err
+	}
+	channels := preference.Channels()
+	if len(channels) == 0 {
+		return nil
+	}
+
+	notifications := make([]models.Notification, len(channels))
+	for i, channel := range channels {
+		notifications[i] = models.Notification{
+			UserID:    userId,
+			Type:      notificationType,
+			Channel:   channel,
+			Reference: reference,
+			Data:      data,
+			Status:    models.NOTIFICATION_STATUS_PENDING,
+		}
+	}
+
+	// Send query to database.
+	return tx.Omit(clause.Associations).Create(&notifications).Error
+}
+
+// GetNotificationPreference method for get the notification settings of the user, the default settings if they are not changed.
+func (q *NotificationQueries) GetNotificationPreference(userId uuid.UUID) (models.NotificationPreference, error) {
+	// Send query to database.
+	return getNotificationPreference(q.DB, userId)
+}
+
+// SaveNotificationPreference method for save the notification settings of the user.
+func (q *NotificationQueries) SaveNotificationPreference(preference *models.NotificationPreference) error {
+	preference.UpdatedAt = time.Now()
+
+	// Send query to database, all columns are written because the false values are not inserted for the columns with defaults.
+	return q.Select("*").Clauses(clause.OnConflict{UpdateAll: true}).Create(preference).Error
+}
+
+// ClaimDueNotifications method for get the pending notifications whose time has come. The claimed notifications are postponed
+// for the lease duration, so the other workers do not take them and they are tried again if the worker stops before saving the result.
+func (q *NotificationQueries) ClaimDueNotifications(limit int, lease time.Duration) ([]models.Notification, error) {
+	// Define notifications variable.
+	notifications := make([]models.Notification, 0)
+
+	var ids []uint64
+	err := q.Raw(`UPDATE notifications SET next_attempt_at = ? WHERE id IN (
+			SELECT id FROM notifications WHERE status = ? AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id LIMIT ? FOR UPDATE SKIP LOCKED
+		) RETURNING id`, time.Now().Add(lease), models.NOTIFICATION_STATUS_PENDING, limit).Scan(&ids).Error
+	if err != nil || len(ids) == 0 {
+		// Return empty object and error.
+		return notifications, err
+	}
+
+	// Send query to database.
+	err = q.Model(&models.Notification{}).Preload("User").Where("id IN ?", ids).Order("id").Find(&notifications).Error
+	if err != nil {
+		// Return empty object and error.
+		return notifications, err
+	}
+
+	// Return query result.
+	return notifications, nil
+}
+
+// SetNotificationResult method for save the result of the delivery attempt. The failed notification stays pending
+// until the next attempt, message is the error of the failed or skipped delivery.
+func (q *NotificationQueries) SetNotificationResult(notification *models.Notification, status models.NotificationStatus, message string, nextAttemptAt time.Time) error {
+	updates := map[string]interface{}{
+		"status":          status,
+		"attempts":        notification.Attempts,
+		"error":           message,
+		"next_attempt_at": nextAttemptAt,
+		"updated_at":      time.Now(),
+	}
+	if status == models.NOTIFICATION_STATUS_SENT {
+		updates["sent_at"] = time.Now()
+	}
+
+	// Send query to database.
+	return q.Model(&models.Notification{}).Where("id = ?", notification.ID).Updates(updates).Error
+}
+
+// GetPaymentsToRemind method for get the pending monthly payments of the accepted reservations which expire before the given time
+// and are not reminded yet.
+func (q *NotificationQueries) GetPaymentsToRemind(before time.Time) ([]models.Payment, error) {
+	// Define payments variable.
+	payments := make([]models.Payment, 0)
+
+	// Send query to database.
+	err := q.Model(&models.Payment{}).Preload("Reservation.RentalHouse", withArchived).
+		Joins("JOIN reservations ON reservations.id = payments.reservation_id").
+		Where("payments.status = ? AND payments.is_first_payment = ? AND reservations.status = ?", models.PAYMENT_STATUS_PENDING, false, models.RESERVATION_STATUS_ACCEPTED).
+		Where("payments.expire > now() AND payments.expire <= ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM notifications WHERE notifications.type = ? AND notifications.reference = payments.uid::text)", models.NOTIFICATION_TYPE_PAYMENT_DUE).
+		Find(&payments).Error
+	if err != nil {
+		// Return empty object and error.
+		return payments, err
+	}
+
+	// Return query result.
+	return payments, nil
+}
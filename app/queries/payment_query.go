@@ -5,6 +5,7 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"time"
 )
 
 // PaymentQueries struct
@@ -18,7 +19,7 @@ func (q *PaymentQueries) GetFirstPaymentWithReservationID(reservationId uint64)
 	payment := models.Payment{}
 
 	// Send query to database.
-	err := q.Model(models.Payment{}).Preload("Reservation."+clause.Associations).Where("reservation_id = ? AND is_first_payment = ?", reservationId, true).First(&payment).Error
+	err := q.Model(models.Payment{}).Preload("Reservation."+clause.Associations).Preload("Reservation.RentalHouse", withArchived).Where("reservation_id = ? AND is_first_payment = ?", reservationId, true).First(&payment).Error
 	if err != nil {
 		// If record not found return empty object.
 		if err == gorm.ErrRecordNotFound {
@@ -39,7 +40,7 @@ func (q *PaymentQueries) GetPaymentsWithUser(uuid uuid.UUID) ([]models.Payment,
 	var payments []models.Payment
 
 	// Send query to database.
-	err := q.Model(models.Payment{}).Joins("Reservation", "CreatorID = ?", uuid.String()).Preload("Reservation.Creator." + clause.Associations).Preload("Reservation.RentalHouse.Quarter.District.Town.City.Country").Find(&payments).Error
+	err := q.Model(models.Payment{}).Joins("Reservation", "CreatorID = ?", uuid.String()).Preload("Reservation.Creator."+clause.Associations).Preload("Reservation.RentalHouse", withArchived).Preload("Reservation.RentalHouse.Quarter.District.Town.City.Country").Preload("Taxes").Find(&payments).Error
 	if err != nil {
 		// If record not found return empty object.
 		if err == gorm.ErrRecordNotFound {
@@ -60,7 +61,7 @@ func (q *PaymentQueries) GetPaymentWithUid(uuid uuid.UUID) (models.Payment, erro
 	payment := models.Payment{}
 
 	// Send query to database.
-	err := q.Model(models.Payment{}).Where("uid = ?", uuid).Preload("Reservation.Creator." + clause.Associations).Preload("Reservation.RentalHouse.Quarter.District.Town.City.Country").First(&payment).Error
+	err := q.Model(models.Payment{}).Where("uid = ?", uuid).Preload("Reservation.Creator."+clause.Associations).Preload("Reservation.RentalHouse", withArchived).Preload("Reservation.RentalHouse.Quarter.District.Town.City.Country").Preload("Taxes").Preload("Tenders").First(&payment).Error
 	if err != nil {
 		// If record not found return empty object.
 		if err == gorm.ErrRecordNotFound {
@@ -81,7 +82,7 @@ func (q *PaymentQueries) GetPaymentWithSPI(paymentIntentId string) (models.Payme
 	payment := models.Payment{}
 
 	// Send query to database.
-	err := q.Model(models.Payment{}).Preload("Reservation."+clause.Associations).Where("stripe_id = ?", paymentIntentId).First(&payment).Error
+	err := q.Model(models.Payment{}).Preload("Reservation."+clause.Associations).Preload("Reservation.RentalHouse", withArchived).Where("stripe_id = ?", paymentIntentId).First(&payment).Error
 	if err != nil {
 		// If record not found return empty object.
 		if err == gorm.ErrRecordNotFound {
@@ -95,3 +96,43 @@ func (q *PaymentQueries) GetPaymentWithSPI(paymentIntentId string) (models.Payme
 	// Return query result.
 	return payment, nil
 }
+
+// GetOwnerCompletedPaymentsInYear method for get completed payments of the rental houses owned by the user in given year.
+func (q *PaymentQueries) GetOwnerCompletedPaymentsInYear(ownerId uuid.UUID, year int) ([]models.Payment, error) {
+	// Define payments variable.
+	var payments []models.Payment
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+
+	// Send query to database.
+	err := q.Model(models.Payment{}).
+		Joins("JOIN reservations ON reservations.id = payments.reservation_id").
+		Joins("JOIN rental_houses ON rental_houses.id = reservations.rental_house_id").
+		Where("rental_houses.creator = ? AND payments.status = ?", ownerId.String(), models.PAYMENT_STATUS_COMPLETED).
+		Where("COALESCE(payments.paid_at, payments.updated_at) >= ? AND COALESCE(payments.paid_at, payments.updated_at) < ?", start, end).
+		Preload("Reservation.RentalHouse", withArchived).Preload("Taxes").Find(&payments).Error
+	if err != nil {
+		// Return empty object and error.
+		return payments, err
+	}
+
+	// Return query result.
+	return payments, nil
+}
+
+// GetStripePaymentsUpdatedBetween method for get payments having a stripe payment intent and updated in given time range.
+func (q *PaymentQueries) GetStripePaymentsUpdatedBetween(from, to time.Time) ([]models.Payment, error) {
+	// Define payments variable.
+	var payments []models.Payment
+
+	// Send query to database.
+	err := q.Model(models.Payment{}).Preload("Reservation."+clause.Associations).Preload("Reservation.RentalHouse", withArchived).Where("stripe_id IS NOT NULL AND updated_at >= ? AND updated_at < ?", from, to).Find(&payments).Error
+	if err != nil {
+		// Return empty object and error.
+		return payments, err
+	}
+
+	// Return query result.
+	return payments, nil
+}
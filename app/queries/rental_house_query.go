@@ -7,6 +7,8 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"html"
+	"strings"
 	"time"
 )
 
@@ -15,28 +17,152 @@ type RentalHouseQueries struct {
 	*gorm.DB
 }
 
+// SearchConfiguration is the text search configuration of the listings, turkish stemming with unaccent.
+const SearchConfiguration = "turkish_unaccent"
+
 // NewRentalHouse method for create new rental house.
 func (q *RentalHouseQueries) NewRentalHouse(rh *models.RentalHouse) error {
 	// Send query to database.
-	err := q.Model(models.RentalHouse{}).Create(rh).Preload("Images").Preload("Quarter.District.Town.City.Country").First(rh).Error
+	err := q.Model(models.RentalHouse{}).Create(rh).Preload("Images", orderedImages).Preload("Quarter.District.Town.City.Country").First(rh).Error
+	if err != nil {
+		// Return only error.
+		return err
+	}
+
+	err = q.UpdateRentalHouseLocations(rh.ID)
 	if err != nil {
 		// Return only error.
 		return err
 	}
 
 	// This query returns nothing.
-	return nil
+	return q.UpdateRentalHouseSearchVectors(rh.ID)
 }
 
-// UpdateRentalHouse method for create new rental house image.
+// rentalHouseEditColumns are the columns of the rental house which are edited by its owner. The moderation and the rating
+// columns are changed by their own queries, so they are not overwritten with the values read before the edit.
+var rentalHouseEditColumns = []string{
+	"title", "description", "quarter_id", "rent_period", "price", "currency", "listing_type", "min_day", "g_coordinate", "published",
+	"room_count", "living_room_count", "gross_area", "net_area", "floor", "building_age", "heating_type", "furnished", "max_guests", "updated_at",
+}
+
+// UpdateRentalHouse method for update the columns of the rental house edited by its owner.
 func (q *RentalHouseQueries) UpdateRentalHouse(rh *models.RentalHouse) error {
-	// Insert query to database.
-	err := q.Save(rh).Error
+	// Send query to database.
+	err := q.Model(rh).Select(rentalHouseEditColumns).Updates(rh).Error
 	if err != nil {
 		// Return only error.
 		return err
 	}
-	return nil
+	err = q.UpdateRentalHouseLocations(rh.ID)
+	if err != nil {
+		// Return only error.
+		return err
+	}
+	return q.UpdateRentalHouseSearchVectors(rh.ID)
+}
+
+// UpdateRentalHouseLocations method for update the locations of the rental houses from the "(lat,lon)" g_coordinate,
+// or from the quarter centroid if it is not set. If no id is given, the missing locations are updated.
+func (q *RentalHouseQueries) UpdateRentalHouseLocations(ids ...int) error {
+	query := `UPDATE rental_houses rh SET location = CASE
+		WHEN rh.g_coordinate ~ '^\(-?[0-9]+(\.[0-9]+)?,-?[0-9]+(\.[0-9]+)?\)$' AND NOT (rh.g_coordinate::point ~= point(0, 0))
+			THEN point((rh.g_coordinate::point)[1], (rh.g_coordinate::point)[0])
+		WHEN q.detail LIKE '{%'
+			THEN point((q.detail::json->>'lon')::float8, (q.detail::json->>'lat')::float8)
+		END
+	FROM quarters q
+	WHERE q.id = rh.quarter_id`
+	args := map[string]interface{}{}
+	if len(ids) > 0 {
+		query += " AND rh.id IN @ids"
+		args["ids"] = ids
+	} else {
+		query += " AND rh.location IS NULL"
+	}
+
+	// Send query to database.
+	return q.Exec(query, args).Error
+}
+
+// UpdateRentalHouseSearchVectors method for update the full text search vectors of the rental houses.
+// Title, address names and description are weighted in order. If no id is given, the missing vectors are updated.
+func (q *RentalHouseQueries) UpdateRentalHouseSearchVectors(ids ...int) error {
+	query := `UPDATE rental_houses rh SET search_vector =
+		setweight(to_tsvector(@config, coalesce(rh.title, '')), 'A') ||
+		setweight(to_tsvector(@config, concat_ws(' ', q.name, d.name, t.name, c.name,
+			CASE WHEN rh.room_count + rh.living_room_count > 0 THEN rh.room_count || '+' || rh.living_room_count END)), 'B') ||
+		setweight(to_tsvector(@config, coalesce(rh.description, '')), 'C')
+	FROM quarters q
+		JOIN districts d ON d.id = q.district_id
+		JOIN towns t ON t.id = d.town_id
+		JOIN cities c ON c.id = t.city_id
+	WHERE q.id = rh.quarter_id`
+	args := map[string]interface{}{"config": SearchConfiguration}
+	if len(ids) > 0 {
+		query += " AND rh.id IN @ids"
+		args["ids"] = ids
+	} else {
+		query += " AND rh.search_vector IS NULL"
+	}
+
+	// Send query to database.
+	return q.Exec(query, args).Error
+}
+
+// RentalHouseHighlight is the search result snippets of a rental house.
+type RentalHouseHighlight struct {
+	ID          int
+	Title       string
+	Description string
+}
+
+// The matched words are marked with private use characters instead of tags, so the listing text is escaped before the <b> tags are added.
+// The markers in the listing text are removed before it is highlighted.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// highlightHTML escapes the snippet and replaces the highlight markers with <b> tags.
+func highlightHTML(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(snippet)
+}
+
+// GetRentalHouseHighlights method for get the highlighted snippets of the rental houses matching the search.
+func (q *RentalHouseQueries) GetRentalHouseHighlights(ids []int, search string) (map[int]RentalHouseHighlight, error) {
+	// Define highlights variable.
+	highlights := map[int]RentalHouseHighlight{}
+	if len(ids) == 0 || search == "" {
+		return highlights, nil
+	}
+
+	var rows []RentalHouseHighlight
+	// Send query to database.
+	err := q.Raw(`SELECT id,
+		ts_headline(@config, translate(title, @markers, ''), websearch_to_tsquery(@config, @search), @titleOptions) AS title,
+		ts_headline(@config, translate(description, @markers, ''), websearch_to_tsquery(@config, @search), @descriptionOptions) AS description
+	FROM rental_houses WHERE id IN @ids`, map[string]interface{}{
+		"config":             SearchConfiguration,
+		"search":             search,
+		"ids":                ids,
+		"markers":            highlightStart + highlightStop,
+		"titleOptions":       fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", highlightStart, highlightStop),
+		"descriptionOptions": fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=8", highlightStart, highlightStop),
+	}).Scan(&rows).Error
+	if err != nil {
+		// Return empty object and error.
+		return highlights, err
+	}
+
+	// Return query result.
+	for _, row := range rows {
+		row.Title = highlightHTML(row.Title)
+		row.Description = highlightHTML(row.Description)
+		highlights[row.ID] = row
+	}
+	return highlights, nil
 }
 
 // GetRentalHouseWithUid method for get rental house with uid.
@@ -45,7 +171,7 @@ func (q *RentalHouseQueries) GetRentalHouseWithUid(uid uuid.UUID) (models.Rental
 	house := models.RentalHouse{}
 
 	// Send query to database.
-	err := q.Debug().Model(models.RentalHouse{}).Where("uid = ?", uid.String()).Preload("Images").Preload("Quarter.District.Town.City.Country").Preload("Creator." + clause.Associations).First(&house).Error
+	err := q.Debug().Model(models.RentalHouse{}).Where("uid = ?", uid.String()).Preload("Images", orderedImages).Preload("Quarter.District.Town.City.Country").Preload("Amenities", "active IS TRUE").Preload("Creator." + clause.Associations).First(&house).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return house, nil
@@ -84,8 +210,8 @@ func (q *RentalHouseQueries) IsUsersFavorite(userId uuid.UUID, id int) (bool, er
 	return false, nil
 }
 
-// GetFavoriteRentalHouseList method for get rental house list. (results, prev, next, error)
-func (q *RentalHouseQueries) GetFavoriteRentalHouseList(userId uuid.UUID, pagination *models.Pagination) (RentalHouseList, error) {
+// GetFavoriteRentalHouseList method for get the public favorite rental houses of the user. (results, prev, next, error)
+func (q *RentalHouseQueries) GetFavoriteRentalHouseList(userId uuid.UUID, pagination *models.Pagination, filter *models.RentalHouseFilter) (RentalHouseList, error) {
 	// Define variables.
 	data := RentalHouseList{}
 	offset := (pagination.Page - 1) * pagination.Limit
@@ -93,19 +219,41 @@ func (q *RentalHouseQueries) GetFavoriteRentalHouseList(userId uuid.UUID, pagina
 		data.PrevPage = true
 	}
 
-	filterArgs := pagination.Filters.ToPreloadQuery()
 	var favoriteHouses []models.RentalHouseFavorite
 
-	// Get full count over()
-	q.Model(models.RentalHouseFavorite{}).Where("creator = ?", userId.String()).Order(pagination.Sort).Preload("RentalHouse", filterArgs...).Preload(clause.Associations).Select("count(*) over() as full_count").Count(&data.FullCount)
-	if data.FullCount > 0 {
-		if int(data.FullCount) > offset+pagination.Limit {
-			data.NextPage = true
-		}
+	// Only the public rental houses are listed, the others are kept in the favorites until they are public again.
+	rentalHouses := filterRentalHouses(publicRentalHouses(q.Model(models.RentalHouse{})), filter).Select("rental_houses.id")
+	tx := q.Model(models.RentalHouseFavorite{}).Where("creator = ?", userId.String()).
+		Where("rental_house_id IN (?)", rentalHouses).
+		Session(&gorm.Session{})
+
+	// Get full count.
+	err := tx.Count(&data.FullCount).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	if int(data.FullCount) > offset+pagination.Limit {
+		data.NextPage = true
+	}
+
+	// Favorites are sorted by the favorite date, the other fields are read from the rental house.
+	field, direction := pagination.Sort, ""
+	if i := strings.LastIndex(pagination.Sort, " "); i >= 0 {
+		field, direction = pagination.Sort[:i], pagination.Sort[i+1:]
 	}
+	order := "rental_house_favorites.created_at " + direction
+	switch field {
+	case "created_at", "relevance", "distance":
+	case "rating":
+		order = "(SELECT rating FROM rental_houses WHERE rental_houses.id = rental_house_favorites.rental_house_id) " + direction + " NULLS LAST"
+	default:
+		order = "(SELECT " + field + " FROM rental_houses WHERE rental_houses.id = rental_house_favorites.rental_house_id) " + direction
+	}
+	order += ", rental_house_favorites.id"
 
 	// Send query to database.
-	err := q.Model(models.RentalHouseFavorite{}).Where("creator = ?", userId.String()).Limit(pagination.Limit).Offset(offset).Order(pagination.Sort).Preload("RentalHouse", filterArgs...).Preload(clause.Associations).Find(&favoriteHouses).Error
+	err = tx.Limit(pagination.Limit).Offset(offset).Order(order).Preload("RentalHouse").Preload("RentalHouse.Images", orderedImages).Preload(clause.Associations).Find(&favoriteHouses).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return data, nil
@@ -123,8 +271,131 @@ func (q *RentalHouseQueries) GetFavoriteRentalHouseList(userId uuid.UUID, pagina
 	return data, nil
 }
 
+// kmPerMile is used to convert the distances of earthdistance, the <@> operator returns statute miles.
+const kmPerMile = 1.609344
+
+// filterRentalHouses method for apply the structured search to a rental house query.
+func filterRentalHouses(tx *gorm.DB, filter *models.RentalHouseFilter) *gorm.DB {
+	if filter == nil {
+		return tx
+	}
+
+	if filter.Search != "" {
+		tx = tx.Where("search_vector @@ websearch_to_tsquery(?, ?)", SearchConfiguration, filter.Search)
+	}
+
+	// Address filters, every level is matched with its sub levels.
+	if len(filter.QuarterIDs) > 0 {
+		tx = tx.Where("quarter_id IN ?", filter.QuarterIDs)
+	}
+	if len(filter.DistrictIDs) > 0 {
+		tx = tx.Where("quarter_id IN (SELECT id FROM quarters WHERE district_id IN ?)", filter.DistrictIDs)
+	}
+	if len(filter.TownIDs) > 0 {
+		tx = tx.Where("quarter_id IN (SELECT q.id FROM quarters q JOIN districts d ON d.id = q.district_id WHERE d.town_id IN ?)", filter.TownIDs)
+	}
+	if len(filter.CityIDs) > 0 {
+		tx = tx.Where("quarter_id IN (SELECT q.id FROM quarters q JOIN districts d ON d.id = q.district_id JOIN towns t ON t.id = d.town_id WHERE t.city_id IN ?)", filter.CityIDs)
+	}
+
+	// Prices are compared in the price currency.
+	if filter.MinPrice != nil {
+		tx = tx.Where(filter.PriceExpression()+" >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		tx = tx.Where(filter.PriceExpression()+" <= ?", *filter.MaxPrice)
+	}
+
+	if filter.RentPeriod != 0 {
+		tx = tx.Where("rent_period = ?", filter.RentPeriod)
+	}
+	if filter.MinDay != 0 {
+		tx = tx.Where("min_day <= ?", filter.MinDay)
+	}
+	if filter.CommisionType != nil {
+		tx = tx.Where("commision = ?", *filter.CommisionType)
+	}
+
+	// Attributes
+	if len(filter.Rooms) > 0 {
+		var rooms []string
+		var args []interface{}
+		for _, r := range filter.Rooms {
+			roomCount, livingRoomCount, ok := models.ParseRooms(r)
+			if !ok {
+				continue
+			}
+			rooms = append(rooms, "(room_count = ? AND living_room_count = ?)")
+			args = append(args, roomCount, livingRoomCount)
+		}
+		if len(rooms) > 0 {
+			tx = tx.Where("("+strings.Join(rooms, " OR ")+")", args...)
+		}
+	}
+	if filter.MinRooms != 0 {
+		tx = tx.Where("room_count >= ?", filter.MinRooms)
+	}
+	if filter.MinArea != 0 {
+		tx = tx.Where("gross_area >= ?", filter.MinArea)
+	}
+	if filter.MaxArea != 0 {
+		tx = tx.Where("gross_area <= ?", filter.MaxArea)
+	}
+	if filter.Furnished != nil {
+		tx = tx.Where("furnished = ?", *filter.Furnished)
+	}
+	if filter.MinGuests != 0 {
+		tx = tx.Where("max_guests >= ?", filter.MinGuests)
+	}
+	if len(filter.HeatingTypes) > 0 {
+		tx = tx.Where("heating_type IN ?", filter.HeatingTypes)
+	}
+	if filter.MaxBuildingAge != nil {
+		tx = tx.Where("building_age <= ?", *filter.MaxBuildingAge)
+	}
+	// The houses must have all of the amenities.
+	if len(filter.AmenityIDs) > 0 {
+		tx = tx.Where("(SELECT count(DISTINCT amenity_id) FROM rental_house_amenities WHERE rental_house_id = rental_houses.id AND amenity_id IN ?) = ?", filter.AmenityIDs, len(filter.AmenityIDs))
+	}
+
+	// Locations, the circle is filtered with its bounding box first to use the spatial index.
+	if filter.Bounds != nil {
+		tx = tx.Where("location <@ box(point(?, ?), point(?, ?))", filter.Bounds.MinLon, filter.Bounds.MinLat, filter.Bounds.MaxLon, filter.Bounds.MaxLat)
+	}
+	if filter.Near != nil {
+		box := filter.Near.BoundingBox()
+		tx = tx.Where("location <@ box(point(?, ?), point(?, ?))", box.MinLon, box.MinLat, box.MaxLon, box.MaxLat).
+			Where("(location <@> point(?, ?)) * ? <= ?", filter.Near.Lon, filter.Near.Lat, kmPerMile, filter.Near.RadiusKm)
+	}
+
+	// Exclude the houses having an active reservation overlapping the dates.
+	if filter.StartDate != nil && filter.EndDate != nil {
+		tx = tx.Where(`NOT EXISTS (SELECT 1 FROM reservations r WHERE r.rental_house_id = rental_houses.id
+			AND r.status NOT IN ? AND NOT (r.status = ? AND r.expire < ?) AND r.start_date < ? AND r.end_date > ?)`,
+			[]models.ReservationStatus{models.RESERVATION_STATUS_REJECTED, models.RESERVATION_STATUS_CANCELLED},
+			models.RESERVATION_STATUS_PENDING, time.Now(), *filter.EndDate, *filter.StartDate)
+	}
+
+	return tx
+}
+
+// publicRentalHouses returns the rental houses which are approved and published.
+func publicRentalHouses(tx *gorm.DB) *gorm.DB {
+	return tx.Where("rental_houses.published IS TRUE AND rental_houses.moderation_status = ?", models.MODERATION_STATUS_APPROVED)
+}
+
+// orderedImages is the preload condition of the rental house images, the main photo is the first.
+func orderedImages(tx *gorm.DB) *gorm.DB {
+	return tx.Order("main_photo DESC, display_order, created_at")
+}
+
+// withArchived is the preload condition of the rental houses of the past records, e.g. the reservations and the payments of an archived rental house.
+func withArchived(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
+
 // GetRentalHouseList method for get rental house list. (results, prev, next, error)
-func (q *RentalHouseQueries) GetRentalHouseList(pagination *models.Pagination) (RentalHouseList, error) {
+func (q *RentalHouseQueries) GetRentalHouseList(pagination *models.Pagination, filter *models.RentalHouseFilter) (RentalHouseList, error) {
 	// Define variables.
 	data := RentalHouseList{}
 	offset := (pagination.Page - 1) * pagination.Limit
@@ -132,18 +403,52 @@ func (q *RentalHouseQueries) GetRentalHouseList(pagination *models.Pagination) (
 		data.PrevPage = true
 	}
 
-	filterQuery, filterArgs := pagination.Filters.ToWhereQuery()
+	tx := publicRentalHouses(q.Model(models.RentalHouse{}))
+	if filterQuery, filterArgs := pagination.Filters.ToWhereQuery(); filterQuery != "" {
+		tx = tx.Where(filterQuery, filterArgs...)
+	}
+	tx = filterRentalHouses(tx, filter).Session(&gorm.Session{})
 
-	// Get full count over()
-	q.Model(models.RentalHouse{}).Order(pagination.Sort).Where("published IS TRUE").Where(filterQuery, filterArgs...).Select("count(*) OVER()").Scan(&data.FullCount)
+	// Get full count
+	err := tx.Count(&data.FullCount).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
 	if data.FullCount > 0 {
 		if int(data.FullCount) > offset+pagination.Limit {
 			data.NextPage = true
 		}
 	}
 
+	// Search results are sorted by relevance, location results by distance.
+	var order interface{} = pagination.Sort
+	field, direction, _ := strings.Cut(pagination.Sort, " ")
+	switch field {
+	case "relevance":
+		order = "created_at desc"
+		if filter != nil && filter.Search != "" {
+			order = clause.OrderBy{Expression: clause.Expr{
+				SQL:                "ts_rank_cd(search_vector, websearch_to_tsquery(?, ?)) " + direction + ", id",
+				Vars:               []interface{}{SearchConfiguration, filter.Search},
+				WithoutParentheses: true,
+			}}
+		}
+	case "distance":
+		order = "created_at desc"
+		if filter != nil && filter.Near != nil {
+			order = "distance " + direction + ", id"
+		}
+	case "rating":
+		// The rental houses without reviews are the last, more reviews are first for the same rating.
+		order = "rating " + direction + " NULLS LAST, review_count desc, id"
+	}
+	if filter != nil && filter.Near != nil {
+		tx = tx.Select("rental_houses.*, (location <@> point(?, ?)) * ? AS distance", filter.Near.Lon, filter.Near.Lat, kmPerMile)
+	}
+
 	// Send query to database.
-	err := q.Model(models.RentalHouse{}).Limit(pagination.Limit).Offset(offset).Order(pagination.Sort).Where("published IS TRUE").Preload("Images").Preload("Quarter.District.Town.City.Country").Find(&data.Houses).Error
+	err = tx.Limit(pagination.Limit).Offset(offset).Order(order).Preload("Images", orderedImages).Preload("Quarter.District.Town.City.Country").Find(&data.Houses).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return data, nil
@@ -157,6 +462,215 @@ func (q *RentalHouseQueries) GetRentalHouseList(pagination *models.Pagination) (
 	return data, nil
 }
 
+// RentalHouseMapPoint is the lightweight map result of a rental house.
+type RentalHouseMapPoint struct {
+	ID       int
+	UID      uuid.UUID
+	Lat      float64
+	Lon      float64
+	Price    float64
+	Currency models.Currency
+	Distance *float64
+}
+
+// RentalHouseMapCluster is the grid cluster of the rental houses on the map.
+type RentalHouseMapCluster struct {
+	Lat      float64
+	Lon      float64
+	Count    int64
+	MinPrice float64
+	MaxPrice float64
+}
+
+// GetRentalHouseMapPoints method for get the locations of the rental houses matching the filter. (results, truncated, error)
+func (q *RentalHouseQueries) GetRentalHouseMapPoints(filter *models.RentalHouseFilter, limit int) ([]RentalHouseMapPoint, bool, error) {
+	// Define points variable.
+	points := make([]RentalHouseMapPoint, 0)
+
+	tx := filterRentalHouses(publicRentalHouses(q.Model(models.RentalHouse{})).Where("location IS NOT NULL"), filter)
+	if filter != nil && filter.Near != nil {
+		tx = tx.Select("id, uid, location[1] AS lat, location[0] AS lon, price, currency, (location <@> point(?, ?)) * ? AS distance", filter.Near.Lon, filter.Near.Lat, kmPerMile).Order("distance, id")
+	} else {
+		tx = tx.Select("id, uid, location[1] AS lat, location[0] AS lon, price, currency").Order("id")
+	}
+
+	// Send query to database.
+	err := tx.Limit(limit + 1).Scan(&points).Error
+	if err != nil {
+		// Return empty object and error.
+		return points, false, err
+	}
+
+	// Return query result.
+	if len(points) > limit {
+		return points[:limit], true, nil
+	}
+	return points, false, nil
+}
+
+// GetRentalHouseMapClusters method for get the rental houses matching the filter grouped in a grid of the cell size in degrees.
+func (q *RentalHouseQueries) GetRentalHouseMapClusters(filter *models.RentalHouseFilter, cellSize float64) ([]RentalHouseMapCluster, error) {
+	// Define clusters variable.
+	clusters := make([]RentalHouseMapCluster, 0)
+
+	// Prices are grouped in the price currency.
+	price := "price"
+	if filter != nil {
+		price = filter.PriceExpression()
+	}
+	tx := filterRentalHouses(publicRentalHouses(q.Model(models.RentalHouse{})).Where("location IS NOT NULL"), filter)
+
+	// Send query to database.
+	err := tx.Select(fmt.Sprintf("avg(location[1]) AS lat, avg(location[0]) AS lon, count(*) AS count, min(%[1]s) AS min_price, max(%[1]s) AS max_price", price)).
+		Group(fmt.Sprintf("floor(location[1] / %[1]f), floor(location[0] / %[1]f)", cellSize)).
+		Scan(&clusters).Error
+	if err != nil {
+		// Return empty object and error.
+		return clusters, err
+	}
+
+	// Return query result.
+	return clusters, nil
+}
+
+// FacetCount is the count of the rental houses having a value.
+type FacetCount struct {
+	ID    int
+	Name  string
+	Count int64
+}
+
+// PriceBucket is the count of the rental houses in a price range, To is exclusive except the last bucket.
+type PriceBucket struct {
+	From  float64
+	To    float64
+	Count int64
+}
+
+// RentalHouseFacets is the aggregations of the rental house search.
+type RentalHouseFacets struct {
+	Total          int64
+	Cities         []FacetCount
+	Towns          []FacetCount
+	RentPeriods    []FacetCount
+	CommisionTypes []FacetCount
+	MinPrice       float64
+	MaxPrice       float64
+	PriceBuckets   []PriceBucket
+}
+
+// facetQuery method for get the public rental houses query with the filter.
+func (q *RentalHouseQueries) facetQuery(filter models.RentalHouseFilter) *gorm.DB {
+	return filterRentalHouses(publicRentalHouses(q.Model(models.RentalHouse{})), &filter)
+}
+
+// GetRentalHouseFacets method for get the facet counts of the rental houses matching the filter.
+// Every facet is counted without its own filter, so the other values of the facet can be selected.
+func (q *RentalHouseQueries) GetRentalHouseFacets(filter models.RentalHouseFilter, priceBuckets int) (RentalHouseFacets, error) {
+	// Define facets variable.
+	facets := RentalHouseFacets{
+		Cities:         make([]FacetCount, 0),
+		Towns:          make([]FacetCount, 0),
+		RentPeriods:    make([]FacetCount, 0),
+		CommisionTypes: make([]FacetCount, 0),
+		PriceBuckets:   make([]PriceBucket, 0),
+	}
+	addressJoin := "JOIN quarters q ON q.id = rental_houses.quarter_id JOIN districts d ON d.id = q.district_id JOIN towns t ON t.id = d.town_id"
+
+	// Send queries to database.
+	err := q.facetQuery(filter).Count(&facets.Total).Error
+	if err != nil {
+		// Return empty object and error.
+		return facets, err
+	}
+
+	cityFilter := filter
+	cityFilter.CityIDs = nil
+	err = q.facetQuery(cityFilter).Joins(addressJoin + " JOIN cities c ON c.id = t.city_id").
+		Select("c.id, c.name, count(*) AS count").Group("c.id, c.name").Order("count DESC, c.name").Scan(&facets.Cities).Error
+	if err != nil {
+		// Return empty object and error.
+		return facets, err
+	}
+
+	// Towns are only counted in the selected cities.
+	if len(filter.CityIDs) > 0 {
+		townFilter := filter
+		townFilter.TownIDs = nil
+		err = q.facetQuery(townFilter).Joins(addressJoin).
+			Select("t.id, t.name, count(*) AS count").Group("t.id, t.name").Order("count DESC, t.name").Scan(&facets.Towns).Error
+		if err != nil {
+			// Return empty object and error.
+			return facets, err
+		}
+	}
+
+	rentPeriodFilter := filter
+	rentPeriodFilter.RentPeriod = 0
+	err = q.facetQuery(rentPeriodFilter).Select("rent_period AS id, count(*) AS count").Group("rent_period").Order("rent_period").Scan(&facets.RentPeriods).Error
+	if err != nil {
+		// Return empty object and error.
+		return facets, err
+	}
+
+	commisionFilter := filter
+	commisionFilter.CommisionType = nil
+	err = q.facetQuery(commisionFilter).Select("commision AS id, count(*) AS count").Group("commision").Order("commision").Scan(&facets.CommisionTypes).Error
+	if err != nil {
+		// Return empty object and error.
+		return facets, err
+	}
+
+	// Price histogram, prices are in the price currency.
+	priceFilter := filter
+	priceFilter.MinPrice, priceFilter.MaxPrice = nil, nil
+	price := filter.PriceExpression()
+	var priceRange struct {
+		Min   *float64
+		Max   *float64
+		Count int64
+	}
+	err = q.facetQuery(priceFilter).Select(fmt.Sprintf("min(%[1]s) AS min, max(%[1]s) AS max, count(%[1]s) AS count", price)).Scan(&priceRange).Error
+	if err != nil {
+		// Return empty object and error.
+		return facets, err
+	}
+	if priceRange.Min == nil || priceRange.Max == nil || priceBuckets <= 0 {
+		return facets, nil
+	}
+	facets.MinPrice, facets.MaxPrice = *priceRange.Min, *priceRange.Max
+	if facets.MinPrice == facets.MaxPrice {
+		facets.PriceBuckets = append(facets.PriceBuckets, PriceBucket{From: facets.MinPrice, To: facets.MaxPrice, Count: priceRange.Count})
+		return facets, nil
+	}
+
+	var buckets []struct {
+		Bucket int
+		Count  int64
+	}
+	err = q.facetQuery(priceFilter).Select(fmt.Sprintf("least(width_bucket(%s, ?, ?, ?), ?) AS bucket, count(*) AS count", price), facets.MinPrice, facets.MaxPrice, priceBuckets, priceBuckets).
+		Group("bucket").Scan(&buckets).Error
+	if err != nil {
+		// Return empty object and error.
+		return facets, err
+	}
+	width := (facets.MaxPrice - facets.MinPrice) / float64(priceBuckets)
+	counts := map[int]int64{}
+	for _, bucket := range buckets {
+		counts[bucket.Bucket] = bucket.Count
+	}
+	for i := 1; i <= priceBuckets; i++ {
+		facets.PriceBuckets = append(facets.PriceBuckets, PriceBucket{
+			From:  facets.MinPrice + width*float64(i-1),
+			To:    facets.MinPrice + width*float64(i),
+			Count: counts[i],
+		})
+	}
+
+	// Return query result.
+	return facets, nil
+}
+
 // GetRentalHouseOwnedList method for get rental house, only for owner. (results, prev, next, error)
 func (q *RentalHouseQueries) GetRentalHouseOwnedList(creatorId uuid.UUID, pagination *models.Pagination) (RentalHouseList, error) {
 	// Define variables.
@@ -175,7 +689,7 @@ func (q *RentalHouseQueries) GetRentalHouseOwnedList(creatorId uuid.UUID, pagina
 	}
 
 	// Send query to database.
-	err := q.Model(models.RentalHouse{}).Limit(pagination.Limit).Offset(offset).Order(pagination.Sort).Where("creator = ?", creatorId).Preload("Images").Preload("Quarter.District.Town.City.Country").Find(&data.Houses).Error
+	err := q.Model(models.RentalHouse{}).Limit(pagination.Limit).Offset(offset).Order(pagination.Sort).Where("creator = ?", creatorId).Preload("Images", orderedImages).Preload("Quarter.District.Town.City.Country").Find(&data.Houses).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return data, nil
@@ -189,6 +703,81 @@ func (q *RentalHouseQueries) GetRentalHouseOwnedList(creatorId uuid.UUID, pagina
 	return data, nil
 }
 
+// ArchiveRentalHouse method for soft delete the rental house and remove it from the favorites.
+func (q *RentalHouseQueries) ArchiveRentalHouse(rh *models.RentalHouse) error {
+	// Send query to database.
+	return q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rental_house_id = ?", rh.ID).Delete(&models.RentalHouseFavorite{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(rh).Error
+	})
+}
+
+// GetArchivedRentalHouseWithUid method for get the archived rental house with uid.
+func (q *RentalHouseQueries) GetArchivedRentalHouseWithUid(uid uuid.UUID) (models.RentalHouse, error) {
+	// Define rental house variable.
+	house := models.RentalHouse{}
+
+	// Send query to database.
+	err := q.Unscoped().Model(models.RentalHouse{}).Where("uid = ? AND deleted_at IS NOT NULL", uid.String()).First(&house).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return house, nil
+		}
+		// Return empty object and error.
+		return house, err
+	}
+
+	// Return query result.
+	return house, nil
+}
+
+// RestoreRentalHouse method for restore the archived rental house as unpublished.
+func (q *RentalHouseQueries) RestoreRentalHouse(rh *models.RentalHouse) error {
+	// Send query to database.
+	err := q.Unscoped().Model(&models.RentalHouse{}).Where("id = ?", rh.ID).Updates(map[string]interface{}{"deleted_at": nil, "published": false}).Error
+	if err != nil {
+		// Return only error.
+		return err
+	}
+	rh.DeletedAt = gorm.DeletedAt{}
+	rh.Published = false
+	return nil
+}
+
+// GetRentalHouseArchivedList method for get the archived rental houses of the owner, the last archived is the first.
+func (q *RentalHouseQueries) GetRentalHouseArchivedList(creatorId uuid.UUID, pagination *models.Pagination) (RentalHouseList, error) {
+	// Define variables.
+	data := RentalHouseList{}
+	offset := (pagination.Page - 1) * pagination.Limit
+	if pagination.Page > 1 {
+		data.PrevPage = true
+	}
+	tx := q.Unscoped().Model(models.RentalHouse{}).Where("creator = ? AND deleted_at IS NOT NULL", creatorId).Session(&gorm.Session{})
+
+	// Get full count
+	err := tx.Count(&data.FullCount).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	if int(data.FullCount) > offset+pagination.Limit {
+		data.NextPage = true
+	}
+
+	// Send query to database.
+	err = tx.Limit(pagination.Limit).Offset(offset).Order("deleted_at DESC").Preload("Images", orderedImages).Preload("Quarter.District.Town.City.Country").Find(&data.Houses).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	data.TotalCount = int64(len(data.Houses))
+
+	// Return query result.
+	return data, nil
+}
+
 // CreateRentalHouseImage method for create new rental house image.
 func (q *RentalHouseQueries) CreateRentalHouseImage(rhi *models.RentalHouseImage) error {
 	// Insert query to database.
@@ -206,7 +795,7 @@ func (q *RentalHouseQueries) GetRentalHouseImagesByRentalHouseID(id int) ([]mode
 	var data []models.RentalHouseImage
 
 	// Insert query to database.
-	err := q.Model(models.RentalHouseImage{}).Where("rental_house_id = ?", id).Preload("RentalHouse").Preload("Creator").Find(&data).Error
+	err := orderedImages(q.Model(models.RentalHouseImage{}).Where("rental_house_id = ?", id)).Preload("RentalHouse").Preload("Creator").Find(&data).Error
 	if err != nil {
 		// Return only error.
 		return data, err
@@ -243,6 +832,107 @@ func (q *RentalHouseQueries) GetRentalHouseImagesByIDs(id []string) ([]models.Re
 	return data, nil
 }
 
+// ErrRentalHouseImagesNotFound is returned when an image is not uploaded by the creator, not processed yet or already used.
+var ErrRentalHouseImagesNotFound = errors.New("some images are not found, not processed yet or already used")
+
+// AttachRentalHouseImages method for add the uploaded images of the creator to the rental house in the order of the ids,
+// they are added after the current images. The first image is the main photo if the rental house has no main photo.
+// None of the images are added if one of them can not be added.
+func (q *RentalHouseQueries) AttachRentalHouseImages(rentalHouseId int, creatorId uuid.UUID, ids []string) ([]models.RentalHouseImage, error) {
+	// Define images variable.
+	images := make([]models.RentalHouseImage, 0)
+	if len(ids) == 0 {
+		return images, nil
+	}
+
+	// Send query to database.
+	err := q.Transaction(func(tx *gorm.DB) error {
+		var uploaded []models.RentalHouseImage
+		err := tx.Model(models.RentalHouseImage{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND creator = ? AND rental_house_id IS NULL AND status = ?", ids, creatorId, models.IMAGE_STATUS_READY).Find(&uploaded).Error
+		if err != nil {
+			return err
+		}
+		if len(uploaded) != len(ids) {
+			return ErrRentalHouseImagesNotFound
+		}
+		var state struct {
+			MaxOrder int
+			HasMain  bool
+		}
+		err = tx.Model(models.RentalHouseImage{}).Where("rental_house_id = ?", rentalHouseId).
+			Select("COALESCE(MAX(display_order), 0) AS max_order, COALESCE(BOOL_OR(main_photo), false) AS has_main").Scan(&state).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			for _, image := range uploaded {
+				if image.ID.String() != id {
+					continue
+				}
+				state.MaxOrder++
+				image.RentalHouseID = &rentalHouseId
+				image.DisplayOrder = state.MaxOrder
+				image.MainPhoto = !state.HasMain
+				state.HasMain = true
+				err = tx.Model(models.RentalHouseImage{}).Where("id = ?", image.ID).
+					Updates(map[string]interface{}{"rental_house_id": rentalHouseId, "display_order": image.DisplayOrder, "main_photo": image.MainPhoto}).Error
+				if err != nil {
+					return err
+				}
+				images = append(images, image)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Return empty object and error.
+		return []models.RentalHouseImage{}, err
+	}
+
+	// Return query result.
+	return images, nil
+}
+
+// SetRentalHouseMainImage method for change the main photo of the rental house.
+func (q *RentalHouseQueries) SetRentalHouseMainImage(rentalHouseId int, imageId uuid.UUID) error {
+	// Send query to database.
+	return q.Model(models.RentalHouseImage{}).Where("rental_house_id = ?", rentalHouseId).
+		Update("main_photo", gorm.Expr("id = ?", imageId)).Error
+}
+
+// SetRentalHouseImageOrder method for save the display order of the rental house images, in the order of the ids.
+func (q *RentalHouseQueries) SetRentalHouseImageOrder(rentalHouseId int, ids []uuid.UUID) error {
+	// Send query to database.
+	return q.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			err := tx.Model(models.RentalHouseImage{}).Where("id = ? AND rental_house_id = ?", id, rentalHouseId).Update("display_order", i+1).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteRentalHouseImage method for delete the image of the rental house, the next image is the main photo if it is deleted.
+func (q *RentalHouseQueries) DeleteRentalHouseImage(image *models.RentalHouseImage) error {
+	// Send query to database.
+	return q.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ?", image.ID).Delete(&models.RentalHouseImage{}).Error
+		if err != nil || !image.MainPhoto || image.RentalHouseID == nil {
+			return err
+		}
+		var next models.RentalHouseImage
+		err = orderedImages(tx.Model(models.RentalHouseImage{}).Where("rental_house_id = ?", *image.RentalHouseID)).Limit(1).Find(&next).Error
+		if err != nil || next.ID == uuid.Nil {
+			return err
+		}
+		return tx.Model(models.RentalHouseImage{}).Where("id = ?", next.ID).Update("main_photo", true).Error
+	})
+}
+
 // UpdateRentalHouseImage method for create new rental house image.
 func (q *RentalHouseQueries) UpdateRentalHouseImage(rh models.RentalHouseImage) error {
 	// Insert query to database.
@@ -285,3 +975,82 @@ func (q *RentalHouseQueries) GetReservedDatesByRentalHouseID(id int) ([]time.Tim
 	// Return query result.
 	return dates, nil
 }
+
+// ErrImageAlreadyHandled is returned when the uploaded image is not processing anymore, it is processed or failed by another worker.
+var ErrImageAlreadyHandled = errors.New("image is already processed or failed")
+
+// SetRentalHouseImageProcessed method for save the created variants of the uploaded image, the image is ready to use.
+func (q *RentalHouseQueries) SetRentalHouseImageProcessed(id uuid.UUID, images models.RentalHouseImagesArray, checksum string, perceptualHash *int64) error {
+	// Send query to database.
+	result := q.Model(&models.RentalHouseImage{}).Where("id = ? AND status = ?", id, models.IMAGE_STATUS_PROCESSING).Updates(map[string]interface{}{
+		"images":           images,
+		"checksum":         checksum,
+		"perceptual_hash":  perceptualHash,
+		"status":           models.IMAGE_STATUS_READY,
+		"source_key":       "",
+		"processing_error": "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrImageAlreadyHandled
+	}
+	return nil
+}
+
+// SetRentalHouseImageAttempt method for save a failed processing attempt of the uploaded image,
+// the processing image is queued again at nextAttemptAt.
+func (q *RentalHouseQueries) SetRentalHouseImageAttempt(id uuid.UUID, attempts int, status models.ImageStatus, message string, nextAttemptAt *time.Time) error {
+	updates := map[string]interface{}{
+		"attempts":         attempts,
+		"status":           status,
+		"processing_error": message,
+		"next_attempt_at":  nextAttemptAt,
+	}
+	if status == models.IMAGE_STATUS_FAILED {
+		updates["source_key"] = ""
+	}
+
+	// Send query to database.
+	result := q.Model(&models.RentalHouseImage{}).Where("id = ? AND status = ?", id, models.IMAGE_STATUS_PROCESSING).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrImageAlreadyHandled
+	}
+	return nil
+}
+
+// ClaimRetryRentalHouseImages method for get the processing images whose next attempt time has come. The next attempt of the
+// claimed images is postponed for the lease duration, so they are queued again if they are not processed until then.
+func (q *RentalHouseQueries) ClaimRetryRentalHouseImages(limit int, lease time.Duration) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+
+	// Send query to database.
+	err := q.Raw(`UPDATE rental_house_images SET next_attempt_at = ? WHERE id IN (
+			SELECT id FROM rental_house_images WHERE status = ? AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED
+		) RETURNING id`, time.Now().Add(lease), models.IMAGE_STATUS_PROCESSING, limit).Scan(&ids).Error
+	return ids, err
+}
+
+// GetRentalHouseImagesWithRentalHouse method for get the images with their rental houses.
+func (q *RentalHouseQueries) GetRentalHouseImagesWithRentalHouse(ids []uuid.UUID) ([]models.RentalHouseImage, error) {
+	// Define images variable.
+	images := make([]models.RentalHouseImage, 0)
+	if len(ids) == 0 {
+		return images, nil
+	}
+
+	// Send query to database.
+	err := q.Model(models.RentalHouseImage{}).Where("id IN ?", ids).Preload("RentalHouse.Creator").Find(&images).Error
+	if err != nil {
+		// Return empty object and error.
+		return images, err
+	}
+
+	// Return query result.
+	return images, nil
+}
@@ -0,0 +1,20 @@
+package queries
+
+import "testing"
+
+func TestHighlightHTML(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{"Deniz manzaralı " + highlightStart + "villa" + highlightStop, "Deniz manzaralı <b>villa</b>"},
+		{"<script>alert(1)</script> " + highlightStart + "daire" + highlightStop, "&lt;script&gt;alert(1)&lt;/script&gt; <b>daire</b>"},
+		{highlightStart + "A&B" + highlightStop + " <b>ofis</b>", "<b>A&amp;B</b> &lt;b&gt;ofis&lt;/b&gt;"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := highlightHTML(tt.snippet); got != tt.want {
+			t.Errorf("highlightHTML(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
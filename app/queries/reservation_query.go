@@ -33,7 +33,7 @@ func (q *ReservationQueries) CheckRentalHouseIsReserved(rentalHouseID int, start
 // GetReservationByUid method for get reservation with uid.
 func (q *ReservationQueries) GetReservationByUid(uid uuid.UUID) (models.Reservation, error) {
 	reservation := models.Reservation{}
-	err := q.Model(&models.Reservation{}).Preload(clause.Associations).Where("uid = ?", uid.String()).First(&reservation).Error
+	err := q.Model(&models.Reservation{}).Preload(clause.Associations).Preload("RentalHouse", withArchived).Where("uid = ?", uid.String()).First(&reservation).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return reservation, nil
@@ -55,3 +55,27 @@ func (q *ReservationQueries) GetReservationsByRentalHouseID(id int) ([]models.Re
 	}
 	return reservations, nil
 }
+
+// GetActiveReservationsByRentalHouseID method for get the pending, paid and accepted reservations of the rental house which are not ended.
+func (q *ReservationQueries) GetActiveReservationsByRentalHouseID(id int) ([]models.Reservation, error) {
+	var reservations = make([]models.Reservation, 0)
+	err := q.Model(&models.Reservation{}).Preload("RentalHouse", withArchived).Where("rental_house_id = ? AND end_date >= ? AND "+
+		"(status IN ? OR (status = ? AND expire > NOW()))", id, time.Now().Truncate(24*time.Hour),
+		[]models.ReservationStatus{models.RESERVATION_STATUS_PAID, models.RESERVATION_STATUS_ACCEPTED}, models.RESERVATION_STATUS_PENDING).
+		Order("start_date").Find(&reservations).Error
+	if err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+// HasPaidReservation method for check the user has a paid or accepted reservation of the rental house.
+func (q *ReservationQueries) HasPaidReservation(userId uuid.UUID, rentalHouseId int) (bool, error) {
+	var count int64
+	err := q.Model(&models.Reservation{}).Where("creator_id = ? AND rental_house_id = ? AND status IN ?", userId.String(), rentalHouseId,
+		[]models.ReservationStatus{models.RESERVATION_STATUS_PAID, models.RESERVATION_STATUS_ACCEPTED}).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
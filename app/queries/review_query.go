@@ -0,0 +1,219 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ReviewQueries struct
+type ReviewQueries struct {
+	*gorm.DB
+}
+
+// ReviewList is the page of the published reviews.
+type ReviewList struct {
+	TotalCount int64
+	FullCount  int64
+	NextPage   bool
+	PrevPage   bool
+	Reviews    []models.Review
+}
+
+// GetReviewWithUid method for get review with uid.
+func (q *ReviewQueries) GetReviewWithUid(uid uuid.UUID) (models.Review, error) {
+	// Define review variable.
+	review := models.Review{}
+
+	// Send query to database.
+	err := q.Model(models.Review{}).Preload("RentalHouse", withArchived).Preload("Author").Where("uid = ?", uid).First(&review).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return review, nil
+		}
+		// Return empty object and error.
+		return review, err
+	}
+
+	// Return query result.
+	return review, nil
+}
+
+// GetReservationReviews method for get the reviews of the reservation.
+func (q *ReviewQueries) GetReservationReviews(reservationId uint64) ([]models.Review, error) {
+	// Define reviews variable.
+	reviews := make([]models.Review, 0)
+
+	// Send query to database.
+	err := q.Model(models.Review{}).Where("reservation_id = ?", reservationId).Find(&reviews).Error
+	if err != nil {
+		// Return empty object and error.
+		return reviews, err
+	}
+
+	// Return query result.
+	return reviews, nil
+}
+
+// CreateReview method for create the review, both reviews of the reservation are published if the other side has reviewed.
+func (q *ReviewQueries) CreateReview(review *models.Review) error {
+	// Send query to database.
+	return q.Transaction(func(tx *gorm.DB) error {
+		// Lock the reservation, the other side may review at the same time.
+		if err := tx.Exec("SELECT id FROM reservations WHERE id = ? FOR UPDATE", review.ReservationID).Error; err != nil {
+			return err
+		}
+		var other models.Review
+		err := tx.Where("reservation_id = ? AND type <> ?", review.ReservationID, review.Type).Limit(1).Find(&other).Error
+		if err != nil {
+			return err
+		}
+		if other.ID != 0 && other.PublishedAt == nil {
+			now := time.Now()
+			review.PublishedAt = &now
+			if err := tx.Model(&models.Review{}).Where("id = ?", other.ID).UpdateColumn("published_at", now).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit(clause.Associations).Create(review).Error; err != nil {
+			return err
+		}
+		if review.PublishedAt != nil {
+			return updateRentalHouseRatings(tx, review.RentalHouseID)
+		}
+		return nil
+	})
+}
+
+// PublishExpiredReviews method for publish the reviews of the stays which ended before the review window, it returns the number of the published reviews.
+func (q *ReviewQueries) PublishExpiredReviews(window time.Duration) (int64, error) {
+	var published int64
+
+	// Send query to database.
+	err := q.Transaction(func(tx *gorm.DB) error {
+		var ids []int
+		err := tx.Raw(`UPDATE reviews SET published_at = NOW() FROM reservations
+			WHERE reservations.id = reviews.reservation_id AND reviews.published_at IS NULL AND reservations.end_date < ?
+			RETURNING reviews.rental_house_id`, time.Now().Add(-window)).Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+		published = int64(len(ids))
+		return updateRentalHouseRatings(tx, ids...)
+	})
+
+	// Return query result.
+	return published, err
+}
+
+// updateRentalHouseRatings updates the average scores of the published rental house reviews of the rental houses.
+func updateRentalHouseRatings(tx *gorm.DB, ids ...int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Exec(`UPDATE rental_houses SET review_count = r.count, rating = r.rating,
+			rating_cleanliness = r.cleanliness, rating_accuracy = r.accuracy, rating_location = r.location,
+			rating_communication = r.communication, rating_check_in = r.check_in, rating_value = r.value
+		FROM (
+			SELECT rh.id, COUNT(rv.id) AS count, ROUND(AVG(rv.rating), 2) AS rating,
+				ROUND(AVG(rv.cleanliness), 2) AS cleanliness, ROUND(AVG(rv.accuracy), 2) AS accuracy, ROUND(AVG(rv.location), 2) AS location,
+				ROUND(AVG(rv.communication), 2) AS communication, ROUND(AVG(rv.check_in), 2) AS check_in, ROUND(AVG(rv.value), 2) AS value
+			FROM rental_houses rh
+			LEFT JOIN reviews rv ON rv.rental_house_id = rh.id AND rv.type = ? AND rv.published_at IS NOT NULL
+			WHERE rh.id IN ?
+			GROUP BY rh.id
+		) r
+		WHERE rental_houses.id = r.id`, models.REVIEW_TYPE_RENTAL_HOUSE, ids).Error
+}
+
+// getPublishedReviews returns the page of the published reviews of the query, the newest is the first.
+func getPublishedReviews(tx *gorm.DB, pagination *models.Pagination) (ReviewList, error) {
+	// Define variables.
+	data := ReviewList{}
+	offset := (pagination.Page - 1) * pagination.Limit
+	if pagination.Page > 1 {
+		data.PrevPage = true
+	}
+
+	tx = tx.Where("published_at IS NOT NULL").Session(&gorm.Session{})
+	err := tx.Count(&data.FullCount).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	if int(data.FullCount) > offset+pagination.Limit {
+		data.NextPage = true
+	}
+
+	// Send query to database.
+	err = tx.Limit(pagination.Limit).Offset(offset).Order("published_at desc, id desc").Preload("Author.ProfileImage").Preload("RentalHouse", withArchived).Find(&data.Reviews).Error
+	if err != nil {
+		// Return empty object and error.
+		return data, err
+	}
+	data.TotalCount = int64(len(data.Reviews))
+
+	// Return query result.
+	return data, nil
+}
+
+// GetRentalHouseReviews method for get the published reviews of the rental house.
+func (q *ReviewQueries) GetRentalHouseReviews(rentalHouseId int, pagination *models.Pagination) (ReviewList, error) {
+	return getPublishedReviews(q.Model(models.Review{}).Where("rental_house_id = ? AND type = ?", rentalHouseId, models.REVIEW_TYPE_RENTAL_HOUSE), pagination)
+}
+
+// GetRenterReviews method for get the published reviews of the owners about the renter.
+func (q *ReviewQueries) GetRenterReviews(renterId uuid.UUID, pagination *models.Pagination) (ReviewList, error) {
+	return getPublishedReviews(q.Model(models.Review{}).Where("subject = ? AND type = ?", renterId, models.REVIEW_TYPE_RENTER), pagination)
+}
+
+// GetRenterRating method for get the average rating and the number of the published reviews of the renter.
+func (q *ReviewQueries) GetRenterRating(renterId uuid.UUID) (*float64, int64, error) {
+	var result struct {
+		Rating *float64
+		Count  int64
+	}
+
+	// Send query to database.
+	err := q.Model(models.Review{}).Select("ROUND(AVG(rating), 2) AS rating, COUNT(*) AS count").
+		Where("subject = ? AND type = ? AND published_at IS NOT NULL", renterId, models.REVIEW_TYPE_RENTER).Scan(&result).Error
+
+	// Return query result.
+	return result.Rating, result.Count, err
+}
+
+// GetReviewableReservations method for get the accepted reservations of the user which ended in the review window and are not reviewed by the user, as the renter or the owner.
+func (q *ReviewQueries) GetReviewableReservations(userId uuid.UUID, window time.Duration) ([]models.Reservation, error) {
+	// Define reservations variable.
+	reservations := make([]models.Reservation, 0)
+	now := time.Now()
+
+	// Send query to database.
+	err := q.Model(models.Reservation{}).
+		Joins("JOIN rental_houses ON rental_houses.id = reservations.rental_house_id").
+		Where("reservations.status = ? AND reservations.end_date <= ? AND reservations.end_date >= ?", models.RESERVATION_STATUS_ACCEPTED, now, now.Add(-window)).
+		Where("(reservations.creator_id = ? AND NOT EXISTS (SELECT 1 FROM reviews WHERE reviews.reservation_id = reservations.id AND reviews.type = ?)) OR "+
+			"(rental_houses.creator = ? AND NOT EXISTS (SELECT 1 FROM reviews WHERE reviews.reservation_id = reservations.id AND reviews.type = ?))",
+			userId, models.REVIEW_TYPE_RENTAL_HOUSE, userId, models.REVIEW_TYPE_RENTER).
+		Preload("RentalHouse", withArchived).Preload("Creator").Order("reservations.end_date desc").Find(&reservations).Error
+	if err != nil {
+		// Return empty object and error.
+		return reservations, err
+	}
+
+	// Return query result.
+	return reservations, nil
+}
+
+// RespondReview method for save the public response of the owner to the review.
+func (q *ReviewQueries) RespondReview(review *models.Review, response string) error {
+	now := time.Now()
+	review.Response = &response
+	review.RespondedAt = &now
+
+	// Send query to database.
+	return q.Model(&models.Review{}).Where("id = ?", review.ID).Updates(map[string]interface{}{"response": response, "responded_at": now}).Error
+}
@@ -0,0 +1,266 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SavedSearchQueries struct
+type SavedSearchQueries struct {
+	*gorm.DB
+}
+
+// GetSavedSearches method for get the saved searches of the user.
+func (q *SavedSearchQueries) GetSavedSearches(userId uuid.UUID) ([]models.SavedSearch, error) {
+	// Define searches variable.
+	searches := make([]models.SavedSearch, 0)
+
+	// Send query to database.
+	err := q.Where("user_id = ?", userId).Order("created_at desc").Find(&searches).Error
+	if err != nil {
+		// Return empty object and error.
+		return searches, err
+	}
+
+	// Return query result.
+	return searches, nil
+}
+
+// GetSavedSearchCount method for get the number of the saved searches of the user.
+func (q *SavedSearchQueries) GetSavedSearchCount(userId uuid.UUID) (int64, error) {
+	var count int64
+
+	// Send query to database.
+	err := q.Model(&models.SavedSearch{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+// GetSavedSearchWithUid method for get the saved search, the ID is 0 if it is not found.
+func (q *SavedSearchQueries) GetSavedSearchWithUid(uid uuid.UUID) (models.SavedSearch, error) {
+	// Define search variable.
+	search := models.SavedSearch{}
+
+	// Send query to database.
+	err := q.Where("uid = ?", uid).Limit(1).Find(&search).Error
+	if err != nil {
+		// Return empty object and error.
+		return search, err
+	}
+
+	// Return query result.
+	return search, nil
+}
+
+// CreateSavedSearch method for save a new search. Only the listing events processed after the search is saved are matched.
+func (q *SavedSearchQueries) CreateSavedSearch(search *models.SavedSearch) error {
+	var err error
+	search.LastEventSequence, err = q.GetLastListingEventSequence()
+	if err != nil {
+		// Return only error.
+		return err
+	}
+
+	// Send query to database.
+	return q.Create(search).Error
+}
+
+// UpdateSavedSearch method for change the name and the alert settings of the saved search.
+func (q *SavedSearchQueries) UpdateSavedSearch(search *models.SavedSearch) error {
+	search.UpdatedAt = time.Now()
+
+	// Send query to database.
+	return q.Model(search).Select("name", "frequency", "last_event_sequence", "next_alert_at", "updated_at").Updates(search).Error
+}
+
+// DeleteSavedSearch method for delete the saved search.
+func (q *SavedSearchQueries) DeleteSavedSearch(id uint64) error {
+	// Send query to database.
+	return q.Where("id = ?", id).Delete(&models.SavedSearch{}).Error
+}
+
+// GetSavedSearchWithUnsubscribeToken method for get the saved search of the unsubscribe link, the id is 0 if it is not found.
+func (q *SavedSearchQueries) GetSavedSearchWithUnsubscribeToken(token uuid.UUID) (models.SavedSearch, error) {
+	// Define search variable.
+	search := models.SavedSearch{}
+
+	// Send query to database.
+	err := q.Where("unsubscribe_token = ?", token).Limit(1).Find(&search).Error
+	if err != nil {
+		// Return empty object and error.
+		return search, err
+	}
+
+	// Return query result.
+	return search, nil
+}
+
+// UnsubscribeSavedSearch method for turn off the alerts of the saved search of the unsubscribe link, the search which is
+// already off is not changed. (search, error)
+func (q *SavedSearchQueries) UnsubscribeSavedSearch(token uuid.UUID) (models.SavedSearch, error) {
+	// Send query to database.
+	search, err := q.GetSavedSearchWithUnsubscribeToken(token)
+	if err != nil || search.ID == 0 || search.Frequency == models.SAVED_SEARCH_FREQUENCY_OFF {
+		// Return query result.
+		return search, err
+	}
+	search.Frequency = models.SAVED_SEARCH_FREQUENCY_OFF
+	err = q.UpdateSavedSearch(&search)
+	if err != nil {
+		// Return empty object and error.
+		return search, err
+	}
+
+	// Return query result.
+	return search, nil
+}
+
+// CreateListingEvent method for save the change of the listing for the saved search alerts.
+func (q *SavedSearchQueries) CreateListingEvent(event *models.ListingEvent) error {
+	// Send query to database.
+	return q.Create(event).Error
+}
+
+// GetLastListingEvent method for get the last event of the rental house, its price is the last public price of the listing.
+func (q *SavedSearchQueries) GetLastListingEvent(rentalHouseId int) (models.ListingEvent, error) {
+	// Define event variable.
+	event := models.ListingEvent{}
+
+	// Send query to database.
+	err := q.Where("rental_house_id = ?", rentalHouseId).Order("id desc").Limit(1).Find(&event).Error
+	if err != nil {
+		// Return empty object and error.
+		return event, err
+	}
+
+	// Return query result.
+	return event, nil
+}
+
+// listingEventLockKey is the advisory lock of numbering the processed listing events.
+const listingEventLockKey = 50
+
+// ProcessListingEvents method for number the committed listing events which are not processed yet after the processed ones,
+// and get the last number. The events are numbered by one worker at a time, so an event whose transaction is committed
+// later is numbered after the matched ones and it is not skipped.
+func (q *SavedSearchQueries) ProcessListingEvents() (uint64, error) {
+	var sequence uint64
+
+	// Send query to database.
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", listingEventLockKey).Error; err != nil {
+			return err
+		}
+		err := tx.Exec(`UPDATE listing_events SET sequence = processed.sequence FROM (
+				SELECT id, (SELECT COALESCE(MAX(sequence), 0) FROM listing_events) + row_number() OVER (ORDER BY id) AS sequence
+				FROM listing_events WHERE sequence = 0
+			) processed WHERE listing_events.id = processed.id`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.ListingEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+	})
+	return sequence, err
+}
+
+// GetLastListingEventSequence method for get the number of the last processed listing event.
+func (q *SavedSearchQueries) GetLastListingEventSequence() (uint64, error) {
+	var sequence uint64
+
+	// Send query to database.
+	err := q.Model(&models.ListingEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+	return sequence, err
+}
+
+// ClaimDueSavedSearches method for get the saved searches which have unmatched listing events and whose alert time has come.
+// The claimed searches are postponed for the lease duration, so the other workers do not take them.
+func (q *SavedSearchQueries) ClaimDueSavedSearches(lastSequence uint64, limit int, lease time.Duration) ([]models.SavedSearch, error) {
+	// Define searches variable.
+	searches := make([]models.SavedSearch, 0)
+
+	var ids []uint64
+	err := q.Raw(`UPDATE saved_searches SET next_alert_at = ? WHERE id IN (
+			SELECT id FROM saved_searches WHERE frequency <> ? AND last_event_sequence < ? AND next_alert_at <= now()
+			ORDER BY next_alert_at, id LIMIT ? FOR UPDATE SKIP LOCKED
+		) RETURNING id`, time.Now().Add(lease), models.SAVED_SEARCH_FREQUENCY_OFF, lastSequence, limit).Scan(&ids).Error
+	if err != nil || len(ids) == 0 {
+		// Return empty object and error.
+		return searches, err
+	}
+
+	// Send query to database.
+	err = q.Where("id IN ?", ids).Order("id").Find(&searches).Error
+	if err != nil {
+		// Return empty object and error.
+		return searches, err
+	}
+
+	// Return query result.
+	return searches, nil
+}
+
+// SavedSearchMatch is a public listing matching the saved search with its last event.
+type SavedSearchMatch struct {
+	RentalHouse models.RentalHouse
+	Event       models.ListingEvent
+}
+
+// GetSavedSearchMatches method for get the public listings which match the filter and have an event after the last matched event
+// of the search until lastSequence. The listings of the user are not matched. (matches, total count, error)
+func (q *SavedSearchQueries) GetSavedSearchMatches(search *models.SavedSearch, filter *models.RentalHouseFilter, lastSequence uint64, limit int) ([]SavedSearchMatch, int64, error) {
+	// Define matches variable.
+	matches := make([]SavedSearchMatch, 0)
+
+	tx := filterRentalHouses(publicRentalHouses(q.Model(&models.RentalHouse{})), filter).
+		Where("rental_houses.creator <> ?", search.UserID).
+		Where("rental_houses.id IN (SELECT rental_house_id FROM listing_events WHERE sequence > ? AND sequence <= ? AND type IN ?)", search.LastEventSequence, lastSequence, models.AlertedListingEvents).
+		Session(&gorm.Session{})
+
+	var count int64
+	if err := tx.Count(&count).Error; err != nil || count == 0 {
+		// Return empty object and error.
+		return matches, 0, err
+	}
+
+	var rentalHouses []models.RentalHouse
+	err := tx.Order("rental_houses.id").Limit(limit).Preload("Quarter.District.Town").Find(&rentalHouses).Error
+	if err != nil {
+		// Return empty object and error.
+		return matches, 0, err
+	}
+
+	// The last event of each listing tells if it is new or cheaper.
+	ids := make([]int, len(rentalHouses))
+	for i, rentalHouse := range rentalHouses {
+		ids[i] = rentalHouse.ID
+	}
+	var events []models.ListingEvent
+	err = q.Raw(`SELECT DISTINCT ON (rental_house_id) * FROM listing_events WHERE rental_house_id IN ? AND sequence > ? AND sequence <= ? AND type IN ?
+		ORDER BY rental_house_id, sequence DESC`, ids, search.LastEventSequence, lastSequence, models.AlertedListingEvents).Scan(&events).Error
+	if err != nil {
+		// Return empty object and error.
+		return matches, 0, err
+	}
+	lastEvents := make(map[int]models.ListingEvent, len(events))
+	for _, event := range events {
+		lastEvents[event.RentalHouseID] = event
+	}
+	for _, rentalHouse := range rentalHouses {
+		matches = append(matches, SavedSearchMatch{RentalHouse: rentalHouse, Event: lastEvents[rentalHouse.ID]})
+	}
+
+	// Return query result.
+	return matches, count, nil
+}
+
+// SetSavedSearchMatched saves the last matched event and the next alert time of the saved search,
+// tx is the transaction of the alert notification.
+func SetSavedSearchMatched(tx *gorm.DB, search *models.SavedSearch) error {
+	// Send query to database.
+	return tx.Model(&models.SavedSearch{}).Where("id = ?", search.ID).UpdateColumns(map[string]interface{}{
+		"last_event_sequence": search.LastEventSequence,
+		"next_alert_at":       search.NextAlertAt,
+		"last_alert_at":       search.LastAlertAt,
+	}).Error
+}
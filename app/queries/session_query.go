@@ -61,9 +61,15 @@ func (q *SessionQueries) CreateSession(session models.Session) (models.Session,
 	return session, nil
 }
 
+// DeleteSessionBySessionID method for delete the session, the push token of the session is removed with it.
 func (q *SessionQueries) DeleteSessionBySessionID(sessionID string) error {
 	// Send query to database.
-	err := q.Table("sessions").Where("session_id = ?", sessionID).Delete(&models.Session{}).Error
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+		return tx.Table("sessions").Where("session_id = ?", sessionID).Delete(&models.Session{}).Error
+	})
 	if err != nil {
 		// Return only error
 		return err
@@ -71,19 +77,35 @@ func (q *SessionQueries) DeleteSessionBySessionID(sessionID string) error {
 	return nil
 }
 
+// DeleteUserSessionBySessionID method for delete the session of the user, the push token of the session is removed with it.
 func (q *SessionQueries) DeleteUserSessionBySessionID(userId uuid.UUID, sessionID string) (int64, error) {
+	var affected int64
+
 	// Send query to database.
-	tx := q.Table("sessions").Where("user_id = ? AND session_id = ?", userId.String(), sessionID).Delete(&models.Session{})
-	if tx.Error != nil {
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND session_id = ?", userId.String(), sessionID).Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+		result := tx.Table("sessions").Where("user_id = ? AND session_id = ?", userId.String(), sessionID).Delete(&models.Session{})
+		affected = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
 		// Return only error
-		return 0, tx.Error
+		return 0, err
 	}
-	return tx.RowsAffected, nil
+	return affected, nil
 }
 
+// DeleteSessionByUserID method for delete all sessions of the user with their push tokens.
 func (q *SessionQueries) DeleteSessionByUserID(userId uuid.UUID) error {
 	// Send query to database.
-	err := q.Table("sessions").Where("user_id = ?", userId.String()).Delete(&models.Session{}).Error
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId.String()).Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+		return tx.Table("sessions").Where("user_id = ?", userId.String()).Delete(&models.Session{}).Error
+	})
 	if err != nil {
 		// Return only error
 		return err
@@ -91,9 +113,15 @@ func (q *SessionQueries) DeleteSessionByUserID(userId uuid.UUID) error {
 	return nil
 }
 
+// DeleteSessionExByUserID method for delete the sessions of the user except the given ones with their push tokens.
 func (q *SessionQueries) DeleteSessionExByUserID(userId uuid.UUID, except []string) error {
 	// Send query to database.
-	err := q.Table("sessions").Where("user_id = ? AND session_id NOT IN ?", userId.String(), except).Delete(&models.Session{}).Error
+	err := q.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND session_id NOT IN ?", userId.String(), except).Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+		return tx.Table("sessions").Where("user_id = ? AND session_id NOT IN ?", userId.String(), except).Delete(&models.Session{}).Error
+	})
 	if err != nil {
 		// Return only error
 		return err
@@ -0,0 +1,237 @@
+package queries
+
+import (
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"time"
+)
+
+// WalletQueries struct
+type WalletQueries struct {
+	*gorm.DB
+}
+
+// GetAvailableCredits method for get the credits of the user that are not used or expired.
+func (q *WalletQueries) GetAvailableCredits(userId uuid.UUID) ([]models.UserCredit, error) {
+	// Define credits variable.
+	credits := make([]models.UserCredit, 0)
+
+	// Send query to database.
+	err := q.Model(models.UserCredit{}).Where("user_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)", userId, time.Now()).Order("expires_at asc nulls last, id").Find(&credits).Error
+	if err != nil {
+		// Return empty object and error.
+		return credits, err
+	}
+
+	// Return query result.
+	return credits, nil
+}
+
+// GetPaymentTenders method for get tenders of the payment.
+func (q *WalletQueries) GetPaymentTenders(paymentId uint64) ([]models.PaymentTender, error) {
+	// Define tenders variable.
+	tenders := make([]models.PaymentTender, 0)
+
+	// Send query to database.
+	err := q.Model(models.PaymentTender{}).Where("payment_id = ?", paymentId).Order("id").Find(&tenders).Error
+	if err != nil {
+		// Return empty object and error.
+		return tenders, err
+	}
+
+	// Return query result.
+	return tenders, nil
+}
+
+// ApplyPaymentTenders method for pay the payment with the credits first and then the wallet balance of the renter.
+// The rest of the payment is left to the card, it is at least minCardAmount if it is not zero. The tenders are applied once,
+// the payment gets the tenders of a concurrent request if they are already applied.
+func (q *WalletQueries) ApplyPaymentTenders(payment *models.Payment, useWallet, useCredits bool, minCardAmount float64) error {
+	userId := payment.Reservation.CreatorID
+
+	return q.Transaction(func(tx *gorm.DB) error {
+		// Lock the payment for concurrent requests and check its tenders again.
+		locked := models.Payment{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", payment.ID).First(&locked).Error
+		if err != nil {
+			return err
+		}
+		var existing []models.PaymentTender
+		err = tx.Where("payment_id = ?", payment.ID).Order("id").Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		if locked.StripeID != nil || len(existing) > 0 {
+			payment.StripeID = locked.StripeID
+			payment.WalletAmount = locked.WalletAmount
+			payment.CreditAmount = locked.CreditAmount
+			payment.Tenders = existing
+			return nil
+		}
+
+		// Lock the user for concurrent payments.
+		user := models.User{}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userId).First(&user).Error
+		if err != nil {
+			return err
+		}
+
+		remaining := payment.Amount
+		var tenders []models.PaymentTender
+		available := map[int]float64{}
+
+		if useCredits {
+			var credits []models.UserCredit
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)", userId, time.Now()).
+				Order("expires_at asc nulls last, id").Find(&credits).Error
+			if err != nil {
+				return err
+			}
+			for i := range credits {
+				if remaining <= 0 {
+					break
+				}
+				amount := math.Min(payment.FromDefaultCurrency(credits[i].Remaining), remaining)
+				if amount <= 0 {
+					continue
+				}
+				available[len(tenders)] = credits[i].Remaining
+				tenders = append(tenders, models.PaymentTender{Type: models.TENDER_TYPE_CREDIT, CreditID: &credits[i].ID, Amount: amount})
+				remaining = utils.RoundPrice(remaining - amount)
+			}
+		}
+		if useWallet && remaining > 0 && user.Balance > 0 {
+			amount := math.Min(payment.FromDefaultCurrency(user.Balance), remaining)
+			if amount > 0 {
+				available[len(tenders)] = user.Balance
+				tenders = append(tenders, models.PaymentTender{Type: models.TENDER_TYPE_WALLET, Amount: amount})
+				remaining = utils.RoundPrice(remaining - amount)
+			}
+		}
+
+		// Card payments have a minimum amount, use less balance for it.
+		if remaining > 0 && remaining < minCardAmount {
+			reduce := utils.RoundPrice(minCardAmount - remaining)
+			for i := len(tenders) - 1; i >= 0 && reduce > 0; i-- {
+				r := math.Min(reduce, tenders[i].Amount)
+				tenders[i].Amount = utils.RoundPrice(tenders[i].Amount - r)
+				reduce = utils.RoundPrice(reduce - r)
+				remaining = utils.RoundPrice(remaining + r)
+			}
+		}
+
+		walletAmount, creditAmount := 0.0, 0.0
+		var created []models.PaymentTender
+		for i := range tenders {
+			tender := tenders[i]
+			if tender.Amount <= 0 {
+				continue
+			}
+			tender.PaymentID = payment.ID
+			tender.DefaultAmount = math.Min(payment.ToDefaultCurrency(tender.Amount), available[i])
+
+			// Debit the credit or wallet balance.
+			switch tender.Type {
+			case models.TENDER_TYPE_CREDIT:
+				err = tx.Model(&models.UserCredit{}).Where("id = ?", *tender.CreditID).Update("remaining", gorm.Expr("remaining - ?", tender.DefaultAmount)).Error
+				creditAmount += tender.Amount
+			case models.TENDER_TYPE_WALLET:
+				err = tx.Model(&models.User{}).Where("id = ?", userId).Update("balance", gorm.Expr("balance - ?", tender.DefaultAmount)).Error
+				walletAmount += tender.Amount
+			}
+			if err != nil {
+				return err
+			}
+			created = append(created, tender)
+		}
+		if remaining > 0 {
+			created = append(created, models.PaymentTender{PaymentID: payment.ID, Type: models.TENDER_TYPE_CARD, Amount: remaining})
+		}
+		if len(created) > 0 {
+			err = tx.Create(&created).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		walletAmount, creditAmount = utils.RoundPrice(walletAmount), utils.RoundPrice(creditAmount)
+		err = tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+			"wallet_amount": walletAmount,
+			"credit_amount": creditAmount,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		payment.WalletAmount = walletAmount
+		payment.CreditAmount = creditAmount
+		payment.Tenders = created
+		return nil
+	})
+}
+
+// RefundPaymentTenders method for return the refunded ratio of the payment to the original tenders.
+// It is idempotent, the tenders already refunded for the ratio are not refunded again.
+func (q *WalletQueries) RefundPaymentTenders(paymentId uint64, userId uuid.UUID, ratio float64) error {
+	ratio = math.Min(math.Max(ratio, 0), 1)
+
+	return q.Transaction(func(tx *gorm.DB) error {
+		var tenders []models.PaymentTender
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("payment_id = ?", paymentId).Find(&tenders).Error
+		if err != nil {
+			return err
+		}
+
+		for _, tender := range tenders {
+			target := utils.RoundPrice(tender.Amount * ratio)
+			delta := utils.RoundPrice(target - tender.RefundedAmount)
+			if delta <= 0 {
+				continue
+			}
+
+			// Card refunds are made by the payment provider.
+			defaultDelta := 0.0
+			if tender.Amount > 0 {
+				defaultDelta = utils.RoundPrice(tender.DefaultAmount * delta / tender.Amount)
+			}
+			switch tender.Type {
+			case models.TENDER_TYPE_CREDIT:
+				err = tx.Model(&models.UserCredit{}).Where("id = ?", *tender.CreditID).Update("remaining", gorm.Expr("remaining + ?", defaultDelta)).Error
+			case models.TENDER_TYPE_WALLET:
+				err = tx.Model(&models.User{}).Where("id = ?", userId).Update("balance", gorm.Expr("balance + ?", defaultDelta)).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&models.PaymentTender{}).Where("id = ?", tender.ID).Update("refunded_amount", target).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetExpiredPaymentsWithTenders method for get unpaid and expired payments having unrefunded wallet or credit tenders.
+func (q *WalletQueries) GetExpiredPaymentsWithTenders() ([]models.Payment, error) {
+	// Define payments variable.
+	var payments []models.Payment
+
+	// Send query to database.
+	err := q.Model(models.Payment{}).Preload("Reservation").
+		Where("status IN ? AND expire < ?", []models.PaymentStatus{models.PAYMENT_STATUS_PENDING, models.PAYMENT_STATUS_FAILED, models.PAYMENT_STATUS_CANCELLED}, time.Now()).
+		Where("EXISTS (SELECT 1 FROM payment_tenders WHERE payment_tenders.payment_id = payments.id AND payment_tenders.type != ? AND payment_tenders.refunded_amount < payment_tenders.amount)", models.TENDER_TYPE_CARD).
+		Find(&payments).Error
+	if err != nil {
+		// Return empty object and error.
+		return payments, err
+	}
+
+	// Return query result.
+	return payments, nil
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"ekira-backend/app/jobs"
+	"ekira-backend/app/models"
+	"ekira-backend/pkg/utils"
+	"ekira-backend/platform/database"
+	"ekira-backend/platform/storage"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs the given command line command and returns the exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "reconcile":
+		return reconcileCommand(args)
+	case "create-coupon":
+		return createCouponCommand(args)
+	case "grant-credit":
+		return grantCreditCommand(args)
+	case "save-amenity":
+		return saveAmenityCommand(args)
+	case "set-role":
+		return setRoleCommand(args)
+	case "migrate-storage":
+		return migrateStorageCommand(args)
+	case "hash-images":
+		return hashImagesCommand(args)
+	}
+	fmt.Printf("unknown command: %s\n", name)
+	return 2
+}
+
+// reconcileCommand reconciles the payments with stripe, e.g. "ekira-backend reconcile -from 2024-01-01 -to 2024-01-02 -dry-run"
+func reconcileCommand(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	from := flags.String("from", time.Now().AddDate(0, 0, -2).Format("2006-01-02"), "start date of the payment intents (YYYY-MM-DD)")
+	to := flags.String("to", time.Now().AddDate(0, 0, 1).Format("2006-01-02"), "end date of the payment intents, exclusive (YYYY-MM-DD)")
+	dryRun := flags.Bool("dry-run", false, "only report mismatches, do not fix them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	fromDate, err := time.ParseInLocation("2006-01-02", *from, time.Local)
+	if err != nil {
+		fmt.Printf("invalid from date: %v\n", err)
+		return 2
+	}
+	toDate, err := time.ParseInLocation("2006-01-02", *to, time.Local)
+	if err != nil || !toDate.After(fromDate) {
+		fmt.Println("invalid to date")
+		return 2
+	}
+
+	report, err := jobs.ReconcilePayments(fromDate, toDate, *dryRun)
+	if err != nil {
+		fmt.Printf("reconciliation failed: %v\n", err)
+		return 1
+	}
+	path, err := jobs.WriteReconciliationReport(report)
+	if err != nil {
+		fmt.Printf("report cannot be written: %v\n", err)
+	}
+
+	fmt.Printf("%d payments checked, %d fixed, %d discrepancies. Report: %s\n", report.Checked, len(report.Fixed), len(report.Discrepancies), path)
+	for _, item := range report.Fixed {
+		fmt.Printf("fixed\t%s\t%s\t%s\t%s\n", item.Type, item.PaymentID, item.StripeID, item.Detail)
+	}
+	for _, item := range report.Discrepancies {
+		fmt.Printf("unresolved\t%s\t%s\t%s\t%s\n", item.Type, item.PaymentID, item.StripeID, item.Detail)
+	}
+	if len(report.Discrepancies) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseIntList parses comma separated integers, e.g. "1,2,3"
+func parseIntList(value string) (models.IntArray, error) {
+	list := models.IntArray{}
+	for _, v := range strings.Split(value, ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, i)
+	}
+	return list, nil
+}
+
+// createCouponCommand creates a platform funded coupon, e.g. "ekira-backend create-coupon -code SUMMER10 -value 10 -ends 2024-09-01"
+func createCouponCommand(args []string) int {
+	flags := flag.NewFlagSet("create-coupon", flag.ContinueOnError)
+	code := flags.String("code", "", "coupon code")
+	description := flags.String("description", "", "coupon description")
+	fixed := flags.Bool("fixed", false, "value is a fixed amount instead of percentage")
+	value := flags.Float64("value", 0, "discount percentage or fixed amount")
+	currency := flags.String("currency", string(models.DefaultCurrency), "currency of the fixed amount, max discount and min amount")
+	maxDiscount := flags.Float64("max-discount", 0, "maximum discount of percentage coupons, 0 = unlimited")
+	minAmount := flags.Float64("min-amount", 0, "minimum price to use the coupon")
+	starts := flags.String("starts", time.Now().Format("2006-01-02"), "start date (YYYY-MM-DD)")
+	ends := flags.String("ends", "", "end date, exclusive (YYYY-MM-DD)")
+	usageLimit := flags.Int("usage-limit", 0, "total usage limit, 0 = unlimited")
+	perUserLimit := flags.Int("per-user-limit", 1, "usage limit per user, 0 = unlimited")
+	rentPeriods := flags.String("rent-periods", "", "comma separated rent periods (1 = daily, 2 = monthly, 3 = yearly)")
+	cityIds := flags.String("cities", "", "comma separated city ids")
+	rentalHouseIds := flags.String("rental-houses", "", "comma separated rental house ids")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	coupon := models.Coupon{
+		Code:         strings.ToUpper(*code),
+		Description:  *description,
+		DiscountType: models.CouponDiscountTypePercentage,
+		Value:        *value,
+		Currency:     models.Currency(strings.ToUpper(*currency)),
+		MinAmount:    *minAmount,
+		UsageLimit:   *usageLimit,
+		PerUserLimit: *perUserLimit,
+		FundedBy:     models.CouponFundedByPlatform,
+		Active:       true,
+	}
+	if *fixed {
+		coupon.DiscountType = models.CouponDiscountTypeFixed
+	} else if coupon.Value > 100 {
+		fmt.Println("percentage discount can not be greater than 100")
+		return 2
+	}
+	if *maxDiscount > 0 {
+		coupon.MaxDiscount = maxDiscount
+	}
+
+	var err error
+	coupon.StartsAt, err = time.ParseInLocation("2006-01-02", *starts, utils.TZ)
+	if err != nil {
+		fmt.Printf("invalid start date: %v\n", err)
+		return 2
+	}
+	if *ends != "" {
+		endsAt, err := time.ParseInLocation("2006-01-02", *ends, utils.TZ)
+		if err != nil || !endsAt.After(coupon.StartsAt) {
+			fmt.Println("invalid end date")
+			return 2
+		}
+		coupon.EndsAt = &endsAt
+	}
+	if coupon.RentPeriods, err = parseIntList(*rentPeriods); err != nil {
+		fmt.Printf("invalid rent periods: %v\n", err)
+		return 2
+	}
+	if coupon.CityIDs, err = parseIntList(*cityIds); err != nil {
+		fmt.Printf("invalid cities: %v\n", err)
+		return 2
+	}
+	if coupon.RentalHouseIDs, err = parseIntList(*rentalHouseIds); err != nil {
+		fmt.Printf("invalid rental houses: %v\n", err)
+		return 2
+	}
+
+	// Validate coupon.
+	if err := utils.NewValidator().Struct(coupon); err != nil {
+		fmt.Println(utils.ValidatorErrors(err))
+		return 2
+	}
+
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("database connection failed: %v\n", err)
+		return 1
+	}
+	existing, err := db.GetCouponWithCode(coupon.Code)
+	if err != nil {
+		fmt.Printf("database query failed: %v\n", err)
+		return 1
+	}
+	if existing.ID != 0 {
+		fmt.Println("coupon code is already used")
+		return 1
+	}
+	if err := db.Create(&coupon).Error; err != nil {
+		fmt.Printf("coupon cannot be created: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("coupon %s created: %s\n", coupon.Code, coupon.UID)
+	return 0
+}
+
+// grantCreditCommand gives platform credit to a user, e.g. "ekira-backend grant-credit -email user@mail.com -amount 250 -days 90 -reason goodwill"
+func grantCreditCommand(args []string) int {
+	flags := flag.NewFlagSet("grant-credit", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	userId := flags.String("user", "", "id of the user, used if email is not given")
+	amount := flags.Float64("amount", 0, fmt.Sprintf("credit amount in %s", models.DefaultCurrency))
+	days := flags.Int("days", 0, "credit expires after the days, 0 = never")
+	reason := flags.String("reason", "", "reason of the credit")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *amount <= 0 {
+		fmt.Println("amount must be greater than 0")
+		return 2
+	}
+	if strings.TrimSpace(*reason) == "" {
+		fmt.Println("reason is required")
+		return 2
+	}
+
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("database connection failed: %v\n", err)
+		return 1
+	}
+
+	var user models.User
+	if *email != "" {
+		user, err = db.GetUserByEmail(*email)
+	} else {
+		id, e := uuid.Parse(*userId)
+		if e != nil {
+			fmt.Println("email or a valid user id is required")
+			return 2
+		}
+		user, err = db.GetUserById(id)
+	}
+	if err != nil {
+		fmt.Printf("database query failed: %v\n", err)
+		return 1
+	}
+	if user.ID == uuid.Nil {
+		fmt.Println("user not found")
+		return 1
+	}
+
+	credit := models.UserCredit{
+		UserID:    user.ID,
+		Amount:    *amount,
+		Remaining: *amount,
+		Reason:    *reason,
+	}
+	if *days > 0 {
+		expiresAt := time.Now().AddDate(0, 0, *days)
+		credit.ExpiresAt = &expiresAt
+	}
+	if err := db.Create(&credit).Error; err != nil {
+		fmt.Printf("credit cannot be created: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%.2f %s credit given to %s: %s\n", credit.Amount, models.DefaultCurrency, user.Email, credit.UID)
+	return 0
+}
+
+// saveAmenityCommand creates the amenity or updates it by code, e.g. "ekira-backend save-amenity -code sauna -name Sauna -category 1 -order 20"
+func saveAmenityCommand(args []string) int {
+	flags := flag.NewFlagSet("save-amenity", flag.ContinueOnError)
+	code := flags.String("code", "", "unique code of the amenity")
+	name := flags.String("name", "", "display name of the amenity")
+	category := flags.Int("category", int(models.AmenityCategoryFeature), "1 = feature, 2 = house rule")
+	order := flags.Int("order", 0, "display order")
+	active := flags.Bool("active", true, "listed in the catalog and selectable")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	*code = strings.ToLower(strings.TrimSpace(*code))
+	if *code == "" || len(*code) > 32 {
+		fmt.Println("code is required, max 32 characters")
+		return 2
+	}
+	if *category != int(models.AmenityCategoryFeature) && *category != int(models.AmenityCategoryRule) {
+		fmt.Println("invalid category")
+		return 2
+	}
+
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("database connection failed: %v\n", err)
+		return 1
+	}
+
+	amenity, err := db.GetAmenityWithCode(*code)
+	if err != nil {
+		fmt.Printf("database query failed: %v\n", err)
+		return 1
+	}
+	if amenity.ID == 0 && strings.TrimSpace(*name) == "" {
+		fmt.Println("name is required for a new amenity")
+		return 2
+	}
+
+	// Existing amenities are only changed by the given flags.
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if amenity.ID == 0 {
+		set["category"], set["order"], set["active"] = true, true, true
+	}
+	amenity.Code = *code
+	if strings.TrimSpace(*name) != "" {
+		amenity.Name = strings.TrimSpace(*name)
+	}
+	if set["category"] {
+		amenity.Category = models.AmenityCategory(*category)
+	}
+	if set["order"] {
+		amenity.DisplayOrder = *order
+	}
+	if set["active"] {
+		amenity.Active = *active
+	}
+	if err := utils.NewValidator().Struct(&amenity); err != nil {
+		fmt.Println(utils.ValidatorErrors(err))
+		return 2
+	}
+
+	// Save also writes the zero values, e.g. active = false.
+	if amenity.ID == 0 {
+		err = db.Create(&amenity).Update("active", amenity.Active).Error
+	} else {
+		err = db.Save(&amenity).Error
+	}
+	if err != nil {
+		fmt.Printf("amenity cannot be saved: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("amenity %s saved: %d\n", amenity.Code, amenity.ID)
+	return 0
+}
+
+// setRoleCommand changes the role of a user, e.g. "ekira-backend set-role -email user@mail.com -role moderator"
+func setRoleCommand(args []string) int {
+	flags := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	roleName := flags.String("role", "", "user or moderator")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var role models.UserRole
+	for _, r := range []models.UserRole{models.USER_ROLE_USER, models.USER_ROLE_MODERATOR} {
+		if r.Name() == *roleName {
+			role = r
+		}
+	}
+	if role == 0 {
+		fmt.Println("role must be user or moderator")
+		return 2
+	}
+
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("database connection failed: %v\n", err)
+		return 1
+	}
+
+	user, err := db.GetUserByEmail(*email)
+	if err != nil {
+		fmt.Printf("database query failed: %v\n", err)
+		return 1
+	}
+	if user.ID == uuid.Nil {
+		fmt.Println("user not found")
+		return 1
+	}
+
+	if err := db.Model(&models.User{}).Where("id = ?", user.ID).Update("role", role).Error; err != nil {
+		fmt.Printf("role cannot be changed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s is %s now\n", user.Email, role.Name())
+	return 0
+}
+
+// storageMigration moves the image files of the local directory to the configured storage.
+type storageMigration struct {
+	from          *storage.LocalStorage
+	to            storage.Storage
+	sameStorage   bool // the files are already in place, only the urls change
+	dryRun        bool
+	deleteSource  bool
+	copied        int
+	missing       int
+	failed        int
+	rewrittenRows int
+}
+
+// migrateURLs copies the files of the urls and changes the urls, it returns true if an url is changed.
+// The urls of the missing or failed files are kept.
+func (m *storageMigration) migrateURLs(prefix string, urls []*string) (bool, []string) {
+	changed := false
+	var copiedKeys []string
+	for _, url := range urls {
+		key := utils.ImageKey(prefix, path.Base(*url))
+		newUrl := m.to.URL(key)
+		if *url == newUrl {
+			continue
+		}
+		if !m.sameStorage {
+			file, err := m.from.Get(key)
+			if err != nil {
+				if errors.Is(err, storage.ErrNotFound) {
+					m.missing++
+				} else {
+					m.failed++
+				}
+				fmt.Printf("skipped\t%s\t%v\n", key, err)
+				continue
+			}
+			if !m.dryRun {
+				err = m.to.Put(key, file, -1, "image/jpeg")
+			}
+			file.Close()
+			if err != nil {
+				m.failed++
+				fmt.Printf("failed\t%s\t%v\n", key, err)
+				continue
+			}
+			m.copied++
+			copiedKeys = append(copiedKeys, key)
+		}
+		*url = newUrl
+		changed = true
+	}
+	return changed, copiedKeys
+}
+
+// removeSource removes the copied local files after their new urls are saved.
+func (m *storageMigration) removeSource(keys []string) {
+	if !m.deleteSource || m.sameStorage || m.dryRun {
+		return
+	}
+	for _, key := range keys {
+		if err := m.from.Delete(key); err != nil {
+			fmt.Printf("not deleted\t%s\t%v\n", key, err)
+		}
+	}
+}
+
+// migrateStorageCommand moves the uploaded images to the configured storage and updates their urls, e.g. "ekira-backend migrate-storage -source public -dry-run"
+func migrateStorageCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	source := flags.String("source", "public", "local directory of the current files")
+	dryRun := flags.Bool("dry-run", false, "only report the files to move")
+	deleteSource := flags.Bool("delete-source", false, "delete the local files after they are moved")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	to, err := storage.NewStorage()
+	if err != nil {
+		fmt.Printf("storage cannot be used: %v\n", err)
+		return 1
+	}
+	m := &storageMigration{
+		from:         &storage.LocalStorage{Root: *source},
+		to:           to,
+		dryRun:       *dryRun,
+		deleteSource: *deleteSource,
+	}
+	if local, ok := to.(*storage.LocalStorage); ok && filepath.Clean(local.Root) == filepath.Clean(*source) {
+		m.sameStorage = true
+	}
+
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("database connection failed: %v\n", err)
+		return 1
+	}
+
+	var rentalHouseImages []models.RentalHouseImage
+	err = db.Model(&models.RentalHouseImage{}).FindInBatches(&rentalHouseImages, 100, func(tx *gorm.DB, batch int) error {
+		for _, image := range rentalHouseImages {
+			urls := make([]*string, len(image.Images))
+			for i := range image.Images {
+				urls[i] = &image.Images[i].URL
+			}
+			changed, keys := m.migrateURLs(utils.RentalHouseImagePrefix, urls)
+			if !changed {
+				continue
+			}
+			m.rewrittenRows++
+			if m.dryRun {
+				continue
+			}
+			if err := db.Model(&models.RentalHouseImage{}).Where("id = ?", image.ID).UpdateColumn("images", image.Images).Error; err != nil {
+				return err
+			}
+			m.removeSource(keys)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		fmt.Printf("rental house images cannot be migrated: %v\n", err)
+		return 1
+	}
+
+	var profileImages []models.UserProfileImage
+	err = db.Model(&models.UserProfileImage{}).FindInBatches(&profileImages, 100, func(tx *gorm.DB, batch int) error {
+		for _, image := range profileImages {
+			urls := make([]*string, len(image.Images))
+			for i := range image.Images {
+				urls[i] = &image.Images[i].URL
+			}
+			changed, keys := m.migrateURLs(utils.ProfileImagePrefix, urls)
+			if !changed {
+				continue
+			}
+			m.rewrittenRows++
+			if m.dryRun {
+				continue
+			}
+			if err := db.Model(&models.UserProfileImage{}).Where("id = ?", image.ID).UpdateColumn("images", image.Images).Error; err != nil {
+				return err
+			}
+			m.removeSource(keys)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		fmt.Printf("profile images cannot be migrated: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d files copied, %d images updated, %d missing, %d failed\n", m.copied, m.rewrittenRows, m.missing, m.failed)
+	if m.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// hashImagesCommand computes the perceptual hashes of the ready rental house images which do not have one, e.g. "ekira-backend hash-images -limit 1000"
+func hashImagesCommand(args []string) int {
+	flags := flag.NewFlagSet("hash-images", flag.ContinueOnError)
+	limit := flags.Int("limit", 0, "maximum number of images to hash, 0 for all")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	store, err := storage.NewStorage()
+	if err != nil {
+		fmt.Printf("storage cannot be used: %v\n", err)
+		return 1
+	}
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Printf("database connection failed: %v\n", err)
+		return 1
+	}
+
+	hashed, failed := 0, 0
+	var images []models.RentalHouseImage
+	query := db.Model(&models.RentalHouseImage{}).Where("perceptual_hash IS NULL AND status = ?", models.IMAGE_STATUS_READY)
+	if *limit > 0 {
+		query = query.Limit(*limit)
+	}
+	err = query.FindInBatches(&images, 100, func(tx *gorm.DB, batch int) error {
+		for _, image := range images {
+			if len(image.Images) == 0 {
+				continue
+			}
+			// The first variant is the original size.
+			key, ok := store.Key(image.Images[0].URL)
+			if !ok {
+				failed++
+				fmt.Printf("skipped\t%s\tnot in the storage\n", image.Images[0].URL)
+				continue
+			}
+			file, err := store.Get(key)
+			if err != nil {
+				failed++
+				fmt.Printf("skipped\t%s\t%v\n", key, err)
+				continue
+			}
+			hash, err := utils.ReadImageDHash(file)
+			file.Close()
+			if err != nil {
+				failed++
+				fmt.Printf("failed\t%s\t%v\n", key, err)
+				continue
+			}
+			if err := db.Model(&models.RentalHouseImage{}).Where("id = ?", image.ID).UpdateColumn("perceptual_hash", hash).Error; err != nil {
+				return err
+			}
+			hashed++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		fmt.Printf("rental house images cannot be hashed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d images hashed, %d failed\n", hashed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
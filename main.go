@@ -1,6 +1,7 @@
 package main
 
 import (
+	"ekira-backend/app/jobs"
 	_ "ekira-backend/docs" // load API Docs files (Swagger)
 	"ekira-backend/pkg/configs"
 	"ekira-backend/pkg/middleware"
@@ -48,6 +49,11 @@ func main() {
 	folder = "logs"
 	os.MkdirAll(folder, os.ModePerm)
 
+	// Run command if given, e.g. "reconcile"
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// Check redis connection
 	rds := database.NewRConnection()
 	err = rds.RPing()
@@ -89,8 +95,30 @@ func main() {
 	routes.PaymentRoutes(app)       // Register a route group for payment routes.
 	routes.StripeWebhookRoutes(app) // Register a route group for stripe webhook routes.
 	routes.WalletRoutes(app)        // Register a route group for wallet routes.
+	routes.CurrencyRoutes(app)      // Register a route group for currency routes.
+	routes.TaxRoutes(app)           // Register a route group for tax routes.
+	routes.DisputeRoutes(app)       // Register a route group for dispute routes.
+	routes.CouponRoutes(app)        // Register a route group for coupon routes.
+	routes.AmenityRoutes(app)       // Register a route group for amenity routes.
+	routes.ModerationRoutes(app)    // Register a route group for moderation routes.
+	routes.ReviewRoutes(app)        // Register a route group for review routes.
+	routes.MessageRoutes(app)       // Register a route group for message routes.
+	routes.RealtimeRoutes(app)      // Register a route for realtime events websocket.
+	routes.NotificationRoutes(app)  // Register a route group for notification routes.
+	routes.DeviceRoutes(app)        // Register a route group for device routes.
+	routes.SavedSearchRoutes(app)   // Register a route group for saved search routes.
 	routes.NotFoundRoute(app)       // Register route for 404 Error.
 
+	// Start jobs
+	jobs.StartReconciliationJob()           // Reconcile payments with stripe every night.
+	jobs.StartImageProcessingWorkers()      // Create the variants of the uploaded images.
+	jobs.StartReviewPublishingJob()         // Publish the reviews of the ended review windows every hour.
+	jobs.StartRealtimeSubscriber()          // Send the realtime events of all instances to the websocket connections.
+	jobs.StartNotificationWorker()          // Send the notifications of the outbox.
+	jobs.StartPaymentReminderJob()          // Remind the renters of the monthly payments every hour.
+	jobs.StartSavedSearchAlertJob()         // Alert the saved searches about the new and the cheaper listings.
+	jobs.StartMessageAttachmentCleanupJob() // Remove the message attachments which are not sent in a day every hour.
+
 	// Start server
 	utils.StartServer(app)
 }
@@ -4,6 +4,7 @@ import (
 	"ekira-backend/app/errs"
 	"ekira-backend/app/models"
 	"ekira-backend/platform/database"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"os"
@@ -85,11 +86,50 @@ func JWTProtectedMaintenance(handle Handler) []func(c *fiber.Ctx) error {
 // JWTProtected func for specify routes group with JWT authentication.
 // See: https://github.com/gofiber/jwt
 func JWTProtected(handlers ...fiber.Handler) []fiber.Handler {
+	return jwtProtected("header:Authorization", handlers...)
+}
+
+// WebSocketProtected func for specify websocket routes with JWT authentication. Browsers can not set the Authorization
+// header of the websocket requests, so a one-time ticket of the session can be given with the ticket query parameter.
+// The tokens are not given in the query, so they are not written to the access logs.
+func WebSocketProtected(handlers ...fiber.Handler) []fiber.Handler {
+	return append([]fiber.Handler{realtimeTicket}, jwtProtected("header:Authorization", handlers...)...)
+}
+
+// realtimeTicket reads the session of the one-time ticket, the ticket is deleted so it can not be used again.
+func realtimeTicket(c *fiber.Ctx) error {
+	ticket := c.Query("ticket")
+	if ticket == "" {
+		return c.Next()
+	}
+
+	rds := database.NewRConnection()
+	defer rds.RClose()
+	sessionId, err := rds.RGetDel(models.RealtimeTicketKey(ticket))
+	if err != nil {
+		// Return status 500 and failed redis error.
+		return c.Status(fiber.StatusInternalServerError).JSON(models.NewResponseErr(errors.New("ticket can not be checked")).SetHeader("redis", err.Error()))
+	}
+	if sessionId == "" {
+		// Return status 401 and failed authentication error.
+		return c.Status(errs.ErrNoAuth.StatusCode).JSON(models.NewResponseError(errs.ErrNoAuth).SetHeader("ticket", "invalid or used ticket"))
+	}
+	c.Locals("ticket-session", sessionId)
+	return c.Next()
+}
+
+func jwtProtected(tokenLookup string, handlers ...fiber.Handler) []fiber.Handler {
 	// Create config for JWT authentication middleware.
 	jwtHandler := jwtWare.New(jwtWare.Config{
 		SigningKey:   []byte(os.Getenv("JWT_SECRET_KEY")),
 		ContextKey:   "jwt",
+		TokenLookup:  tokenLookup,
 		ErrorHandler: jwtError,
+		// The token is not needed if the session is given with a ticket.
+		Filter: func(c *fiber.Ctx) bool {
+			_, ok := c.Locals("ticket-session").(string)
+			return ok
+		},
 	})
 
 	sfMiddleware := func(c *fiber.Ctx) error {
@@ -99,14 +139,17 @@ func JWTProtected(handlers ...fiber.Handler) []fiber.Handler {
 			return c.Status(errs.ErrDatabaseConnection.StatusCode).JSON(models.NewResponseError(errs.ErrDatabaseConnection))
 		}
 
-		// Get JWT claims from context.
-		if _, ok := c.Locals("jwt").(*jwt.Token); !ok {
-			// Return status 401 and failed authentication error.
-			return c.Status(errs.ErrNoAuth.StatusCode).JSON(models.NewResponseError(errs.ErrNoAuth).SetHeader("jwt", "invalid ctx").SetHeader("token", c.Get("Authorization")))
+		// Get the session of the ticket or JWT claims from context.
+		sessionId, ok := c.Locals("ticket-session").(string)
+		if !ok {
+			if _, ok := c.Locals("jwt").(*jwt.Token); !ok {
+				// Return status 401 and failed authentication error.
+				return c.Status(errs.ErrNoAuth.StatusCode).JSON(models.NewResponseError(errs.ErrNoAuth).SetHeader("jwt", "invalid ctx").SetHeader("token", c.Get("Authorization")))
+			}
+			user := c.Locals("jwt").(*jwt.Token)
+			claims := user.Claims.(jwt.MapClaims)
+			sessionId = claims["Session"].(string)
 		}
-		user := c.Locals("jwt").(*jwt.Token)
-		claims := user.Claims.(jwt.MapClaims)
-		sessionId := claims["Session"].(string)
 
 		if len(sessionId) < 36 {
 			// Return status 401 and failed authentication error.
@@ -158,6 +201,19 @@ func JWTProtected(handlers ...fiber.Handler) []fiber.Handler {
 	return rHandlers
 }
 
+// ModeratorProtected func for specify routes with JWT authentication, only for the moderators.
+func ModeratorProtected(handlers ...fiber.Handler) []fiber.Handler {
+	return JWTProtected(append([]fiber.Handler{moderatorOnly}, handlers...)...)
+}
+
+func moderatorOnly(c *fiber.Ctx) error {
+	if user, ok := c.Locals("user").(models.User); !ok || !user.IsModerator() {
+		// Return status 403 and forbidden error.
+		return c.Status(errs.ErrForbidden.StatusCode).JSON(models.NewResponseError(errs.ErrForbidden))
+	}
+	return c.Next()
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	// Return status 401 and failed authentication error.
 	if err.Error() == "Missing or malformed JWT" {
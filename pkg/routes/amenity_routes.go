@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func AmenityRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	amenity := route.Group("/amenity")
+
+	// Routes for GET method:
+	amenity.Get("/list", middleware.JWTProtected(controllers.GetAmenityList)...) // get amenities catalog
+}
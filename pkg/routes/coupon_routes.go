@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func CouponRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	coupon := route.Group("/coupon")
+
+	// Routes for GET method:
+	coupon.Get("/list", middleware.JWTProtected(controllers.GetCouponList)...) // get coupons created by user
+	coupon.Get("/check", middleware.JWTProtected(controllers.CheckCoupon)...)  // check coupon for rental house
+
+	// Routes for POST method:
+	coupon.Post("/create", middleware.JWTProtected(controllers.CreateCoupon)...) // create owner funded coupon
+
+	// Routes for PUT method:
+	coupon.Put("/:id/active", middleware.JWTProtected(controllers.SetCouponActive)...) // activate or deactivate coupon
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func CurrencyRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	currency := route.Group("/currency")
+
+	// Routes for GET method:
+	currency.Get("/rates", controllers.GetExchangeRates) // get exchange rates of supported currencies
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func DeviceRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	device := route.Group("/device")
+
+	// Routes for POST method:
+	device.Post("/register", middleware.JWTProtected(controllers.RegisterDevice)...)     // register push token of the session
+	device.Post("/unregister", middleware.JWTProtected(controllers.UnregisterDevice)...) // remove push token of the session
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func DisputeRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	dispute := route.Group("/dispute")
+
+	// Routes for GET method:
+	dispute.Get("/list", middleware.JWTProtected(controllers.GetDisputeList)...)   // get disputes of owned rental houses
+	dispute.Get("/:id", middleware.JWTProtected(controllers.GetDisputeDetails)...) // get dispute details
+
+	// Routes for POST method:
+	dispute.Post("/:id/evidence", middleware.JWTProtected(controllers.SubmitDisputeEvidence)...) // submit evidence for dispute
+}
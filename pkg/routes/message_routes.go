@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func MessageRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	message := route.Group("/message")
+
+	// Routes for GET method:
+	message.Get("/conversations", middleware.JWTProtected(controllers.GetConversations)...)           // get conversations of user
+	message.Get("/conversation/:id", middleware.JWTProtected(controllers.GetConversationMessages)...) // get messages of conversation
+	message.Get("/unread-count", middleware.JWTProtected(controllers.GetUnreadMessageCount)...)       // get number of unread messages
+	message.Get("/image/:id", middleware.JWTProtected(controllers.GetMessageImageStatus)...)          // get processing status of uploaded image
+
+	// Routes for POST method:
+	message.Post("/conversation", middleware.JWTProtected(controllers.StartConversation)...)         // get or create conversation of rental house or reservation
+	message.Post("/conversation/:id", middleware.JWTProtected(controllers.SendMessage)...)           // send message to conversation
+	message.Post("/conversation/:id/read", middleware.JWTProtected(controllers.ReadConversation)...) // mark messages of conversation as read
+	message.Post("/upload-image", middleware.JWTProtected(controllers.UploadMessageImage)...)        // upload image of message
+}
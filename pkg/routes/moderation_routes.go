@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func ModerationRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	moderation := route.Group("/moderation")
+
+	// Routes for GET method:
+	moderation.Get("/queue", middleware.ModeratorProtected(controllers.GetModerationQueue)...)             // get rental houses by moderation status
+	moderation.Get("/:id/history", middleware.ModeratorProtected(controllers.GetModerationHistory)...)     // get moderation history of rental house
+	moderation.Get("/duplicates", middleware.ModeratorProtected(controllers.GetDuplicateImageClusters)...) // get similar images of listings of different owners
+
+	// Routes for POST method:
+	moderation.Post("/:id/approve", middleware.ModeratorProtected(controllers.ApproveRentalHouse)...) // approve rental house
+	moderation.Post("/:id/reject", middleware.ModeratorProtected(controllers.RejectRentalHouse)...)   // reject rental house with reason
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func NotificationRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	notification := route.Group("/notification")
+
+	// Routes for GET method:
+	notification.Get("/preferences", middleware.JWTProtected(controllers.GetNotificationPreferences)...) // get notification settings of user
+
+	// Routes for POST method:
+	notification.Post("/preferences", middleware.JWTProtected(controllers.UpdateNotificationPreferences)...) // change notification settings of user
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+func RealtimeRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+
+	// Routes for GET method:
+	route.Get("/ws", middleware.WebSocketProtected(controllers.RealtimeUpgrade, websocket.New(controllers.RealtimeEvents))...) // websocket connection of realtime events
+
+	// Routes for POST method:
+	route.Post("/realtime/ticket", middleware.JWTProtected(controllers.CreateRealtimeTicket)...) // one-time ticket of the websocket connection
+}
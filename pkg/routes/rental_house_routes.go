@@ -14,13 +14,24 @@ func RentalHouseRoutes(a *fiber.App) {
 	// Main routes:
 	rh.Get("/list", middleware.JWTProtected(controllers.GetPublicList)...)
 	rh.Get("/owned-list", middleware.JWTProtected(controllers.GetOwnedList)...)
+	rh.Get("/archived-list", middleware.JWTProtected(controllers.GetArchivedList)...)
+	rh.Get("/map", middleware.JWTProtected(controllers.GetRentalHouseMap)...)
+	rh.Get("/facets", middleware.JWTProtected(controllers.GetRentalHouseFacets)...)
 	rh.Post("/create", middleware.JWTProtected(controllers.CreateRentalHouse)...)
 	rh.Post("/upload-image", middleware.JWTProtected(controllers.UploadRentalHouseImage)...)
+	rh.Get("/image/:id", middleware.JWTProtected(controllers.GetRentalHouseImageStatus)...)
 
 	// Rental house sub routes:
 	rh.Get("/:id/reserved-dates", middleware.JWTProtected(controllers.GetReservedDates)...)
 	rh.Get("/:id/favorite", middleware.JWTProtected(controllers.FavoriteRentalHouse)...)
 	rh.Get("/:id/unfavorite", middleware.JWTProtected(controllers.UnfavoriteRentalHouse)...)
+	rh.Post("/:id/submit", middleware.JWTProtected(controllers.SubmitRentalHouse)...)
+	rh.Post("/:id/restore", middleware.JWTProtected(controllers.RestoreRentalHouse)...)
+	rh.Post("/:id/images", middleware.JWTProtected(controllers.AddRentalHouseImages)...)
+	rh.Put("/:id/images/order", middleware.JWTProtected(controllers.SetRentalHouseImageOrder)...)
+	rh.Put("/:id/images/:imageId/main", middleware.JWTProtected(controllers.SetRentalHouseMainImage)...)
+	rh.Delete("/:id/images/:imageId", middleware.JWTProtected(controllers.DeleteRentalHouseImage)...)
 	rh.Get("/:id", middleware.JWTProtected(controllers.GetDetails)...)
 	rh.Put("/:id", middleware.JWTProtected(controllers.EditRentalHouse)...)
+	rh.Delete("/:id", middleware.JWTProtected(controllers.DeleteRentalHouse)...)
 }
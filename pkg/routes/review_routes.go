@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func ReviewRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	review := route.Group("/review")
+
+	// Routes for GET method:
+	review.Get("/pending", middleware.JWTProtected(controllers.GetPendingReviews)...)              // get ended stays to review
+	review.Get("/rental-house/:id", middleware.JWTProtected(controllers.GetRentalHouseReviews)...) // get published reviews of rental house
+	review.Get("/user/:id", middleware.JWTProtected(controllers.GetRenterReviews)...)              // get published reviews of renter
+
+	// Routes for POST method:
+	review.Post("/create", middleware.JWTProtected(controllers.CreateReview)...)        // review a stay
+	review.Post("/:id/response", middleware.JWTProtected(controllers.RespondReview)...) // respond to review of owned rental house
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SavedSearchRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	savedSearch := route.Group("/saved-search")
+
+	// Routes for GET method:
+	savedSearch.Get("/list", middleware.JWTProtected(controllers.GetSavedSearches)...) // get saved searches of user
+	savedSearch.Get("/unsubscribe/:token", controllers.ConfirmUnsubscribeSavedSearch)  // show unsubscribe page of the link of the alert e-mail
+
+	// Routes for POST method:
+	savedSearch.Post("/create", middleware.JWTProtected(controllers.CreateSavedSearch)...) // save search with the filters of the rental house list
+	savedSearch.Post("/unsubscribe/:token", controllers.UnsubscribeSavedSearch)            // turn off alerts with the form of the unsubscribe page
+
+	// Routes for PUT method:
+	savedSearch.Put("/:id", middleware.JWTProtected(controllers.UpdateSavedSearch)...) // change name or alert frequency of saved search
+
+	// Routes for DELETE method:
+	savedSearch.Delete("/:id", middleware.JWTProtected(controllers.DeleteSavedSearch)...) // delete saved search
+}
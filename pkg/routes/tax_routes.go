@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ekira-backend/app/controllers"
+	"ekira-backend/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TaxRoutes(a *fiber.App) {
+	// Create routes group.
+	route := a.Group("/v1")
+	tax := route.Group("/tax")
+
+	// Routes for GET method:
+	tax.Get("/annual-report", middleware.JWTProtected(controllers.GetAnnualRentalIncomeReport)...) // get annual rental income report of owned rental houses
+}
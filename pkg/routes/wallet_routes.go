@@ -13,4 +13,5 @@ func WalletRoutes(a *fiber.App) {
 
 	// Routes for GET method:
 	user.Get("/balance", middleware.JWTProtected(controllers.GetWalletBalance)...) // get wallet balance
+	user.Get("/credits", middleware.JWTProtected(controllers.GetWalletCredits)...) // get available credits
 }
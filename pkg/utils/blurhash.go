@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// EncodeBlurhash returns the blurhash placeholder of the RGB pixels (3 bytes per pixel), see https://blurha.sh.
+// The components are between 1 and 9, 4x3 is enough for the photos.
+func EncodeBlurhash(xComponents int, yComponents int, width int, height int, rgb []byte) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", errors.New("blurhash components must be between 1 and 9")
+	}
+	if width < 1 || height < 1 || len(rgb) < width*height*3 {
+		return "", errors.New("blurhash pixels do not match the size")
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for y := 0; y < yComponents; y++ {
+		for x := 0; x < xComponents; x++ {
+			factors = append(factors, blurhashFactor(x, y, width, height, rgb))
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maxValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, factor := range factors[1:] {
+			for _, value := range factor {
+				actualMax = math.Max(actualMax, math.Abs(value))
+			}
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, factor := range factors[1:] {
+		quantised := [3]int{}
+		for i, value := range factor {
+			quantised[i] = int(math.Max(0, math.Min(18, math.Floor(signPow(value/maxValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quantised[0]*19*19+quantised[1]*19+quantised[2], 2))
+	}
+	return hash.String(), nil
+}
+
+func blurhashFactor(xComponent int, yComponent int, width int, height int, rgb []byte) [3]float64 {
+	var r, g, b float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			basis := math.Cos(math.Pi*float64(xComponent)*float64(x)/float64(width)) *
+				math.Cos(math.Pi*float64(yComponent)*float64(y)/float64(height))
+			i := (y*width + x) * 3
+			r += basis * sRGBToLinear(rgb[i])
+			g += basis * sRGBToLinear(rgb[i+1])
+			b += basis * sRGBToLinear(rgb[i+2])
+		}
+	}
+	normalisation := 2.0
+	if xComponent == 0 && yComponent == 0 {
+		normalisation = 1
+	}
+	scale := normalisation / float64(width*height)
+	return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func sRGBToLinear(value byte) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+func encodeBase83(value int, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = base83Characters[digit]
+	}
+	return string(result)
+}
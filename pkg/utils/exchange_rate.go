@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"ekira-backend/app/models"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	req2 "github.com/imroc/req/v3"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RateSource provides the value of one unit of each supported currency in TRY.
+type RateSource interface {
+	Name() string
+	TRYRates() (map[models.Currency]float64, error)
+}
+
+// NewRateSource returns the rate source selected by EXCHANGE_RATE_SOURCE (file, tcmb). Defaults to file.
+func NewRateSource() RateSource {
+	switch strings.ToLower(os.Getenv("EXCHANGE_RATE_SOURCE")) {
+	case "tcmb":
+		return &TCMBRateSource{URL: "https://www.tcmb.gov.tr/kurlar/today.xml"}
+	default:
+		path := os.Getenv("EXCHANGE_RATES_FILE")
+		if path == "" {
+			path = "exchange_rates.json"
+		}
+		return &StaticFileRateSource{Path: path}
+	}
+}
+
+// StaticFileRateSource reads rates from a JSON file like {"TRY": 1, "EUR": 35.2}, for offline use.
+type StaticFileRateSource struct {
+	Path string
+}
+
+func (s *StaticFileRateSource) Name() string {
+	return "file"
+}
+
+func (s *StaticFileRateSource) TRYRates() (map[models.Currency]float64, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]float64
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	rates := map[models.Currency]float64{models.CurrencyTRY: 1}
+	for code, rate := range raw {
+		currency, ok := models.ParseCurrency(code)
+		if !ok || rate <= 0 {
+			continue
+		}
+		rates[currency] = rate
+	}
+	return rates, nil
+}
+
+// TCMBRateSource reads forex selling rates published by the Central Bank of the Republic of Türkiye.
+type TCMBRateSource struct {
+	URL string
+}
+
+func (s *TCMBRateSource) Name() string {
+	return "tcmb"
+}
+
+func (s *TCMBRateSource) TRYRates() (map[models.Currency]float64, error) {
+	type TCMBResponse struct {
+		Currencies []struct {
+			Code         string `xml:"CurrencyCode,attr"`
+			Unit         string `xml:"Unit"`
+			ForexSelling string `xml:"ForexSelling"`
+		} `xml:"Currency"`
+	}
+
+	resp, err := req2.C().R().Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("tcmb rate request failed with status %d", resp.StatusCode)
+	}
+	tcmbRes := TCMBResponse{}
+	if err := xml.Unmarshal(resp.Bytes(), &tcmbRes); err != nil {
+		return nil, err
+	}
+
+	rates := map[models.Currency]float64{models.CurrencyTRY: 1}
+	for _, item := range tcmbRes.Currencies {
+		currency, ok := models.ParseCurrency(item.Code)
+		if !ok {
+			continue
+		}
+		rate, err := strconv.ParseFloat(item.ForexSelling, 64)
+		if err != nil || rate <= 0 {
+			continue
+		}
+		unit, err := strconv.ParseFloat(item.Unit, 64)
+		if err != nil || unit <= 0 {
+			unit = 1
+		}
+		rates[currency] = rate / unit
+	}
+	return rates, nil
+}
+
+// GetExchangeRate returns the value of one unit of "from" in "to" currency.
+func GetExchangeRate(source RateSource, from, to models.Currency) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	rates, err := source.TRYRates()
+	if err != nil {
+		return 0, err
+	}
+	fromRate, ok := rates[from]
+	if !ok {
+		return 0, errors.New("exchange rate not found for " + string(from))
+	}
+	toRate, ok := rates[to]
+	if !ok {
+		return 0, errors.New("exchange rate not found for " + string(to))
+	}
+	return fromRate / toRate, nil
+}
+
+// ConvertPrice converts the given price with the given rate, rounded to 2 decimals.
+func ConvertPrice(price, rate float64) float64 {
+	return math.Round(price*rate*100) / 100
+}
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"ekira-backend/platform/storage"
+	"encoding/hex"
 	"fmt"
 	"github.com/google/uuid"
 	exifremove "github.com/scottleedavis/go-exif-remove"
@@ -10,10 +14,59 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+// Storage key prefixes of the uploaded images.
+const (
+	RentalHouseImagePrefix  = "photos/rental-house"
+	ProfileImagePrefix      = "photos/profile"
+	MessageImagePrefix      = "photos/message"
+	RentalHouseUploadPrefix = "uploads/rental-house" // raw uploads in the upload storage
+	MessageUploadPrefix     = "uploads/message"
+)
+
+// RemoveImageFiles removes the files of the image urls under the prefix of the storage, the missing files are ignored.
+func RemoveImageFiles(store storage.Storage, prefix string, urls ...string) error {
+	for _, url := range urls {
+		if i := strings.Index(url, "?"); i >= 0 {
+			url = url[:i]
+		}
+		filename := path.Base(url)
+		if filename == "." || filename == "/" {
+			continue
+		}
+		err := store.Delete(ImageKey(prefix, filename))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImageKey returns the storage key of the image file, e.g. "photos/profile/image.jpg".
+func ImageKey(prefix string, filename string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + filename
+}
+
+// putImage writes the current image of the wand to the storage and returns its size.
+func putImage(mw *imagick.MagickWand, store storage.Storage, key string, contentType string) (int64, error) {
+	blob := mw.GetImageBlob()
+	if len(blob) == 0 {
+		return 0, mw.GetLastError()
+	}
+	err := store.Put(key, bytes.NewReader(blob), int64(len(blob)), contentType)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(blob)), nil
+}
+
 func GetFileContentType(out multipart.File) (string, error) {
 	buffer := make([]byte, 512)
 	_, err := out.Read(buffer)
@@ -24,40 +77,42 @@ func GetFileContentType(out multipart.File) (string, error) {
 	return contentType, nil
 }
 
-func ValidImageContentType(contentType string) bool {
-	switch contentType {
-	case "image/bmp", "image/jpeg", "image/gif", "image/png", "image/webp", "image/heif", "image/heic":
-		return true
-	}
-	return false
+var imageMagickOnce sync.Once
+
+// InitImageMagick initializes ImageMagick once for the process, it is shared by the concurrent image operations.
+// The pixel area and the memory of an image are limited, the larger images fail instead of exhausting the server.
+func InitImageMagick() {
+	imageMagickOnce.Do(func() {
+		imagick.Initialize()
+		mw := imagick.NewMagickWand()
+		defer mw.Destroy()
+		mw.SetResourceLimit(imagick.RESOURCE_AREA, 128_000_000)
+		mw.SetResourceLimit(imagick.RESOURCE_MEMORY, 512*1024*1024)
+	})
 }
 
 type CreatedImage struct {
 	ID            uuid.UUID
 	Filename      string
+	Key           string // key of the file in the storage
 	Width, Height uint
 	Original      bool
 	Size          int64
+	URL           string // public url of the file in the storage
+	Format        string // jpeg, webp or avif
+	Blurhash      string // placeholder of the image, same for all sizes
+	Checksum      string // sha256 of the uploaded image without exif data
+	PHash         *int64 // difference hash of the image, nil if it can not be calculated
 }
 
-func CreateImageFile(fh *multipart.FileHeader, directory string) ([]CreatedImage, error) {
-	// Fix directory path.
-	if strings.HasSuffix(directory, "/") {
-		directory = directory[:len(directory)-1]
-	}
+// CreateImageFile creates the variants of the rental house image from the raw upload, the file names start with the image id.
+func CreateImageFile(source io.Reader, imageId uuid.UUID, store storage.Storage, prefix string) ([]CreatedImage, error) {
 	// Initialize imagick.
 	var result []CreatedImage
-	imagick.Initialize()
-	defer imagick.Terminate()
+	InitImageMagick()
 	mw := imagick.NewMagickWand()
 	defer mw.Destroy()
 
-	// Open form file.
-	multipartFile, err := fh.Open()
-	if err != nil {
-		return result, err
-	}
-
 	// Create temporary folder.
 	os.Mkdir("temp-images", 0755)
 
@@ -66,111 +121,201 @@ func CreateImageFile(fh *multipart.FileHeader, directory string) ([]CreatedImage
 	if pathError != nil {
 		return result, pathError
 	}
-	_, copyError := io.Copy(out, multipartFile)
+	filename1 := out.Name()
+	defer os.Remove(filename1)
+	_, copyError := io.Copy(out, source)
+	out.Close()
 	if copyError != nil {
 		return result, copyError
 	}
-	multipartFile.Close()
-	filename1 := out.Name()
-	out.Close()
-	defer os.Remove(filename1)
 
-	// Remove exif data from image.
+	// Checksum of the image without exif data, the same photo with other metadata is a duplicate.
 	f1, _ := os.ReadFile(filename1)
+	checksumBytes := f1
 	noExifBytes, err := exifremove.Remove(f1)
 	if err == nil {
-		ioutil.WriteFile(filename1, noExifBytes, 0644)
+		checksumBytes = noExifBytes
 	}
+	sum := sha256.Sum256(checksumBytes)
+	checksum := hex.EncodeToString(sum[:])
 
-	// Read image from temporary file.
+	// Read image from temporary file, the orientation is applied before the metadata is removed.
 	err = mw.ReadImage(filename1)
 	if err != nil {
 		return result, err
 	}
 	mw.SetIteratorIndex(0) // This being the page offset
-	err = mw.SetImageFormat("jpg")
+	err = mw.AutoOrientImage()
+	if err != nil {
+		return result, err
+	}
+	err = mw.StripImage()
 	if err != nil {
 		return result, err
 	}
 
-	// Original Image Compression
-	imageId := uuid.New()
 	originalWidth := mw.GetImageWidth()
 	originalHeight := mw.GetImageHeight()
-	filename := fmt.Sprintf("%s-%dx%d.jpg", imageId.String(), originalWidth, originalHeight)
-	err = mw.WriteImage(fmt.Sprintf("%s/%s", directory, filename))
-	if err != nil {
-		return result, err
+	blurhash := imageBlurhash(mw)
+	var perceptualHash *int64
+	if hash, err := ImageDHash(mw); err == nil {
+		value := int64(hash)
+		perceptualHash = &value
 	}
-	originalFile, err := os.Open(fmt.Sprintf("%s/%s", directory, filename))
-	if err != nil {
-		return result, err
+
+	// Variants from the largest to the smallest, the original size is the first.
+	widths := []uint{originalWidth}
+	variantWidths := ImageVariantWidths()
+	for i := len(variantWidths) - 1; i >= 0; i-- {
+		if variantWidths[i] < originalWidth {
+			widths = append(widths, variantWidths[i])
+		}
 	}
-	defer originalFile.Close()
-	originalFileStat, _ := originalFile.Stat()
-	result = append(result, CreatedImage{
-		ID:       imageId,
-		Filename: filename,
-		Width:    originalWidth,
-		Height:   originalHeight,
-		Original: true,
-		Size:     originalFileStat.Size(),
-	})
+	formats := ImageVariantFormats(mw)
+
+	for _, width := range widths {
+		vw := mw.Clone()
+		if width != originalWidth {
+			height := uint(float64(originalHeight) * float64(width) / float64(originalWidth))
+			if height == 0 {
+				height = 1
+			}
+			err = vw.ResizeImage(width, height, imagick.FILTER_LANCZOS)
+		}
+		for _, format := range formats {
+			if err != nil {
+				break
+			}
+			err = vw.SetImageFormat(format)
+			if err != nil {
+				break
+			}
+			err = vw.SetImageCompressionQuality(imageQuality())
+			if err != nil {
+				break
+			}
+			filename := fmt.Sprintf("%s-%dx%d.%s", imageId.String(), vw.GetImageWidth(), vw.GetImageHeight(), imageExtension(format))
+			var size int64
+			size, err = putImage(vw, store, ImageKey(prefix, filename), "image/"+format)
+			if err != nil {
+				break
+			}
+			result = append(result, CreatedImage{
+				ID:       imageId,
+				Filename: filename,
+				Key:      ImageKey(prefix, filename),
+				URL:      store.URL(ImageKey(prefix, filename)),
+				Width:    vw.GetImageWidth(),
+				Height:   vw.GetImageHeight(),
+				Original: width == originalWidth,
+				Size:     size,
+				Format:   format,
+				Blurhash: blurhash,
+				Checksum: checksum,
+				PHash:    perceptualHash,
+			})
+		}
+		vw.Destroy()
+		if err != nil {
+			// Remove the created variants.
+			for _, image := range result {
+				store.Delete(image.Key)
+			}
+			return nil, err
+		}
+	}
+	return result, nil
+}
 
-	// Create thumbnail.
-	targetWidth := uint(512)
-	targetHeight := uint(512)
+// ImageVariantWidths returns the widths of the rental house image variants from IMAGE_VARIANT_WIDTHS (comma separated), 320, 640 and 1280 by default.
+// The original size is always kept, the widths which are not smaller than the original are skipped.
+func ImageVariantWidths() []uint {
+	var widths []uint
+	for _, value := range strings.Split(os.Getenv("IMAGE_VARIANT_WIDTHS"), ",") {
+		width, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err == nil && width > 0 {
+			widths = append(widths, uint(width))
+		}
+	}
+	if len(widths) == 0 {
+		widths = []uint{320, 640, 1280}
+	}
+	sort.Slice(widths, func(i, j int) bool { return widths[i] < widths[j] })
+	return widths
+}
 
-	// Check width and height.
-	if originalWidth > targetWidth && originalHeight > targetHeight {
-		if originalWidth >= originalHeight {
-			rate := float64(originalWidth) / float64(targetWidth)
-			targetHeight = uint(float64(originalHeight) / rate)
-		} else {
-			rate := float64(originalHeight) / float64(targetHeight)
-			targetWidth = uint(float64(originalWidth) / rate)
+// ImageVariantFormats returns the formats of the rental house image variants from IMAGE_VARIANT_FORMATS (comma separated, jpeg, webp or avif), webp by default.
+// jpeg is always the first as the fallback, the formats which ImageMagick can not write are skipped.
+func ImageVariantFormats(mw *imagick.MagickWand) []string {
+	value := os.Getenv("IMAGE_VARIANT_FORMATS")
+	if value == "" {
+		value = "webp"
+	}
+	formats := []string{"jpeg"}
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format != "webp" && format != "avif" {
+			continue
+		}
+		if len(mw.QueryFormats(strings.ToUpper(format))) == 0 {
+			continue
 		}
+		formats = append(formats, format)
 	}
-	err = mw.ThumbnailImage(targetWidth, targetHeight)
-	if err != nil {
-		os.Remove(result[0].Filename)
-		return result, err
+	return formats
+}
+
+// imageQuality returns IMAGE_QUALITY, 82 by default.
+func imageQuality() uint {
+	quality, err := strconv.ParseUint(os.Getenv("IMAGE_QUALITY"), 10, 32)
+	if err != nil || quality == 0 || quality > 100 {
+		return 82
 	}
-	thumbnailWidth := mw.GetImageWidth()
-	thumbnailHeight := mw.GetImageHeight()
-	filename = fmt.Sprintf("%s-%dx%d.jpg", imageId.String(), thumbnailWidth, thumbnailHeight)
-	err = mw.WriteImage(fmt.Sprintf("%s/%s", directory, filename))
+	return uint(quality)
+}
+
+func imageExtension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+// imageBlurhash returns the blurhash placeholder of the image, empty if it can not be calculated.
+func imageBlurhash(mw *imagick.MagickWand) string {
+	width, height := uint(32), uint(32)
+	if mw.GetImageWidth() >= mw.GetImageHeight() {
+		height = uint(float64(mw.GetImageHeight()) * 32 / float64(mw.GetImageWidth()))
+	} else {
+		width = uint(float64(mw.GetImageWidth()) * 32 / float64(mw.GetImageHeight()))
+	}
+	if width == 0 || height == 0 {
+		return ""
+	}
+	small := mw.Clone()
+	defer small.Destroy()
+	if err := small.ResizeImage(width, height, imagick.FILTER_BOX); err != nil {
+		return ""
+	}
+	pixels, err := small.ExportImagePixels(0, 0, width, height, "RGB", imagick.PIXEL_CHAR)
 	if err != nil {
-		os.Remove(result[0].Filename)
-		return result, err
+		return ""
 	}
-	thumbnailFile, err := os.Open(fmt.Sprintf("%s/%s", directory, filename))
+	rgb, ok := pixels.([]byte)
+	if !ok {
+		return ""
+	}
+	hash, err := EncodeBlurhash(4, 3, int(width), int(height), rgb)
 	if err != nil {
-		os.Remove(result[0].Filename)
-		return result, err
+		return ""
 	}
-	defer thumbnailFile.Close()
-	thumbnailFileStat, _ := thumbnailFile.Stat()
-	result = append(result, CreatedImage{
-		ID:       imageId,
-		Filename: filename,
-		Width:    thumbnailWidth,
-		Height:   thumbnailHeight,
-		Original: false,
-		Size:     thumbnailFileStat.Size(),
-	})
-	return result, nil
+	return hash
 }
 
-func CreateProfileImageFile(fh *multipart.FileHeader, directory string) ([]CreatedImage, error) {
-	// Fix directory path.
-	if strings.HasSuffix(directory, "/") {
-		directory = directory[:len(directory)-1]
-	}
+func CreateProfileImageFile(fh *multipart.FileHeader, store storage.Storage, prefix string) ([]CreatedImage, error) {
 	// Initialize imagick.
 	var result []CreatedImage
-	imagick.Initialize()
-	defer imagick.Terminate()
+	InitImageMagick()
 	mw := imagick.NewMagickWand()
 	defer mw.Destroy()
 
@@ -198,14 +343,7 @@ func CreateProfileImageFile(fh *multipart.FileHeader, directory string) ([]Creat
 	out.Close()
 	defer os.Remove(filename1)
 
-	// Remove exif data from image.
-	f1, _ := os.ReadFile(filename1)
-	noExifBytes, err := exifremove.Remove(f1)
-	if err == nil {
-		ioutil.WriteFile(filename1, noExifBytes, 0644)
-	}
-
-	// Read image from temporary file.
+	// Read image from temporary file, the orientation is applied before the metadata is removed.
 	err = mw.ReadImage(filename1)
 	if err != nil {
 		return result, err
@@ -214,6 +352,14 @@ func CreateProfileImageFile(fh *multipart.FileHeader, directory string) ([]Creat
 	if strings.ToLower(mw.GetImageFormat()) == "gif" {
 		mw = mw.CoalesceImages()
 	}
+	err = mw.AutoOrientImage()
+	if err != nil {
+		return result, err
+	}
+	err = mw.StripImage()
+	if err != nil {
+		return result, err
+	}
 	err = mw.SetImageFormat("jpg")
 	if err != nil {
 		return result, err
@@ -224,7 +370,8 @@ func CreateProfileImageFile(fh *multipart.FileHeader, directory string) ([]Creat
 	originalWidth := mw.GetImageWidth()
 	originalHeight := mw.GetImageHeight()
 	filename := fmt.Sprintf("%s-%dx%d.jpg", imageId.String(), originalWidth, originalHeight)
-	err = mw.WriteImage(fmt.Sprintf("%s/%s", directory, filename))
+	originalKey := ImageKey(prefix, filename)
+	_, err = putImage(mw, store, originalKey, "image/jpeg")
 	if err != nil {
 		return result, err
 	}
@@ -245,31 +392,26 @@ func CreateProfileImageFile(fh *multipart.FileHeader, directory string) ([]Creat
 	}
 	err = mw.ThumbnailImage(targetWidth, targetHeight)
 	if err != nil {
-		os.Remove(result[0].Filename)
+		store.Delete(originalKey)
 		return result, err
 	}
 	thumbnailWidth := mw.GetImageWidth()
 	thumbnailHeight := mw.GetImageHeight()
 	filename = fmt.Sprintf("%s-%dx%d.jpg", imageId.String(), thumbnailWidth, thumbnailHeight)
-	err = mw.WriteImage(fmt.Sprintf("%s/%s", directory, filename))
-	if err != nil {
-		os.Remove(result[0].Filename)
-		return result, err
-	}
-	thumbnailFile, err := os.Open(fmt.Sprintf("%s/%s", directory, filename))
+	thumbnailSize, err := putImage(mw, store, ImageKey(prefix, filename), "image/jpeg")
 	if err != nil {
-		os.Remove(result[0].Filename)
+		store.Delete(originalKey)
 		return result, err
 	}
-	defer thumbnailFile.Close()
-	thumbnailFileStat, _ := thumbnailFile.Stat()
 	result = append(result, CreatedImage{
 		ID:       imageId,
 		Filename: filename,
+		Key:      ImageKey(prefix, filename),
+		URL:      store.URL(ImageKey(prefix, filename)),
 		Width:    thumbnailWidth,
 		Height:   thumbnailHeight,
 		Original: false,
-		Size:     thumbnailFileStat.Size(),
+		Size:     thumbnailSize,
 	})
 
 	// Create 200x200~ image.
@@ -288,31 +430,26 @@ func CreateProfileImageFile(fh *multipart.FileHeader, directory string) ([]Creat
 	}
 	err = mw.ThumbnailImage(targetWidth2, targetHeight2)
 	if err != nil {
-		os.Remove(result[0].Filename)
+		store.Delete(originalKey)
 		return result, err
 	}
 	thumbnailWidth2 := mw.GetImageWidth()
 	thumbnailHeight2 := mw.GetImageHeight()
 	filename = fmt.Sprintf("%s-%dx%d.jpg", imageId.String(), thumbnailWidth2, thumbnailHeight2)
-	err = mw.WriteImage(fmt.Sprintf("%s/%s", directory, filename))
-	if err != nil {
-		os.Remove(result[0].Filename)
-		return result, err
-	}
-	thumbnailFile2, err := os.Open(fmt.Sprintf("%s/%s", directory, filename))
+	thumbnailSize2, err := putImage(mw, store, ImageKey(prefix, filename), "image/jpeg")
 	if err != nil {
-		os.Remove(result[0].Filename)
+		store.Delete(originalKey)
 		return result, err
 	}
-	defer thumbnailFile2.Close()
-	thumbnailFileStat2, _ := thumbnailFile2.Stat()
 	result = append(result, CreatedImage{
 		ID:       imageId,
 		Filename: filename,
+		Key:      ImageKey(prefix, filename),
+		URL:      store.URL(ImageKey(prefix, filename)),
 		Width:    thumbnailWidth2,
 		Height:   thumbnailHeight2,
 		Original: false,
-		Size:     thumbnailFileStat2.Size(),
+		Size:     thumbnailSize2,
 	})
 	return result, nil
 }
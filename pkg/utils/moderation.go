@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"ekira-backend/app/models"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// defaultBannedWords are always checked, more words can be added with MODERATION_BANNED_WORDS (comma separated).
+var defaultBannedWords = []string{"western union", "moneygram", "bitcoin", "kripto para"}
+
+var phoneCandidate = regexp.MustCompile(`\+?\d[\d\s\-.()/]{8,}\d`)
+
+var emailCandidate = regexp.MustCompile(`[\p{L}\p{N}._%+\-]+@[\p{L}\p{N}\-]+(\.[\p{L}\p{N}\-]+)*\.\p{L}{2,}`)
+
+// ContactMask replaces the hidden contact information.
+const ContactMask = "[iletişim bilgisi gizlendi]"
+
+// ListingCheck is the result of the automatic listing checks, Reasons are shown to the owner.
+type ListingCheck struct {
+	Flags   []string
+	Reasons []string
+}
+
+func (l *ListingCheck) add(flag string, reason string) {
+	for _, f := range l.Flags {
+		if f == flag {
+			return
+		}
+	}
+	l.Flags = append(l.Flags, flag)
+	l.Reasons = append(l.Reasons, reason)
+}
+
+// BannedWords returns the banned words of the listings in lower case.
+func BannedWords() []string {
+	words := append([]string{}, defaultBannedWords...)
+	for _, word := range strings.Split(os.Getenv("MODERATION_BANNED_WORDS"), ",") {
+		word = strings.ToLowerSpecial(unicode.TurkishCase, strings.TrimSpace(word))
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// FindBannedWord returns the first banned word in the text, matched as a whole word.
+func FindBannedWord(text string) (string, bool) {
+	text = strings.ToLowerSpecial(unicode.TurkishCase, text)
+	for _, word := range BannedWords() {
+		re, err := regexp.Compile(`(^|[^\p{L}\p{N}])` + regexp.QuoteMeta(word) + `($|[^\p{L}\p{N}])`)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(text) {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+// ContainsPhoneNumber returns true if the text has a turkish mobile or landline number, e.g. "0532 123 45 67" or "+90 (212) 123-45-67".
+func ContainsPhoneNumber(text string) bool {
+	for _, candidate := range phoneCandidate.FindAllString(text, -1) {
+		if isPhoneNumber(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPhoneNumber returns true if the digits of the candidate are a turkish phone number.
+func isPhoneNumber(candidate string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, candidate)
+	digits = strings.TrimPrefix(digits, "90")
+	digits = strings.TrimPrefix(digits, "0")
+	return len(digits) == 10 && strings.ContainsRune("2345", rune(digits[0]))
+}
+
+// MaskContactInfo replaces the phone numbers and the e-mail addresses in the text with ContactMask.
+func MaskContactInfo(text string) string {
+	text = phoneCandidate.ReplaceAllStringFunc(text, func(candidate string) string {
+		if isPhoneNumber(candidate) {
+			return ContactMask
+		}
+		return candidate
+	})
+	return emailCandidate.ReplaceAllString(text, ContactMask)
+}
+
+// CheckListingText runs the automatic checks on the title and the description of a listing.
+func CheckListingText(title string, description string) ListingCheck {
+	check := ListingCheck{}
+	for _, text := range []string{title, description} {
+		if word, ok := FindBannedWord(text); ok {
+			check.add(models.ModerationFlagBannedWord, "İlan yasaklı bir ifade içeriyor: \""+word+"\"")
+		}
+		if ContainsPhoneNumber(text) {
+			check.add(models.ModerationFlagPhoneNumber, "İlan metninde telefon numarası paylaşılamaz")
+		}
+	}
+	return check
+}
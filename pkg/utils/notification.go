@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bytes"
+	"ekira-backend/app/models"
+	"errors"
+	"strconv"
+	"text/template"
+)
+
+// notificationTemplate is the message of a notification type in a language, SMS is the short message without a subject
+// which is also the text of the push notification.
+type notificationTemplate struct {
+	Subject string
+	Email   string
+	SMS     string
+}
+
+// notificationTemplates are the messages of the notification types in Turkish (tr) and English (en).
+var notificationTemplates = map[models.NotificationType]map[string]notificationTemplate{
+	models.NOTIFICATION_TYPE_RESERVATION_CREATED: {
+		"tr": {
+			Subject: "Rezervasyonunuz oluşturuldu: {{.title}}",
+			Email:   "Merhaba {{.renter}},\n\n{{.title}} için {{.start_date}} - {{.end_date}} tarihli rezervasyonunuz oluşturuldu. Rezervasyonun geçerli olması için {{.expire}} tarihine kadar {{.amount}} {{.currency}} ödeme yapmanız gerekmektedir.\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} rezervasyonunuz oluşturuldu. {{.expire}} tarihine kadar {{.amount}} {{.currency}} ödeme yapmanız gerekmektedir.",
+		},
+		"en": {
+			Subject: "Your reservation is created: {{.title}}",
+			Email:   "Hello {{.renter}},\n\nYour reservation of {{.title}} for {{.start_date}} - {{.end_date}} is created. Please pay {{.amount}} {{.currency}} until {{.expire}} to keep the reservation.\n\nE-Kira",
+			SMS:     "E-Kira: Your reservation of {{.title}} is created. Please pay {{.amount}} {{.currency}} until {{.expire}}.",
+		},
+	},
+	models.NOTIFICATION_TYPE_RESERVATION_PAID: {
+		"tr": {
+			Subject: "Onayınızı bekleyen bir rezervasyon var: {{.title}}",
+			Email:   "Merhaba,\n\n{{.renter}}, {{.title}} için {{.start_date}} - {{.end_date}} tarihli rezervasyonun ödemesini yaptı. Rezervasyonu uygulamadan onaylayabilirsiniz.\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} için {{.start_date}} - {{.end_date}} tarihli ödenmiş bir rezervasyon onayınızı bekliyor.",
+		},
+		"en": {
+			Subject: "A reservation is waiting for your approval: {{.title}}",
+			Email:   "Hello,\n\n{{.renter}} paid the reservation of {{.title}} for {{.start_date}} - {{.end_date}}. You can accept the reservation in the app.\n\nE-Kira",
+			SMS:     "E-Kira: A paid reservation of {{.title}} for {{.start_date}} - {{.end_date}} is waiting for your approval.",
+		},
+	},
+	models.NOTIFICATION_TYPE_RESERVATION_ACCEPTED: {
+		"tr": {
+			Subject: "Rezervasyonunuz onaylandı: {{.title}}",
+			Email:   "Merhaba {{.renter}},\n\n{{.title}} için {{.start_date}} - {{.end_date}} tarihli rezervasyonunuz ev sahibi tarafından onaylandı.\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} için {{.start_date}} - {{.end_date}} tarihli rezervasyonunuz onaylandı.",
+		},
+		"en": {
+			Subject: "Your reservation is accepted: {{.title}}",
+			Email:   "Hello {{.renter}},\n\nYour reservation of {{.title}} for {{.start_date}} - {{.end_date}} is accepted by the owner.\n\nE-Kira",
+			SMS:     "E-Kira: Your reservation of {{.title}} for {{.start_date}} - {{.end_date}} is accepted.",
+		},
+	},
+	models.NOTIFICATION_TYPE_RESERVATION_CANCELLED: {
+		"tr": {
+			Subject: "Rezervasyon iptal edildi: {{.title}}",
+			Email:   "Merhaba,\n\n{{.title}} için {{.start_date}} - {{.end_date}} tarihli rezervasyon iptal edildi.{{if .refunded}} Ödeme iade edilecektir.{{end}}\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} için {{.start_date}} - {{.end_date}} tarihli rezervasyon iptal edildi.{{if .refunded}} Ödeme iade edilecektir.{{end}}",
+		},
+		"en": {
+			Subject: "Reservation is cancelled: {{.title}}",
+			Email:   "Hello,\n\nThe reservation of {{.title}} for {{.start_date}} - {{.end_date}} is cancelled.{{if .refunded}} The payment will be refunded.{{end}}\n\nE-Kira",
+			SMS:     "E-Kira: The reservation of {{.title}} for {{.start_date}} - {{.end_date}} is cancelled.{{if .refunded}} The payment will be refunded.{{end}}",
+		},
+	},
+	models.NOTIFICATION_TYPE_PAYMENT_DUE: {
+		"tr": {
+			Subject: "Ödeme hatırlatması: {{.title}}",
+			Email:   "Merhaba {{.renter}},\n\n{{.title}} için {{.payment_start}} - {{.payment_end}} dönemine ait {{.amount}} {{.currency}} tutarındaki ödemenizin son günü {{.expire}}.\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} için {{.amount}} {{.currency}} tutarındaki ödemenizin son günü {{.expire}}.",
+		},
+		"en": {
+			Subject: "Payment reminder: {{.title}}",
+			Email:   "Hello {{.renter}},\n\nThe payment of {{.amount}} {{.currency}} for {{.title}} for {{.payment_start}} - {{.payment_end}} is due on {{.expire}}.\n\nE-Kira",
+			SMS:     "E-Kira: The payment of {{.amount}} {{.currency}} for {{.title}} is due on {{.expire}}.",
+		},
+	},
+	models.NOTIFICATION_TYPE_PAYMENT_RECEIVED: {
+		"tr": {
+			Subject: "Ödemeniz alındı: {{.title}}",
+			Email:   "Merhaba {{.renter}},\n\n{{.title}} için {{.payment_start}} - {{.payment_end}} dönemine ait {{.amount}} {{.currency}} tutarındaki ödemeniz alındı.\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} için {{.amount}} {{.currency}} tutarındaki ödemeniz alındı.",
+		},
+		"en": {
+			Subject: "Your payment is received: {{.title}}",
+			Email:   "Hello {{.renter}},\n\nYour payment of {{.amount}} {{.currency}} for {{.title}} for {{.payment_start}} - {{.payment_end}} is received.\n\nE-Kira",
+			SMS:     "E-Kira: Your payment of {{.amount}} {{.currency}} for {{.title}} is received.",
+		},
+	},
+	models.NOTIFICATION_TYPE_PAYMENT_FAILED: {
+		"tr": {
+			Subject: "Ödemeniz başarısız oldu: {{.title}}",
+			Email:   "Merhaba {{.renter}},\n\n{{.title}} için {{.amount}} {{.currency}} tutarındaki ödemeniz gerçekleştirilemedi. {{.expire}} tarihine kadar ödemeyi tekrar deneyebilirsiniz.\n\nE-Kira",
+			SMS:     "E-Kira: {{.title}} için {{.amount}} {{.currency}} tutarındaki ödemeniz gerçekleştirilemedi. {{.expire}} tarihine kadar tekrar deneyebilirsiniz.",
+		},
+		"en": {
+			Subject: "Your payment failed: {{.title}}",
+			Email:   "Hello {{.renter}},\n\nYour payment of {{.amount}} {{.currency}} for {{.title}} could not be completed. You can try again until {{.expire}}.\n\nE-Kira",
+			SMS:     "E-Kira: Your payment of {{.amount}} {{.currency}} for {{.title}} could not be completed. You can try again until {{.expire}}.",
+		},
+	},
+	models.NOTIFICATION_TYPE_SAVED_SEARCH_ALERT: {
+		"tr": {
+			Subject: "\"{{.name}}\" aramanıza uyan {{.count}} ilan var",
+			Email:   "Merhaba,\n\n\"{{.name}}\" aramanıza uyan yeni veya fiyatı düşen ilanlar:\n\n{{.listings}}{{if .more}}\nve {{.more}} ilan daha.{{end}}\n\nBu aramanın bildirimlerini durdurmak için: {{.unsubscribe_url}}\n\nE-Kira",
+			SMS:     "E-Kira: \"{{.name}}\" aramanıza uyan {{.count}} yeni veya fiyatı düşen ilan var.",
+		},
+		"en": {
+			Subject: "{{.count}} listings match your search \"{{.name}}\"",
+			Email:   "Hello,\n\nThe new or cheaper listings matching your search \"{{.name}}\":\n\n{{.listings}}{{if .more}}\nand {{.more}} more listings.{{end}}\n\nTo stop the alerts of this search: {{.unsubscribe_url}}\n\nE-Kira",
+			SMS:     "E-Kira: {{.count}} new or cheaper listings match your search \"{{.name}}\".",
+		},
+	},
+}
+
+// RenderNotification returns the subject and the message of the notification for the channel in the language, Turkish is the default.
+func RenderNotification(notificationType models.NotificationType, channel models.NotificationChannel, language string, data models.NotificationData) (string, string, error) {
+	templates, ok := notificationTemplates[notificationType]
+	if !ok {
+		return "", "", errors.New("no template for notification type " + strconv.Itoa(int(notificationType)))
+	}
+	message, ok := templates[language]
+	if !ok {
+		message = templates["tr"]
+	}
+
+	subject, err := renderNotificationText(message.Subject, data)
+	if err != nil {
+		return "", "", err
+	}
+	body := message.Email
+	if channel == models.NOTIFICATION_CHANNEL_SMS || channel == models.NOTIFICATION_CHANNEL_PUSH {
+		body = message.SMS
+	}
+	body, err = renderNotificationText(body, data)
+	if err != nil {
+		return "", "", err
+	}
+	return subject, body, nil
+}
+
+func renderNotificationText(text string, data models.NotificationData) (string, error) {
+	tmpl, err := template.New("notification").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, map[string]string(data)); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// ReservationNotificationData returns the template values of the reservation notifications, the rental house of the reservation must be loaded.
+func ReservationNotificationData(reservation *models.Reservation) models.NotificationData {
+	return models.NotificationData{
+		"title":      reservation.RentalHouse.Title,
+		"renter":     reservation.FullName,
+		"start_date": reservation.StartDate.Format("02/01/2006"),
+		"end_date":   reservation.EndDate.Format("02/01/2006"),
+	}
+}
+
+// PaymentNotificationData returns the template values of the payment notifications of the reservation.
+func PaymentNotificationData(payment *models.Payment, reservation *models.Reservation) models.NotificationData {
+	data := ReservationNotificationData(reservation)
+	data["payment_start"] = payment.StartDate.Format("02/01/2006")
+	data["payment_end"] = payment.EndDate.Format("02/01/2006")
+	data["amount"] = strconv.FormatFloat(payment.Amount, 'f', 2, 64)
+	data["currency"] = string(payment.Currency)
+	data["expire"] = payment.Expire.Format("02/01/2006 15:04")
+	return data
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"errors"
+	"gopkg.in/gographics/imagick.v3/imagick"
+	"io"
+	"math/bits"
+	"os"
+	"strconv"
+)
+
+// ImageDHash returns the difference hash of the image, the hashes of the similar images have a small hamming distance.
+// Resizing, recompression and small color changes keep the hash nearly the same.
+func ImageDHash(mw *imagick.MagickWand) (uint64, error) {
+	small := mw.Clone()
+	defer small.Destroy()
+	if err := small.ResizeImage(9, 8, imagick.FILTER_BOX); err != nil {
+		return 0, err
+	}
+	pixels, err := small.ExportImagePixels(0, 0, 9, 8, "I", imagick.PIXEL_CHAR)
+	if err != nil {
+		return 0, err
+	}
+	gray, ok := pixels.([]byte)
+	if !ok || len(gray) < 72 {
+		return 0, errors.New("image pixels cannot be read")
+	}
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y*9+x] < gray[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// HammingDistance returns the number of the different bits of the hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// ImageSimilarityDistance returns the largest hamming distance of the similar images from IMAGE_SIMILARITY_DISTANCE, 6 by default.
+// It is at most 7, the hashes are searched by their 8 bit bands and two hashes within 7 bits share at least one band.
+func ImageSimilarityDistance() int {
+	distance, err := strconv.Atoi(os.Getenv("IMAGE_SIMILARITY_DISTANCE"))
+	if err != nil || distance < 0 || distance > 7 {
+		return 6
+	}
+	return distance
+}
+
+// ReadImageDHash returns the difference hash of the image file as it is stored in the perceptual_hash column.
+func ReadImageDHash(file io.Reader) (int64, error) {
+	InitImageMagick()
+	blob, err := io.ReadAll(file)
+	if err != nil {
+		return 0, err
+	}
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+	if err := mw.ReadImageBlob(blob); err != nil {
+		return 0, err
+	}
+	hash, err := ImageDHash(mw)
+	return int64(hash), err
+}
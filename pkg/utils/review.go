@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// ReviewWindow returns the time after the end of a stay to review it from REVIEW_WINDOW_DAYS, 14 days by default.
+// The reviews which are not answered by the other side are published at the end of the window.
+func ReviewWindow() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("REVIEW_WINDOW_DAYS"))
+	if err != nil || days <= 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -6,20 +6,63 @@ import (
 	"github.com/stripe/stripe-go/v74"
 	"github.com/stripe/stripe-go/v74/charge"
 	"github.com/stripe/stripe-go/v74/customer"
+	"github.com/stripe/stripe-go/v74/dispute"
+	"github.com/stripe/stripe-go/v74/file"
 	"github.com/stripe/stripe-go/v74/paymentintent"
 	"github.com/stripe/stripe-go/v74/refund"
+	"io"
 	"math"
+	"time"
 )
 
 const STRIPE_COMMISION_PERCENTAGE = 2.9 // 2.9%
 const STRIPE_COMMISION_FIXED_TRY = 6.29 // 0.30 USD (Fixed) -> 6.29 TRY
+const STRIPE_COMMISION_FIXED_USD = 0.30 // 0.30 USD (Fixed)
+const STRIPE_COMMISION_FIXED_EUR = 0.25 // 0.25 EUR (Fixed)
+const STRIPE_MINIMUM_CHARGE_TRY = 10.0  // Minimum card charge amounts
+const STRIPE_MINIMUM_CHARGE_USD = 0.50
+const STRIPE_MINIMUM_CHARGE_EUR = 0.50
 
-func GetPriceWithCommission(price float64) float64 {
+func GetCommissionFixed(currency models.Currency) float64 {
+	switch currency {
+	case models.CurrencyUSD:
+		return STRIPE_COMMISION_FIXED_USD
+	case models.CurrencyEUR:
+		return STRIPE_COMMISION_FIXED_EUR
+	}
+	return STRIPE_COMMISION_FIXED_TRY
+}
+
+func GetMinimumChargeAmount(currency models.Currency) float64 {
+	switch currency {
+	case models.CurrencyUSD:
+		return STRIPE_MINIMUM_CHARGE_USD
+	case models.CurrencyEUR:
+		return STRIPE_MINIMUM_CHARGE_EUR
+	}
+	return STRIPE_MINIMUM_CHARGE_TRY
+}
+
+func GetPriceWithCommission(price float64, currency models.Currency) float64 {
 	// calculate net price + stripe commission
-	x := (price + STRIPE_COMMISION_FIXED_TRY) / (1 - (STRIPE_COMMISION_PERCENTAGE / 100))
+	x := (price + GetCommissionFixed(currency)) / (1 - (STRIPE_COMMISION_PERCENTAGE / 100))
 	return math.Round(x*100) / 100
 }
 
+// GetOwnerBalanceShare returns the amount given to the owner's balance for the payment, in default currency.
+func GetOwnerBalanceShare(payment *models.Payment) float64 {
+	balance := payment.Amount
+	if payment.Reservation.RentalHouse.CommisionType == models.CommisionTypeOwnerPays {
+		commision := GetPriceWithCommission(payment.AmountGross, payment.Currency) - payment.AmountGross
+		balance = payment.Amount - commision
+	}
+	// Platform funded discounts are paid to the owner by the platform.
+	if payment.Discount > 0 && payment.DiscountFunder == models.CouponFundedByPlatform {
+		balance += payment.Discount
+	}
+	return payment.ToDefaultCurrency(balance)
+}
+
 func GetReceiptURL(chargeID string) (string, error) {
 	chargeInfo, err := charge.Get(chargeID, nil)
 	if err != nil {
@@ -29,7 +72,9 @@ func GetReceiptURL(chargeID string) (string, error) {
 }
 
 func GetPaymentIntent(paymentIntentID string) (*stripe.PaymentIntent, error) {
-	pi, err := paymentintent.Get(paymentIntentID, nil)
+	params := &stripe.PaymentIntentParams{}
+	params.AddExpand("latest_charge")
+	pi, err := paymentintent.Get(paymentIntentID, params)
 	if err != nil {
 		return nil, err
 	}
@@ -68,12 +113,12 @@ func CreateCustomer(user models.User) (*stripe.Customer, error) {
 	}
 }
 
-func CreateAPaymentIntent(customer *stripe.Customer, description string, amount float64, currency string) (*stripe.PaymentIntent, error) {
+func CreateAPaymentIntent(customer *stripe.Customer, description string, amount float64, currency models.Currency) (*stripe.PaymentIntent, error) {
 	// Create a PaymentIntent with the order amount and currency
 	fmt.Println(customer)
 	params := &stripe.PaymentIntentParams{
 		Amount:   stripe.Int64(int64(amount * 100)),
-		Currency: stripe.String(currency),
+		Currency: stripe.String(currency.StripeCode()),
 		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
 		},
@@ -88,6 +133,36 @@ func CreateAPaymentIntent(customer *stripe.Customer, description string, amount
 	return pi, nil
 }
 
+// ListPaymentIntents returns the payment intents created in the given time range with their latest charges.
+func ListPaymentIntents(from, to time.Time) ([]*stripe.PaymentIntent, error) {
+	params := &stripe.PaymentIntentListParams{
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: from.Unix(),
+			LesserThan:         to.Unix(),
+		},
+	}
+	params.Limit = stripe.Int64(100)
+	params.AddExpand("data.latest_charge")
+
+	var paymentIntents []*stripe.PaymentIntent
+	i := paymentintent.List(params)
+	for i.Next() {
+		paymentIntents = append(paymentIntents, i.PaymentIntent())
+	}
+	if err := i.Err(); err != nil {
+		return nil, err
+	}
+	return paymentIntents, nil
+}
+
+func CancelPaymentIntent(paymentIntentID string) (*stripe.PaymentIntent, error) {
+	pi, err := paymentintent.Cancel(paymentIntentID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pi, nil
+}
+
 func RefundCharge(chargeID string) (*stripe.Refund, error) {
 	chargeInfo, err := charge.Get(chargeID, nil)
 	if err != nil {
@@ -102,3 +177,53 @@ func RefundCharge(chargeID string) (*stripe.Refund, error) {
 	}
 	return refundInfo, nil
 }
+
+// DISPUTE_EVIDENCE_FILE_KINDS are the form fields accepted as dispute evidence files.
+var DISPUTE_EVIDENCE_FILE_KINDS = []string{"receipt", "service_documentation", "customer_communication", "cancellation_policy", "refund_policy", "uncategorized_file"}
+
+func UploadDisputeEvidenceFile(filename string, r io.Reader) (*stripe.File, error) {
+	params := &stripe.FileParams{
+		FileReader: r,
+		Filename:   stripe.String(filename),
+		Purpose:    stripe.String(string(stripe.FilePurposeDisputeEvidence)),
+	}
+	f, err := file.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SubmitDisputeEvidence stages the evidence on the dispute, and submits it to the bank if submit is true.
+// files is a map of evidence file kind to the uploaded stripe file id.
+func SubmitDisputeEvidence(disputeID string, text string, files map[string]string, submit bool) (*stripe.Dispute, error) {
+	evidence := &stripe.DisputeEvidenceParams{}
+	if text != "" {
+		evidence.UncategorizedText = stripe.String(text)
+	}
+	for kind, fileID := range files {
+		switch kind {
+		case "receipt":
+			evidence.Receipt = stripe.String(fileID)
+		case "service_documentation":
+			evidence.ServiceDocumentation = stripe.String(fileID)
+		case "customer_communication":
+			evidence.CustomerCommunication = stripe.String(fileID)
+		case "cancellation_policy":
+			evidence.CancellationPolicy = stripe.String(fileID)
+		case "refund_policy":
+			evidence.RefundPolicy = stripe.String(fileID)
+		case "uncategorized_file":
+			evidence.UncategorizedFile = stripe.String(fileID)
+		}
+	}
+	params := &stripe.DisputeParams{
+		Evidence: evidence,
+		Submit:   stripe.Bool(submit),
+	}
+	d, err := dispute.Update(disputeID, params)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
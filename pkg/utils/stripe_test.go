@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"ekira-backend/app/models"
+	"testing"
+)
+
+func TestGetPriceWithCommission(t *testing.T) {
+	tests := []struct {
+		price    float64
+		currency models.Currency
+		want     float64
+	}{
+		{100, models.CurrencyTRY, 109.46},
+		{100, models.CurrencyUSD, 103.30},
+		{100, models.CurrencyEUR, 103.24},
+	}
+	for _, tt := range tests {
+		if got := GetPriceWithCommission(tt.price, tt.currency); got != tt.want {
+			t.Errorf("GetPriceWithCommission(%v, %s) = %v, want %v", tt.price, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestGetOwnerBalanceShare(t *testing.T) {
+	payment := func(commisionType models.CommisionType, currency models.Currency, rate float64) *models.Payment {
+		p := &models.Payment{Amount: 100, AmountGross: 100, Currency: currency, ExchangeRate: rate}
+		p.Reservation.RentalHouse.CommisionType = commisionType
+		return p
+	}
+
+	platformFunded := payment(models.CommisionTypeRenterPays, models.CurrencyTRY, 1)
+	platformFunded.Amount, platformFunded.Discount, platformFunded.DiscountFunder = 90, 10, models.CouponFundedByPlatform
+	ownerFunded := payment(models.CommisionTypeRenterPays, models.CurrencyTRY, 1)
+	ownerFunded.Amount, ownerFunded.Discount, ownerFunded.DiscountFunder = 90, 10, models.CouponFundedByOwner
+
+	tests := []struct {
+		name    string
+		payment *models.Payment
+		want    float64
+	}{
+		{"renter pays", payment(models.CommisionTypeRenterPays, models.CurrencyTRY, 1), 100},
+		{"owner pays", payment(models.CommisionTypeOwnerPays, models.CurrencyTRY, 1), 90.54},
+		{"converted to default currency", payment(models.CommisionTypeRenterPays, models.CurrencyEUR, 35.5), 3550},
+		{"platform funded discount", platformFunded, 100},
+		{"owner funded discount", ownerFunded, 90},
+	}
+	for _, tt := range tests {
+		if got := GetOwnerBalanceShare(tt.payment); got != tt.want {
+			t.Errorf("%s: GetOwnerBalanceShare() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
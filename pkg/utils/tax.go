@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"ekira-backend/app/models"
+	"math"
+)
+
+const TAX_KDV_GENERAL_PERCENTAGE = 20.0       // KDV for daily commercial rentals, included in price
+const TAX_KDV_ACCOMMODATION_PERCENTAGE = 10.0 // KDV for short-stay accommodation, included in price
+const TAX_ACCOMMODATION_PERCENTAGE = 2.0      // Konaklama vergisi, included in price
+const TAX_STOPAJ_PERCENTAGE = 20.0            // Withheld by corporate renters from gross rent (GVK 94/5-a)
+
+// RESIDENTIAL_INCOME_EXEMPTION is the yearly residential rental income exemption (GVK 21) in TRY.
+var RESIDENTIAL_INCOME_EXEMPTION = map[int]float64{
+	2023: 21000,
+	2024: 33000,
+	2025: 47000,
+}
+
+// RoundPrice rounds the price to 2 decimals.
+func RoundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
+
+// CalculateTaxes returns the tax lines of the rent, the owner's share is taxed as the rent and the platform commission
+// included in the price is taxed separately with the general KDV.
+// Daily short-stays include KDV and accommodation tax in the price, monthly and yearly leases are KDV exempt,
+// and corporate renters withhold stopaj from the rent of long-term leases.
+func CalculateTaxes(ownerShare float64, commission float64, rentPeriod int, listingType models.ListingType, renterType models.RenterType) []models.PaymentTax {
+	var taxes []models.PaymentTax
+
+	switch {
+	case rentPeriod == models.RentPeriodDay && listingType == models.ListingTypeCommercial:
+		base := RoundPrice(ownerShare / (1 + TAX_KDV_GENERAL_PERCENTAGE/100))
+		taxes = append(taxes, models.PaymentTax{
+			Type:   models.TAX_TYPE_KDV,
+			Rate:   TAX_KDV_GENERAL_PERCENTAGE,
+			Base:   base,
+			Amount: RoundPrice(ownerShare - base),
+		})
+	case rentPeriod == models.RentPeriodDay:
+		base := RoundPrice(ownerShare / (1 + (TAX_KDV_ACCOMMODATION_PERCENTAGE+TAX_ACCOMMODATION_PERCENTAGE)/100))
+		accommodationTax := RoundPrice(base * TAX_ACCOMMODATION_PERCENTAGE / 100)
+		taxes = append(taxes, models.PaymentTax{
+			Type:   models.TAX_TYPE_KDV,
+			Rate:   TAX_KDV_ACCOMMODATION_PERCENTAGE,
+			Base:   base,
+			Amount: RoundPrice(ownerShare - base - accommodationTax),
+		}, models.PaymentTax{
+			Type:   models.TAX_TYPE_ACCOMMODATION,
+			Rate:   TAX_ACCOMMODATION_PERCENTAGE,
+			Base:   base,
+			Amount: accommodationTax,
+		})
+	case renterType == models.RenterTypeCorporate:
+		taxes = append(taxes, models.PaymentTax{
+			Type:     models.TAX_TYPE_STOPAJ,
+			Rate:     TAX_STOPAJ_PERCENTAGE,
+			Base:     ownerShare,
+			Amount:   RoundPrice(ownerShare * TAX_STOPAJ_PERCENTAGE / 100),
+			Withheld: true,
+		})
+	}
+
+	if commission > 0 {
+		base := RoundPrice(commission / (1 + TAX_KDV_GENERAL_PERCENTAGE/100))
+		taxes = append(taxes, models.PaymentTax{
+			Type:   models.TAX_TYPE_COMMISSION_KDV,
+			Rate:   TAX_KDV_GENERAL_PERCENTAGE,
+			Base:   base,
+			Amount: RoundPrice(commission - base),
+		})
+	}
+	return taxes
+}
+
+// GetWithheldTax returns the total of taxes withheld by the renter, not paid to the owner.
+func GetWithheldTax(taxes []models.PaymentTax) float64 {
+	total := 0.0
+	for _, tax := range taxes {
+		if tax.Withheld {
+			total += tax.Amount
+		}
+	}
+	return RoundPrice(total)
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"ekira-backend/app/models"
+	"testing"
+)
+
+func TestRoundPrice(t *testing.T) {
+	tests := []struct {
+		price float64
+		want  float64
+	}{
+		{10.124, 10.12},
+		{10.126, 10.13},
+		{0.125, 0.13},
+		{-0.125, -0.13},
+		{100, 100},
+	}
+	for _, tt := range tests {
+		if got := RoundPrice(tt.price); got != tt.want {
+			t.Errorf("RoundPrice(%v) = %v, want %v", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateTaxes(t *testing.T) {
+	tests := []struct {
+		name        string
+		ownerShare  float64
+		commission  float64
+		rentPeriod  int
+		listingType models.ListingType
+		renterType  models.RenterType
+		want        []models.PaymentTax
+	}{
+		{
+			name:        "daily residential includes KDV and accommodation tax",
+			ownerShare:  1120,
+			rentPeriod:  models.RentPeriodDay,
+			listingType: models.ListingTypeResidential,
+			renterType:  models.RenterTypeIndividual,
+			want: []models.PaymentTax{
+				{Type: models.TAX_TYPE_KDV, Rate: TAX_KDV_ACCOMMODATION_PERCENTAGE, Base: 1000, Amount: 100},
+				{Type: models.TAX_TYPE_ACCOMMODATION, Rate: TAX_ACCOMMODATION_PERCENTAGE, Base: 1000, Amount: 20},
+			},
+		},
+		{
+			name:        "daily commission is taxed separately with general KDV",
+			ownerShare:  1120,
+			commission:  120,
+			rentPeriod:  models.RentPeriodDay,
+			listingType: models.ListingTypeResidential,
+			renterType:  models.RenterTypeIndividual,
+			want: []models.PaymentTax{
+				{Type: models.TAX_TYPE_KDV, Rate: TAX_KDV_ACCOMMODATION_PERCENTAGE, Base: 1000, Amount: 100},
+				{Type: models.TAX_TYPE_ACCOMMODATION, Rate: TAX_ACCOMMODATION_PERCENTAGE, Base: 1000, Amount: 20},
+				{Type: models.TAX_TYPE_COMMISSION_KDV, Rate: TAX_KDV_GENERAL_PERCENTAGE, Base: 100, Amount: 20},
+			},
+		},
+		{
+			name:        "daily commercial includes general KDV",
+			ownerShare:  1200,
+			rentPeriod:  models.RentPeriodDay,
+			listingType: models.ListingTypeCommercial,
+			renterType:  models.RenterTypeCorporate,
+			want: []models.PaymentTax{
+				{Type: models.TAX_TYPE_KDV, Rate: TAX_KDV_GENERAL_PERCENTAGE, Base: 1000, Amount: 200},
+			},
+		},
+		{
+			name:        "monthly corporate withholds stopaj",
+			ownerShare:  10000,
+			rentPeriod:  models.RentPeriodMonth,
+			listingType: models.ListingTypeResidential,
+			renterType:  models.RenterTypeCorporate,
+			want: []models.PaymentTax{
+				{Type: models.TAX_TYPE_STOPAJ, Rate: TAX_STOPAJ_PERCENTAGE, Base: 10000, Amount: 2000, Withheld: true},
+			},
+		},
+		{
+			name:        "monthly individual has no tax",
+			ownerShare:  10000,
+			rentPeriod:  models.RentPeriodMonth,
+			listingType: models.ListingTypeResidential,
+			renterType:  models.RenterTypeIndividual,
+			want:        nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CalculateTaxes(tt.ownerShare, tt.commission, tt.rentPeriod, tt.listingType, tt.renterType)
+			if len(got) != len(tt.want) {
+				t.Fatalf("CalculateTaxes() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("CalculateTaxes()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateTaxesRounding(t *testing.T) {
+	// The tax lines of a daily rent add up to the owner's share and the commission after rounding.
+	for _, ownerShare := range []float64{99.99, 333.33, 1234.56, 7} {
+		commission := RoundPrice(ownerShare / 10)
+		taxes := CalculateTaxes(ownerShare, commission, models.RentPeriodDay, models.ListingTypeResidential, models.RenterTypeIndividual)
+		total := taxes[0].Base + taxes[2].Base
+		for _, tax := range taxes {
+			total += tax.Amount
+		}
+		if RoundPrice(total) != RoundPrice(ownerShare+commission) {
+			t.Errorf("taxes of %v and %v add up to %v", ownerShare, commission, RoundPrice(total))
+		}
+	}
+}
+
+func TestGetWithheldTax(t *testing.T) {
+	taxes := []models.PaymentTax{
+		{Type: models.TAX_TYPE_KDV, Amount: 100},
+		{Type: models.TAX_TYPE_STOPAJ, Amount: 333.333, Withheld: true},
+		{Type: models.TAX_TYPE_STOPAJ, Amount: 0.004, Withheld: true},
+	}
+	if got := GetWithheldTax(taxes); got != 333.34 {
+		t.Errorf("GetWithheldTax() = %v, want 333.34", got)
+	}
+	if got := GetWithheldTax(nil); got != 0 {
+		t.Errorf("GetWithheldTax(nil) = %v, want 0", got)
+	}
+}
@@ -0,0 +1,414 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/gographics/imagick.v3/imagick"
+	"image"
+	_ "image/gif"  // register gif header decoder
+	_ "image/jpeg" // register jpeg header decoder
+	_ "image/png"  // register png header decoder
+	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+)
+
+// ImageUploadLimits are the limits of an image upload endpoint.
+type ImageUploadLimits struct {
+	MaxBytes       int64
+	MaxWidth       uint
+	MaxHeight      uint
+	MaxPixels      uint64 // width x height of a frame
+	MaxFrames      uint
+	MaxTotalPixels uint64 // pixels of all the frames together
+}
+
+// RentalHouseImageLimits returns the limits of the rental house images, IMAGE_UPLOAD_MAX_MB is 8 by default.
+func RentalHouseImageLimits() ImageUploadLimits {
+	return ImageUploadLimits{
+		MaxBytes:       uploadMaxBytes("IMAGE_UPLOAD_MAX_MB", 8),
+		MaxWidth:       10000,
+		MaxHeight:      10000,
+		MaxPixels:      50_000_000,
+		MaxFrames:      50,
+		MaxTotalPixels: 100_000_000,
+	}
+}
+
+// ProfileImageLimits returns the limits of the profile images, PROFILE_IMAGE_UPLOAD_MAX_MB is 5 by default.
+func ProfileImageLimits() ImageUploadLimits {
+	return ImageUploadLimits{
+		MaxBytes:       uploadMaxBytes("PROFILE_IMAGE_UPLOAD_MAX_MB", 5),
+		MaxWidth:       6000,
+		MaxHeight:      6000,
+		MaxPixels:      25_000_000,
+		MaxFrames:      100,
+		MaxTotalPixels: 100_000_000,
+	}
+}
+
+// MessageImageLimits returns the limits of the message attachments, the size is MESSAGE_IMAGE_UPLOAD_MAX_MB (5 MB by default).
+func MessageImageLimits() ImageUploadLimits {
+	return ImageUploadLimits{
+		MaxBytes:       uploadMaxBytes("MESSAGE_IMAGE_UPLOAD_MAX_MB", 5),
+		MaxWidth:       10000,
+		MaxHeight:      10000,
+		MaxPixels:      50_000_000,
+		MaxFrames:      1,
+		MaxTotalPixels: 50_000_000,
+	}
+}
+
+func uploadMaxBytes(env string, defaultMB int64) int64 {
+	mb, err := strconv.ParseInt(os.Getenv(env), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = defaultMB
+	}
+	return mb * 1024 * 1024
+}
+
+// ImageUploadError is the reason of a rejected image upload, it is shown to the user.
+type ImageUploadError struct {
+	Reason string
+}
+
+func (e *ImageUploadError) Error() string {
+	return e.Reason
+}
+
+func uploadError(format string, args ...interface{}) error {
+	return &ImageUploadError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// UploadedImage is an image upload which passed the checks.
+type UploadedImage struct {
+	File          *multipart.FileHeader
+	Format        string // jpeg, png, gif, webp, bmp, heic or avif
+	ContentType   string // content type of the format, the header of the request is not used
+	Width, Height uint
+	Frames        uint
+}
+
+// markupMarkers are searched in the uploads, an image which is also a html or php file is rejected.
+var markupMarkers = [][]byte{
+	[]byte("<script"), []byte("<?php"), []byte("<html"), []byte("<iframe"), []byte("<svg"), []byte("<!doctype html"), []byte("javascript:"),
+}
+
+// ValidateImageUpload returns the single image of the form field if it passes the checks of the limits.
+// The format is detected from the magic bytes and the dimensions are read from the headers without decoding the image.
+// The returned error is an *ImageUploadError for the rejected images.
+func ValidateImageUpload(form *multipart.Form, field string, limits ImageUploadLimits) (*UploadedImage, error) {
+	if form == nil || len(form.File[field]) == 0 {
+		return nil, uploadError("%s is required", field)
+	}
+	if len(form.File[field]) > 1 {
+		return nil, uploadError("only one %s is allowed", field)
+	}
+	fh := form.File[field][0]
+	if fh.Size <= 0 {
+		return nil, uploadError("file is empty")
+	}
+	if fh.Size > limits.MaxBytes {
+		return nil, uploadError("file is larger than %d MB", limits.MaxBytes/1024/1024)
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(file, limits.MaxBytes+1))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, uploadError("file is larger than %d MB", limits.MaxBytes/1024/1024)
+	}
+
+	format := sniffImageFormat(data)
+	if format == "" {
+		return nil, uploadError("unsupported image format, jpeg, png, gif, webp, bmp, heic and avif are allowed")
+	}
+	upload := &UploadedImage{File: fh, Format: format, ContentType: "image/" + format}
+
+	var trailing int
+	switch format {
+	case "jpeg":
+		upload.Width, upload.Height, err = configDimensions(data)
+		if err == nil {
+			trailing, err = jpegTrailing(data)
+		}
+		upload.Frames = 1
+	case "png":
+		upload.Width, upload.Height, err = configDimensions(data)
+		if err == nil {
+			upload.Frames, trailing, err = pngFrames(data)
+		}
+	case "gif":
+		upload.Width, upload.Height, err = configDimensions(data)
+		if err == nil {
+			upload.Frames, trailing, err = gifFrames(data)
+		}
+	case "webp":
+		upload.Width, upload.Height, upload.Frames, err = webpHeader(data)
+	case "bmp":
+		upload.Width, upload.Height, err = bmpDimensions(data)
+		upload.Frames = 1
+	case "heic", "avif":
+		upload.Width, upload.Height, upload.Frames, err = pingDimensions(data)
+	}
+	if err != nil {
+		return nil, uploadError("corrupt %s image: %v", format, err)
+	}
+
+	if upload.Width == 0 || upload.Height == 0 {
+		return nil, uploadError("image has no size")
+	}
+	if upload.Width > limits.MaxWidth || upload.Height > limits.MaxHeight {
+		return nil, uploadError("image is larger than %dx%d pixels", limits.MaxWidth, limits.MaxHeight)
+	}
+	pixels := uint64(upload.Width) * uint64(upload.Height)
+	if pixels > limits.MaxPixels {
+		return nil, uploadError("image has more than %d megapixels", limits.MaxPixels/1_000_000)
+	}
+	if upload.Frames > limits.MaxFrames || pixels*uint64(upload.Frames) > limits.MaxTotalPixels {
+		return nil, uploadError("image has too many frames")
+	}
+	if trailing > 0 {
+		return nil, uploadError("image has %d bytes of unknown data after its end", trailing)
+	}
+	lower := bytes.ToLower(data)
+	for _, marker := range markupMarkers {
+		if bytes.Contains(lower, marker) {
+			return nil, uploadError("image contains embedded markup")
+		}
+	}
+	return upload, nil
+}
+
+// sniffImageFormat returns the image format from the magic bytes, empty if it is not allowed.
+func sniffImageFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "webp"
+	case bytes.HasPrefix(data, []byte("BM")):
+		return "bmp"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		switch string(data[8:12]) {
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return "heic"
+		}
+	}
+	return ""
+}
+
+// configDimensions reads the dimensions from the header of the formats of the standard library.
+func configDimensions(data []byte) (uint, uint, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint(config.Width), uint(config.Height), nil
+}
+
+// jpegTrailing returns the byte count after the EOI marker of the jpeg. The segments and the scans are walked,
+// so the EOI bytes in the metadata are not taken as the end.
+func jpegTrailing(data []byte) (int, error) {
+	offset := 2
+	for {
+		// Fill bytes may come before the marker.
+		for offset+1 < len(data) && data[offset] == 0xFF && data[offset+1] == 0xFF {
+			offset++
+		}
+		if offset+2 > len(data) || data[offset] != 0xFF {
+			return 0, fmt.Errorf("EOI marker is missing")
+		}
+		marker := data[offset+1]
+		offset += 2
+		if marker == 0xD9 { // EOI
+			return len(data) - offset, nil
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) { // markers without segment
+			continue
+		}
+		if offset+2 > len(data) {
+			return 0, fmt.Errorf("segment 0x%02x is truncated", marker)
+		}
+		length := int(binary.BigEndian.Uint16(data[offset : offset+2]))
+		if length < 2 || offset+length > len(data) {
+			return 0, fmt.Errorf("segment 0x%02x is truncated", marker)
+		}
+		offset += length
+		if marker != 0xDA { // SOS
+			continue
+		}
+		// The entropy coded data of the scan ends with a marker which is not a stuffed byte or a restart marker.
+		for {
+			if offset+1 >= len(data) {
+				return 0, fmt.Errorf("scan is truncated")
+			}
+			if data[offset] == 0xFF && data[offset+1] != 0x00 && (data[offset+1] < 0xD0 || data[offset+1] > 0xD7) {
+				break
+			}
+			offset++
+		}
+	}
+}
+
+// pngFrames returns the frame count of the png (apng) and the byte count after the IEND chunk.
+func pngFrames(data []byte) (uint, int, error) {
+	frames := uint(1)
+	offset := 8
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		chunk := string(data[offset+4 : offset+8])
+		end := offset + 12 + length
+		if length < 0 || end > len(data) || end < offset {
+			return 0, 0, fmt.Errorf("chunk %q is truncated", chunk)
+		}
+		if chunk == "acTL" && length >= 4 {
+			frames = uint(binary.BigEndian.Uint32(data[offset+8 : offset+12]))
+		}
+		if chunk == "IEND" {
+			return frames, len(data) - end, nil
+		}
+		offset = end
+	}
+	return 0, 0, fmt.Errorf("IEND chunk is missing")
+}
+
+// gifFrames counts the frames of the gif without decoding them and returns the byte count after the trailer.
+func gifFrames(data []byte) (uint, int, error) {
+	if len(data) < 13 {
+		return 0, 0, fmt.Errorf("header is truncated")
+	}
+	offset := 13
+	if data[10]&0x80 != 0 {
+		offset += 3 << (uint(data[10]&0x07) + 1)
+	}
+	frames := uint(0)
+	skipSubBlocks := func() error {
+		for {
+			if offset >= len(data) {
+				return fmt.Errorf("block is truncated")
+			}
+			size := int(data[offset])
+			offset += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x21: // extension
+			offset += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x2C: // image descriptor
+			if offset+10 > len(data) {
+				return 0, 0, fmt.Errorf("image descriptor is truncated")
+			}
+			packed := data[offset+9]
+			offset += 10
+			if packed&0x80 != 0 {
+				offset += 3 << (uint(packed&0x07) + 1)
+			}
+			offset++ // lzw minimum code size
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, len(data) - offset - 1, nil
+		default:
+			return 0, 0, fmt.Errorf("unknown block 0x%02x", data[offset])
+		}
+	}
+	return 0, 0, fmt.Errorf("trailer is missing")
+}
+
+// webpHeader reads the dimensions and the frame count from the chunks of the webp.
+func webpHeader(data []byte) (uint, uint, uint, error) {
+	if len(data) < 30 {
+		return 0, 0, 0, fmt.Errorf("header is truncated")
+	}
+	chunk := string(data[12:16])
+	switch chunk {
+	case "VP8 ":
+		if !bytes.Equal(data[23:26], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, 0, fmt.Errorf("invalid frame header")
+		}
+		width := uint(binary.LittleEndian.Uint16(data[26:28]) & 0x3FFF)
+		height := uint(binary.LittleEndian.Uint16(data[28:30]) & 0x3FFF)
+		return width, height, 1, nil
+	case "VP8L":
+		if data[20] != 0x2F {
+			return 0, 0, 0, fmt.Errorf("invalid lossless header")
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return uint(bits&0x3FFF) + 1, uint((bits>>14)&0x3FFF) + 1, 1, nil
+	case "VP8X":
+		width := uint(data[24]) | uint(data[25])<<8 | uint(data[26])<<16
+		height := uint(data[27]) | uint(data[28])<<8 | uint(data[29])<<16
+		frames := uint(1)
+		if data[20]&0x02 != 0 {
+			frames = 0
+			offset := 12
+			for offset+8 <= len(data) {
+				size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+				if string(data[offset:offset+4]) == "ANMF" {
+					frames++
+				}
+				next := offset + 8 + size + size%2
+				if size < 0 || next > len(data) || next <= offset {
+					break
+				}
+				offset = next
+			}
+			if frames == 0 {
+				return 0, 0, 0, fmt.Errorf("animation has no frames")
+			}
+		}
+		return width + 1, height + 1, frames, nil
+	}
+	return 0, 0, 0, fmt.Errorf("unknown chunk %q", chunk)
+}
+
+// bmpDimensions reads the dimensions from the info header of the bmp.
+func bmpDimensions(data []byte) (uint, uint, error) {
+	if len(data) < 26 || binary.LittleEndian.Uint32(data[14:18]) < 40 {
+		return 0, 0, fmt.Errorf("unsupported header")
+	}
+	width := int32(binary.LittleEndian.Uint32(data[18:22]))
+	height := int32(binary.LittleEndian.Uint32(data[22:26]))
+	if width < 0 {
+		width = -width
+	}
+	if height < 0 {
+		height = -height
+	}
+	return uint(width), uint(height), nil
+}
+
+// pingDimensions reads the dimensions of the formats which are not in the standard library with ImageMagick, the pixels are not decoded.
+func pingDimensions(data []byte) (uint, uint, uint, error) {
+	InitImageMagick()
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+	if err := mw.PingImageBlob(data); err != nil {
+		return 0, 0, 0, err
+	}
+	return mw.GetImageWidth(), mw.GetImageHeight(), mw.GetNumberImages(), nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestJpegTrailing(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if trailing, err := jpegTrailing(data); err != nil || trailing != 0 {
+		t.Errorf("jpegTrailing() = %d, %v, want 0, nil", trailing, err)
+	}
+	appended := append(append([]byte{}, data...), []byte("PK\x03\x04<html>")...)
+	if trailing, err := jpegTrailing(appended); err != nil || trailing != 10 {
+		t.Errorf("jpegTrailing() of the appended data = %d, %v, want 10, nil", trailing, err)
+	}
+	if _, err := jpegTrailing(data[:len(data)-2]); err == nil {
+		t.Error("jpegTrailing() of the jpeg without EOI, want error")
+	}
+}
+
+func TestWebpHeaderAnimation(t *testing.T) {
+	// VP8X header of a 10x10 animated webp without ANMF chunks.
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8X")
+	data = binary.LittleEndian.AppendUint32(data, 10)
+	data = append(data, 0x02, 0, 0, 0, 9, 0, 0, 9, 0, 0)
+	if _, _, _, err := webpHeader(data); err == nil {
+		t.Error("webpHeader() of the animation without frames, want error")
+	}
+
+	data = append(data, []byte("ANMF")...)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	if _, _, frames, err := webpHeader(data); err != nil || frames != 1 {
+		t.Errorf("webpHeader() = %d frames, %v, want 1, nil", frames, err)
+	}
+}
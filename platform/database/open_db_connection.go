@@ -8,12 +8,23 @@ import (
 // Queries struct for collect all app queries.
 type Queries struct {
 	*gorm.DB
-	*queries.UserQueries        // load queries from User model
-	*queries.AddressQueries     // load queries from Address model
-	*queries.RentalHouseQueries // load queries from RentalHouse model
-	*queries.SessionQueries     // load queries from Session model
-	*queries.ReservationQueries // load queries from Reservation model
-	*queries.PaymentQueries     // load queries from Payment model
+	*queries.UserQueries         // load queries from User model
+	*queries.AddressQueries      // load queries from Address model
+	*queries.RentalHouseQueries  // load queries from RentalHouse model
+	*queries.SessionQueries      // load queries from Session model
+	*queries.ReservationQueries  // load queries from Reservation model
+	*queries.PaymentQueries      // load queries from Payment model
+	*queries.ExchangeRateQueries // load queries from ExchangeRate model
+	*queries.DisputeQueries      // load queries from Dispute model
+	*queries.CouponQueries       // load queries from Coupon model
+	*queries.WalletQueries       // load queries from Wallet models
+	*queries.AmenityQueries      // load queries from Amenity model
+	*queries.ModerationQueries   // load queries from Moderation models
+	*queries.ReviewQueries       // load queries from Review model
+	*queries.MessageQueries      // load queries from Message models
+	*queries.NotificationQueries // load queries from Notification models
+	*queries.DeviceQueries       // load queries from Device model
+	*queries.SavedSearchQueries  // load queries from SavedSearch models
 }
 
 // OpenDBConnection func for opening database connection.
@@ -24,14 +35,37 @@ func OpenDBConnection() (*Queries, error) {
 		return nil, err
 	}
 
+	return newQueries(db), nil
+}
+
+// WithTransaction runs fn with the queries of a transaction, the transaction is rolled back if fn returns an error.
+func (q *Queries) WithTransaction(fn func(tx *Queries) error) error {
+	return q.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(newQueries(tx))
+	})
+}
+
+// newQueries returns the app queries of the database connection or transaction.
+func newQueries(db *gorm.DB) *Queries {
 	return &Queries{
 		DB: db,
 		// Set queries from models:
-		UserQueries:        &queries.UserQueries{DB: db},        // from User model
-		AddressQueries:     &queries.AddressQueries{DB: db},     // from Address model
-		RentalHouseQueries: &queries.RentalHouseQueries{DB: db}, // from RentalHouse model
-		SessionQueries:     &queries.SessionQueries{DB: db},     // from Session model
-		ReservationQueries: &queries.ReservationQueries{DB: db}, // from Reservation model
-		PaymentQueries:     &queries.PaymentQueries{DB: db},     // from Payment model
-	}, nil
+		UserQueries:         &queries.UserQueries{DB: db},         // from User model
+		AddressQueries:      &queries.AddressQueries{DB: db},      // from Address model
+		RentalHouseQueries:  &queries.RentalHouseQueries{DB: db},  // from RentalHouse model
+		SessionQueries:      &queries.SessionQueries{DB: db},      // from Session model
+		ReservationQueries:  &queries.ReservationQueries{DB: db},  // from Reservation model
+		PaymentQueries:      &queries.PaymentQueries{DB: db},      // from Payment model
+		ExchangeRateQueries: &queries.ExchangeRateQueries{DB: db}, // from ExchangeRate model
+		DisputeQueries:      &queries.DisputeQueries{DB: db},      // from Dispute model
+		CouponQueries:       &queries.CouponQueries{DB: db},       // from Coupon model
+		WalletQueries:       &queries.WalletQueries{DB: db},       // from Wallet models
+		AmenityQueries:      &queries.AmenityQueries{DB: db},      // from Amenity model
+		ModerationQueries:   &queries.ModerationQueries{DB: db},   // from Moderation models
+		ReviewQueries:       &queries.ReviewQueries{DB: db},       // from Review model
+		MessageQueries:      &queries.MessageQueries{DB: db},      // from Message models
+		NotificationQueries: &queries.NotificationQueries{DB: db}, // from Notification models
+		DeviceQueries:       &queries.DeviceQueries{DB: db},       // from Device model
+		SavedSearchQueries:  &queries.SavedSearchQueries{DB: db},  // from SavedSearch models
+	}
 }
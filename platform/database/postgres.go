@@ -2,6 +2,7 @@ package database
 
 import (
 	"ekira-backend/app/models"
+	"ekira-backend/app/queries"
 	"errors"
 	"fmt"
 	"gorm.io/driver/postgres"
@@ -60,11 +61,43 @@ func Migrate(db *gorm.DB) error {
 		&models.Session{},
 		&models.Reservation{},
 		&models.Payment{},
+		&models.ExchangeRate{},
+		&models.PaymentTax{},
+		&models.Dispute{},
+		&models.DisputeEvidence{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.UserCredit{},
+		&models.PaymentTender{},
+		&models.Amenity{},
+		&models.ModerationLog{},
+		&models.Review{},
+		&models.Conversation{},
+		&models.Message{},
+		&models.MessageAttachment{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.Device{},
+		&models.SavedSearch{},
+		&models.ListingEvent{},
 	}
+	// The listings before the moderation are approved.
+	approveListings := db.Migrator().HasTable(&models.RentalHouse{}) && !db.Migrator().HasColumn(&models.RentalHouse{}, "moderation_status")
 	// Migrate the schema
 	if err := db.Debug().AutoMigrate(models1...); err != nil {
 		return err
 	}
+	if approveListings {
+		if err := db.Exec("UPDATE rental_houses SET moderation_status = ?", models.MODERATION_STATUS_APPROVED).Error; err != nil {
+			return err
+		}
+	}
+	if err := db.First(&models.Amenity{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		for i, amenity := range models.DefaultAmenities {
+			amenity.DisplayOrder = i + 1
+			db.Create(&amenity)
+		}
+	}
 	if err := db.AutoMigrate(&models.Country{}); err == nil && db.Migrator().HasTable(&models.Country{}) {
 		if err := db.First(&models.Country{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
 			db.Create(&models.Country{ID: 1, Name: "Türkiye", Abbreviation: "TR", Language: "tr", DisplayOrder: 1, SortOrder: 1, PhoneCode: "+90", Alpha2Code: "TR", Alpha3Code: "TUR"})
@@ -107,5 +140,59 @@ func Migrate(db *gorm.DB) error {
 			}
 		}
 	}
+	if err := migrateSearch(db); err != nil {
+		return err
+	}
+	if err := migrateImageHashes(db); err != nil {
+		return err
+	}
+	// A renter has one conversation about a rental house before the reservations.
+	err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_inquiry ON conversations (rental_house_id, renter) WHERE reservation_id IS NULL").Error
+	if err != nil {
+		return err
+	}
+	return migrateLocations(db)
+}
+
+// migrateImageHashes func for create the indexes of the perceptual hash bands, the similar images are searched by the bands.
+func migrateImageHashes(db *gorm.DB) error {
+	for band := 0; band < queries.PerceptualHashBands; band++ {
+		err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_rental_house_images_hash_band_%[1]d ON rental_house_images (%[2]s)",
+			band, queries.PerceptualHashBand("perceptual_hash", band))).Error
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// migrateSearch func for create the text search configuration of the listings and fill the missing search vectors.
+func migrateSearch(db *gorm.DB) error {
+	err := db.Exec("CREATE EXTENSION IF NOT EXISTS unaccent").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec(fmt.Sprintf(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = '%[1]s') THEN
+			CREATE TEXT SEARCH CONFIGURATION %[1]s (COPY = turkish);
+			ALTER TEXT SEARCH CONFIGURATION %[1]s ALTER MAPPING FOR hword, hword_part, word WITH unaccent, turkish_stem;
+		END IF;
+	END $$`, queries.SearchConfiguration)).Error
+	if err != nil {
+		return err
+	}
+	rentalHouseQueries := queries.RentalHouseQueries{DB: db}
+	return rentalHouseQueries.UpdateRentalHouseSearchVectors()
+}
+
+// migrateLocations func for create the extensions of the distance search and fill the missing locations.
+func migrateLocations(db *gorm.DB) error {
+	for _, extension := range []string{"cube", "earthdistance"} {
+		err := db.Exec(fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", extension)).Error
+		if err != nil {
+			return err
+		}
+	}
+	rentalHouseQueries := queries.RentalHouseQueries{DB: db}
+	return rentalHouseQueries.UpdateRentalHouseLocations()
+}
@@ -111,6 +111,54 @@ func (rdb *RedisCon) RSetTTL(key, value string, ttl_second time.Duration) error
 	return errs
 }
 
+// RSetNX sets the key only if it does not exist, returns false if the key is already set.
+func (rdb *RedisCon) RSetNX(key, value string, ttl_second time.Duration) (bool, error) {
+	return rdb.rdb.SetNX(ctx, key, value, ttl_second*time.Second).Result()
+}
+
+// RGetDel returns the value of the key and deletes it, the value is empty if the key does not exist.
+func (rdb *RedisCon) RGetDel(key string) (string, error) {
+	val, err := rdb.rdb.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// RLPush adds the values to the head of the list.
+func (rdb *RedisCon) RLPush(key string, values ...interface{}) error {
+	return rdb.rdb.LPush(ctx, key, values...).Err()
+}
+
+// RBRPopLPush moves the last value of the source list to the destination list, it waits for a value until the timeout.
+// The value is empty if the timeout is reached.
+func (rdb *RedisCon) RBRPopLPush(source, destination string, timeout time.Duration) (string, error) {
+	val, err := rdb.rdb.BRPopLPush(ctx, source, destination, timeout).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// RRPopLPush moves the last value of the source list to the destination list, the value is empty if the source is empty.
+func (rdb *RedisCon) RRPopLPush(source, destination string) (string, error) {
+	val, err := rdb.rdb.RPopLPush(ctx, source, destination).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// RLRem removes the value from the list.
+func (rdb *RedisCon) RLRem(key string, value string) error {
+	return rdb.rdb.LRem(ctx, key, 0, value).Err()
+}
+
+// RLLen returns the length of the list.
+func (rdb *RedisCon) RLLen(key string) (int64, error) {
+	return rdb.rdb.LLen(ctx, key).Result()
+}
+
 type RedisKey struct {
 	Key  string
 	Data string
@@ -135,3 +183,13 @@ func (rdb *RedisCon) RGetAllKeys() ([]RedisKey, error) {
 	}
 	return results, nil
 }
+
+// RPublish sends the message to the subscribers of the channel.
+func (rdb *RedisCon) RPublish(channel string, message interface{}) error {
+	return rdb.rdb.Publish(ctx, channel, message).Err()
+}
+
+// RSubscribe subscribes to the channels, the messages are received from the channel of the returned subscription.
+func (rdb *RedisCon) RSubscribe(channels ...string) *redis.PubSub {
+	return rdb.rdb.Subscribe(ctx, channels...)
+}
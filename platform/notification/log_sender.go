@@ -0,0 +1,44 @@
+package notification
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// logSenderMutex keeps the lines of the concurrent senders apart.
+var logSenderMutex sync.Mutex
+
+// LogSender writes the messages to a file instead of sending them, for the local development.
+type LogSender struct {
+	Channel string
+	Path    string
+}
+
+// NewLogSender returns the log sender of NOTIFICATION_LOG_FILE ("logs/notifications.log" by default).
+func NewLogSender(channel string) *LogSender {
+	path := os.Getenv("NOTIFICATION_LOG_FILE")
+	if path == "" {
+		path = "logs/notifications.log"
+	}
+	return &LogSender{Channel: channel, Path: path}
+}
+
+func (s *LogSender) Send(message Message) error {
+	logSenderMutex.Lock()
+	defer logSenderMutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s [%s] to: %s\nsubject: %s\n%s\n\n", time.Now().Format("02-01-2006 15:04:05"), s.Channel, message.To, message.Subject, message.Body)
+	return err
+}
@@ -0,0 +1,54 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	req2 "github.com/imroc/req/v3"
+	"os"
+	"strings"
+	"time"
+)
+
+// NetgsmSender sends the SMS messages with the Netgsm API.
+// See: https://www.netgsm.com.tr/dokuman/#http-get-sms-g%C3%B6nderme
+type NetgsmSender struct {
+	UserCode string
+	Password string
+	Header   string
+}
+
+// NewNetgsmSender returns the sender of NETGSM_USERCODE, NETGSM_PASSWORD and NETGSM_HEADER (the approved sender name).
+func NewNetgsmSender() (*NetgsmSender, error) {
+	sender := &NetgsmSender{
+		UserCode: os.Getenv("NETGSM_USERCODE"),
+		Password: os.Getenv("NETGSM_PASSWORD"),
+		Header:   os.Getenv("NETGSM_HEADER"),
+	}
+	if sender.UserCode == "" || sender.Password == "" || sender.Header == "" {
+		return nil, errors.New("NETGSM_USERCODE, NETGSM_PASSWORD and NETGSM_HEADER must be set")
+	}
+	return sender, nil
+}
+
+func (s *NetgsmSender) Send(message Message) error {
+	client := req2.C().SetTimeout(30 * time.Second)
+	resp, err := client.R().SetQueryParams(map[string]string{
+		"usercode":  s.UserCode,
+		"password":  s.Password,
+		"gsmno":     strings.TrimPrefix(message.To, "+"),
+		"message":   message.Body,
+		"msgheader": s.Header,
+		"dil":       "TR",
+	}).Get("https://api.netgsm.com.tr/sms/send/get")
+	if err != nil {
+		return err
+	}
+
+	// The successful responses start with 00, 01 or 02 and the job id, the others are the error codes.
+	result := strings.TrimSpace(resp.String())
+	code, _, _ := strings.Cut(result, " ")
+	if resp.StatusCode != 200 || (code != "00" && code != "01" && code != "02") {
+		return fmt.Errorf("netgsm error: %d %s", resp.StatusCode, result)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package notification
+
+import (
+	"errors"
+	"os"
+)
+
+// Message is a rendered notification, To is the e-mail address or the phone number of the user. SMS senders do not use Subject.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers the messages of a channel.
+type Sender interface {
+	// Send delivers the message, the errors are retried by the notification worker.
+	Send(message Message) error
+}
+
+// NewEmailSender returns the e-mail sender of NOTIFICATION_EMAIL_DRIVER, the log sender is the default.
+func NewEmailSender() (Sender, error) {
+	switch os.Getenv("NOTIFICATION_EMAIL_DRIVER") {
+	case "", "log":
+		return NewLogSender("email"), nil
+	case "smtp":
+		return NewSMTPSender()
+	}
+	return nil, errors.New("unknown e-mail driver: " + os.Getenv("NOTIFICATION_EMAIL_DRIVER"))
+}
+
+// NewSMSSender returns the SMS sender of NOTIFICATION_SMS_DRIVER, the log sender is the default.
+func NewSMSSender() (Sender, error) {
+	switch os.Getenv("NOTIFICATION_SMS_DRIVER") {
+	case "", "log":
+		return NewLogSender("sms"), nil
+	case "netgsm":
+		return NewNetgsmSender()
+	}
+	return nil, errors.New("unknown sms driver: " + os.Getenv("NOTIFICATION_SMS_DRIVER"))
+}
@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+)
+
+// SMTPSender sends the e-mails with an SMTP server, the connection is upgraded with STARTTLS if the server supports it.
+type SMTPSender struct {
+	Addr string
+	Auth smtp.Auth
+	From mail.Address
+}
+
+// NewSMTPSender returns the sender of SMTP_HOST, SMTP_PORT (587 by default), SMTP_USER, SMTP_PASS and SMTP_FROM.
+func NewSMTPSender() (*SMTPSender, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, errors.New("SMTP_HOST is not set")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	sender := &SMTPSender{Addr: net.JoinHostPort(host, port), From: *from}
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		sender.Auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASS"), host)
+	}
+	return sender, nil
+}
+
+func (s *SMTPSender) Send(message Message) error {
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", s.From.String())
+	fmt.Fprintf(&body, "To: %s\r\n", to.String())
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	body.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	writer := quotedprintable.NewWriter(&body)
+	if _, err := writer.Write([]byte(message.Body)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.Addr, s.Auth, s.From.Address, []string{to.Address}, body.Bytes())
+}
@@ -0,0 +1,130 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	req2 "github.com/imroc/req/v3"
+	"os"
+	"sync"
+	"time"
+)
+
+// APNsSender sends the push notifications with the Apple Push Notification service, it is authenticated with a token signing key.
+// See: https://developer.apple.com/documentation/usernotifications/sending-notification-requests-to-apns
+type APNsSender struct {
+	KeyID  string
+	TeamID string
+	Topic  string
+	Host   string
+	key    interface{}
+	client *req2.Client
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewAPNsSender returns the sender of the .p8 key of PUSH_APNS_KEY_FILE with PUSH_APNS_KEY_ID, PUSH_APNS_TEAM_ID and
+// PUSH_APNS_TOPIC (the bundle id of the app). The sandbox is used if PUSH_APNS_SANDBOX is true.
+func NewAPNsSender() (*APNsSender, error) {
+	path := os.Getenv("PUSH_APNS_KEY_FILE")
+	sender := &APNsSender{
+		KeyID:  os.Getenv("PUSH_APNS_KEY_ID"),
+		TeamID: os.Getenv("PUSH_APNS_TEAM_ID"),
+		Topic:  os.Getenv("PUSH_APNS_TOPIC"),
+		Host:   "https://api.push.apple.com",
+		client: req2.C().SetTimeout(30 * time.Second).EnableForceHTTP2(),
+	}
+	if path == "" || sender.KeyID == "" || sender.TeamID == "" || sender.Topic == "" {
+		return nil, errors.New("PUSH_APNS_KEY_FILE, PUSH_APNS_KEY_ID, PUSH_APNS_TEAM_ID and PUSH_APNS_TOPIC must be set")
+	}
+	if os.Getenv("PUSH_APNS_SANDBOX") == "true" {
+		sender.Host = "https://api.sandbox.push.apple.com"
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sender.key, err = jwt.ParseECPrivateKeyFromPEM(content)
+	if err != nil {
+		return nil, err
+	}
+	return sender, nil
+}
+
+// getToken returns the provider token, APNs accepts a token for an hour and rejects the renewals more often than 20 minutes.
+func (s *APNsSender) getToken() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": s.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = s.KeyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+
+	s.token = signed
+	s.expiresAt = now.Add(50 * time.Minute)
+	return s.token, nil
+}
+
+func (s *APNsSender) Send(message Message) error {
+	token, err := s.getToken()
+	if err != nil {
+		return err
+	}
+
+	// The data are sent next to the aps dictionary.
+	body := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": message.Title,
+				"body":  message.Body,
+			},
+			"sound": "default",
+		},
+	}
+	for key, value := range message.Data {
+		body[key] = value
+	}
+	resp, err := s.client.R().
+		SetHeaders(map[string]string{
+			"authorization":  "bearer " + token,
+			"apns-topic":     s.Topic,
+			"apns-push-type": "alert",
+		}).
+		SetBodyJsonMarshal(body).
+		Post(s.Host + "/3/device/" + message.Token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 200 {
+		return nil
+	}
+
+	result := struct {
+		Reason string `json:"reason"`
+	}{}
+	_ = resp.Unmarshal(&result)
+	switch {
+	case resp.StatusCode == 410:
+		return ErrInvalidToken
+	case result.Reason == "BadDeviceToken" || result.Reason == "DeviceTokenNotForTopic":
+		return ErrInvalidToken
+	case result.Reason == "ExpiredProviderToken" || result.Reason == "InvalidProviderToken":
+		s.mutex.Lock()
+		s.token = ""
+		s.mutex.Unlock()
+	}
+	return fmt.Errorf("apns error: %d %s", resp.StatusCode, resp.String())
+}
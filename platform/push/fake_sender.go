@@ -0,0 +1,50 @@
+package push
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeSenderMutex keeps the lines of the concurrent senders apart.
+var fakeSenderMutex sync.Mutex
+
+// FakeSender writes the messages to a file instead of sending them, for the local development.
+// The tokens starting with "invalid" are rejected like the uninstalled apps, so the pruning can be tried.
+type FakeSender struct {
+	Platform string
+	Path     string
+}
+
+// NewFakeSender returns the fake sender of PUSH_LOG_FILE ("logs/push.log" by default).
+func NewFakeSender(platform string) *FakeSender {
+	path := os.Getenv("PUSH_LOG_FILE")
+	if path == "" {
+		path = "logs/push.log"
+	}
+	return &FakeSender{Platform: platform, Path: path}
+}
+
+func (s *FakeSender) Send(message Message) error {
+	if strings.HasPrefix(message.Token, "invalid") {
+		return ErrInvalidToken
+	}
+
+	fakeSenderMutex.Lock()
+	defer fakeSenderMutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s [%s] to: %s\ntitle: %s\n%s\ndata: %v\n\n", time.Now().Format("02-01-2006 15:04:05"), s.Platform, message.Token, message.Title, message.Body, message.Data)
+	return err
+}
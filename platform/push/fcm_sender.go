@@ -0,0 +1,173 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	req2 "github.com/imroc/req/v3"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FCMSender sends the push notifications with the Firebase Cloud Messaging HTTP v1 API.
+// See: https://firebase.google.com/docs/cloud-messaging/send-message
+type FCMSender struct {
+	ProjectID   string
+	ClientEmail string
+	TokenURI    string
+	privateKey  interface{}
+
+	mutex       sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMSender returns the sender of the service account file of PUSH_FCM_CREDENTIALS_FILE.
+func NewFCMSender() (*FCMSender, error) {
+	path := os.Getenv("PUSH_FCM_CREDENTIALS_FILE")
+	if path == "" {
+		return nil, errors.New("PUSH_FCM_CREDENTIALS_FILE must be set")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	credentials := struct {
+		ProjectID   string `json:"project_id"`
+		PrivateKey  string `json:"private_key"`
+		ClientEmail string `json:"client_email"`
+		TokenURI    string `json:"token_uri"`
+	}{}
+	if err := json.Unmarshal(content, &credentials); err != nil {
+		return nil, err
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(credentials.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &FCMSender{
+		ProjectID:   credentials.ProjectID,
+		ClientEmail: credentials.ClientEmail,
+		TokenURI:    credentials.TokenURI,
+		privateKey:  privateKey,
+	}, nil
+}
+
+// getAccessToken returns the OAuth token of the service account, it is renewed 5 minutes before it expires.
+func (s *FCMSender) getAccessToken() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/firebase.messaging",
+		"aud":   s.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	result := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	resp, err := req2.C().SetTimeout(30 * time.Second).R().SetFormData(map[string]string{
+		"grant_type": "urn:ietf:params:oauth:grant-type:jwt-bearer",
+		"assertion":  assertion,
+	}).Post(s.TokenURI)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("fcm token error: %d %s", resp.StatusCode, resp.String())
+	}
+	if err := resp.Unmarshal(&result); err != nil || result.AccessToken == "" {
+		return "", fmt.Errorf("fcm token error: %s", resp.String())
+	}
+
+	s.accessToken = result.AccessToken
+	s.expiresAt = now.Add(time.Duration(result.ExpiresIn)*time.Second - 5*time.Minute)
+	return s.accessToken, nil
+}
+
+func (s *FCMSender) Send(message Message) error {
+	accessToken, err := s.getAccessToken()
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": message.Token,
+			"notification": map[string]string{
+				"title": message.Title,
+				"body":  message.Body,
+			},
+			"data": message.Data,
+		},
+	}
+	resp, err := req2.C().SetTimeout(30 * time.Second).R().
+		SetBearerAuthToken(accessToken).
+		SetBodyJsonMarshal(body).
+		Post("https://fcm.googleapis.com/v1/projects/" + s.ProjectID + "/messages:send")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 200 {
+		return nil
+	}
+
+	// The rejected tokens are told with the error code of the details. INVALID_ARGUMENT is also returned for the other
+	// errors of the message, so it means a malformed token only if the message.token field is named.
+	result := struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode       string `json:"errorCode"`
+				FieldViolations []struct {
+					Field string `json:"field"`
+				} `json:"fieldViolations"`
+			} `json:"details"`
+		} `json:"error"`
+	}{}
+	_ = resp.Unmarshal(&result)
+	invalidArgument := result.Error.Status == "INVALID_ARGUMENT"
+	tokenField := strings.Contains(result.Error.Message, "message.token")
+	for _, detail := range result.Error.Details {
+		switch detail.ErrorCode {
+		case "UNREGISTERED", "SENDER_ID_MISMATCH":
+			return ErrInvalidToken
+		case "INVALID_ARGUMENT":
+			invalidArgument = true
+		}
+		for _, violation := range detail.FieldViolations {
+			if violation.Field == "message.token" {
+				tokenField = true
+			}
+		}
+	}
+	if resp.StatusCode == 400 && invalidArgument && tokenField {
+		return ErrInvalidToken
+	}
+	if resp.StatusCode == 401 {
+		// The access token is revoked, a new one is taken on the next attempt.
+		s.mutex.Lock()
+		s.accessToken = ""
+		s.mutex.Unlock()
+	}
+	return fmt.Errorf("fcm error: %d %s", resp.StatusCode, resp.String())
+}
@@ -0,0 +1,48 @@
+package push
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrInvalidToken is returned when the provider tells the device token is not valid anymore, e.g. the app is uninstalled.
+// The token is removed and not used again.
+var ErrInvalidToken = errors.New("push token is not valid")
+
+// Message is a push notification to a device, Data are the values the app uses to open the related screen.
+type Message struct {
+	Token string
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Sender delivers the push notifications of a platform.
+type Sender interface {
+	// Send delivers the message, ErrInvalidToken is returned for the rejected tokens and the other errors are retried.
+	Send(message Message) error
+}
+
+// NewAndroidSender returns the Android sender of PUSH_ANDROID_DRIVER (fake or fcm), the fake sender is the default.
+func NewAndroidSender() (Sender, error) {
+	switch os.Getenv("PUSH_ANDROID_DRIVER") {
+	case "", "fake":
+		return NewFakeSender("android"), nil
+	case "fcm":
+		return NewFCMSender()
+	}
+	return nil, errors.New("unknown android push driver: " + os.Getenv("PUSH_ANDROID_DRIVER"))
+}
+
+// NewIOSSender returns the iOS sender of PUSH_IOS_DRIVER (fake, apns or fcm if the app registers FCM tokens), the fake sender is the default.
+func NewIOSSender() (Sender, error) {
+	switch os.Getenv("PUSH_IOS_DRIVER") {
+	case "", "fake":
+		return NewFakeSender("ios"), nil
+	case "apns":
+		return NewAPNsSender()
+	case "fcm":
+		return NewFCMSender()
+	}
+	return nil, errors.New("unknown ios push driver: " + os.Getenv("PUSH_IOS_DRIVER"))
+}
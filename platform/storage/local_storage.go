@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorage keeps the files in a local directory which is served by the api, e.g. "public".
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+// NewLocalStorage returns the local storage of STORAGE_LOCAL_ROOT ("public" by default), the urls start with STORAGE_PUBLIC_URL or API_URL.
+func NewLocalStorage() *LocalStorage {
+	root := os.Getenv("STORAGE_LOCAL_ROOT")
+	if root == "" {
+		root = "public"
+	}
+	return &LocalStorage{
+		Root:    root,
+		BaseURL: publicURL(os.Getenv("API_URL")),
+	}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+func (s *LocalStorage) Put(key string, body io.Reader, size int64, contentType string) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, the readers never see a half written file.
+	out, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
+
+func (s *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+// SignedURL returns the public url, the local files are served to everyone.
+func (s *LocalStorage) SignedURL(key string, expires time.Duration) (string, error) {
+	return s.URL(key), nil
+}
+
+func (s *LocalStorage) Key(url string) (string, bool) {
+	if !strings.HasPrefix(url, s.BaseURL+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(url, s.BaseURL+"/"), true
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Storage keeps the files in a bucket of an S3 compatible service, e.g. AWS S3 or MinIO.
+// Requests are signed with AWS signature version 4.
+type S3Storage struct {
+	Endpoint  *url.URL
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool   // bucket in the path instead of the host name, needed for MinIO
+	BaseURL   string // public url of the files, the bucket url if STORAGE_PUBLIC_URL is empty
+	Client    *http.Client
+}
+
+// timeNow returns the signing time of the requests, it is fixed in the tests.
+var timeNow = time.Now
+
+// NewS3Storage returns the storage of the STORAGE_S3_* settings.
+func NewS3Storage() (*S3Storage, error) {
+	endpoint, err := url.Parse(os.Getenv("STORAGE_S3_ENDPOINT"))
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.New("STORAGE_S3_ENDPOINT is not a valid url")
+	}
+	s := &S3Storage{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("STORAGE_S3_REGION"),
+		Bucket:    os.Getenv("STORAGE_S3_BUCKET"),
+		AccessKey: os.Getenv("STORAGE_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("STORAGE_S3_SECRET_KEY"),
+		Client:    &http.Client{Timeout: 60 * time.Second},
+	}
+	if s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("STORAGE_S3_BUCKET, STORAGE_S3_ACCESS_KEY and STORAGE_S3_SECRET_KEY are required")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	s.PathStyle, _ = strconv.ParseBool(os.Getenv("STORAGE_S3_PATH_STYLE"))
+	s.BaseURL = publicURL(s.objectURL("").String())
+	return s, nil
+}
+
+// objectURL returns the url of the object in the bucket.
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := *s.Endpoint
+	key = strings.TrimPrefix(key, "/")
+	if s.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	// The path is sent as it is signed, e.g. "+" is encoded too.
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = ""
+	return &u
+}
+
+func (s *S3Storage) Put(key string, body io.Reader, size int64, contentType string) error {
+	// Images are small, the payload is read to sign its hash.
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// The keys are never reused for another content.
+	req.Header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	res, err := s.do(req, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return checkResponse(res)
+}
+
+func (s *S3Storage) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if err := checkResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkResponse(res)
+}
+
+func (s *S3Storage) URL(key string) string {
+	return s.BaseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+// SignedURL returns a presigned url of the bucket, it works for the private buckets too. S3 allows at most 7 days.
+func (s *S3Storage) SignedURL(key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.New("signed url expiry must be between 1 second and 7 days")
+	}
+	now := timeNow().UTC()
+	u := s.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		encodePath(u.Path),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return u.String(), nil
+}
+
+func (s *S3Storage) Key(rawUrl string) (string, bool) {
+	// Signed urls are accepted too.
+	if i := strings.Index(rawUrl, "?"); i >= 0 {
+		rawUrl = rawUrl[:i]
+	}
+	for _, base := range []string{s.BaseURL, s.objectURL("").String()} {
+		base = strings.TrimSuffix(base, "/") + "/"
+		if strings.HasPrefix(rawUrl, base) && len(rawUrl) > len(base) {
+			return strings.TrimPrefix(rawUrl, base), true
+		}
+	}
+	return "", false
+}
+
+// do signs the request with the authorization header and sends it.
+func (s *S3Storage) do(req *http.Request, payload []byte) (*http.Response, error) {
+	now := timeNow().UTC()
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + req.Header.Get("X-Amz-Content-Sha256") + "\n" +
+		"x-amz-date:" + req.Header.Get("X-Amz-Date") + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		encodePath(req.URL.Path),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+	return s.Client.Do(req)
+}
+
+func (s *S3Storage) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) signature(t time.Time, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + s.scope(t) + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// encodePath encodes the path like AWS, everything except the unreserved characters and the slashes.
+func encodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = encodeValue(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func encodeValue(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, encodeValue(key)+"="+encodeValue(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// checkResponse returns the error message of S3 for the unsuccessful responses.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("storage request failed with status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+}
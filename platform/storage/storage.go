@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage keeps the uploaded files, keys are slash separated paths, e.g. "photos/profile/image.jpg".
+type Storage interface {
+	// Put writes the file, an existing file with the key is replaced. size is -1 if it is unknown.
+	Put(key string, body io.Reader, size int64, contentType string) error
+	// Get opens the file for reading.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the file, a missing file is not an error.
+	Delete(key string) error
+	// URL returns the public url of the file.
+	URL(key string) string
+	// SignedURL returns an url of the file which is valid for the given duration.
+	SignedURL(key string, expires time.Duration) (string, error)
+	// Key returns the key of an url returned by URL, false if the url is not of this storage.
+	Key(url string) (string, bool)
+}
+
+// ErrNotFound is returned by Get when the file does not exist.
+var ErrNotFound = errors.New("file not found")
+
+// NewStorage returns the storage of STORAGE_DRIVER, the local file system is the default.
+func NewStorage() (Storage, error) {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "", "local":
+		return NewLocalStorage(), nil
+	case "s3":
+		return NewS3Storage()
+	}
+	return nil, errors.New("unknown storage driver: " + os.Getenv("STORAGE_DRIVER"))
+}
+
+// NewUploadStorage returns the storage of the raw uploads which wait for processing, they must not be public.
+// The local driver keeps them in STORAGE_UPLOAD_ROOT ("uploads" by default) which is not served, S3 keeps them in the same bucket.
+func NewUploadStorage() (Storage, error) {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "", "local":
+		root := os.Getenv("STORAGE_UPLOAD_ROOT")
+		if root == "" {
+			root = "uploads"
+		}
+		return &LocalStorage{Root: root}, nil
+	}
+	return NewStorage()
+}
+
+// PresentURL returns the url to show to the clients, it is signed when STORAGE_SIGNED_URLS is true.
+// Urls of other storages and signing errors return the url as it is.
+func PresentURL(url string) string {
+	if signed, _ := strconv.ParseBool(os.Getenv("STORAGE_SIGNED_URLS")); !signed {
+		return url
+	}
+	store := presentStorage()
+	if store == nil {
+		return url
+	}
+	key, ok := store.Key(url)
+	if !ok {
+		return url
+	}
+	signedUrl, err := store.SignedURL(key, signedURLExpiry())
+	if err != nil {
+		return url
+	}
+	return signedUrl
+}
+
+var (
+	presentOnce  sync.Once
+	presentStore Storage
+)
+
+// presentStorage returns the storage which signs the urls of PresentURL, it is created once. nil if the settings are invalid.
+func presentStorage() Storage {
+	presentOnce.Do(func() {
+		store, err := NewStorage()
+		if err == nil {
+			presentStore = store
+		}
+	})
+	return presentStore
+}
+
+// signedURLExpiry returns STORAGE_SIGNED_URL_MINUTES, 60 minutes by default.
+func signedURLExpiry() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("STORAGE_SIGNED_URL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// publicURL returns STORAGE_PUBLIC_URL without the trailing slash, or the fallback if it is empty.
+func publicURL(fallback string) string {
+	url := os.Getenv("STORAGE_PUBLIC_URL")
+	if url == "" {
+		url = fallback
+	}
+	return strings.TrimSuffix(url, "/")
+}